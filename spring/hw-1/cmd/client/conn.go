@@ -0,0 +1,96 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+	"ws-chat/internal/domain"
+)
+
+const (
+	ackInterval       = time.Second
+	closeWriteTimeout = time.Second
+)
+
+type chatConn struct {
+	*websocket.Conn
+	mu     *sync.Mutex
+	lastID *atomic.Int64
+	done   chan struct{}
+}
+
+func newChatConn(conn *websocket.Conn, lastID *atomic.Int64) chatConn {
+	return chatConn{
+		Conn:   conn,
+		mu:     &sync.Mutex{},
+		lastID: lastID,
+		done:   make(chan struct{}),
+	}
+}
+
+func (c chatConn) send(frame domain.Frame) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.WriteJSON(frame)
+}
+
+func (c chatConn) receive() (domain.Frame, error) {
+	var frame domain.Frame
+	if err := c.ReadJSON(&frame); err != nil {
+		return domain.Frame{}, err
+	}
+	if frame.Type == domain.FrameMessage && frame.ID > c.lastID.Load() {
+		c.lastID.Store(frame.ID)
+	}
+	return frame, nil
+}
+
+func (c chatConn) readLoop(errs chan<- error, handle func(domain.Frame)) {
+	defer close(c.done)
+	for {
+		frame, err := c.receive()
+		if err != nil {
+			errs <- err
+			return
+		}
+		handle(frame)
+	}
+}
+
+// ackLoop periodically tells the server which messages have been shown,
+// instead of acknowledging every single frame.
+func (c chatConn) ackLoop(logger *zap.Logger) {
+	ticker := time.NewTicker(ackInterval)
+	defer ticker.Stop()
+	var acked int64
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+		lastID := c.lastID.Load()
+		if lastID <= acked {
+			continue
+		}
+		if err := c.send(domain.Frame{Type: domain.FrameAck, ID: lastID}); err != nil {
+			logger.Warn("ack: " + err.Error())
+			return
+		}
+		acked = lastID
+	}
+}
+
+func (c chatConn) closeNormally() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_ = c.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+		time.Now().Add(closeWriteTimeout),
+	)
+	_ = c.Close()
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"ws-chat/internal/domain"
+)
+
+const (
+	directCommand = "/dm"
+	verifyCommand = "/verify"
+	verifyConfirm = "confirm"
+)
+
+func (s *session) prepareDirect(args string) (domain.Frame, bool) {
+	to, text, _ := strings.Cut(strings.TrimSpace(args), " ")
+	text = strings.TrimSpace(text)
+	if to == "" || text == "" {
+		fmt.Printf("*** usage: %s <user> <text>\n", directCommand)
+		return domain.Frame{}, false
+	}
+	p, known := s.keys.peer(to)
+	if !known {
+		s.mu.Lock()
+		s.waiting[to] = append(s.waiting[to], text)
+		s.mu.Unlock()
+		fmt.Printf("*** fetching the key of %s, the message will be sent once it arrives\n", to)
+		return domain.Frame{Type: domain.FrameKey, To: to}, true
+	}
+	if p.Changed != nil {
+		fmt.Printf("*** the key of %s has changed, compare it with %s %s first\n", to, verifyCommand, to)
+		return domain.Frame{}, false
+	}
+	frame, err := s.sealDirect(to, p, text)
+	if err != nil {
+		fmt.Printf("*** %s\n", err)
+		return domain.Frame{}, false
+	}
+	return frame, true
+}
+
+func (s *session) sealDirect(to string, p peer, text string) (domain.Frame, error) {
+	nonce, ciphertext, err := s.keys.seal(p, text)
+	if err != nil {
+		return domain.Frame{}, err
+	}
+	fmt.Printf("[dm to %s] %s\n", to, text)
+	return domain.Frame{Type: domain.FrameDirect, To: to, Nonce: nonce, Ciphertext: ciphertext}, nil
+}
+
+// verify prints both fingerprints so the users can compare them over another channel,
+// and with "confirm" marks the peer's key as trusted.
+func (s *session) verify(args []string) (domain.Frame, bool) {
+	if len(args) == 0 || len(args) > 2 || (len(args) == 2 && args[1] != verifyConfirm) {
+		fmt.Printf("*** usage: %s <user> [%s]\n", verifyCommand, verifyConfirm)
+		return domain.Frame{}, false
+	}
+	user := args[0]
+	p, known := s.keys.peer(user)
+	if !known {
+		fmt.Printf("*** fetching the key of %s\n", user)
+		return domain.Frame{Type: domain.FrameKey, To: user}, true
+	}
+	if len(args) == 2 {
+		if err := s.keys.confirm(user); err != nil {
+			fmt.Printf("*** %s\n", err)
+			return domain.Frame{}, false
+		}
+		fmt.Printf("*** the key of %s is verified\n", user)
+		return domain.Frame{}, false
+	}
+	status := "unverified"
+	if p.Verified {
+		status = "verified"
+	}
+	fmt.Printf("*** your fingerprint:  %s\n", fingerprint(s.keys.publicKey()))
+	fmt.Printf("*** %s's fingerprint: %s (%s)\n", user, fingerprint(p.Key), status)
+	if p.Changed != nil {
+		fmt.Printf("*** the server now presents a different key: %s\n", fingerprint(p.Changed))
+	}
+	fmt.Printf("*** if they match what %s sees, run %s %s %s\n", user, verifyCommand, user, verifyConfirm)
+	return domain.Frame{}, false
+}
+
+// receiveKey handles the reply to a key request and sends the messages that were waiting for it.
+func (s *session) receiveKey(chat chatConn, frame domain.Frame) {
+	user := frame.Author
+	known, changed, err := s.keys.remember(user, frame.Key)
+	if err != nil {
+		fmt.Printf("*** %s\n", err)
+		return
+	}
+	s.mu.Lock()
+	waiting := s.waiting[user]
+	delete(s.waiting, user)
+	s.mu.Unlock()
+	if changed {
+		fmt.Printf("*** WARNING: the key of %s has changed, check it with %s %s\n", user, verifyCommand, user)
+		if len(waiting) > 0 {
+			fmt.Printf("*** %d direct messages to %s were not sent\n", len(waiting), user)
+		}
+		return
+	}
+	if !known {
+		s.announceKey(user, frame.Key)
+	}
+	p, _ := s.keys.peer(user)
+	for _, text := range waiting {
+		sealed, err := s.sealDirect(user, p, text)
+		if err == nil {
+			err = chat.send(sealed)
+		}
+		if err != nil {
+			fmt.Printf("*** direct message to %s was not sent: %s\n", user, err)
+			return
+		}
+	}
+}
+
+func (s *session) receiveDirect(frame domain.Frame) {
+	known, changed, err := s.keys.remember(frame.Author, frame.Key)
+	if err != nil {
+		fmt.Printf("*** %s\n", err)
+		return
+	}
+	if !known {
+		s.announceKey(frame.Author, frame.Key)
+	}
+	text, err := s.keys.open(frame.Key, frame.Nonce, frame.Ciphertext)
+	if err != nil {
+		fmt.Printf("*** direct message from %s: %s\n", frame.Author, err)
+		return
+	}
+	mark := ""
+	if p, _ := s.keys.peer(frame.Author); changed {
+		mark = " [key changed!]"
+	} else if !p.Verified {
+		mark = " [unverified]"
+	}
+	fmt.Printf("[dm from %s]%s %s\n", frame.Author, mark, text)
+}
+
+func (s *session) dropWaiting() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for user, texts := range s.waiting {
+		fmt.Printf("*** %d direct messages to %s were not sent\n", len(texts), user)
+		delete(s.waiting, user)
+	}
+}
+
+func (s *session) announceKey(user string, key []byte) {
+	fmt.Printf("*** new key for %s, fingerprint %s; compare it with them using %s %s\n",
+		user, fingerprint(key), verifyCommand, user)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/nacl/box"
+	"ws-chat/internal/domain"
+)
+
+const (
+	identityFile = "identity.json"
+	peersFile    = "peers.json"
+)
+
+type identity struct {
+	Public  []byte `json:"public"`
+	Private []byte `json:"private"`
+}
+
+// peer is what we know about someone else's key. Changed holds a key the server
+// presented that differs from the trusted one until the user confirms it with /verify.
+type peer struct {
+	Key      []byte `json:"key"`
+	Verified bool   `json:"verified"`
+	Changed  []byte `json:"changed,omitempty"`
+}
+
+// keyStore keeps the X25519 key pair and the keys of known peers on disk,
+// so the private key never leaves this machine.
+type keyStore struct {
+	dir     string
+	public  *[32]byte
+	private *[32]byte
+	mu      *sync.Mutex
+	peers   map[string]peer
+}
+
+func keysDir(username string) (string, error) {
+	if dir := os.Getenv("CHAT_KEYS_DIR"); dir != "" {
+		return filepath.Join(dir, username), nil
+	}
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return "", errors.WithMessage(err, "find config dir")
+	}
+	return filepath.Join(config, "ws-chat", username), nil
+}
+
+func loadKeyStore(dir string) (*keyStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, errors.WithMessage(err, "create keys dir")
+	}
+	k := &keyStore{dir: dir, public: new([32]byte), private: new([32]byte), mu: &sync.Mutex{}, peers: make(map[string]peer)}
+	var id identity
+	err := readJSON(filepath.Join(dir, identityFile), &id)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		public, private, err := box.GenerateKey(crand.Reader)
+		if err != nil {
+			return nil, errors.WithMessage(err, "generate key pair")
+		}
+		k.public, k.private = public, private
+		id = identity{Public: public[:], Private: private[:]}
+		if err := writeJSON(filepath.Join(dir, identityFile), id); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	case len(id.Public) != domain.PublicKeySize || len(id.Private) != domain.PublicKeySize:
+		return nil, errors.New("identity file is corrupted")
+	default:
+		copy(k.public[:], id.Public)
+		copy(k.private[:], id.Private)
+	}
+	if err := readJSON(filepath.Join(dir, peersFile), &k.peers); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (k *keyStore) publicKey() []byte {
+	return k.public[:]
+}
+
+func (k *keyStore) peer(user string) (peer, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	p, ok := k.peers[user]
+	return p, ok
+}
+
+// remember trusts the first key seen for a user and flags any later different one.
+func (k *keyStore) remember(user string, key []byte) (known, changed bool, err error) {
+	if len(key) != domain.PublicKeySize {
+		return false, false, errors.Errorf("invalid key for %s", user)
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	p, known := k.peers[user]
+	switch {
+	case !known:
+		p = peer{Key: key}
+	case bytes.Equal(p.Key, key):
+		return true, false, nil
+	case bytes.Equal(p.Changed, key):
+		return true, true, nil
+	default:
+		p.Changed = key
+	}
+	k.peers[user] = p
+	return known, known, k.savePeers()
+}
+
+// confirm marks the user's key as verified, accepting a changed key if there is one.
+func (k *keyStore) confirm(user string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	p, ok := k.peers[user]
+	if !ok {
+		return errors.Errorf("no key for %s yet", user)
+	}
+	if p.Changed != nil {
+		p.Key, p.Changed = p.Changed, nil
+	}
+	p.Verified = true
+	k.peers[user] = p
+	return k.savePeers()
+}
+
+func (k *keyStore) seal(to peer, text string) (nonce, ciphertext []byte, err error) {
+	var n [domain.NonceSize]byte
+	if _, err := crand.Read(n[:]); err != nil {
+		return nil, nil, errors.WithMessage(err, "generate nonce")
+	}
+	var peerKey [32]byte
+	copy(peerKey[:], to.Key)
+	return n[:], box.Seal(nil, []byte(text), &n, &peerKey, k.private), nil
+}
+
+func (k *keyStore) open(senderKey, nonce, ciphertext []byte) (string, error) {
+	if len(senderKey) != domain.PublicKeySize || len(nonce) != domain.NonceSize {
+		return "", errors.New("malformed direct message")
+	}
+	var (
+		n       [domain.NonceSize]byte
+		peerKey [32]byte
+	)
+	copy(n[:], nonce)
+	copy(peerKey[:], senderKey)
+	text, ok := box.Open(nil, ciphertext, &n, &peerKey, k.private)
+	if !ok {
+		return "", errors.New("failed to decrypt direct message")
+	}
+	return string(text), nil
+}
+
+func (k *keyStore) savePeers() error {
+	return writeJSON(filepath.Join(k.dir, peersFile), k.peers)
+}
+
+// fingerprint is a short, readable digest of a public key to compare over another channel.
+func fingerprint(key []byte) string {
+	sum := sha256.Sum256(key)
+	digest := hex.EncodeToString(sum[:16])
+	groups := make([]string, 0, len(digest)/4)
+	for i := 0; i < len(digest); i += 4 {
+		groups = append(groups, digest[i:i+4])
+	}
+	return strings.Join(groups, " ")
+}
+
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.WithMessagef(err, "decode %s", filepath.Base(path))
+	}
+	return nil
+}
+
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return errors.WithMessage(err, "encode keys")
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return errors.WithMessage(err, "write keys")
+	}
+	return nil
+}
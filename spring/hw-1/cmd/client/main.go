@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"net/url"
 	"os"
@@ -9,11 +10,11 @@ import (
 	"strings"
 	"syscall"
 
-	"github.com/gorilla/websocket"
 	"github.com/joho/godotenv"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
+	"ws-chat/internal/domain"
 )
 
 func main() {
@@ -27,56 +28,79 @@ func main() {
 	if err := godotenv.Load(".env"); err != nil {
 		logger.Warn(err.Error())
 	}
-	u := url.URL{Scheme: "ws", Host: os.Getenv("SERVER_ADDR"), Path: "/"}
+	host := os.Getenv("SERVER_ADDR")
+	u := url.URL{Scheme: "ws", Host: host, Path: "/ws"}
+	room := os.Getenv("CHAT_ROOM")
+	if room == "" {
+		room = domain.DefaultRoom
+	}
 	username := ""
 	for username == "" {
 		fmt.Print("enter your name: ")
 		_, _ = fmt.Scan(&username)
 		username = strings.TrimSpace(username)
 	}
+	dir, err := keysDir(username)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+	keys, err := loadKeyStore(dir)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+	fmt.Printf("your key fingerprint: %s\n", fingerprint(keys.publicKey()))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	sigChan := make(chan os.Signal, 2)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	errGroup := new(errgroup.Group)
 	errGroup.Go(func() error {
+		defer cancel()
 		select {
 		case s := <-sigChan:
 			return errors.Errorf("captured signal: %v", s)
+		case <-ctx.Done():
+			return nil
 		}
 	})
-	go func() {
-		logger.Info("connecting to " + u.String())
-		conn, _, err := websocket.DefaultDialer.Dial(u.String(), map[string][]string{
-			"X-User-Name-Key": {username},
-		})
-		if err != nil {
-			logger.Fatal("dial: " + err.Error())
-		}
-		defer func() {
-			_ = conn.Close()
-		}()
-		go readMessages(conn, logger)
-		scanner := bufio.NewScanner(os.Stdin)
-		for scanner.Scan() {
-			msg := scanner.Bytes()
-			fmt.Printf("\033[1A\033[K")
-			err := conn.WriteMessage(websocket.TextMessage, msg)
-			if err != nil {
-				logger.Fatal("write: " + err.Error())
-			}
-		}
-	}()
+	lines := make(chan string)
+	go readLines(lines)
+	fmt.Printf("joining #%s\n", room)
+	errGroup.Go(func() error {
+		defer cancel()
+		return newSession(u, "http://"+host, username, os.Getenv("CHAT_TOKEN"), room, keys, logger).run(ctx, lines)
+	})
 	if err := errGroup.Wait(); err != nil {
 		logger.Info("gracefully stopping: " + err.Error())
 	}
 }
 
-func readMessages(conn *websocket.Conn, logger *zap.Logger) {
-	for {
-		_, message, err := conn.ReadMessage()
-		if err != nil {
-			logger.Warn("read: " + err.Error())
-			return
+func readLines(lines chan<- string) {
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		fmt.Printf("\033[1A\033[K")
+		lines <- scanner.Text()
+	}
+}
+
+func printFrame(frame domain.Frame, baseURL string) {
+	switch frame.Type {
+	case domain.FrameMessage:
+		fmt.Printf("%s: %s\n", frame.Author, frame.Text)
+		for _, at := range frame.Attachments {
+			if at.URL == "" {
+				fmt.Printf("    [attachment %s is unavailable]\n", at.ID)
+				continue
+			}
+			fmt.Printf("    [%s, %s] %s%s\n", at.Name, formatSize(at.Size), baseURL, at.URL)
 		}
-		fmt.Printf("%s\n", message)
+	case domain.FrameNotice:
+		fmt.Printf("*** %s\n", frame.Text)
+	case domain.FrameError:
+		fmt.Printf("error (%s): %s\n", frame.Code, frame.Text)
+	case domain.FrameUnread:
+		fmt.Printf("===== %d unread =====\n", frame.Count)
+	case domain.FrameSeparator:
+		fmt.Println("===== end of unread =====")
 	}
 }
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"ws-chat/internal/domain"
+)
+
+const (
+	usernameKey   = "X-User-Name-Key"
+	roomKey       = "X-Room"
+	lastSeenIDKey = "X-Last-Message-Id"
+	authKey       = "Authorization"
+	originKey     = "Origin"
+)
+
+const (
+	minBackoff = 500 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+type session struct {
+	url      url.URL
+	baseURL  string
+	username string
+	token    string
+	room     string
+	lastID   *atomic.Int64
+	unsent   []domain.Frame
+	keys     *keyStore
+	// waiting holds direct messages to users whose key hasn't arrived yet
+	waiting map[string][]string
+	mu      *sync.Mutex
+	logger  *zap.Logger
+}
+
+func newSession(u url.URL, baseURL, username, token, room string, keys *keyStore, logger *zap.Logger) *session {
+	return &session{
+		url:      u,
+		baseURL:  baseURL,
+		username: username,
+		token:    token,
+		room:     room,
+		lastID:   &atomic.Int64{},
+		keys:     keys,
+		waiting:  make(map[string][]string),
+		mu:       &sync.Mutex{},
+		logger:   logger,
+	}
+}
+
+// run keeps the session connected, reconnecting with exponential backoff
+// and resuming from the last message seen on the previous connection.
+func (s *session) run(ctx context.Context, lines <-chan string) error {
+	backoff := minBackoff
+	for {
+		chat, err := s.dial(ctx)
+		if err == nil {
+			backoff = minBackoff
+			err = s.serve(ctx, chat, lines)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		if websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+			return errors.WithMessage(err, "disconnected by server")
+		}
+		delay := jitter(backoff)
+		s.logger.Warn("connection lost, reconnecting", zap.Error(err), zap.Duration("in", delay))
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+func (s *session) dial(ctx context.Context) (chatConn, error) {
+	// the server refuses handshakes without an origin, so the client presents the server's own
+	header := http.Header{usernameKey: {s.username}, roomKey: {s.room}, originKey: {s.baseURL}}
+	if lastID := s.lastID.Load(); lastID > 0 {
+		header.Set(lastSeenIDKey, strconv.FormatInt(lastID, 10))
+	}
+	if s.token != "" {
+		header.Set(authKey, "Bearer "+s.token)
+	}
+	s.logger.Info("connecting to " + s.url.String())
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, s.url.String(), header)
+	if err != nil {
+		return chatConn{}, errors.WithMessage(err, "dial")
+	}
+	return newChatConn(conn, s.lastID), nil
+}
+
+func (s *session) serve(ctx context.Context, chat chatConn, lines <-chan string) error {
+	errs := make(chan error, 1)
+	go chat.readLoop(errs, func(frame domain.Frame) {
+		s.handleFrame(chat, frame)
+	})
+	go chat.ackLoop(s.logger)
+	// the key is published on every connect, so the server always has the current one
+	if err := chat.send(domain.Frame{Type: domain.FrameKey, Key: s.keys.publicKey()}); err != nil {
+		_ = chat.Close()
+		return errors.WithMessage(err, "publish key")
+	}
+	for len(s.unsent) > 0 {
+		if err := chat.send(s.unsent[0]); err != nil {
+			_ = chat.Close()
+			return errors.WithMessage(err, "write")
+		}
+		s.unsent = s.unsent[1:]
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			chat.closeNormally()
+			return nil
+		case err := <-errs:
+			_ = chat.Close()
+			return errors.WithMessage(err, "read")
+		case line := <-lines:
+			frame, ok := s.prepare(line)
+			if !ok {
+				continue
+			}
+			if err := chat.send(frame); err != nil {
+				fmt.Println("*** not connected, the message will be sent after reconnect")
+				s.unsent = append(s.unsent, frame)
+				_ = chat.Close()
+				return errors.WithMessage(err, "write")
+			}
+		}
+	}
+}
+
+func (s *session) handleFrame(chat chatConn, frame domain.Frame) {
+	switch frame.Type {
+	case domain.FrameKey:
+		s.receiveKey(chat, frame)
+	case domain.FrameDirect:
+		s.receiveDirect(frame)
+	default:
+		if frame.Type == domain.FrameError && frame.Code == domain.CodeNoKey {
+			s.dropWaiting()
+		}
+		printFrame(frame, s.baseURL)
+	}
+}
+
+func (s *session) prepare(line string) (domain.Frame, bool) {
+	if fields := strings.Fields(line); len(fields) > 0 {
+		switch fields[0] {
+		case directCommand:
+			return s.prepareDirect(strings.TrimPrefix(strings.TrimSpace(line), directCommand))
+		case verifyCommand:
+			return s.verify(fields[1:])
+		}
+	}
+	path, ok := strings.CutPrefix(line, uploadCommand+" ")
+	if !ok {
+		return domain.Frame{Type: domain.FrameMessage, Text: line}, true
+	}
+	attachment, err := uploadFile(s.baseURL, s.username, strings.TrimSpace(path))
+	if err != nil {
+		fmt.Printf("*** %s\n", err)
+		return domain.Frame{}, false
+	}
+	return domain.Frame{Type: domain.FrameMessage, Attachments: []domain.FrameAttachment{attachment}}, true
+}
+
+func jitter(d time.Duration) time.Duration {
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
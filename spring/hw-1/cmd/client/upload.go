@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"ws-chat/internal/domain"
+)
+
+const uploadCommand = "/upload"
+
+type uploadResponse struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func uploadFile(baseURL, username, path string) (domain.FrameAttachment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return domain.FrameAttachment{}, errors.WithMessage(err, "open file")
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		part, err := form.CreateFormFile("file", filepath.Base(path))
+		if err == nil {
+			_, err = io.Copy(part, f)
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		_ = writer.CloseWithError(err)
+	}()
+	req, err := http.NewRequest(http.MethodPost, baseURL+"/attachments", body)
+	if err != nil {
+		return domain.FrameAttachment{}, errors.WithMessage(err, "new request")
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set(usernameKey, username)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return domain.FrameAttachment{}, errors.WithMessage(err, "upload")
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return domain.FrameAttachment{}, errors.Errorf("upload: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var uploaded uploadResponse
+	if err := json.NewDecoder(resp.Body).Decode(&uploaded); err != nil {
+		return domain.FrameAttachment{}, errors.WithMessage(err, "decode response")
+	}
+	return domain.FrameAttachment{ID: uploaded.ID, Name: uploaded.Name}, nil
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"ws-chat/internal/domain"
+)
+
+const (
+	usernameKey = "X-User-Name-Key"
+	roomKey     = "X-Room"
+	originKey   = "Origin"
+)
+
+// payloads look like "lg|<run>|<sender>|<seq>|<unix nanos>|xxxx..." so receivers can
+// tell this run's messages apart and measure latency without a shared clock service.
+const (
+	payloadPrefix  = "lg"
+	payloadSep     = "|"
+	minPayloadSize = 64
+)
+
+type loadClient struct {
+	id     int
+	name   string
+	room   string
+	runID  string
+	sender bool
+	size   int
+	conn   *websocket.Conn
+	done   chan struct{}
+
+	sent         atomic.Int64
+	closing      atomic.Bool
+	disconnected atomic.Bool
+	// the fields below are owned by the read loop and read only after done is closed
+	received   int64
+	outOfOrder int64
+	latencies  []time.Duration
+	lastSeq    map[int]int64
+	seen       map[int]map[int64]struct{}
+	errors     map[string]int64
+}
+
+func newLoadClient(id int, runID, room string, sender bool, opts options) *loadClient {
+	return &loadClient{
+		id:      id,
+		name:    fmt.Sprintf("load-%s-%d", runID, id),
+		room:    room,
+		runID:   runID,
+		sender:  sender,
+		size:    opts.size,
+		done:    make(chan struct{}),
+		lastSeq: make(map[int]int64),
+		seen:    make(map[int]map[int64]struct{}),
+		errors:  make(map[string]int64),
+	}
+}
+
+func (c *loadClient) connect(ctx context.Context, addr string) error {
+	u := url.URL{Scheme: "ws", Host: addr, Path: "/ws"}
+	header := http.Header{usernameKey: {c.name}, roomKey: {c.room}, originKey: {"http://" + addr}}
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, u.String(), header)
+	if err != nil {
+		close(c.done)
+		return errors.WithMessage(err, "dial")
+	}
+	c.conn = conn
+	go c.readLoop()
+	return nil
+}
+
+func (c *loadClient) connected() bool {
+	return c.conn != nil
+}
+
+func (c *loadClient) send(ctx context.Context, rate float64) {
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+	defer ticker.Stop()
+	for seq := int64(1); ; seq++ {
+		frame := domain.Frame{Type: domain.FrameMessage, Text: c.payload(seq), Time: time.Now()}
+		if err := c.conn.WriteJSON(frame); err != nil {
+			return
+		}
+		c.sent.Add(1)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *loadClient) payload(seq int64) string {
+	head := strings.Join([]string{
+		payloadPrefix, c.runID, strconv.Itoa(c.id), strconv.FormatInt(seq, 10),
+		strconv.FormatInt(time.Now().UnixNano(), 10), "",
+	}, payloadSep)
+	return head + strings.Repeat("x", max(c.size-len(head), 0))
+}
+
+func (c *loadClient) readLoop() {
+	defer close(c.done)
+	for {
+		var frame domain.Frame
+		if err := c.conn.ReadJSON(&frame); err != nil {
+			if !c.closing.Load() {
+				c.disconnected.Store(true)
+			}
+			return
+		}
+		switch frame.Type {
+		case domain.FrameMessage:
+			c.receive(frame.Text, time.Now())
+		case domain.FrameError:
+			c.errors[frame.Code]++
+		}
+	}
+}
+
+func (c *loadClient) receive(text string, now time.Time) {
+	parts := strings.SplitN(text, payloadSep, 6)
+	if len(parts) < 6 || parts[0] != payloadPrefix || parts[1] != c.runID {
+		return
+	}
+	sender, err1 := strconv.Atoi(parts[2])
+	seq, err2 := strconv.ParseInt(parts[3], 10, 64)
+	sentAt, err3 := strconv.ParseInt(parts[4], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return
+	}
+	c.received++
+	if c.seen[sender] == nil {
+		c.seen[sender] = make(map[int64]struct{})
+	}
+	c.seen[sender][seq] = struct{}{}
+	c.latencies = append(c.latencies, now.Sub(time.Unix(0, sentAt)))
+	if seq < c.lastSeq[sender] {
+		c.outOfOrder++
+	}
+	c.lastSeq[sender] = max(c.lastSeq[sender], seq)
+}
+
+func (c *loadClient) close() {
+	if c.conn == nil {
+		return
+	}
+	c.closing.Store(true)
+	_ = c.conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+		time.Now().Add(time.Second),
+	)
+	select {
+	case <-c.done:
+	case <-time.After(time.Second):
+	}
+	_ = c.conn.Close()
+	<-c.done
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"ws-chat/internal/adapters/diskstore"
+	"ws-chat/internal/adapters/storage"
+	"ws-chat/internal/metrics"
+	"ws-chat/internal/transport/ws"
+	"ws-chat/internal/usecase"
+)
+
+// startEmbedded serves a hub backed by the in-memory repository on a random local port.
+// Rate limits are off so the run measures the hub rather than the limiter.
+func startEmbedded(logger *zap.Logger) (string, func(), error) {
+	ctx := context.Background()
+	serverLogger := logger.WithOptions(zap.IncreaseLevel(zap.WarnLevel))
+	store, err := storage.New(ctx, storage.Config{Driver: storage.DriverMemory}, serverLogger)
+	if err != nil {
+		return "", nil, err
+	}
+	dir, err := os.MkdirTemp("", "loadgen-attachments")
+	if err != nil {
+		return "", nil, errors.WithMessage(err, "create attachment dir")
+	}
+	blobStore, err := diskstore.New(dir)
+	if err != nil {
+		return "", nil, err
+	}
+	filter, err := usecase.NewFilter(usecase.FilterMask, nil, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	attachments := usecase.NewAttachments(store.Attachments, blobStore, store.Moderation, usecase.AttachmentConfig{
+		Secret: []byte("loadgen"),
+	}, serverLogger)
+	webhooks := usecase.NewWebhooks(store.Webhooks, usecase.WebhookConfig{}, serverLogger)
+	hub := usecase.New(
+		store.Messages,
+		store.Moderation,
+		store.Direct,
+		filter,
+		usecase.RateLimitConfig{},
+		attachments,
+		webhooks,
+		metrics.NewChat(prometheus.NewRegistry()),
+		serverLogger,
+	)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, errors.WithMessage(err, "listen")
+	}
+	server := ws.New(listener.Addr().String(), hub, attachments, hub, ws.Config{}, serverLogger)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	stop := func() {
+		_ = server.Shutdown(ctx)
+		_ = hub.Shutdown(ctx)
+		store.Close()
+		_ = os.RemoveAll(dir)
+	}
+	return listener.Addr().String(), stop, nil
+}
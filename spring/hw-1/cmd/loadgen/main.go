@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+type options struct {
+	addr     string
+	clients  int
+	senders  int
+	rooms    int
+	rate     float64
+	size     int
+	duration time.Duration
+	rampUp   time.Duration
+	drain    time.Duration
+	jsonPath string
+	embedded bool
+}
+
+// parseOptions reads the flags from args, which excludes the program name.
+func parseOptions(args []string) (options, error) {
+	var opts options
+	addr := os.Getenv("SERVER_ADDR")
+	if addr == "" {
+		addr = "localhost:8000"
+	}
+	flags := flag.NewFlagSet("loadgen", flag.ContinueOnError)
+	flags.StringVar(&opts.addr, "addr", addr, "chat server address")
+	flags.IntVar(&opts.clients, "clients", 100, "number of websocket clients")
+	flags.IntVar(&opts.senders, "senders", -1, "how many of the clients send messages (default: all)")
+	flags.IntVar(&opts.rooms, "rooms", 1, "spread clients over this many rooms")
+	flags.Float64Var(&opts.rate, "rate", 1, "messages per second per sender")
+	flags.IntVar(&opts.size, "size", 128, "message size in bytes")
+	flags.DurationVar(&opts.duration, "duration", 30*time.Second, "how long to send messages")
+	flags.DurationVar(&opts.rampUp, "ramp-up", 5*time.Second, "spread connecting clients over this period")
+	flags.DurationVar(&opts.drain, "drain", 3*time.Second, "keep reading this long after the last message is sent")
+	flags.StringVar(&opts.jsonPath, "json", "", "also write the report as JSON to this file")
+	flags.BoolVar(&opts.embedded, "embedded", false, "start an in-process server with the in-memory repository")
+	if err := flags.Parse(args); err != nil {
+		return options{}, err
+	}
+	// run divides the ramp-up by the clients and a second by the rate
+	if opts.clients <= 0 {
+		return options{}, errors.Errorf("-clients must be positive, got %d", opts.clients)
+	}
+	if opts.rate <= 0 {
+		return options{}, errors.Errorf("-rate must be positive, got %g", opts.rate)
+	}
+	if opts.senders < 0 || opts.senders > opts.clients {
+		opts.senders = opts.clients
+	}
+	opts.rooms = max(opts.rooms, 1)
+	opts.size = max(opts.size, minPayloadSize)
+	return opts, nil
+}
+
+func main() {
+	logger, err := zap.NewProduction()
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		_ = logger.Sync()
+	}()
+	opts, err := parseOptions(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+	ctx := context.Background()
+	if opts.embedded {
+		addr, stop, err := startEmbedded(logger)
+		if err != nil {
+			logger.Fatal(err.Error())
+		}
+		defer stop()
+		opts.addr = addr
+		logger.Info("embedded server is listening", zap.String("addr", addr))
+	}
+	report := run(ctx, opts, logger)
+	report.print(os.Stdout)
+	if opts.jsonPath != "" {
+		if err := report.writeJSON(opts.jsonPath); err != nil {
+			logger.Fatal(err.Error())
+		}
+	}
+}
+
+// run connects every client, lets the senders talk for the configured duration
+// and collects what each client received.
+func run(ctx context.Context, opts options, logger *zap.Logger) report {
+	runID := strconv.FormatInt(time.Now().UnixNano(), 36)
+	clients := make([]*loadClient, opts.clients)
+	wg := &sync.WaitGroup{}
+	step := opts.rampUp / time.Duration(opts.clients)
+	for i := range clients {
+		room := fmt.Sprintf("load-%d", i%opts.rooms)
+		clients[i] = newLoadClient(i, runID, room, i < opts.senders, opts)
+		wg.Add(1)
+		go func(c *loadClient) {
+			defer wg.Done()
+			if err := c.connect(ctx, opts.addr); err != nil {
+				logger.Warn("connect failed", zap.String("client", c.name), zap.Error(err))
+			}
+		}(clients[i])
+		time.Sleep(step)
+	}
+	wg.Wait()
+	logger.Info("clients connected, sending", zap.Duration("duration", opts.duration))
+
+	sendCtx, stopSending := context.WithTimeout(ctx, opts.duration)
+	defer stopSending()
+	start := time.Now()
+	senders := &sync.WaitGroup{}
+	for _, c := range clients {
+		if !c.sender || !c.connected() {
+			continue
+		}
+		senders.Add(1)
+		go func(c *loadClient) {
+			defer senders.Done()
+			// random offsets keep senders from firing in lockstep
+			time.Sleep(time.Duration(rand.Int63n(int64(time.Second / time.Duration(max(opts.rate, 1))))))
+			c.send(sendCtx, opts.rate)
+		}(c)
+	}
+	senders.Wait()
+	elapsed := time.Since(start)
+	time.Sleep(opts.drain)
+	for _, c := range clients {
+		c.close()
+	}
+	return buildReport(opts, clients, elapsed)
+}
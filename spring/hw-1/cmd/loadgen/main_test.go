@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOptions(t *testing.T) {
+	opts, err := parseOptions([]string{"-clients", "10", "-senders", "20", "-rate", "0.5", "-rooms", "0", "-size", "1"})
+	require.NoError(t, err)
+	require.Equal(t, 10, opts.clients)
+	require.Equal(t, 10, opts.senders, "there can't be more senders than clients")
+	require.Equal(t, 0.5, opts.rate)
+	require.Equal(t, 1, opts.rooms)
+	require.Equal(t, minPayloadSize, opts.size, "the payload must fit the sequence header")
+}
+
+func TestParseOptionsRejects(t *testing.T) {
+	for name, args := range map[string][]string{
+		"zero clients":     {"-clients", "0"},
+		"negative clients": {"-clients", "-5"},
+		"zero rate":        {"-rate", "0"},
+		"negative rate":    {"-rate", "-1"},
+		"unknown flag":     {"-bogus"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseOptions(args)
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"ws-chat/internal/domain"
+)
+
+type latencyReport struct {
+	MinMs  float64 `json:"min_ms"`
+	MeanMs float64 `json:"mean_ms"`
+	P50Ms  float64 `json:"p50_ms"`
+	P90Ms  float64 `json:"p90_ms"`
+	P99Ms  float64 `json:"p99_ms"`
+	P999Ms float64 `json:"p999_ms"`
+	MaxMs  float64 `json:"max_ms"`
+}
+
+type report struct {
+	Addr         string           `json:"addr"`
+	Clients      int              `json:"clients"`
+	Connected    int              `json:"connected"`
+	Disconnected int              `json:"disconnected"`
+	Senders      int              `json:"senders"`
+	Rooms        int              `json:"rooms"`
+	Rate         float64          `json:"rate_per_sender"`
+	Size         int              `json:"message_size"`
+	DurationSec  float64          `json:"duration_sec"`
+	Sent         int64            `json:"sent"`
+	Rejected     int64            `json:"rejected"`
+	Accepted     int64            `json:"accepted"`
+	Expected     int64            `json:"expected_deliveries"`
+	Received     int64            `json:"received"`
+	Lost         int64            `json:"lost"`
+	LossRatio    float64          `json:"loss_ratio"`
+	OutOfOrder   int64            `json:"out_of_order"`
+	SendRate     float64          `json:"send_rate"`
+	DeliveryRate float64          `json:"delivery_rate"`
+	Latency      latencyReport    `json:"latency"`
+	Errors       map[string]int64 `json:"errors"`
+}
+
+// rejectCodes are the errors a sender gets back instead of its message being broadcast.
+// The hub also uses some of them for one-off notices (e.g. "you were muted"), so the
+// rejected count is only an estimate and a message counts as accepted once anyone received it.
+var rejectCodes = []string{
+	domain.CodeRateLimited,
+	domain.CodeMuted,
+	domain.CodeRejected,
+	domain.CodeBanned,
+	domain.CodeShuttingDown,
+	domain.CodeTooLarge,
+}
+
+func buildReport(opts options, clients []*loadClient, elapsed time.Duration) report {
+	r := report{
+		Addr:        opts.addr,
+		Clients:     opts.clients,
+		Senders:     opts.senders,
+		Rooms:       opts.rooms,
+		Rate:        opts.rate,
+		Size:        opts.size,
+		DurationSec: elapsed.Seconds(),
+		Errors:      make(map[string]int64),
+	}
+	accepted := make(map[string]int64)
+	members := make(map[string]int64)
+	delivered := make(map[int]map[int64]struct{})
+	latencies := make([]time.Duration, 0)
+	for _, c := range clients {
+		for sender, seqs := range c.seen {
+			if delivered[sender] == nil {
+				delivered[sender] = make(map[int64]struct{})
+			}
+			for seq := range seqs {
+				delivered[sender][seq] = struct{}{}
+			}
+		}
+	}
+	for _, c := range clients {
+		if !c.connected() {
+			continue
+		}
+		r.Connected++
+		members[c.room]++
+		if c.disconnected.Load() {
+			r.Disconnected++
+		}
+		sent := c.sent.Load()
+		rejected := int64(0)
+		for code, n := range c.errors {
+			r.Errors[code] += n
+			if slices.Contains(rejectCodes, code) {
+				rejected += n
+			}
+		}
+		r.Sent += sent
+		r.Rejected += rejected
+		accepted[c.room] += max(sent-rejected, int64(len(delivered[c.id])))
+		r.Received += c.received
+		r.OutOfOrder += c.outOfOrder
+		latencies = append(latencies, c.latencies...)
+	}
+	for room, n := range accepted {
+		r.Accepted += n
+		r.Expected += n * members[room]
+	}
+	r.Lost = max(r.Expected-r.Received, 0)
+	if r.Expected > 0 {
+		r.LossRatio = float64(r.Lost) / float64(r.Expected)
+	}
+	if elapsed > 0 {
+		r.SendRate = float64(r.Sent) / elapsed.Seconds()
+		r.DeliveryRate = float64(r.Received) / elapsed.Seconds()
+	}
+	r.Latency = summarize(latencies)
+	return r
+}
+
+func summarize(latencies []time.Duration) latencyReport {
+	if len(latencies) == 0 {
+		return latencyReport{}
+	}
+	slices.Sort(latencies)
+	var total time.Duration
+	for _, l := range latencies {
+		total += l
+	}
+	return latencyReport{
+		MinMs:  millis(latencies[0]),
+		MeanMs: millis(total / time.Duration(len(latencies))),
+		P50Ms:  millis(percentile(latencies, 0.5)),
+		P90Ms:  millis(percentile(latencies, 0.9)),
+		P99Ms:  millis(percentile(latencies, 0.99)),
+		P999Ms: millis(percentile(latencies, 0.999)),
+		MaxMs:  millis(latencies[len(latencies)-1]),
+	}
+}
+
+// percentile expects sorted input and uses the nearest-rank method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(p*float64(len(sorted))+0.5) - 1
+	return sorted[min(max(rank, 0), len(sorted)-1)]
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func (r report) print(out io.Writer) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(w, "server\t%s\n", r.Addr)
+	_, _ = fmt.Fprintf(w, "clients\t%d connected of %d, %d dropped\n", r.Connected, r.Clients, r.Disconnected)
+	_, _ = fmt.Fprintf(w, "load\t%d senders x %.1f msg/s, %d bytes, %d rooms\n", r.Senders, r.Rate, r.Size, r.Rooms)
+	_, _ = fmt.Fprintf(w, "duration\t%.1fs\n", r.DurationSec)
+	_, _ = fmt.Fprintf(w, "sent\t%d (%.1f msg/s), %d accepted, ~%d rejected\n", r.Sent, r.SendRate, r.Accepted, r.Rejected)
+	_, _ = fmt.Fprintf(w, "received\t%d of %d expected (%.1f msg/s)\n", r.Received, r.Expected, r.DeliveryRate)
+	_, _ = fmt.Fprintf(w, "lost\t%d (%.3f%%), %d out of order\n", r.Lost, r.LossRatio*100, r.OutOfOrder)
+	l := r.Latency
+	_, _ = fmt.Fprintf(w, "latency ms\tmin %.2f  mean %.2f  p50 %.2f  p90 %.2f  p99 %.2f  p99.9 %.2f  max %.2f\n",
+		l.MinMs, l.MeanMs, l.P50Ms, l.P90Ms, l.P99Ms, l.P999Ms, l.MaxMs)
+	for code, n := range r.Errors {
+		_, _ = fmt.Fprintf(w, "error %s\t%d\n", code, n)
+	}
+	_ = w.Flush()
+}
+
+func (r report) writeJSON(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return errors.WithMessage(err, "marshal report")
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return errors.WithMessage(err, "write report")
+	}
+	return nil
+}
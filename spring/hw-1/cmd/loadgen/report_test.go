@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPercentile(t *testing.T) {
+	sorted := make([]time.Duration, 100)
+	for i := range sorted {
+		sorted[i] = time.Duration(i+1) * time.Millisecond
+	}
+	for _, tc := range []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, time.Millisecond},
+		{0.01, time.Millisecond},
+		{0.5, 50 * time.Millisecond},
+		{0.9, 90 * time.Millisecond},
+		{0.99, 99 * time.Millisecond},
+		{0.999, 100 * time.Millisecond},
+		{1, 100 * time.Millisecond},
+	} {
+		require.Equal(t, tc.want, percentile(sorted, tc.p), "p%g", tc.p*100)
+	}
+
+	single := []time.Duration{7 * time.Millisecond}
+	require.Equal(t, 7*time.Millisecond, percentile(single, 0.5))
+	require.Equal(t, 7*time.Millisecond, percentile(single, 0.999))
+}
+
+func TestSummarize(t *testing.T) {
+	require.Equal(t, latencyReport{}, summarize(nil))
+
+	latencies := []time.Duration{
+		4 * time.Millisecond,
+		1 * time.Millisecond,
+		3 * time.Millisecond,
+		2 * time.Millisecond,
+	}
+	report := summarize(latencies)
+	require.Equal(t, latencyReport{
+		MinMs:  1,
+		MeanMs: 2.5,
+		P50Ms:  2,
+		P90Ms:  4,
+		P99Ms:  4,
+		P999Ms: 4,
+		MaxMs:  4,
+	}, report)
+}
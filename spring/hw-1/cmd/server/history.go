@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"ws-chat/internal/adapters/diskstore"
+	"ws-chat/internal/adapters/storage"
+	"ws-chat/internal/config"
+	"ws-chat/internal/domain"
+	"ws-chat/internal/usecase"
+)
+
+const (
+	exportCommand = "export"
+	forgetCommand = "forget"
+)
+
+const exportUsage = `usage: server export [flags]
+
+writes the history of a room to JSON Lines or CSV; safe to run while the chat is live
+
+flags:
+`
+
+const forgetUsage = `usage: server forget [-mode anonymize|delete] <user>
+
+anonymizes or deletes the user's messages and removes their read markers,
+keys, direct messages and attachments
+
+flags:
+`
+
+// runHistory serves the export and forget admin commands against the configured storage.
+func runHistory(ctx context.Context, command string, args []string, cfg *config.Config, logger *zap.Logger) error {
+	if storage.Driver(cfg.StorageDriver) == storage.DriverMemory {
+		return errors.Errorf("%s needs a persistent storage driver", command)
+	}
+	store, err := storage.New(ctx, storage.Config{
+		Driver:         storage.Driver(cfg.StorageDriver),
+		SQLitePath:     cfg.SQLitePath,
+		MigrateOnStart: cfg.MigrateOnStart,
+	}, logger)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	blobs, err := diskstore.New(cfg.Attachments.Dir)
+	if err != nil {
+		return err
+	}
+	retention := usecase.NewRetention(store.Retention, store.Messages, blobs, retentionConfig(cfg), logger)
+	if command == exportCommand {
+		return runExport(ctx, retention, args)
+	}
+	return runForget(ctx, retention, args, usecase.ForgetMode(cfg.Retention.ForgetMode))
+}
+
+type exporter interface {
+	Export(ctx context.Context, w io.Writer, room string, from, to time.Time, format usecase.ExportFormat) (int, error)
+}
+
+func runExport(ctx context.Context, retention exporter, args []string) error {
+	flags := flag.NewFlagSet(exportCommand, flag.ContinueOnError)
+	room := flags.String("room", domain.DefaultRoom, "room to export")
+	from := flags.String("from", "", "start of the range, RFC 3339 or YYYY-MM-DD (default: the beginning)")
+	to := flags.String("to", "", "end of the range, exclusive (default: now)")
+	format := flags.String("format", string(usecase.ExportJSONLines), "jsonl or csv")
+	out := flags.String("out", "", "output file (default: stdout)")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), exportUsage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	start, err := parseTime(*from, time.Unix(0, 0))
+	if err != nil {
+		return err
+	}
+	end, err := parseTime(*to, time.Now())
+	if err != nil {
+		return err
+	}
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return errors.WithMessage(err, "create output file")
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+		w = file
+	}
+	n, err := retention.Export(ctx, w, *room, start, end, usecase.ExportFormat(*format))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "exported %d messages from #%s\n", n, *room)
+	return nil
+}
+
+type forgetter interface {
+	ForgetUser(ctx context.Context, user string, mode usecase.ForgetMode) (int, error)
+}
+
+func runForget(ctx context.Context, retention forgetter, args []string, defaultMode usecase.ForgetMode) error {
+	flags := flag.NewFlagSet(forgetCommand, flag.ContinueOnError)
+	mode := flags.String("mode", string(defaultMode), "anonymize or delete the user's messages")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), forgetUsage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("expected exactly one user")
+	}
+	user := flags.Arg(0)
+	n, err := retention.ForgetUser(ctx, user, usecase.ForgetMode(*mode))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%s: %d messages of '%s' processed, other data removed\n", *mode, n, user)
+	return nil
+}
+
+func parseTime(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.Errorf("invalid time '%s'", value)
+}
+
+func retentionConfig(cfg *config.Config) usecase.RetentionConfig {
+	return usecase.RetentionConfig{
+		MaxAge:             cfg.Retention.MaxAge,
+		MaxMessagesPerRoom: cfg.Retention.MaxMessagesPerRoom,
+		Interval:           cfg.Retention.Interval,
+		BatchSize:          cfg.Retention.BatchSize,
+	}
+}
@@ -8,10 +8,16 @@ import (
 
 	"github.com/joho/godotenv"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
-	"ws-chat/internal/adapters"
-	"ws-chat/internal/adapters/pgrepo"
+	"ws-chat/internal/adapters/diskstore"
+	"ws-chat/internal/adapters/storage"
+	"ws-chat/internal/config"
+	"ws-chat/internal/domain"
+	"ws-chat/internal/metrics"
 	"ws-chat/internal/transport/ws"
 	"ws-chat/internal/usecase"
 )
@@ -28,13 +34,43 @@ func main() {
 		logger.Warn(err.Error())
 	}
 	ctx := context.Background()
-	connPool, err := pgrepo.NewConnectionPool(ctx)
+	if len(os.Args) > 1 && os.Args[1] == migrateCommand {
+		if err := runMigrate(ctx, os.Args[2:], logger); err != nil {
+			logger.Fatal(err.Error())
+		}
+		return
+	}
+	cfg, err := config.New()
 	if err != nil {
 		logger.Fatal(err.Error())
 	}
+	if len(os.Args) > 1 && (os.Args[1] == exportCommand || os.Args[1] == forgetCommand) {
+		if err := runHistory(ctx, os.Args[1], os.Args[2:], cfg, logger); err != nil {
+			logger.Fatal(err.Error())
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == tokenCommand {
+		if err := runToken(os.Args[2:], cfg); err != nil {
+			logger.Fatal(err.Error())
+		}
+		return
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	store, err := storage.New(ctx, storage.Config{
+		Driver:         storage.Driver(cfg.StorageDriver),
+		SQLitePath:     cfg.SQLitePath,
+		MigrateOnStart: cfg.MigrateOnStart,
+		QueryTracer:    metrics.NewQueryTracer(registry),
+	}, logger)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+	logger.Info("storage is ready", zap.String("driver", cfg.StorageDriver))
 	defer func() {
 		logger.Info("closing db connections...")
-		connPool.Close()
+		store.Close()
 	}()
 	sigChan := make(chan os.Signal, 2)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -45,11 +81,86 @@ func main() {
 			return errors.Errorf("captured signal: %v", s)
 		}
 	})
+	filter, err := usecase.NewFilter(
+		usecase.FilterAction(cfg.Filter.Action),
+		cfg.Filter.Words,
+		cfg.Filter.Patterns,
+	)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+	modRepo := store.Moderation
+	for _, admin := range cfg.AdminUsers {
+		if admin == "" {
+			continue
+		}
+		if err := modRepo.SetRole(ctx, admin, domain.RoleAdmin); err != nil {
+			logger.Fatal(err.Error())
+		}
+	}
+	limits := usecase.RateLimitConfig{
+		MessagesPerSecond: cfg.Limits.MessagesPerSecond,
+		Burst:             cfg.Limits.Burst,
+		MaxViolations:     cfg.Limits.MaxViolations,
+		ViolationWindow:   cfg.Limits.ViolationWindow,
+		MuteDuration:      cfg.Limits.MuteDuration,
+	}
+	blobStore, err := diskstore.New(cfg.Attachments.Dir)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+	attachments := usecase.NewAttachments(
+		store.Attachments,
+		blobStore,
+		modRepo,
+		usecase.AttachmentConfig{
+			MaxSize:      cfg.Attachments.MaxSize,
+			AllowedTypes: cfg.Attachments.AllowedTypes,
+			Secret:       []byte(cfg.Attachments.Secret),
+			LinkTTL:      cfg.Attachments.LinkTTL,
+		},
+		logger,
+	)
+	webhooks := usecase.NewWebhooks(store.Webhooks, usecase.WebhookConfig{
+		MaxAttempts:  cfg.Webhooks.MaxAttempts,
+		MinBackoff:   cfg.Webhooks.MinBackoff,
+		MaxBackoff:   cfg.Webhooks.MaxBackoff,
+		PollInterval: cfg.Webhooks.PollInterval,
+		Timeout:      cfg.Webhooks.Timeout,
+		BatchSize:    cfg.Webhooks.BatchSize,
+	}, logger)
 	var (
-		msgRepo = adapters.NewMessageRepo(connPool)
-		hub     = usecase.New(msgRepo, logger)
-		server  = ws.New(os.Getenv("SERVER_ADDR"), hub, logger)
+		hub = usecase.New(
+			store.Messages,
+			modRepo,
+			store.Direct,
+			filter,
+			limits,
+			attachments,
+			webhooks,
+			metrics.NewChat(registry),
+			logger,
+		)
+		server = ws.New(cfg.ServerAddr, hub, attachments, hub, ws.Config{
+			ReadLimit:         cfg.Limits.MaxMessageSize,
+			MaxAttachmentSize: cfg.Attachments.MaxSize,
+			AllowedOrigins:    cfg.AllowedOrigins,
+			Auth:              usecase.NewAuth([]byte(cfg.AuthSecret)),
+			MetricsHandler:    promhttp.HandlerFor(registry, promhttp.HandlerOpts{}),
+		}, logger)
 	)
+	retention := usecase.NewRetention(store.Retention, store.Messages, blobStore, retentionConfig(cfg), logger)
+	workerCtx, stopWorkers := context.WithCancel(ctx)
+	workers := new(errgroup.Group)
+	workers.Go(func() error {
+		return webhooks.Run(workerCtx)
+	})
+	workers.Go(func() error {
+		return retention.Run(workerCtx)
+	})
+	workers.Go(func() error {
+		return hub.Run(workerCtx)
+	})
 	go func() {
 		logger.Info("http server is starting...", zap.String("addr", server.Addr))
 		if err := server.ListenAndServe(); err != nil {
@@ -59,7 +170,16 @@ func main() {
 	if err := errGroup.Wait(); err != nil {
 		logger.Info("gracefully shutting down the server: " + err.Error())
 	}
-	if err := server.Shutdown(ctx); err != nil {
+	shutdownCtx, cancel := context.WithTimeout(ctx, cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
 		logger.Info("failed to shutdown http server: " + err.Error())
 	}
+	if err := hub.Shutdown(shutdownCtx); err != nil {
+		logger.Info("failed to drain chat hub: " + err.Error())
+	}
+	stopWorkers()
+	if err := workers.Wait(); err != nil {
+		logger.Info("background worker stopped with error: " + err.Error())
+	}
 }
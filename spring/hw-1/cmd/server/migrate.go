@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"ws-chat/internal/adapters/pgrepo"
+	"ws-chat/internal/migrate"
+)
+
+const migrateCommand = "migrate"
+
+const migrateUsage = `usage: server migrate [-dir path -table name] <command>
+
+commands:
+  up        apply all pending migrations
+  down N    revert the last N migrations
+  status    print the current version and pending migrations
+  force V   set the version to V without running migrations
+
+flags:
+`
+
+func runMigrate(ctx context.Context, args []string, logger *zap.Logger) error {
+	flags := flag.NewFlagSet(migrateCommand, flag.ContinueOnError)
+	dir := flags.String("dir", "", "read migrations from this directory instead of the embedded ones")
+	table := flags.String("table", "", "keep the version of -dir migrations in this table")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), migrateUsage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		return errors.New("no migrate command")
+	}
+	source, versionTable := pgrepo.Migrations(), migrate.DefaultTable
+	switch {
+	case *dir == "" && *table != "":
+		return errors.New("-table is only used with -dir")
+	case *dir != "" && (*table == "" || *table == migrate.DefaultTable):
+		// sharing the version with the chat schema would skip or revert the wrong migrations
+		return errors.Errorf("-dir needs a -table of its own, not '%s'", migrate.DefaultTable)
+	case *dir != "":
+		source, versionTable = os.DirFS(*dir), *table
+	}
+	pool, err := pgrepo.NewConnectionPool(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+	migrator, err := migrate.New(pool, source, versionTable, logger)
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "up":
+		return migrator.Up(ctx)
+	case "down":
+		steps, err := intArg(args, 1)
+		if err != nil {
+			return err
+		}
+		return migrator.Down(ctx, int(steps))
+	case "force":
+		version, err := intArg(args, 0)
+		if err != nil {
+			return err
+		}
+		return migrator.Force(ctx, version)
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		printStatus(status)
+		return nil
+	default:
+		flags.Usage()
+		return errors.Errorf("unknown migrate command '%s'", args[0])
+	}
+}
+
+func intArg(args []string, minValue uint64) (uint64, error) {
+	if len(args) != 2 {
+		return 0, errors.Errorf("usage: migrate %s <number>", args[0])
+	}
+	n, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil || n < minValue {
+		return 0, errors.Errorf("invalid number '%s'", args[1])
+	}
+	return n, nil
+}
+
+func printStatus(status migrate.Status) {
+	fmt.Printf("version: %d\n", status.Version)
+	for _, m := range status.Applied {
+		fmt.Printf("  applied  %06d_%s\n", m.Version, m.Name)
+	}
+	for _, m := range status.Pending {
+		fmt.Printf("  pending  %06d_%s\n", m.Version, m.Name)
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"ws-chat/internal/config"
+	"ws-chat/internal/usecase"
+)
+
+const tokenCommand = "token"
+
+const tokenUsage = "usage: server token <user>"
+
+// runToken prints the token a user passes as CHAT_TOKEN, so the chat grants them their role.
+func runToken(args []string, cfg *config.Config) error {
+	if len(args) != 1 || args[0] == "" {
+		return errors.New(tokenUsage)
+	}
+	if cfg.AuthSecret == "" {
+		return errors.New("AUTH_SECRET is not set")
+	}
+	fmt.Println(usecase.NewAuth([]byte(cfg.AuthSecret)).Token(args[0]))
+	return nil
+}
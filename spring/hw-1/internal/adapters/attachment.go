@@ -0,0 +1,54 @@
+package adapters
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+	"ws-chat/internal/domain"
+)
+
+type attachmentRepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewAttachmentRepo(pool *pgxpool.Pool) attachmentRepo {
+	return attachmentRepo{
+		pool: pool,
+	}
+}
+
+const (
+	saveAttachmentQuery = `insert into attachments (id, owner, name, mime, size, created_at)
+		values ($1, $2, $3, $4, $5, $6)`
+	getAttachmentsQuery = `select id, owner, name, mime, size, created_at from attachments
+		where id = any($1)`
+)
+
+func (a attachmentRepo) SaveAttachment(ctx context.Context, attachment domain.Attachment) error {
+	_, err := a.pool.Exec(
+		ctx, saveAttachmentQuery,
+		attachment.ID, attachment.Owner, attachment.Name, attachment.MIME, attachment.Size, attachment.Time,
+	)
+	if err != nil {
+		return errors.WithMessage(err, "insert attachment")
+	}
+	return nil
+}
+
+func (a attachmentRepo) GetAttachments(ctx context.Context, ids []string) ([]domain.Attachment, error) {
+	attachments := make([]domain.Attachment, 0, len(ids))
+	rows, err := a.pool.Query(ctx, getAttachmentsQuery, ids)
+	if err != nil {
+		return nil, errors.WithMessage(err, "select attachments")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var at domain.Attachment
+		if err := rows.Scan(&at.ID, &at.Owner, &at.Name, &at.MIME, &at.Size, &at.Time); err != nil {
+			return nil, errors.WithMessage(err, "scan rows")
+		}
+		attachments = append(attachments, at)
+	}
+	return attachments, rows.Err()
+}
@@ -0,0 +1,93 @@
+package adapters
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+	"ws-chat/internal/domain"
+)
+
+type directRepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewDirectRepo(pool *pgxpool.Pool) directRepo {
+	return directRepo{
+		pool: pool,
+	}
+}
+
+const (
+	setPublicKeyQuery = `insert into public_keys (username, key, updated_at) values ($1, $2, $3)
+		on conflict (username) do update set key = excluded.key, updated_at = excluded.updated_at`
+	getPublicKeyQuery      = `select username, key, updated_at from public_keys where username = $1`
+	saveDirectMessageQuery = `insert into direct_messages (sender, recipient, sender_key, nonce, ciphertext, created_at)
+		values ($1, $2, $3, $4, $5, $6) returning id`
+	getPendingDirectQuery = `select id, sender, recipient, sender_key, nonce, ciphertext, created_at
+		from direct_messages where recipient = $1 and delivered_at is null order by id limit $2`
+	markDirectDeliveredQuery = `update direct_messages set delivered_at = $2
+		where id = any($1) and delivered_at is null`
+)
+
+func (d directRepo) SetPublicKey(ctx context.Context, key domain.PublicKey) error {
+	if _, err := d.pool.Exec(ctx, setPublicKeyQuery, key.User, key.Key, key.Time); err != nil {
+		return errors.WithMessage(err, "upsert public key")
+	}
+	return nil
+}
+
+func (d directRepo) GetPublicKey(ctx context.Context, user string) (domain.PublicKey, error) {
+	var key domain.PublicKey
+	err := d.pool.QueryRow(ctx, getPublicKeyQuery, user).Scan(&key.User, &key.Key, &key.Time)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.PublicKey{}, domain.ErrNotFound
+	}
+	if err != nil {
+		return domain.PublicKey{}, errors.WithMessage(err, "select public key")
+	}
+	return key, nil
+}
+
+func (d directRepo) SaveDirectMessage(ctx context.Context, msg domain.DirectMessage) (int64, error) {
+	var id int64
+	err := d.pool.QueryRow(
+		ctx, saveDirectMessageQuery,
+		msg.From, msg.To, msg.SenderKey, msg.Nonce, msg.Ciphertext, msg.Time,
+	).Scan(&id)
+	if err != nil {
+		return 0, errors.WithMessage(err, "insert direct message")
+	}
+	return id, nil
+}
+
+func (d directRepo) GetPendingDirectMessages(
+	ctx context.Context,
+	user string,
+	limit int,
+) ([]domain.DirectMessage, error) {
+	rows, err := d.pool.Query(ctx, getPendingDirectQuery, user, limit)
+	if err != nil {
+		return nil, errors.WithMessage(err, "select direct messages")
+	}
+	defer rows.Close()
+	messages := make([]domain.DirectMessage, 0)
+	for rows.Next() {
+		var msg domain.DirectMessage
+		err := rows.Scan(&msg.ID, &msg.From, &msg.To, &msg.SenderKey, &msg.Nonce, &msg.Ciphertext, &msg.Time)
+		if err != nil {
+			return nil, errors.WithMessage(err, "scan rows")
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+func (d directRepo) MarkDirectDelivered(ctx context.Context, ids []int64) error {
+	if _, err := d.pool.Exec(ctx, markDirectDeliveredQuery, ids, time.Now()); err != nil {
+		return errors.WithMessage(err, "mark direct messages delivered")
+	}
+	return nil
+}
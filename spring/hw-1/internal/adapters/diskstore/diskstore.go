@@ -0,0 +1,80 @@
+package diskstore
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"ws-chat/internal/domain"
+)
+
+type store struct {
+	dir string
+}
+
+func New(dir string) (store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return store{}, errors.WithMessage(err, "create storage dir")
+	}
+	return store{dir: dir}, nil
+}
+
+func (s store) Put(_ context.Context, key string, r io.Reader) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return errors.WithMessage(err, "create temp file")
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err := io.Copy(tmp, r); err != nil {
+		_ = tmp.Close()
+		return errors.WithMessage(err, "write file")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.WithMessage(err, "close file")
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return errors.WithMessage(err, "rename file")
+	}
+	return nil
+}
+
+func (s store) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.WithMessage(err, "open file")
+	}
+	return f, nil
+}
+
+func (s store) Delete(_ context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.WithMessage(err, "remove file")
+	}
+	return nil
+}
+
+func (s store) path(key string) (string, error) {
+	if key == "" || key != filepath.Base(key) || key[0] == '.' {
+		return "", errors.Errorf("invalid key '%s'", key)
+	}
+	return filepath.Join(s.dir, key), nil
+}
@@ -0,0 +1,81 @@
+package memrepo
+
+import (
+	"context"
+	"slices"
+
+	"ws-chat/internal/domain"
+)
+
+type directStore struct {
+	keys      map[string]domain.PublicKey
+	messages  []domain.DirectMessage
+	lastID    int64
+	delivered map[int64]bool
+}
+
+func newDirectStore() *directStore {
+	return &directStore{
+		keys:      make(map[string]domain.PublicKey),
+		delivered: make(map[int64]bool),
+	}
+}
+
+func (r repo) SetPublicKey(_ context.Context, key domain.PublicKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key.Key = slices.Clone(key.Key)
+	r.direct.keys[key.User] = key
+	return nil
+}
+
+func (r repo) GetPublicKey(_ context.Context, user string) (domain.PublicKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	key, ok := r.direct.keys[user]
+	if !ok {
+		return domain.PublicKey{}, domain.ErrNotFound
+	}
+	key.Key = slices.Clone(key.Key)
+	return key, nil
+}
+
+func (r repo) SaveDirectMessage(_ context.Context, msg domain.DirectMessage) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.direct.lastID++
+	msg.ID = r.direct.lastID
+	r.direct.messages = append(r.direct.messages, cloneDirect(msg))
+	return msg.ID, nil
+}
+
+func (r repo) GetPendingDirectMessages(_ context.Context, user string, limit int) ([]domain.DirectMessage, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	messages := make([]domain.DirectMessage, 0)
+	for _, msg := range r.direct.messages {
+		if len(messages) == limit {
+			break
+		}
+		if msg.To == user && !r.direct.delivered[msg.ID] {
+			messages = append(messages, cloneDirect(msg))
+		}
+	}
+	return messages, nil
+}
+
+func (r repo) MarkDirectDelivered(_ context.Context, ids []int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range ids {
+		r.direct.delivered[id] = true
+	}
+	return nil
+}
+
+func cloneDirect(msg domain.DirectMessage) domain.DirectMessage {
+	msg.SenderKey = slices.Clone(msg.SenderKey)
+	msg.Nonce = slices.Clone(msg.Nonce)
+	msg.Ciphertext = slices.Clone(msg.Ciphertext)
+	return msg
+}
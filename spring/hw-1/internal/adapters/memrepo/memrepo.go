@@ -0,0 +1,237 @@
+package memrepo
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"ws-chat/internal/domain"
+)
+
+const recentMessageCount = 10
+
+type repo struct {
+	mu          *sync.RWMutex
+	lastID      *int64
+	messages    *[]domain.Message
+	readMarkers map[readMarker]int64
+	roles       map[string]domain.Role
+	sanctions   *[]domain.Sanction
+	audit       *[]domain.AuditEntry
+	attachments map[string]domain.Attachment
+	webhooks    *webhookStore
+	direct      *directStore
+}
+
+type readMarker struct {
+	user string
+	room string
+}
+
+func New() repo {
+	return repo{
+		mu:          &sync.RWMutex{},
+		lastID:      new(int64),
+		messages:    &[]domain.Message{},
+		readMarkers: make(map[readMarker]int64),
+		roles:       make(map[string]domain.Role),
+		sanctions:   &[]domain.Sanction{},
+		audit:       &[]domain.AuditEntry{},
+		attachments: make(map[string]domain.Attachment),
+		webhooks:    newWebhookStore(),
+		direct:      newDirectStore(),
+	}
+}
+
+func (r repo) SaveMessage(_ context.Context, message domain.Message) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	*r.lastID++
+	message.ID = *r.lastID
+	message.Attachments = slices.Clone(message.Attachments)
+	*r.messages = append(*r.messages, message)
+	return message.ID, nil
+}
+
+func (r repo) GetRecentMessages(_ context.Context, room string) ([]domain.Message, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.collectBefore(room, *r.lastID+1, recentMessageCount), nil
+}
+
+func (r repo) GetMessagesAfter(
+	_ context.Context,
+	room string,
+	afterID int64,
+	limit int,
+) ([]domain.Message, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	messages := make([]domain.Message, 0)
+	for _, msg := range (*r.messages)[r.indexAfter(afterID):] {
+		if len(messages) == limit {
+			break
+		}
+		if msg.Room == room {
+			messages = append(messages, msg)
+		}
+	}
+	return cloneMessages(messages), nil
+}
+
+func (r repo) GetMessagesBefore(
+	_ context.Context,
+	room string,
+	beforeID int64,
+	limit int,
+) ([]domain.Message, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.collectBefore(room, beforeID, limit), nil
+}
+
+func (r repo) CountMessagesAfter(_ context.Context, room string, afterID int64) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	count := 0
+	for _, msg := range (*r.messages)[r.indexAfter(afterID):] {
+		if msg.Room == room {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r repo) ListRooms(_ context.Context) ([]domain.Room, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	byName := make(map[string]*domain.Room)
+	rooms := make([]domain.Room, 0)
+	for _, msg := range *r.messages {
+		room, ok := byName[msg.Room]
+		if !ok {
+			rooms = append(rooms, domain.Room{Name: msg.Room})
+			room = &rooms[len(rooms)-1]
+			byName[msg.Room] = room
+		}
+		room.Messages++
+		if msg.Time.After(room.LastActivity) {
+			room.LastActivity = msg.Time
+		}
+	}
+	slices.SortFunc(rooms, func(a, b domain.Room) int {
+		return b.LastActivity.Compare(a.LastActivity)
+	})
+	return rooms, nil
+}
+
+// collectBefore returns up to limit messages of the room with ids below beforeID, oldest first.
+func (r repo) collectBefore(room string, beforeID int64, limit int) []domain.Message {
+	messages := make([]domain.Message, 0)
+	for i := r.indexAfter(beforeID-1) - 1; i >= 0 && len(messages) < limit; i-- {
+		if msg := (*r.messages)[i]; msg.Room == room {
+			messages = append(messages, msg)
+		}
+	}
+	slices.Reverse(messages)
+	return cloneMessages(messages)
+}
+
+func (r repo) indexAfter(afterID int64) int {
+	i, _ := slices.BinarySearchFunc(*r.messages, afterID+1, func(msg domain.Message, id int64) int {
+		return cmp.Compare(msg.ID, id)
+	})
+	return i
+}
+
+func (r repo) GetLastRead(_ context.Context, user, room string) (int64, bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	id, ok := r.readMarkers[readMarker{user: user, room: room}]
+	return id, ok, nil
+}
+
+func (r repo) SetLastRead(_ context.Context, user, room string, messageID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := readMarker{user: user, room: room}
+	if current, ok := r.readMarkers[key]; !ok || messageID > current {
+		r.readMarkers[key] = messageID
+	}
+	return nil
+}
+
+func (r repo) GetRole(_ context.Context, user string) (domain.Role, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if role, ok := r.roles[user]; ok {
+		return role, nil
+	}
+	return domain.RoleMember, nil
+}
+
+func (r repo) SetRole(_ context.Context, user string, role domain.Role) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.roles[user] = role
+	return nil
+}
+
+func (r repo) AddSanction(_ context.Context, sanction domain.Sanction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	*r.sanctions = append(*r.sanctions, sanction)
+	return nil
+}
+
+func (r repo) GetActiveSanctions(_ context.Context, user string, at time.Time) ([]domain.Sanction, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	active := make([]domain.Sanction, 0)
+	for _, s := range *r.sanctions {
+		if s.User == user && s.Until.After(at) {
+			active = append(active, s)
+		}
+	}
+	slices.SortFunc(active, func(a, b domain.Sanction) int {
+		return b.Until.Compare(a.Until)
+	})
+	return active, nil
+}
+
+func (r repo) SaveAuditEntry(_ context.Context, entry domain.AuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	*r.audit = append(*r.audit, entry)
+	return nil
+}
+
+func (r repo) SaveAttachment(_ context.Context, attachment domain.Attachment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attachments[attachment.ID] = attachment
+	return nil
+}
+
+func (r repo) GetAttachments(_ context.Context, ids []string) ([]domain.Attachment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	attachments := make([]domain.Attachment, 0, len(ids))
+	for _, id := range ids {
+		if at, ok := r.attachments[id]; ok {
+			attachments = append(attachments, at)
+		}
+	}
+	return attachments, nil
+}
+
+func cloneMessages(messages []domain.Message) []domain.Message {
+	cloned := make([]domain.Message, 0, len(messages))
+	for _, msg := range messages {
+		msg.Attachments = slices.Clone(msg.Attachments)
+		cloned = append(cloned, msg)
+	}
+	return cloned
+}
@@ -0,0 +1,14 @@
+package memrepo_test
+
+import (
+	"testing"
+
+	"ws-chat/internal/adapters/memrepo"
+	"ws-chat/internal/adapters/repotest"
+)
+
+func TestRepo(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repotest.Repo {
+		return memrepo.New()
+	})
+}
@@ -0,0 +1,167 @@
+package memrepo
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"ws-chat/internal/domain"
+)
+
+func (r repo) DeleteMessagesBefore(_ context.Context, before time.Time, limit int) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.deleteMessages(limit, func(msg domain.Message) bool {
+		return msg.Time.Before(before)
+	}), nil
+}
+
+func (r repo) DeleteExcessMessages(_ context.Context, room string, keep, limit int) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	excess := -keep
+	for _, msg := range *r.messages {
+		if msg.Room == room {
+			excess++
+		}
+	}
+	return r.deleteMessages(min(excess, limit), func(msg domain.Message) bool {
+		return msg.Room == room
+	}), nil
+}
+
+func (r repo) ExportMessages(
+	_ context.Context,
+	room string,
+	from, to time.Time,
+	afterID int64,
+	limit int,
+) ([]domain.Message, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	messages := make([]domain.Message, 0)
+	for _, msg := range (*r.messages)[r.indexAfter(afterID):] {
+		if len(messages) == limit {
+			break
+		}
+		if msg.Room == room && !msg.Time.Before(from) && msg.Time.Before(to) {
+			messages = append(messages, msg)
+		}
+	}
+	return cloneMessages(messages), nil
+}
+
+func (r repo) AnonymizeMessages(_ context.Context, author, alias string, limit int) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for i := range *r.messages {
+		if n == limit {
+			break
+		}
+		if msg := &(*r.messages)[i]; msg.Author == author {
+			msg.Author = alias
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r repo) DeleteUserMessages(_ context.Context, author string, limit int) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.deleteMessages(limit, func(msg domain.Message) bool {
+		return msg.Author == author
+	}), nil
+}
+
+func (r repo) DeleteUserData(_ context.Context, user, alias string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for marker := range r.readMarkers {
+		if marker.user == user {
+			delete(r.readMarkers, marker)
+		}
+	}
+	delete(r.roles, user)
+	*r.sanctions = slices.DeleteFunc(*r.sanctions, func(s domain.Sanction) bool {
+		return s.User == user
+	})
+	for i := range *r.sanctions {
+		if s := &(*r.sanctions)[i]; s.IssuedBy == user {
+			s.IssuedBy = alias
+		}
+	}
+	for i := range *r.audit {
+		entry := &(*r.audit)[i]
+		if entry.Actor == user {
+			entry.Actor = alias
+		}
+		if entry.Target == user {
+			entry.Target = alias
+		}
+	}
+	for id, s := range r.webhooks.subscriptions {
+		if s.CreatedBy == user {
+			s.CreatedBy = alias
+			r.webhooks.subscriptions[id] = s
+		}
+	}
+	for name, bot := range r.webhooks.bots {
+		if bot.CreatedBy == user {
+			bot.CreatedBy = alias
+			r.webhooks.bots[name] = bot
+		}
+	}
+	delete(r.direct.keys, user)
+	r.direct.messages = slices.DeleteFunc(r.direct.messages, func(msg domain.DirectMessage) bool {
+		return msg.From == user || msg.To == user
+	})
+	ids := make([]string, 0)
+	for id, at := range r.attachments {
+		if at.Owner == user {
+			ids = append(ids, id)
+			delete(r.attachments, id)
+		}
+	}
+	return ids, nil
+}
+
+func (r repo) DeleteOrphanAttachments(_ context.Context, before time.Time, limit int) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	referenced := make(map[string]bool)
+	for _, msg := range *r.messages {
+		for _, id := range msg.Attachments {
+			referenced[id] = true
+		}
+	}
+	orphans := make([]domain.Attachment, 0)
+	for id, at := range r.attachments {
+		if !referenced[id] && at.Time.Before(before) {
+			orphans = append(orphans, at)
+		}
+	}
+	slices.SortFunc(orphans, func(a, b domain.Attachment) int {
+		return a.Time.Compare(b.Time)
+	})
+	ids := make([]string, 0, min(len(orphans), limit))
+	for _, at := range orphans[:min(len(orphans), limit)] {
+		ids = append(ids, at.ID)
+		delete(r.attachments, at.ID)
+	}
+	return ids, nil
+}
+
+// deleteMessages removes up to limit of the oldest messages that match.
+func (r repo) deleteMessages(limit int, match func(domain.Message) bool) int {
+	n := 0
+	*r.messages = slices.DeleteFunc(*r.messages, func(msg domain.Message) bool {
+		if n < limit && match(msg) {
+			n++
+			return true
+		}
+		return false
+	})
+	return n
+}
@@ -0,0 +1,185 @@
+package memrepo
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"ws-chat/internal/domain"
+)
+
+type webhookStore struct {
+	subscriptions  map[string]domain.Subscription
+	deliveries     map[int64]*outboxEntry
+	lastDeliveryID int64
+	bots           map[string]domain.Bot
+}
+
+type outboxEntry struct {
+	domain.Delivery
+	failed bool
+}
+
+func newWebhookStore() *webhookStore {
+	return &webhookStore{
+		subscriptions: make(map[string]domain.Subscription),
+		deliveries:    make(map[int64]*outboxEntry),
+		bots:          make(map[string]domain.Bot),
+	}
+}
+
+func (r repo) SaveSubscription(_ context.Context, subscription domain.Subscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	subscription.Events = slices.Clone(subscription.Events)
+	r.webhooks.subscriptions[subscription.ID] = subscription
+	return nil
+}
+
+func (r repo) DeleteSubscription(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.webhooks.subscriptions[id]; !ok {
+		return domain.ErrNotFound
+	}
+	delete(r.webhooks.subscriptions, id)
+	for deliveryID, entry := range r.webhooks.deliveries {
+		if entry.SubscriptionID == id {
+			delete(r.webhooks.deliveries, deliveryID)
+		}
+	}
+	return nil
+}
+
+func (r repo) ListSubscriptions(_ context.Context, room string) ([]domain.Subscription, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	subscriptions := make([]domain.Subscription, 0)
+	for _, s := range r.webhooks.subscriptions {
+		if s.Room == room {
+			s.Events = slices.Clone(s.Events)
+			subscriptions = append(subscriptions, s)
+		}
+	}
+	slices.SortFunc(subscriptions, func(a, b domain.Subscription) int {
+		return a.Time.Compare(b.Time)
+	})
+	return subscriptions, nil
+}
+
+func (r repo) EnqueueDeliveries(_ context.Context, deliveries []domain.Delivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range deliveries {
+		r.webhooks.lastDeliveryID++
+		d.ID = r.webhooks.lastDeliveryID
+		d.Payload = slices.Clone(d.Payload)
+		r.webhooks.deliveries[d.ID] = &outboxEntry{Delivery: d}
+	}
+	return nil
+}
+
+func (r repo) ClaimDeliveries(_ context.Context, now, leaseUntil time.Time, limit int) ([]domain.Delivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	due := make([]*outboxEntry, 0)
+	for _, entry := range r.webhooks.deliveries {
+		if !entry.failed && !entry.NextAttempt.After(now) {
+			due = append(due, entry)
+		}
+	}
+	slices.SortFunc(due, func(a, b *outboxEntry) int {
+		return a.NextAttempt.Compare(b.NextAttempt)
+	})
+	deliveries := make([]domain.Delivery, 0, min(len(due), limit))
+	for _, entry := range due[:min(len(due), limit)] {
+		subscription := r.webhooks.subscriptions[entry.SubscriptionID]
+		d := entry.Delivery
+		d.URL, d.Secret = subscription.URL, subscription.Secret
+		d.Payload = slices.Clone(d.Payload)
+		deliveries = append(deliveries, d)
+		entry.NextAttempt = leaseUntil
+	}
+	return deliveries, nil
+}
+
+func (r repo) CompleteDelivery(_ context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.webhooks.deliveries, id)
+	return nil
+}
+
+func (r repo) RetryDelivery(_ context.Context, id int64, next time.Time, lastErr string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if entry, ok := r.webhooks.deliveries[id]; ok {
+		entry.Attempts++
+		entry.NextAttempt = next
+		entry.LastError = lastErr
+	}
+	return nil
+}
+
+func (r repo) FailDelivery(_ context.Context, id int64, lastErr string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if entry, ok := r.webhooks.deliveries[id]; ok {
+		entry.Attempts++
+		entry.LastError = lastErr
+		entry.failed = true
+	}
+	return nil
+}
+
+func (r repo) SaveBot(_ context.Context, bot domain.Bot) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.webhooks.bots[bot.Name] = bot
+	return nil
+}
+
+func (r repo) DeleteBot(_ context.Context, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.webhooks.bots[name]; !ok {
+		return domain.ErrNotFound
+	}
+	delete(r.webhooks.bots, name)
+	return nil
+}
+
+func (r repo) GetBot(_ context.Context, name string) (domain.Bot, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	bot, ok := r.webhooks.bots[name]
+	if !ok {
+		return domain.Bot{}, domain.ErrNotFound
+	}
+	return bot, nil
+}
+
+func (r repo) GetBotByToken(_ context.Context, token string) (domain.Bot, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, bot := range r.webhooks.bots {
+		if bot.Token == token {
+			return bot, nil
+		}
+	}
+	return domain.Bot{}, domain.ErrNotFound
+}
+
+func (r repo) ListBots(_ context.Context) ([]domain.Bot, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	bots := make([]domain.Bot, 0, len(r.webhooks.bots))
+	for _, bot := range r.webhooks.bots {
+		bots = append(bots, bot)
+	}
+	slices.SortFunc(bots, func(a, b domain.Bot) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return bots, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"slices"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/pkg/errors"
 	"ws-chat/internal/domain"
@@ -20,33 +21,130 @@ func NewMessageRepo(pool *pgxpool.Pool) messageRepo {
 }
 
 const (
-	saveMessageQuery = `insert into messages (author, text, send_time) values ($1, $2, $3)`
-	getMessagesQuery = `select author, text, send_time from messages order by send_time desc limit $1`
+	saveMessageQuery = `insert into messages (room, author, text, send_time, attachments)
+		values ($1, $2, $3, $4, $5) returning id`
+	getMessagesQuery = `select id, room, author, text, send_time, attachments from messages
+		where room = $1 order by id desc limit $2`
+	getMessagesAfterQuery = `select id, room, author, text, send_time, attachments from messages
+		where room = $1 and id > $2 order by id limit $3`
+	getMessagesBeforeQuery = `select id, room, author, text, send_time, attachments from messages
+		where room = $1 and id < $2 order by id desc limit $3`
+	countMessagesAfterQuery = `select count(*) from messages where room = $1 and id > $2`
+	listRoomsQuery          = `select room, count(*), max(send_time) from messages
+		group by room order by max(send_time) desc`
+	getLastReadQuery = `select last_read_id from read_markers where username = $1 and room = $2`
+	setLastReadQuery = `insert into read_markers (username, room, last_read_id) values ($1, $2, $3)
+		on conflict (username, room) do update
+		set last_read_id = greatest(read_markers.last_read_id, excluded.last_read_id)`
 )
 
 const recentMessageCount = 10
 
-func (m messageRepo) SaveMessage(ctx context.Context, message domain.Message) error {
-	_, err := m.pool.Exec(ctx, saveMessageQuery, message.Author, message.Text, message.Time)
+func (m messageRepo) SaveMessage(ctx context.Context, message domain.Message) (int64, error) {
+	var id int64
+	attachments := message.Attachments
+	if attachments == nil {
+		attachments = []string{}
+	}
+	err := m.pool.QueryRow(
+		ctx, saveMessageQuery,
+		message.Room, message.Author, message.Text, message.Time, attachments,
+	).Scan(&id)
+	if err != nil {
+		return 0, errors.WithMessage(err, "insert message")
+	}
+	return id, nil
+}
+
+func (m messageRepo) GetRecentMessages(ctx context.Context, room string) ([]domain.Message, error) {
+	messages, err := m.queryMessages(ctx, getMessagesQuery, room, recentMessageCount)
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(messages)
+	return messages, nil
+}
+
+func (m messageRepo) GetMessagesAfter(
+	ctx context.Context,
+	room string,
+	afterID int64,
+	limit int,
+) ([]domain.Message, error) {
+	return m.queryMessages(ctx, getMessagesAfterQuery, room, afterID, limit)
+}
+
+func (m messageRepo) GetMessagesBefore(
+	ctx context.Context,
+	room string,
+	beforeID int64,
+	limit int,
+) ([]domain.Message, error) {
+	messages, err := m.queryMessages(ctx, getMessagesBeforeQuery, room, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(messages)
+	return messages, nil
+}
+
+func (m messageRepo) CountMessagesAfter(ctx context.Context, room string, afterID int64) (int, error) {
+	var count int
+	if err := m.pool.QueryRow(ctx, countMessagesAfterQuery, room, afterID).Scan(&count); err != nil {
+		return 0, errors.WithMessage(err, "count messages")
+	}
+	return count, nil
+}
+
+func (m messageRepo) ListRooms(ctx context.Context) ([]domain.Room, error) {
+	rooms := make([]domain.Room, 0)
+	rows, err := m.pool.Query(ctx, listRoomsQuery)
+	if err != nil {
+		return nil, errors.WithMessage(err, "select rooms")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var room domain.Room
+		if err := rows.Scan(&room.Name, &room.Messages, &room.LastActivity); err != nil {
+			return nil, errors.WithMessage(err, "scan rows")
+		}
+		rooms = append(rooms, room)
+	}
+	return rooms, rows.Err()
+}
+
+func (m messageRepo) GetLastRead(ctx context.Context, user, room string) (int64, bool, error) {
+	var id int64
+	err := m.pool.QueryRow(ctx, getLastReadQuery, user, room).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
 	if err != nil {
-		return errors.WithMessage(err, "insert message")
+		return 0, false, errors.WithMessage(err, "select read marker")
+	}
+	return id, true, nil
+}
+
+func (m messageRepo) SetLastRead(ctx context.Context, user, room string, messageID int64) error {
+	if _, err := m.pool.Exec(ctx, setLastReadQuery, user, room, messageID); err != nil {
+		return errors.WithMessage(err, "upsert read marker")
 	}
 	return nil
 }
 
-func (m messageRepo) GetRecentMessages(ctx context.Context) ([]domain.Message, error) {
+func (m messageRepo) queryMessages(ctx context.Context, query string, args ...any) ([]domain.Message, error) {
 	messages := make([]domain.Message, 0)
-	rows, err := m.pool.Query(ctx, getMessagesQuery, recentMessageCount)
+	rows, err := m.pool.Query(ctx, query, args...)
 	if err != nil {
 		return nil, errors.WithMessage(err, "select messages")
 	}
+	defer rows.Close()
 	for rows.Next() {
 		var msg domain.Message
-		if err := rows.Scan(&msg.Author, &msg.Text, &msg.Time); err != nil {
+		if err := rows.Scan(&msg.ID, &msg.Room, &msg.Author, &msg.Text, &msg.Time, &msg.Attachments); err != nil {
 			return nil, errors.WithMessage(err, "scan rows")
 		}
 		messages = append(messages, msg)
 	}
-	slices.Reverse(messages)
-	return messages, nil
+	return messages, rows.Err()
 }
@@ -0,0 +1,92 @@
+package adapters
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+	"ws-chat/internal/domain"
+)
+
+type moderationRepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewModerationRepo(pool *pgxpool.Pool) moderationRepo {
+	return moderationRepo{
+		pool: pool,
+	}
+}
+
+const (
+	getRoleQuery = `select role from users where name = $1`
+	setRoleQuery = `insert into users (name, role) values ($1, $2)
+		on conflict (name) do update set role = excluded.role`
+	addSanctionQuery = `insert into sanctions (username, kind, until, issued_by, created_at)
+		values ($1, $2, $3, $4, $5)`
+	getActiveSanctionsQuery = `select username, kind, until, issued_by, created_at from sanctions
+		where username = $1 and until > $2 order by until desc`
+	saveAuditEntryQuery = `insert into audit_log (actor, action, target, details, created_at)
+		values ($1, $2, $3, $4, $5)`
+)
+
+func (m moderationRepo) GetRole(ctx context.Context, user string) (domain.Role, error) {
+	var role domain.Role
+	err := m.pool.QueryRow(ctx, getRoleQuery, user).Scan(&role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.RoleMember, nil
+	}
+	if err != nil {
+		return "", errors.WithMessage(err, "select role")
+	}
+	return role, nil
+}
+
+func (m moderationRepo) SetRole(ctx context.Context, user string, role domain.Role) error {
+	_, err := m.pool.Exec(ctx, setRoleQuery, user, role)
+	if err != nil {
+		return errors.WithMessage(err, "upsert role")
+	}
+	return nil
+}
+
+func (m moderationRepo) AddSanction(ctx context.Context, sanction domain.Sanction) error {
+	_, err := m.pool.Exec(
+		ctx, addSanctionQuery,
+		sanction.User, sanction.Kind, sanction.Until, sanction.IssuedBy, sanction.Time,
+	)
+	if err != nil {
+		return errors.WithMessage(err, "insert sanction")
+	}
+	return nil
+}
+
+func (m moderationRepo) GetActiveSanctions(ctx context.Context, user string, at time.Time) ([]domain.Sanction, error) {
+	sanctions := make([]domain.Sanction, 0)
+	rows, err := m.pool.Query(ctx, getActiveSanctionsQuery, user, at)
+	if err != nil {
+		return nil, errors.WithMessage(err, "select sanctions")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s domain.Sanction
+		if err := rows.Scan(&s.User, &s.Kind, &s.Until, &s.IssuedBy, &s.Time); err != nil {
+			return nil, errors.WithMessage(err, "scan rows")
+		}
+		sanctions = append(sanctions, s)
+	}
+	return sanctions, rows.Err()
+}
+
+func (m moderationRepo) SaveAuditEntry(ctx context.Context, entry domain.AuditEntry) error {
+	_, err := m.pool.Exec(
+		ctx, saveAuditEntryQuery,
+		entry.Actor, entry.Action, entry.Target, entry.Details, entry.Time,
+	)
+	if err != nil {
+		return errors.WithMessage(err, "insert audit entry")
+	}
+	return nil
+}
@@ -3,4 +3,4 @@ CREATE TABLE IF NOT EXISTS messages (
     author TEXT NOT NULL,
     text TEXT NOT NULL,
     send_time TIMESTAMP NOT NULL
-);
\ No newline at end of file
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS audit_log;
+DROP TABLE IF EXISTS sanctions;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS read_markers (
+    username TEXT PRIMARY KEY,
+    last_read_id INT NOT NULL
+);
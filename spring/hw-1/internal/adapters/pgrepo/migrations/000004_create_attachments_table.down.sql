@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS attachments;
+ALTER TABLE messages DROP COLUMN IF EXISTS attachments;
@@ -0,0 +1,10 @@
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS attachments TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE TABLE IF NOT EXISTS attachments (
+    id TEXT PRIMARY KEY,
+    owner TEXT NOT NULL,
+    name TEXT NOT NULL,
+    mime TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,7 @@
+DELETE FROM read_markers WHERE room <> 'general';
+ALTER TABLE read_markers DROP CONSTRAINT IF EXISTS read_markers_pkey;
+ALTER TABLE read_markers DROP COLUMN IF EXISTS room;
+ALTER TABLE read_markers ADD PRIMARY KEY (username);
+
+DROP INDEX IF EXISTS messages_room_id_idx;
+ALTER TABLE messages DROP COLUMN IF EXISTS room;
@@ -0,0 +1,7 @@
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS room TEXT NOT NULL DEFAULT 'general';
+
+CREATE INDEX IF NOT EXISTS messages_room_id_idx ON messages (room, id);
+
+ALTER TABLE read_markers ADD COLUMN IF NOT EXISTS room TEXT NOT NULL DEFAULT 'general';
+ALTER TABLE read_markers DROP CONSTRAINT IF EXISTS read_markers_pkey;
+ALTER TABLE read_markers ADD PRIMARY KEY (username, room);
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS public_keys (
+    username TEXT PRIMARY KEY,
+    key BYTEA NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS direct_messages (
+    id BIGSERIAL PRIMARY KEY,
+    sender TEXT NOT NULL,
+    recipient TEXT NOT NULL,
+    sender_key BYTEA NOT NULL,
+    nonce BYTEA NOT NULL,
+    ciphertext BYTEA NOT NULL,
+    delivered_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS direct_messages_pending_idx ON direct_messages (recipient, id)
+    WHERE delivered_at IS NULL;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS attachments_owner_idx;
+DROP INDEX IF EXISTS messages_author_idx;
+DROP INDEX IF EXISTS messages_send_time_idx;
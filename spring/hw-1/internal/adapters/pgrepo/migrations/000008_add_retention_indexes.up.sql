@@ -0,0 +1,5 @@
+CREATE INDEX IF NOT EXISTS messages_send_time_idx ON messages (send_time);
+
+CREATE INDEX IF NOT EXISTS messages_author_idx ON messages (author);
+
+CREATE INDEX IF NOT EXISTS attachments_owner_idx ON attachments (owner);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS messages_attachments_idx;
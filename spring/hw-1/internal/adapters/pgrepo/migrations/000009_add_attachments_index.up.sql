@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS messages_attachments_idx ON messages USING gin (attachments);
@@ -5,12 +5,19 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/pkg/errors"
 )
 
-func NewConnectionPool(ctx context.Context) (*pgxpool.Pool, error) {
-	pool, err := pgxpool.New(ctx, getConnString())
+// NewConnectionPool connects to the database from DB_* env; tracer may be nil.
+func NewConnectionPool(ctx context.Context, tracer pgx.QueryTracer) (*pgxpool.Pool, error) {
+	cfg, err := pgxpool.ParseConfig(getConnString())
+	if err != nil {
+		return nil, errors.WithMessage(err, "parse pgxpool config")
+	}
+	cfg.ConnConfig.Tracer = tracer
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
 	if err != nil {
 		return nil, errors.WithMessage(err, "new pgxpool")
 	}
@@ -0,0 +1,103 @@
+package adapters_test
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"go.uber.org/zap"
+	"ws-chat/internal/adapters"
+	"ws-chat/internal/adapters/pgrepo"
+	"ws-chat/internal/adapters/repotest"
+	"ws-chat/internal/domain"
+	"ws-chat/internal/migrate"
+)
+
+type pgRepo struct {
+	domain.Repository
+	domain.ModerationRepository
+	domain.AttachmentRepository
+	domain.WebhookRepository
+	domain.DirectRepository
+	domain.RetentionRepository
+}
+
+const truncateQuery = `truncate messages, users, sanctions, audit_log, read_markers, attachments,
+	webhook_subscriptions, webhook_deliveries, bots, public_keys, direct_messages restart identity`
+
+func TestPostgresRepo(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping postgres contract test in short mode")
+	}
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+	ctx := context.Background()
+	container, err := postgres.RunContainer(ctx,
+		testcontainers.WithImage("postgres:16-alpine"),
+		testcontainers.WithWaitStrategy(
+			wait.ForLog("database system is ready to accept connections").
+				WithOccurrence(2).
+				WithStartupTimeout(time.Minute),
+		),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = container.Terminate(ctx)
+	})
+	connString, err := container.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+	pool, err := pgxpool.New(ctx, connString)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	migrator, err := migrate.New(pool, pgrepo.Migrations(), migrate.DefaultTable, zap.NewNop())
+	require.NoError(t, err)
+	// concurrent runs must be serialized by the advisory lock
+	errs := make(chan error, 3)
+	for range cap(errs) {
+		go func() {
+			errs <- migrator.Up(ctx)
+		}()
+	}
+	for range cap(errs) {
+		require.NoError(t, <-errs)
+	}
+	require.NoError(t, migrator.Down(ctx, 2))
+	status, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, status.Pending, 2)
+	require.NoError(t, migrator.Up(ctx))
+
+	// another set of migrations keeps its own version and doesn't touch the chat schema
+	other, err := migrate.New(pool, fstest.MapFS{
+		"000001_create_probe.up.sql":   {Data: []byte("create table probe (id int)")},
+		"000001_create_probe.down.sql": {Data: []byte("drop table probe")},
+	}, "probe_schema_migrations", zap.NewNop())
+	require.NoError(t, err)
+	require.NoError(t, other.Up(ctx))
+	otherStatus, err := other.Status(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), otherStatus.Version)
+	require.NoError(t, other.Down(ctx, 1))
+	chatStatus, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	require.Empty(t, chatStatus.Pending)
+
+	repotest.Run(t, func(t *testing.T) repotest.Repo {
+		_, err := pool.Exec(ctx, truncateQuery)
+		require.NoError(t, err)
+		return pgRepo{
+			Repository:           adapters.NewMessageRepo(pool),
+			ModerationRepository: adapters.NewModerationRepo(pool),
+			AttachmentRepository: adapters.NewAttachmentRepo(pool),
+			WebhookRepository:    adapters.NewWebhookRepo(pool),
+			DirectRepository:     adapters.NewDirectRepo(pool),
+			RetentionRepository:  adapters.NewMessageRepo(pool),
+		}
+	})
+}
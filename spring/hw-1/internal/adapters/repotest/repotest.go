@@ -0,0 +1,613 @@
+package repotest
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"ws-chat/internal/domain"
+)
+
+type Repo interface {
+	domain.Repository
+	domain.ModerationRepository
+	domain.AttachmentRepository
+	domain.WebhookRepository
+	domain.DirectRepository
+	domain.RetentionRepository
+}
+
+// Run checks that a storage backend behaves the way the hub expects.
+// newRepo must return an empty repository on every call.
+func Run(t *testing.T, newRepo func(t *testing.T) Repo) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, repo Repo)
+	}{
+		{"RecentMessages", testRecentMessages},
+		{"MessagesAfter", testMessagesAfter},
+		{"MessagesBefore", testMessagesBefore},
+		{"Rooms", testRooms},
+		{"ReadMarkers", testReadMarkers},
+		{"Roles", testRoles},
+		{"Sanctions", testSanctions},
+		{"AuditLog", testAuditLog},
+		{"Attachments", testAttachments},
+		{"Subscriptions", testSubscriptions},
+		{"Outbox", testOutbox},
+		{"Bots", testBots},
+		{"PublicKeys", testPublicKeys},
+		{"DirectMessages", testDirectMessages},
+		{"RetentionByAge", testRetentionByAge},
+		{"RetentionByCount", testRetentionByCount},
+		{"Export", testExport},
+		{"ForgetUser", testForgetUser},
+		{"OrphanAttachments", testOrphanAttachments},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newRepo(t))
+		})
+	}
+}
+
+func saveMessages(t *testing.T, repo Repo, room string, n int) []int64 {
+	ids := make([]int64, 0, n)
+	for i := range n {
+		id, err := repo.SaveMessage(context.Background(), domain.Message{
+			Room:   room,
+			Author: "alice",
+			Text:   fmt.Sprintf("message %d", i),
+			Time:   time.Now(),
+		})
+		require.NoError(t, err)
+		if len(ids) > 0 {
+			require.Greater(t, id, ids[len(ids)-1])
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func testRecentMessages(t *testing.T, repo Repo) {
+	ctx := context.Background()
+	messages, err := repo.GetRecentMessages(ctx, domain.DefaultRoom)
+	require.NoError(t, err)
+	require.Empty(t, messages)
+
+	ids := saveMessages(t, repo, domain.DefaultRoom, 15)
+	saveMessages(t, repo, "random", 3)
+	messages, err = repo.GetRecentMessages(ctx, domain.DefaultRoom)
+	require.NoError(t, err)
+	require.Len(t, messages, 10)
+	for i, msg := range messages {
+		require.Equal(t, ids[5+i], msg.ID)
+		require.Equal(t, domain.DefaultRoom, msg.Room)
+		require.Equal(t, fmt.Sprintf("message %d", 5+i), msg.Text)
+		require.Equal(t, "alice", msg.Author)
+		require.WithinDuration(t, time.Now(), msg.Time, time.Minute)
+	}
+}
+
+func testMessagesAfter(t *testing.T, repo Repo) {
+	ctx := context.Background()
+	ids := saveMessages(t, repo, domain.DefaultRoom, 7)
+	saveMessages(t, repo, "random", 2)
+
+	page, err := repo.GetMessagesAfter(ctx, domain.DefaultRoom, ids[1], 3)
+	require.NoError(t, err)
+	require.Len(t, page, 3)
+	require.Equal(t, ids[2], page[0].ID)
+	require.Equal(t, ids[4], page[2].ID)
+
+	page, err = repo.GetMessagesAfter(ctx, domain.DefaultRoom, ids[4], 100)
+	require.NoError(t, err)
+	require.Len(t, page, 2)
+
+	count, err := repo.CountMessagesAfter(ctx, domain.DefaultRoom, ids[4])
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	count, err = repo.CountMessagesAfter(ctx, domain.DefaultRoom, 0)
+	require.NoError(t, err)
+	require.Equal(t, 7, count)
+
+	count, err = repo.CountMessagesAfter(ctx, "random", 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+}
+
+func testMessagesBefore(t *testing.T, repo Repo) {
+	ctx := context.Background()
+	ids := saveMessages(t, repo, domain.DefaultRoom, 3)
+	saveMessages(t, repo, "random", 2)
+	ids = append(ids, saveMessages(t, repo, domain.DefaultRoom, 4)...)
+
+	page, err := repo.GetMessagesBefore(ctx, domain.DefaultRoom, ids[5], 4)
+	require.NoError(t, err)
+	require.Len(t, page, 4)
+	for i, msg := range page {
+		require.Equal(t, ids[1+i], msg.ID, "page must be ordered oldest first")
+	}
+
+	page, err = repo.GetMessagesBefore(ctx, domain.DefaultRoom, ids[1], 10)
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	require.Equal(t, ids[0], page[0].ID)
+
+	page, err = repo.GetMessagesBefore(ctx, domain.DefaultRoom, ids[0], 10)
+	require.NoError(t, err)
+	require.Empty(t, page)
+}
+
+func testRooms(t *testing.T, repo Repo) {
+	ctx := context.Background()
+	rooms, err := repo.ListRooms(ctx)
+	require.NoError(t, err)
+	require.Empty(t, rooms)
+
+	saveMessages(t, repo, "random", 2)
+	saveMessages(t, repo, domain.DefaultRoom, 3)
+	rooms, err = repo.ListRooms(ctx)
+	require.NoError(t, err)
+	require.Len(t, rooms, 2)
+	require.Equal(t, domain.DefaultRoom, rooms[0].Name, "most recently active room goes first")
+	require.Equal(t, 3, rooms[0].Messages)
+	require.Equal(t, "random", rooms[1].Name)
+	require.Equal(t, 2, rooms[1].Messages)
+	require.WithinDuration(t, time.Now(), rooms[0].LastActivity, time.Minute)
+}
+
+func testReadMarkers(t *testing.T, repo Repo) {
+	ctx := context.Background()
+	_, ok, err := repo.GetLastRead(ctx, "alice", domain.DefaultRoom)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, repo.SetLastRead(ctx, "alice", domain.DefaultRoom, 5))
+	require.NoError(t, repo.SetLastRead(ctx, "alice", domain.DefaultRoom, 3))
+	id, ok, err := repo.GetLastRead(ctx, "alice", domain.DefaultRoom)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, int64(5), id, "read marker must never move backwards")
+
+	require.NoError(t, repo.SetLastRead(ctx, "alice", domain.DefaultRoom, 8))
+	id, _, err = repo.GetLastRead(ctx, "alice", domain.DefaultRoom)
+	require.NoError(t, err)
+	require.Equal(t, int64(8), id)
+
+	_, ok, err = repo.GetLastRead(ctx, "alice", "random")
+	require.NoError(t, err)
+	require.False(t, ok, "read markers are kept per room")
+}
+
+func testRoles(t *testing.T, repo Repo) {
+	ctx := context.Background()
+	role, err := repo.GetRole(ctx, "bob")
+	require.NoError(t, err)
+	require.Equal(t, domain.RoleMember, role)
+
+	require.NoError(t, repo.SetRole(ctx, "bob", domain.RoleModerator))
+	require.NoError(t, repo.SetRole(ctx, "bob", domain.RoleAdmin))
+	role, err = repo.GetRole(ctx, "bob")
+	require.NoError(t, err)
+	require.Equal(t, domain.RoleAdmin, role)
+}
+
+func testSanctions(t *testing.T, repo Repo) {
+	ctx := context.Background()
+	now := time.Now()
+	for _, s := range []domain.Sanction{
+		{User: "bob", Kind: domain.SanctionMute, Until: now.Add(-time.Minute), IssuedBy: "alice", Time: now},
+		{User: "bob", Kind: domain.SanctionMute, Until: now.Add(time.Minute), IssuedBy: "alice", Time: now},
+		{User: "bob", Kind: domain.SanctionBan, Until: now.Add(time.Hour), IssuedBy: "alice", Time: now},
+		{User: "carol", Kind: domain.SanctionBan, Until: now.Add(time.Hour), IssuedBy: "alice", Time: now},
+	} {
+		require.NoError(t, repo.AddSanction(ctx, s))
+	}
+	active, err := repo.GetActiveSanctions(ctx, "bob", now)
+	require.NoError(t, err)
+	require.Len(t, active, 2)
+	require.Equal(t, domain.SanctionBan, active[0].Kind)
+	require.Equal(t, domain.SanctionMute, active[1].Kind)
+	require.Equal(t, "alice", active[0].IssuedBy)
+	require.WithinDuration(t, now.Add(time.Hour), active[0].Until, time.Millisecond)
+
+	active, err = repo.GetActiveSanctions(ctx, "bob", now.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, active)
+}
+
+func testAuditLog(t *testing.T, repo Repo) {
+	err := repo.SaveAuditEntry(context.Background(), domain.AuditEntry{
+		Actor:   "alice",
+		Action:  "kick",
+		Target:  "bob",
+		Details: "",
+		Time:    time.Now(),
+	})
+	require.NoError(t, err)
+}
+
+func testAttachments(t *testing.T, repo Repo) {
+	ctx := context.Background()
+	attachment := domain.Attachment{
+		ID:    "0123456789abcdef",
+		Owner: "alice",
+		Name:  "cat.png",
+		MIME:  "image/png",
+		Size:  1024,
+		Time:  time.Now(),
+	}
+	require.NoError(t, repo.SaveAttachment(ctx, attachment))
+
+	found, err := repo.GetAttachments(ctx, []string{attachment.ID, "missing"})
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	require.Equal(t, attachment.Owner, found[0].Owner)
+	require.Equal(t, attachment.Name, found[0].Name)
+	require.Equal(t, attachment.Size, found[0].Size)
+
+	id, err := repo.SaveMessage(ctx, domain.Message{
+		Room:        domain.DefaultRoom,
+		Author:      "alice",
+		Time:        time.Now(),
+		Attachments: []string{attachment.ID},
+	})
+	require.NoError(t, err)
+	messages, err := repo.GetMessagesAfter(ctx, domain.DefaultRoom, id-1, 1)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	require.Equal(t, []string{attachment.ID}, messages[0].Attachments)
+}
+
+func saveSubscription(t *testing.T, repo Repo, id, room string) domain.Subscription {
+	subscription := domain.Subscription{
+		ID:        id,
+		Room:      room,
+		URL:       "http://ci.example/" + id,
+		Events:    []domain.EventType{domain.EventMessageCreated, domain.EventUserJoined},
+		Secret:    "secret-" + id,
+		CreatedBy: "admin",
+		Time:      time.Now(),
+	}
+	require.NoError(t, repo.SaveSubscription(context.Background(), subscription))
+	return subscription
+}
+
+func testSubscriptions(t *testing.T, repo Repo) {
+	ctx := context.Background()
+	first := saveSubscription(t, repo, "wh1", domain.DefaultRoom)
+	saveSubscription(t, repo, "wh2", "random")
+
+	subscriptions, err := repo.ListSubscriptions(ctx, domain.DefaultRoom)
+	require.NoError(t, err)
+	require.Len(t, subscriptions, 1)
+	require.Equal(t, first.URL, subscriptions[0].URL)
+	require.Equal(t, first.Events, subscriptions[0].Events)
+	require.Equal(t, first.Secret, subscriptions[0].Secret)
+
+	require.NoError(t, repo.DeleteSubscription(ctx, "wh1"))
+	require.ErrorIs(t, repo.DeleteSubscription(ctx, "wh1"), domain.ErrNotFound)
+	subscriptions, err = repo.ListSubscriptions(ctx, domain.DefaultRoom)
+	require.NoError(t, err)
+	require.Empty(t, subscriptions)
+}
+
+func testOutbox(t *testing.T, repo Repo) {
+	ctx := context.Background()
+	subscription := saveSubscription(t, repo, "wh1", domain.DefaultRoom)
+	saveSubscription(t, repo, "wh2", domain.DefaultRoom)
+	now := time.Now()
+	require.NoError(t, repo.EnqueueDeliveries(ctx, []domain.Delivery{
+		{SubscriptionID: "wh1", Event: domain.EventMessageCreated, Payload: []byte(`{"n":1}`), NextAttempt: now, Time: now},
+		{SubscriptionID: "wh1", Event: domain.EventUserJoined, Payload: []byte(`{"n":2}`), NextAttempt: now, Time: now},
+		{SubscriptionID: "wh2", Event: domain.EventMessageCreated, Payload: []byte(`{"n":3}`), NextAttempt: now, Time: now},
+		{SubscriptionID: "wh1", Event: domain.EventMessageCreated, Payload: []byte(`{"n":4}`),
+			NextAttempt: now.Add(time.Hour), Time: now},
+	}))
+
+	claimed, err := repo.ClaimDeliveries(ctx, now, now.Add(time.Minute), 2)
+	require.NoError(t, err)
+	require.Len(t, claimed, 2)
+	claimed = append(claimed, mustClaim(t, repo, now, 10)...)
+	require.Len(t, claimed, 3, "future deliveries must not be claimed")
+	require.Empty(t, mustClaim(t, repo, now, 10), "claimed deliveries are leased")
+	// due deliveries share next_attempt_at, so the claim order among them is unspecified
+	slices.SortFunc(claimed, func(a, b domain.Delivery) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	var first domain.Delivery
+	for _, d := range claimed {
+		if string(d.Payload) == `{"n":1}` {
+			first = d
+		}
+	}
+	require.Equal(t, subscription.URL, first.URL)
+	require.Equal(t, subscription.Secret, first.Secret)
+	require.Equal(t, domain.EventMessageCreated, first.Event)
+
+	require.NoError(t, repo.CompleteDelivery(ctx, claimed[0].ID))
+	require.NoError(t, repo.RetryDelivery(ctx, claimed[1].ID, now, "503 Service Unavailable"))
+	require.NoError(t, repo.FailDelivery(ctx, claimed[2].ID, "410 Gone"))
+	retried := mustClaim(t, repo, now, 10)
+	require.Len(t, retried, 1)
+	require.Equal(t, claimed[1].ID, retried[0].ID)
+	require.Equal(t, 1, retried[0].Attempts)
+	require.Equal(t, "503 Service Unavailable", retried[0].LastError)
+
+	require.NoError(t, repo.DeleteSubscription(ctx, "wh1"))
+	require.Empty(t, mustClaim(t, repo, now.Add(2*time.Hour), 10), "deliveries go away with their subscription")
+}
+
+func mustClaim(t *testing.T, repo Repo, now time.Time, limit int) []domain.Delivery {
+	deliveries, err := repo.ClaimDeliveries(context.Background(), now, now.Add(time.Minute), limit)
+	require.NoError(t, err)
+	return deliveries
+}
+
+func testBots(t *testing.T, repo Repo) {
+	ctx := context.Background()
+	_, err := repo.GetBot(ctx, "deploy")
+	require.ErrorIs(t, err, domain.ErrNotFound)
+
+	bot := domain.Bot{Name: "deploy", URL: "http://ci.example/deploy", Token: "t1", CreatedBy: "admin", Time: time.Now()}
+	require.NoError(t, repo.SaveBot(ctx, bot))
+	require.NoError(t, repo.SaveBot(ctx, domain.Bot{Name: "oncall", Token: "t2", CreatedBy: "admin", Time: time.Now()}))
+
+	found, err := repo.GetBot(ctx, "deploy")
+	require.NoError(t, err)
+	require.Equal(t, bot.URL, found.URL)
+	found, err = repo.GetBotByToken(ctx, "t2")
+	require.NoError(t, err)
+	require.Equal(t, "oncall", found.Name)
+	_, err = repo.GetBotByToken(ctx, "missing")
+	require.ErrorIs(t, err, domain.ErrNotFound)
+
+	bot.Token = "t3"
+	require.NoError(t, repo.SaveBot(ctx, bot))
+	_, err = repo.GetBotByToken(ctx, "t1")
+	require.ErrorIs(t, err, domain.ErrNotFound, "saving a bot again rotates its token")
+
+	bots, err := repo.ListBots(ctx)
+	require.NoError(t, err)
+	require.Len(t, bots, 2)
+	require.Equal(t, "deploy", bots[0].Name)
+
+	require.NoError(t, repo.DeleteBot(ctx, "deploy"))
+	require.ErrorIs(t, repo.DeleteBot(ctx, "deploy"), domain.ErrNotFound)
+}
+
+func testPublicKeys(t *testing.T, repo Repo) {
+	ctx := context.Background()
+	_, err := repo.GetPublicKey(ctx, "alice")
+	require.ErrorIs(t, err, domain.ErrNotFound)
+
+	require.NoError(t, repo.SetPublicKey(ctx, domain.PublicKey{User: "alice", Key: []byte("key-1"), Time: time.Now()}))
+	require.NoError(t, repo.SetPublicKey(ctx, domain.PublicKey{User: "alice", Key: []byte("key-2"), Time: time.Now()}))
+	key, err := repo.GetPublicKey(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, []byte("key-2"), key.Key, "publishing again replaces the key")
+}
+
+func testDirectMessages(t *testing.T, repo Repo) {
+	ctx := context.Background()
+	ids := make([]int64, 0)
+	for i, to := range []string{"bob", "carol", "bob"} {
+		id, err := repo.SaveDirectMessage(ctx, domain.DirectMessage{
+			From:       "alice",
+			To:         to,
+			SenderKey:  []byte("alice-key"),
+			Nonce:      []byte(fmt.Sprintf("nonce-%d", i)),
+			Ciphertext: []byte(fmt.Sprintf("sealed-%d", i)),
+			Time:       time.Now(),
+		})
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+
+	pending, err := repo.GetPendingDirectMessages(ctx, "bob", 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	require.Equal(t, ids[0], pending[0].ID)
+	require.Equal(t, []byte("sealed-0"), pending[0].Ciphertext)
+	require.Equal(t, []byte("alice-key"), pending[0].SenderKey)
+	require.Equal(t, "alice", pending[0].From)
+
+	require.NoError(t, repo.MarkDirectDelivered(ctx, []int64{ids[0]}))
+	pending, err = repo.GetPendingDirectMessages(ctx, "bob", 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	require.Equal(t, ids[2], pending[0].ID)
+
+	pending, err = repo.GetPendingDirectMessages(ctx, "carol", 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1, "delivering to one recipient leaves others pending")
+}
+
+func saveMessageAt(t *testing.T, repo Repo, room, author string, at time.Time) int64 {
+	id, err := repo.SaveMessage(context.Background(), domain.Message{Room: room, Author: author, Text: "text", Time: at})
+	require.NoError(t, err)
+	return id
+}
+
+func testRetentionByAge(t *testing.T, repo Repo) {
+	ctx := context.Background()
+	now := time.Now()
+	for i := range 5 {
+		saveMessageAt(t, repo, domain.DefaultRoom, "alice", now.Add(-time.Duration(10-i)*time.Hour))
+	}
+	kept := saveMessageAt(t, repo, "random", "alice", now)
+
+	n, err := repo.DeleteMessagesBefore(ctx, now.Add(-time.Hour), 3)
+	require.NoError(t, err)
+	require.Equal(t, 3, n, "one call deletes at most one batch")
+	n, err = repo.DeleteMessagesBefore(ctx, now.Add(-time.Hour), 3)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	rooms, err := repo.ListRooms(ctx)
+	require.NoError(t, err)
+	require.Len(t, rooms, 1)
+	messages, err := repo.GetRecentMessages(ctx, "random")
+	require.NoError(t, err)
+	require.Equal(t, kept, messages[0].ID)
+}
+
+func testRetentionByCount(t *testing.T, repo Repo) {
+	ctx := context.Background()
+	ids := saveMessages(t, repo, domain.DefaultRoom, 6)
+	saveMessages(t, repo, "random", 2)
+
+	n, err := repo.DeleteExcessMessages(ctx, domain.DefaultRoom, 2, 3)
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	n, err = repo.DeleteExcessMessages(ctx, domain.DefaultRoom, 2, 3)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	n, err = repo.DeleteExcessMessages(ctx, domain.DefaultRoom, 2, 3)
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	messages, err := repo.GetRecentMessages(ctx, domain.DefaultRoom)
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+	require.Equal(t, ids[4], messages[0].ID, "the newest messages are kept")
+	count, err := repo.CountMessagesAfter(ctx, "random", 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, count, "other rooms are untouched")
+}
+
+func testExport(t *testing.T, repo Repo) {
+	ctx := context.Background()
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	ids := make([]int64, 0)
+	for i := range 5 {
+		ids = append(ids, saveMessageAt(t, repo, domain.DefaultRoom, "alice", start.Add(time.Duration(i)*time.Hour)))
+	}
+	saveMessageAt(t, repo, "random", "alice", start.Add(time.Hour))
+
+	from, to := start.Add(time.Hour), start.Add(4*time.Hour)
+	page, err := repo.ExportMessages(ctx, domain.DefaultRoom, from, to, 0, 2)
+	require.NoError(t, err)
+	require.Len(t, page, 2)
+	require.Equal(t, ids[1], page[0].ID)
+	page, err = repo.ExportMessages(ctx, domain.DefaultRoom, from, to, page[1].ID, 2)
+	require.NoError(t, err)
+	require.Len(t, page, 1, "the end of the range is exclusive")
+	require.Equal(t, ids[3], page[0].ID)
+}
+
+func testForgetUser(t *testing.T, repo Repo) {
+	ctx := context.Background()
+	for range 3 {
+		saveMessageAt(t, repo, domain.DefaultRoom, "bob", time.Now())
+	}
+	saveMessageAt(t, repo, domain.DefaultRoom, "alice", time.Now())
+	require.NoError(t, repo.SetLastRead(ctx, "bob", domain.DefaultRoom, 1))
+	require.NoError(t, repo.SetPublicKey(ctx, domain.PublicKey{User: "bob", Key: []byte("key"), Time: time.Now()}))
+	_, err := repo.SaveDirectMessage(ctx, domain.DirectMessage{
+		From: "alice", To: "bob", SenderKey: []byte("k"), Nonce: []byte("n"), Ciphertext: []byte("c"), Time: time.Now(),
+	})
+	require.NoError(t, err)
+	require.NoError(t, repo.SaveAttachment(ctx, domain.Attachment{
+		ID: "bob-file", Owner: "bob", Name: "a.txt", MIME: "text/plain", Size: 1, Time: time.Now(),
+	}))
+	now := time.Now()
+	require.NoError(t, repo.SetRole(ctx, "bob", domain.RoleModerator))
+	require.NoError(t, repo.AddSanction(ctx, domain.Sanction{
+		User: "bob", Kind: domain.SanctionMute, Until: now.Add(time.Hour), IssuedBy: "alice", Time: now,
+	}))
+	require.NoError(t, repo.AddSanction(ctx, domain.Sanction{
+		User: "carol", Kind: domain.SanctionBan, Until: now.Add(time.Hour), IssuedBy: "bob", Time: now,
+	}))
+	require.NoError(t, repo.SaveAuditEntry(ctx, domain.AuditEntry{Actor: "bob", Action: "ban", Target: "carol", Time: now}))
+	require.NoError(t, repo.SaveSubscription(ctx, domain.Subscription{
+		ID: "wh1", Room: domain.DefaultRoom, URL: "http://ci.example/wh1", Secret: "secret", CreatedBy: "bob", Time: now,
+	}))
+	require.NoError(t, repo.SaveBot(ctx, domain.Bot{Name: "deploy", Token: "t1", CreatedBy: "bob", Time: now}))
+
+	n, err := repo.AnonymizeMessages(ctx, "bob", "deleted", 2)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	n, err = repo.DeleteUserMessages(ctx, "bob", 10)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	messages, err := repo.GetRecentMessages(ctx, domain.DefaultRoom)
+	require.NoError(t, err)
+	authors := make([]string, 0)
+	for _, msg := range messages {
+		authors = append(authors, msg.Author)
+	}
+	require.Equal(t, []string{"deleted", "deleted", "alice"}, authors)
+
+	ids, err := repo.DeleteUserData(ctx, "bob", "deleted")
+	require.NoError(t, err)
+	require.Equal(t, []string{"bob-file"}, ids)
+	role, err := repo.GetRole(ctx, "bob")
+	require.NoError(t, err)
+	require.Equal(t, domain.RoleMember, role)
+	sanctions, err := repo.GetActiveSanctions(ctx, "bob", now)
+	require.NoError(t, err)
+	require.Empty(t, sanctions)
+	sanctions, err = repo.GetActiveSanctions(ctx, "carol", now)
+	require.NoError(t, err)
+	require.Len(t, sanctions, 1)
+	require.Equal(t, "deleted", sanctions[0].IssuedBy)
+	subscriptions, err := repo.ListSubscriptions(ctx, domain.DefaultRoom)
+	require.NoError(t, err)
+	require.Len(t, subscriptions, 1)
+	require.Equal(t, "deleted", subscriptions[0].CreatedBy)
+	bot, err := repo.GetBot(ctx, "deploy")
+	require.NoError(t, err)
+	require.Equal(t, "deleted", bot.CreatedBy)
+	_, ok, err := repo.GetLastRead(ctx, "bob", domain.DefaultRoom)
+	require.NoError(t, err)
+	require.False(t, ok)
+	_, err = repo.GetPublicKey(ctx, "bob")
+	require.ErrorIs(t, err, domain.ErrNotFound)
+	pending, err := repo.GetPendingDirectMessages(ctx, "bob", 10)
+	require.NoError(t, err)
+	require.Empty(t, pending)
+	attachments, err := repo.GetAttachments(ctx, []string{"bob-file"})
+	require.NoError(t, err)
+	require.Empty(t, attachments)
+}
+
+func testOrphanAttachments(t *testing.T, repo Repo) {
+	ctx := context.Background()
+	now := time.Now()
+	for _, at := range []domain.Attachment{
+		{ID: "posted", Time: now.Add(-3 * time.Hour)},
+		{ID: "oldest", Time: now.Add(-3 * time.Hour)},
+		{ID: "old", Time: now.Add(-2 * time.Hour)},
+		{ID: "fresh", Time: now},
+	} {
+		at.Owner, at.Name, at.MIME, at.Size = "alice", at.ID+".txt", "text/plain", 1
+		require.NoError(t, repo.SaveAttachment(ctx, at))
+	}
+	_, err := repo.SaveMessage(ctx, domain.Message{
+		Room: domain.DefaultRoom, Author: "alice", Time: now, Attachments: []string{"posted"},
+	})
+	require.NoError(t, err)
+
+	before := now.Add(-time.Hour)
+	ids, err := repo.DeleteOrphanAttachments(ctx, before, 1)
+	require.NoError(t, err)
+	require.Equal(t, []string{"oldest"}, ids, "the oldest orphan goes first")
+	ids, err = repo.DeleteOrphanAttachments(ctx, before, 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"old"}, ids)
+	ids, err = repo.DeleteOrphanAttachments(ctx, before, 10)
+	require.NoError(t, err)
+	require.Empty(t, ids)
+
+	left, err := repo.GetAttachments(ctx, []string{"posted", "oldest", "old", "fresh"})
+	require.NoError(t, err)
+	require.Len(t, left, 2)
+}
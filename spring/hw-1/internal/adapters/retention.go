@@ -0,0 +1,132 @@
+package adapters
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+	"ws-chat/internal/domain"
+)
+
+const (
+	deleteMessagesBeforeQuery = `delete from messages where id in (
+		select id from messages where send_time < $1 order by id limit $2)`
+	deleteExcessMessagesQuery = `delete from messages where id in (
+		select id from messages where room = $1 order by id desc offset $2 limit $3)`
+	exportMessagesQuery = `select id, room, author, text, send_time, attachments from messages
+		where room = $1 and send_time >= $2 and send_time < $3 and id > $4 order by id limit $5`
+	anonymizeMessagesQuery = `update messages set author = $2 where id in (
+		select id from messages where author = $1 order by id limit $3)`
+	deleteUserMessagesQuery = `delete from messages where id in (
+		select id from messages where author = $1 order by id limit $2)`
+	deleteUserReadMarkersQuery = `delete from read_markers where username = $1`
+	deleteUserRoleQuery        = `delete from users where name = $1`
+	deleteUserSanctionsQuery   = `delete from sanctions where username = $1`
+	deleteUserKeyQuery         = `delete from public_keys where username = $1`
+	deleteUserDirectQuery      = `delete from direct_messages where sender = $1 or recipient = $1`
+	deleteUserAttachmentsQuery = `delete from attachments where owner = $1 returning id`
+	// these take the user as $1 and the alias as $2
+	anonymizeIssuedSanctionsQuery = `update sanctions set issued_by = $2 where issued_by = $1`
+	anonymizeAuditActorQuery      = `update audit_log set actor = $2 where actor = $1`
+	anonymizeAuditTargetQuery     = `update audit_log set target = $2 where target = $1`
+	anonymizeSubscriptionsQuery   = `update webhook_subscriptions set created_by = $2 where created_by = $1`
+	anonymizeBotsQuery            = `update bots set created_by = $2 where created_by = $1`
+	// @> rather than = any() so that the gin index on messages.attachments is used
+	deleteOrphanAttachmentsQuery = `delete from attachments where id in (
+		select a.id from attachments a where a.created_at < $1
+			and not exists (select 1 from messages m where m.attachments @> array[a.id])
+		order by a.created_at limit $2)
+		returning id`
+)
+
+func (m messageRepo) DeleteMessagesBefore(ctx context.Context, before time.Time, limit int) (int, error) {
+	return m.execBatch(ctx, deleteMessagesBeforeQuery, before, limit)
+}
+
+func (m messageRepo) DeleteExcessMessages(ctx context.Context, room string, keep, limit int) (int, error) {
+	return m.execBatch(ctx, deleteExcessMessagesQuery, room, keep, limit)
+}
+
+func (m messageRepo) ExportMessages(
+	ctx context.Context,
+	room string,
+	from, to time.Time,
+	afterID int64,
+	limit int,
+) ([]domain.Message, error) {
+	return m.queryMessages(ctx, exportMessagesQuery, room, from, to, afterID, limit)
+}
+
+func (m messageRepo) AnonymizeMessages(ctx context.Context, author, alias string, limit int) (int, error) {
+	return m.execBatch(ctx, anonymizeMessagesQuery, author, alias, limit)
+}
+
+func (m messageRepo) DeleteUserMessages(ctx context.Context, author string, limit int) (int, error) {
+	return m.execBatch(ctx, deleteUserMessagesQuery, author, limit)
+}
+
+func (m messageRepo) DeleteUserData(ctx context.Context, user, alias string) ([]string, error) {
+	tx, err := m.pool.Begin(ctx)
+	if err != nil {
+		return nil, errors.WithMessage(err, "begin transaction")
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+	for _, query := range []string{
+		deleteUserReadMarkersQuery,
+		deleteUserRoleQuery,
+		deleteUserSanctionsQuery,
+		deleteUserKeyQuery,
+		deleteUserDirectQuery,
+	} {
+		if _, err := tx.Exec(ctx, query, user); err != nil {
+			return nil, errors.WithMessage(err, "delete user data")
+		}
+	}
+	for _, query := range []string{
+		anonymizeIssuedSanctionsQuery,
+		anonymizeAuditActorQuery,
+		anonymizeAuditTargetQuery,
+		anonymizeSubscriptionsQuery,
+		anonymizeBotsQuery,
+	} {
+		if _, err := tx.Exec(ctx, query, user, alias); err != nil {
+			return nil, errors.WithMessage(err, "anonymize user data")
+		}
+	}
+	rows, err := tx.Query(ctx, deleteUserAttachmentsQuery, user)
+	if err != nil {
+		return nil, errors.WithMessage(err, "delete attachments")
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, errors.WithMessage(err, "scan rows")
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, errors.WithMessage(err, "commit")
+	}
+	return ids, nil
+}
+
+func (m messageRepo) DeleteOrphanAttachments(ctx context.Context, before time.Time, limit int) ([]string, error) {
+	rows, err := m.pool.Query(ctx, deleteOrphanAttachmentsQuery, before, limit)
+	if err != nil {
+		return nil, errors.WithMessage(err, "delete orphan attachments")
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, errors.WithMessage(err, "scan rows")
+	}
+	return ids, nil
+}
+
+// execBatch runs a statement that touches at most one batch of rows and reports how many it did.
+func (m messageRepo) execBatch(ctx context.Context, query string, args ...any) (int, error) {
+	tag, err := m.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return 0, errors.WithMessage(err, "update messages")
+	}
+	return int(tag.RowsAffected()), nil
+}
@@ -0,0 +1,101 @@
+package sqliterepo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+	"ws-chat/internal/domain"
+)
+
+const (
+	setPublicKeyQuery = `insert into public_keys (username, key, updated_at) values (?, ?, ?)
+		on conflict (username) do update set key = excluded.key, updated_at = excluded.updated_at`
+	getPublicKeyQuery      = `select username, key, updated_at from public_keys where username = ?`
+	saveDirectMessageQuery = `insert into direct_messages (sender, recipient, sender_key, nonce, ciphertext, created_at)
+		values (?, ?, ?, ?, ?, ?) returning id`
+	getPendingDirectQuery = `select id, sender, recipient, sender_key, nonce, ciphertext, created_at
+		from direct_messages where recipient = ? and delivered_at is null order by id limit ?`
+	markDirectDeliveredQuery = `update direct_messages set delivered_at = ? where id = ? and delivered_at is null`
+)
+
+func (r repo) SetPublicKey(ctx context.Context, key domain.PublicKey) error {
+	if _, err := r.db.ExecContext(ctx, setPublicKeyQuery, key.User, key.Key, key.Time.UnixNano()); err != nil {
+		return errors.WithMessage(err, "upsert public key")
+	}
+	return nil
+}
+
+func (r repo) GetPublicKey(ctx context.Context, user string) (domain.PublicKey, error) {
+	var (
+		key     domain.PublicKey
+		updated int64
+	)
+	err := r.db.QueryRowContext(ctx, getPublicKeyQuery, user).Scan(&key.User, &key.Key, &updated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.PublicKey{}, domain.ErrNotFound
+	}
+	if err != nil {
+		return domain.PublicKey{}, errors.WithMessage(err, "select public key")
+	}
+	key.Time = fromUnixNano(updated)
+	return key, nil
+}
+
+func (r repo) SaveDirectMessage(ctx context.Context, msg domain.DirectMessage) (int64, error) {
+	var id int64
+	err := r.db.QueryRowContext(
+		ctx, saveDirectMessageQuery,
+		msg.From, msg.To, msg.SenderKey, msg.Nonce, msg.Ciphertext, msg.Time.UnixNano(),
+	).Scan(&id)
+	if err != nil {
+		return 0, errors.WithMessage(err, "insert direct message")
+	}
+	return id, nil
+}
+
+func (r repo) GetPendingDirectMessages(
+	ctx context.Context,
+	user string,
+	limit int,
+) ([]domain.DirectMessage, error) {
+	rows, err := r.db.QueryContext(ctx, getPendingDirectQuery, user, limit)
+	if err != nil {
+		return nil, errors.WithMessage(err, "select direct messages")
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	messages := make([]domain.DirectMessage, 0)
+	for rows.Next() {
+		var (
+			msg     domain.DirectMessage
+			created int64
+		)
+		err := rows.Scan(&msg.ID, &msg.From, &msg.To, &msg.SenderKey, &msg.Nonce, &msg.Ciphertext, &created)
+		if err != nil {
+			return nil, errors.WithMessage(err, "scan rows")
+		}
+		msg.Time = fromUnixNano(created)
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+func (r repo) MarkDirectDelivered(ctx context.Context, ids []int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.WithMessage(err, "begin transaction")
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	now := time.Now().UnixNano()
+	for _, id := range ids {
+		if _, err := tx.ExecContext(ctx, markDirectDeliveredQuery, now, id); err != nil {
+			return errors.WithMessage(err, "mark direct message delivered")
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,61 @@
+package sqliterepo
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+
+	"github.com/pkg/errors"
+	"ws-chat/internal/migrate"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// migrateUp applies the embedded migrations newer than the database version. SQLite keeps
+// the version in PRAGMA user_version, which is part of the transaction, so a script and its
+// version bump are committed together. Databases created before the migrations were versioned
+// are at version 0, and the first migration only creates what they are missing.
+func migrateUp(ctx context.Context, db *sql.DB) error {
+	sub, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return errors.WithMessage(err, "open migrations dir")
+	}
+	list, err := migrate.Load(sub)
+	if err != nil {
+		return errors.WithMessage(err, "load migrations")
+	}
+	var version uint64
+	if err := db.QueryRowContext(ctx, `pragma user_version`).Scan(&version); err != nil {
+		return errors.WithMessage(err, "select version")
+	}
+	for _, migration := range list {
+		if migration.Version <= version {
+			continue
+		}
+		if err := applyMigration(ctx, db, migration); err != nil {
+			return errors.WithMessagef(err, "migration %d_%s up", migration.Version, migration.Name)
+		}
+	}
+	return nil
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, migration migrate.Migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.WithMessage(err, "begin transaction")
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+		return errors.WithMessage(err, "exec script")
+	}
+	// pragmas take no parameters, the version is a number anyway
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`pragma user_version = %d`, migration.Version)); err != nil {
+		return errors.WithMessage(err, "set version")
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,144 @@
+package sqliterepo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+	"ws-chat/internal/domain"
+)
+
+const (
+	deleteMessagesBeforeQuery = `delete from messages where id in (
+		select id from messages where send_time < ? order by id limit ?)`
+	deleteExcessMessagesQuery = `delete from messages where id in (
+		select id from messages where room = ? order by id desc limit ? offset ?)`
+	exportMessagesQuery = `select id, room, author, text, send_time, attachments from messages
+		where room = ? and send_time >= ? and send_time < ? and id > ? order by id limit ?`
+	anonymizeMessagesQuery = `update messages set author = ? where id in (
+		select id from messages where author = ? order by id limit ?)`
+	deleteUserMessagesQuery = `delete from messages where id in (
+		select id from messages where author = ? order by id limit ?)`
+	deleteUserReadMarkersQuery = `delete from read_markers where username = ?`
+	deleteUserRoleQuery        = `delete from users where name = ?`
+	deleteUserSanctionsQuery   = `delete from sanctions where username = ?`
+	deleteUserKeyQuery         = `delete from public_keys where username = ?`
+	deleteUserDirectQuery      = `delete from direct_messages where sender = ?1 or recipient = ?1`
+	deleteUserAttachmentsQuery = `delete from attachments where owner = ? returning id`
+	// these take the user as ?1 and the alias as ?2
+	anonymizeIssuedSanctionsQuery = `update sanctions set issued_by = ?2 where issued_by = ?1`
+	anonymizeAuditActorQuery      = `update audit_log set actor = ?2 where actor = ?1`
+	anonymizeAuditTargetQuery     = `update audit_log set target = ?2 where target = ?1`
+	anonymizeSubscriptionsQuery   = `update webhook_subscriptions set created_by = ?2 where created_by = ?1`
+	anonymizeBotsQuery            = `update bots set created_by = ?2 where created_by = ?1`
+	deleteOrphanAttachmentsQuery  = `delete from attachments where id in (
+		select a.id from attachments a where a.created_at < ?
+			and not exists (select 1 from messages m, json_each(m.attachments) j where j.value = a.id)
+		order by a.created_at limit ?)
+		returning id`
+)
+
+func (r repo) DeleteMessagesBefore(ctx context.Context, before time.Time, limit int) (int, error) {
+	return r.execBatch(ctx, deleteMessagesBeforeQuery, before.UnixNano(), limit)
+}
+
+func (r repo) DeleteExcessMessages(ctx context.Context, room string, keep, limit int) (int, error) {
+	return r.execBatch(ctx, deleteExcessMessagesQuery, room, limit, keep)
+}
+
+func (r repo) ExportMessages(
+	ctx context.Context,
+	room string,
+	from, to time.Time,
+	afterID int64,
+	limit int,
+) ([]domain.Message, error) {
+	return r.queryMessages(ctx, exportMessagesQuery, room, from.UnixNano(), to.UnixNano(), afterID, limit)
+}
+
+func (r repo) AnonymizeMessages(ctx context.Context, author, alias string, limit int) (int, error) {
+	return r.execBatch(ctx, anonymizeMessagesQuery, alias, author, limit)
+}
+
+func (r repo) DeleteUserMessages(ctx context.Context, author string, limit int) (int, error) {
+	return r.execBatch(ctx, deleteUserMessagesQuery, author, limit)
+}
+
+func (r repo) DeleteUserData(ctx context.Context, user, alias string) ([]string, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.WithMessage(err, "begin transaction")
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	for _, query := range []string{
+		deleteUserReadMarkersQuery,
+		deleteUserRoleQuery,
+		deleteUserSanctionsQuery,
+		deleteUserKeyQuery,
+		deleteUserDirectQuery,
+	} {
+		if _, err := tx.ExecContext(ctx, query, user); err != nil {
+			return nil, errors.WithMessage(err, "delete user data")
+		}
+	}
+	for _, query := range []string{
+		anonymizeIssuedSanctionsQuery,
+		anonymizeAuditActorQuery,
+		anonymizeAuditTargetQuery,
+		anonymizeSubscriptionsQuery,
+		anonymizeBotsQuery,
+	} {
+		if _, err := tx.ExecContext(ctx, query, user, alias); err != nil {
+			return nil, errors.WithMessage(err, "anonymize user data")
+		}
+	}
+	rows, err := tx.QueryContext(ctx, deleteUserAttachmentsQuery, user)
+	if err != nil {
+		return nil, errors.WithMessage(err, "delete attachments")
+	}
+	ids, err := scanIDs(rows)
+	if err != nil {
+		return nil, err
+	}
+	return ids, tx.Commit()
+}
+
+func (r repo) DeleteOrphanAttachments(ctx context.Context, before time.Time, limit int) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, deleteOrphanAttachmentsQuery, before.UnixNano(), limit)
+	if err != nil {
+		return nil, errors.WithMessage(err, "delete orphan attachments")
+	}
+	return scanIDs(rows)
+}
+
+// scanIDs reads the IDs a returning clause yields and closes rows.
+func scanIDs(rows *sql.Rows) ([]string, error) {
+	ids := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			_ = rows.Close()
+			return nil, errors.WithMessage(err, "scan rows")
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, errors.WithMessage(err, "close rows")
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.WithMessage(err, "scan rows")
+	}
+	return ids, nil
+}
+
+func (r repo) execBatch(ctx context.Context, query string, args ...any) (int, error) {
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, errors.WithMessage(err, "update messages")
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,345 @@
+package sqliterepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	_ "modernc.org/sqlite"
+	"ws-chat/internal/domain"
+)
+
+const recentMessageCount = 10
+
+type repo struct {
+	db *sql.DB
+}
+
+func New(ctx context.Context, path string) (repo, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return repo{}, errors.WithMessage(err, "open sqlite")
+	}
+	// sqlite allows a single writer, and ":memory:" databases live in one connection
+	db.SetMaxOpenConns(1)
+	if err := upgradeRooms(ctx, db); err != nil {
+		_ = db.Close()
+		return repo{}, errors.WithMessage(err, "upgrade schema")
+	}
+	if err := migrateUp(ctx, db); err != nil {
+		_ = db.Close()
+		return repo{}, errors.WithMessage(err, "apply migrations")
+	}
+	return repo{db: db}, nil
+}
+
+func (r repo) Close() error {
+	return r.db.Close()
+}
+
+const upgradeRoomsQuery = `
+ALTER TABLE messages ADD COLUMN room TEXT NOT NULL DEFAULT 'general';
+ALTER TABLE read_markers RENAME TO read_markers_old;
+CREATE TABLE read_markers (
+    username TEXT NOT NULL,
+    room TEXT NOT NULL DEFAULT 'general',
+    last_read_id INTEGER NOT NULL,
+    PRIMARY KEY (username, room)
+);
+INSERT INTO read_markers (username, last_read_id) SELECT username, last_read_id FROM read_markers_old;
+DROP TABLE read_markers_old;`
+
+// upgradeRooms brings databases created before rooms existed to the current schema.
+func upgradeRooms(ctx context.Context, db *sql.DB) error {
+	var columns, roomColumns int
+	err := db.QueryRowContext(
+		ctx, `select count(*), count(*) filter (where name = 'room') from pragma_table_info('messages')`,
+	).Scan(&columns, &roomColumns)
+	if err != nil {
+		return errors.WithMessage(err, "inspect messages table")
+	}
+	if columns == 0 || roomColumns > 0 {
+		return nil
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.WithMessage(err, "begin transaction")
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	if _, err := tx.ExecContext(ctx, upgradeRoomsQuery); err != nil {
+		return errors.WithMessage(err, "add rooms")
+	}
+	return tx.Commit()
+}
+
+const (
+	saveMessageQuery = `insert into messages (room, author, text, send_time, attachments)
+		values (?, ?, ?, ?, ?) returning id`
+	getMessagesQuery = `select id, room, author, text, send_time, attachments from messages
+		where room = ? order by id desc limit ?`
+	getMessagesAfterQuery = `select id, room, author, text, send_time, attachments from messages
+		where room = ? and id > ? order by id limit ?`
+	getMessagesBeforeQuery = `select id, room, author, text, send_time, attachments from messages
+		where room = ? and id < ? order by id desc limit ?`
+	countMessagesAfterQuery = `select count(*) from messages where room = ? and id > ?`
+	listRoomsQuery          = `select room, count(*), max(send_time) from messages
+		group by room order by max(send_time) desc`
+	getLastReadQuery = `select last_read_id from read_markers where username = ? and room = ?`
+	setLastReadQuery = `insert into read_markers (username, room, last_read_id) values (?, ?, ?)
+		on conflict (username, room) do update set last_read_id = max(last_read_id, excluded.last_read_id)`
+	getRoleQuery = `select role from users where name = ?`
+	setRoleQuery = `insert into users (name, role) values (?, ?)
+		on conflict (name) do update set role = excluded.role`
+	addSanctionQuery = `insert into sanctions (username, kind, until, issued_by, created_at)
+		values (?, ?, ?, ?, ?)`
+	getActiveSanctionsQuery = `select username, kind, until, issued_by, created_at from sanctions
+		where username = ? and until > ? order by until desc`
+	saveAuditEntryQuery = `insert into audit_log (actor, action, target, details, created_at)
+		values (?, ?, ?, ?, ?)`
+	saveAttachmentQuery = `insert into attachments (id, owner, name, mime, size, created_at)
+		values (?, ?, ?, ?, ?, ?)`
+	getAttachmentsQuery = `select id, owner, name, mime, size, created_at from attachments
+		where id in (%s)`
+)
+
+func (r repo) SaveMessage(ctx context.Context, message domain.Message) (int64, error) {
+	attachments, err := json.Marshal(append([]string{}, message.Attachments...))
+	if err != nil {
+		return 0, errors.WithMessage(err, "marshal attachments")
+	}
+	var id int64
+	err = r.db.QueryRowContext(
+		ctx, saveMessageQuery,
+		message.Room, message.Author, message.Text, message.Time.UnixNano(), string(attachments),
+	).Scan(&id)
+	if err != nil {
+		return 0, errors.WithMessage(err, "insert message")
+	}
+	return id, nil
+}
+
+func (r repo) GetRecentMessages(ctx context.Context, room string) ([]domain.Message, error) {
+	messages, err := r.queryMessages(ctx, getMessagesQuery, room, recentMessageCount)
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(messages)
+	return messages, nil
+}
+
+func (r repo) GetMessagesAfter(
+	ctx context.Context,
+	room string,
+	afterID int64,
+	limit int,
+) ([]domain.Message, error) {
+	return r.queryMessages(ctx, getMessagesAfterQuery, room, afterID, limit)
+}
+
+func (r repo) GetMessagesBefore(
+	ctx context.Context,
+	room string,
+	beforeID int64,
+	limit int,
+) ([]domain.Message, error) {
+	messages, err := r.queryMessages(ctx, getMessagesBeforeQuery, room, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(messages)
+	return messages, nil
+}
+
+func (r repo) CountMessagesAfter(ctx context.Context, room string, afterID int64) (int, error) {
+	var count int
+	if err := r.db.QueryRowContext(ctx, countMessagesAfterQuery, room, afterID).Scan(&count); err != nil {
+		return 0, errors.WithMessage(err, "count messages")
+	}
+	return count, nil
+}
+
+func (r repo) ListRooms(ctx context.Context) ([]domain.Room, error) {
+	rooms := make([]domain.Room, 0)
+	rows, err := r.db.QueryContext(ctx, listRoomsQuery)
+	if err != nil {
+		return nil, errors.WithMessage(err, "select rooms")
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	for rows.Next() {
+		var (
+			room         domain.Room
+			lastActivity int64
+		)
+		if err := rows.Scan(&room.Name, &room.Messages, &lastActivity); err != nil {
+			return nil, errors.WithMessage(err, "scan rows")
+		}
+		room.LastActivity = fromUnixNano(lastActivity)
+		rooms = append(rooms, room)
+	}
+	return rooms, rows.Err()
+}
+
+func (r repo) GetLastRead(ctx context.Context, user, room string) (int64, bool, error) {
+	var id int64
+	err := r.db.QueryRowContext(ctx, getLastReadQuery, user, room).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, errors.WithMessage(err, "select read marker")
+	}
+	return id, true, nil
+}
+
+func (r repo) SetLastRead(ctx context.Context, user, room string, messageID int64) error {
+	if _, err := r.db.ExecContext(ctx, setLastReadQuery, user, room, messageID); err != nil {
+		return errors.WithMessage(err, "upsert read marker")
+	}
+	return nil
+}
+
+func (r repo) GetRole(ctx context.Context, user string) (domain.Role, error) {
+	var role domain.Role
+	err := r.db.QueryRowContext(ctx, getRoleQuery, user).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.RoleMember, nil
+	}
+	if err != nil {
+		return "", errors.WithMessage(err, "select role")
+	}
+	return role, nil
+}
+
+func (r repo) SetRole(ctx context.Context, user string, role domain.Role) error {
+	if _, err := r.db.ExecContext(ctx, setRoleQuery, user, role); err != nil {
+		return errors.WithMessage(err, "upsert role")
+	}
+	return nil
+}
+
+func (r repo) AddSanction(ctx context.Context, sanction domain.Sanction) error {
+	_, err := r.db.ExecContext(
+		ctx, addSanctionQuery,
+		sanction.User, sanction.Kind, sanction.Until.UnixNano(), sanction.IssuedBy, sanction.Time.UnixNano(),
+	)
+	if err != nil {
+		return errors.WithMessage(err, "insert sanction")
+	}
+	return nil
+}
+
+func (r repo) GetActiveSanctions(ctx context.Context, user string, at time.Time) ([]domain.Sanction, error) {
+	sanctions := make([]domain.Sanction, 0)
+	rows, err := r.db.QueryContext(ctx, getActiveSanctionsQuery, user, at.UnixNano())
+	if err != nil {
+		return nil, errors.WithMessage(err, "select sanctions")
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	for rows.Next() {
+		var (
+			s              domain.Sanction
+			until, created int64
+		)
+		if err := rows.Scan(&s.User, &s.Kind, &until, &s.IssuedBy, &created); err != nil {
+			return nil, errors.WithMessage(err, "scan rows")
+		}
+		s.Until, s.Time = fromUnixNano(until), fromUnixNano(created)
+		sanctions = append(sanctions, s)
+	}
+	return sanctions, rows.Err()
+}
+
+func (r repo) SaveAuditEntry(ctx context.Context, entry domain.AuditEntry) error {
+	_, err := r.db.ExecContext(
+		ctx, saveAuditEntryQuery,
+		entry.Actor, entry.Action, entry.Target, entry.Details, entry.Time.UnixNano(),
+	)
+	if err != nil {
+		return errors.WithMessage(err, "insert audit entry")
+	}
+	return nil
+}
+
+func (r repo) SaveAttachment(ctx context.Context, attachment domain.Attachment) error {
+	_, err := r.db.ExecContext(
+		ctx, saveAttachmentQuery,
+		attachment.ID, attachment.Owner, attachment.Name, attachment.MIME, attachment.Size,
+		attachment.Time.UnixNano(),
+	)
+	if err != nil {
+		return errors.WithMessage(err, "insert attachment")
+	}
+	return nil
+}
+
+func (r repo) GetAttachments(ctx context.Context, ids []string) ([]domain.Attachment, error) {
+	attachments := make([]domain.Attachment, 0, len(ids))
+	if len(ids) == 0 {
+		return attachments, nil
+	}
+	args := make([]any, 0, len(ids))
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	rows, err := r.db.QueryContext(ctx, strings.Replace(getAttachmentsQuery, "%s", placeholders, 1), args...)
+	if err != nil {
+		return nil, errors.WithMessage(err, "select attachments")
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	for rows.Next() {
+		var (
+			at      domain.Attachment
+			created int64
+		)
+		if err := rows.Scan(&at.ID, &at.Owner, &at.Name, &at.MIME, &at.Size, &created); err != nil {
+			return nil, errors.WithMessage(err, "scan rows")
+		}
+		at.Time = fromUnixNano(created)
+		attachments = append(attachments, at)
+	}
+	return attachments, rows.Err()
+}
+
+func (r repo) queryMessages(ctx context.Context, query string, args ...any) ([]domain.Message, error) {
+	messages := make([]domain.Message, 0)
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.WithMessage(err, "select messages")
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	for rows.Next() {
+		var (
+			msg         domain.Message
+			sendTime    int64
+			attachments string
+		)
+		if err := rows.Scan(&msg.ID, &msg.Room, &msg.Author, &msg.Text, &sendTime, &attachments); err != nil {
+			return nil, errors.WithMessage(err, "scan rows")
+		}
+		if err := json.Unmarshal([]byte(attachments), &msg.Attachments); err != nil {
+			return nil, errors.WithMessage(err, "unmarshal attachments")
+		}
+		msg.Time = fromUnixNano(sendTime)
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+func fromUnixNano(n int64) time.Time {
+	return time.Unix(0, n)
+}
@@ -0,0 +1,39 @@
+package sqliterepo_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"ws-chat/internal/adapters/repotest"
+	"ws-chat/internal/adapters/sqliterepo"
+)
+
+func TestRepo(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repotest.Repo {
+		repo, err := sqliterepo.New(context.Background(), filepath.Join(t.TempDir(), "chat.db"))
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = repo.Close()
+		})
+		return repo
+	})
+}
+
+func TestMigrationsRecordVersion(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "chat.db")
+	for range 2 {
+		repo, err := sqliterepo.New(ctx, path)
+		require.NoError(t, err)
+		require.NoError(t, repo.Close())
+	}
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	defer db.Close()
+	var version int
+	require.NoError(t, db.QueryRowContext(ctx, `pragma user_version`).Scan(&version))
+	require.Equal(t, 1, version)
+}
@@ -0,0 +1,262 @@
+package sqliterepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"ws-chat/internal/domain"
+)
+
+const (
+	saveSubscriptionQuery = `insert into webhook_subscriptions (id, room, url, events, secret, created_by, created_at)
+		values (?, ?, ?, ?, ?, ?, ?)`
+	deleteSubscriptionQuery    = `delete from webhook_subscriptions where id = ?`
+	deleteSubscriptionOutQuery = `delete from webhook_deliveries where subscription_id = ?`
+	listSubscriptionsQuery     = `select id, room, url, events, secret, created_by, created_at
+		from webhook_subscriptions where room = ? order by created_at`
+	enqueueDeliveryQuery = `insert into webhook_deliveries (subscription_id, event, payload, next_attempt_at, created_at)
+		values (?, ?, ?, ?, ?)`
+	dueDeliveriesQuery = `select d.id, d.subscription_id, s.url, s.secret, d.event, d.payload,
+			d.attempts, d.next_attempt_at, d.last_error, d.created_at
+		from webhook_deliveries d join webhook_subscriptions s on s.id = d.subscription_id
+		where d.failed_at is null and d.next_attempt_at <= ?
+		order by d.next_attempt_at limit ?`
+	leaseDeliveryQuery    = `update webhook_deliveries set next_attempt_at = ? where id = ?`
+	completeDeliveryQuery = `delete from webhook_deliveries where id = ?`
+	retryDeliveryQuery    = `update webhook_deliveries
+		set attempts = attempts + 1, next_attempt_at = ?, last_error = ? where id = ?`
+	failDeliveryQuery = `update webhook_deliveries
+		set attempts = attempts + 1, failed_at = ?, last_error = ? where id = ?`
+	saveBotQuery = `insert into bots (name, url, token, created_by, created_at) values (?, ?, ?, ?, ?)
+		on conflict (name) do update set url = excluded.url, token = excluded.token,
+		created_by = excluded.created_by, created_at = excluded.created_at`
+	deleteBotQuery     = `delete from bots where name = ?`
+	getBotQuery        = `select name, url, token, created_by, created_at from bots where name = ?`
+	getBotByTokenQuery = `select name, url, token, created_by, created_at from bots where token = ?`
+	listBotsQuery      = `select name, url, token, created_by, created_at from bots order by name`
+)
+
+func (r repo) SaveSubscription(ctx context.Context, s domain.Subscription) error {
+	events, err := json.Marshal(append([]domain.EventType{}, s.Events...))
+	if err != nil {
+		return errors.WithMessage(err, "marshal events")
+	}
+	_, err = r.db.ExecContext(
+		ctx, saveSubscriptionQuery,
+		s.ID, s.Room, s.URL, string(events), s.Secret, s.CreatedBy, s.Time.UnixNano(),
+	)
+	if err != nil {
+		return errors.WithMessage(err, "insert subscription")
+	}
+	return nil
+}
+
+func (r repo) DeleteSubscription(ctx context.Context, id string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.WithMessage(err, "begin transaction")
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	result, err := tx.ExecContext(ctx, deleteSubscriptionQuery, id)
+	if err != nil {
+		return errors.WithMessage(err, "delete subscription")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return domain.ErrNotFound
+	}
+	if _, err := tx.ExecContext(ctx, deleteSubscriptionOutQuery, id); err != nil {
+		return errors.WithMessage(err, "delete deliveries")
+	}
+	return tx.Commit()
+}
+
+func (r repo) ListSubscriptions(ctx context.Context, room string) ([]domain.Subscription, error) {
+	subscriptions := make([]domain.Subscription, 0)
+	rows, err := r.db.QueryContext(ctx, listSubscriptionsQuery, room)
+	if err != nil {
+		return nil, errors.WithMessage(err, "select subscriptions")
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	for rows.Next() {
+		var (
+			s       domain.Subscription
+			events  string
+			created int64
+		)
+		if err := rows.Scan(&s.ID, &s.Room, &s.URL, &events, &s.Secret, &s.CreatedBy, &created); err != nil {
+			return nil, errors.WithMessage(err, "scan rows")
+		}
+		if err := json.Unmarshal([]byte(events), &s.Events); err != nil {
+			return nil, errors.WithMessage(err, "unmarshal events")
+		}
+		s.Time = fromUnixNano(created)
+		subscriptions = append(subscriptions, s)
+	}
+	return subscriptions, rows.Err()
+}
+
+func (r repo) EnqueueDeliveries(ctx context.Context, deliveries []domain.Delivery) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.WithMessage(err, "begin transaction")
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	for _, d := range deliveries {
+		_, err := tx.ExecContext(
+			ctx, enqueueDeliveryQuery,
+			d.SubscriptionID, d.Event, d.Payload, d.NextAttempt.UnixNano(), d.Time.UnixNano(),
+		)
+		if err != nil {
+			return errors.WithMessage(err, "insert delivery")
+		}
+	}
+	return tx.Commit()
+}
+
+func (r repo) ClaimDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]domain.Delivery, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.WithMessage(err, "begin transaction")
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	deliveries, err := scanDeliveries(tx.QueryContext(ctx, dueDeliveriesQuery, now.UnixNano(), limit))
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range deliveries {
+		if _, err := tx.ExecContext(ctx, leaseDeliveryQuery, leaseUntil.UnixNano(), d.ID); err != nil {
+			return nil, errors.WithMessage(err, "lease delivery")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, errors.WithMessage(err, "commit transaction")
+	}
+	return deliveries, nil
+}
+
+func scanDeliveries(rows *sql.Rows, err error) ([]domain.Delivery, error) {
+	if err != nil {
+		return nil, errors.WithMessage(err, "select deliveries")
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	deliveries := make([]domain.Delivery, 0)
+	for rows.Next() {
+		var (
+			d                    domain.Delivery
+			nextAttempt, created int64
+		)
+		err := rows.Scan(
+			&d.ID, &d.SubscriptionID, &d.URL, &d.Secret, &d.Event, &d.Payload,
+			&d.Attempts, &nextAttempt, &d.LastError, &created,
+		)
+		if err != nil {
+			return nil, errors.WithMessage(err, "scan rows")
+		}
+		d.NextAttempt, d.Time = fromUnixNano(nextAttempt), fromUnixNano(created)
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (r repo) CompleteDelivery(ctx context.Context, id int64) error {
+	if _, err := r.db.ExecContext(ctx, completeDeliveryQuery, id); err != nil {
+		return errors.WithMessage(err, "delete delivery")
+	}
+	return nil
+}
+
+func (r repo) RetryDelivery(ctx context.Context, id int64, next time.Time, lastErr string) error {
+	if _, err := r.db.ExecContext(ctx, retryDeliveryQuery, next.UnixNano(), lastErr, id); err != nil {
+		return errors.WithMessage(err, "reschedule delivery")
+	}
+	return nil
+}
+
+func (r repo) FailDelivery(ctx context.Context, id int64, lastErr string) error {
+	if _, err := r.db.ExecContext(ctx, failDeliveryQuery, time.Now().UnixNano(), lastErr, id); err != nil {
+		return errors.WithMessage(err, "fail delivery")
+	}
+	return nil
+}
+
+func (r repo) SaveBot(ctx context.Context, bot domain.Bot) error {
+	_, err := r.db.ExecContext(
+		ctx, saveBotQuery,
+		bot.Name, bot.URL, bot.Token, bot.CreatedBy, bot.Time.UnixNano(),
+	)
+	if err != nil {
+		return errors.WithMessage(err, "upsert bot")
+	}
+	return nil
+}
+
+func (r repo) DeleteBot(ctx context.Context, name string) error {
+	result, err := r.db.ExecContext(ctx, deleteBotQuery, name)
+	if err != nil {
+		return errors.WithMessage(err, "delete bot")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r repo) GetBot(ctx context.Context, name string) (domain.Bot, error) {
+	return r.getBot(ctx, getBotQuery, name)
+}
+
+func (r repo) GetBotByToken(ctx context.Context, token string) (domain.Bot, error) {
+	return r.getBot(ctx, getBotByTokenQuery, token)
+}
+
+func (r repo) getBot(ctx context.Context, query string, arg string) (domain.Bot, error) {
+	var (
+		bot     domain.Bot
+		created int64
+	)
+	err := r.db.QueryRowContext(ctx, query, arg).Scan(&bot.Name, &bot.URL, &bot.Token, &bot.CreatedBy, &created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Bot{}, domain.ErrNotFound
+	}
+	if err != nil {
+		return domain.Bot{}, errors.WithMessage(err, "select bot")
+	}
+	bot.Time = fromUnixNano(created)
+	return bot, nil
+}
+
+func (r repo) ListBots(ctx context.Context) ([]domain.Bot, error) {
+	bots := make([]domain.Bot, 0)
+	rows, err := r.db.QueryContext(ctx, listBotsQuery)
+	if err != nil {
+		return nil, errors.WithMessage(err, "select bots")
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	for rows.Next() {
+		var (
+			bot     domain.Bot
+			created int64
+		)
+		if err := rows.Scan(&bot.Name, &bot.URL, &bot.Token, &bot.CreatedBy, &created); err != nil {
+			return nil, errors.WithMessage(err, "scan rows")
+		}
+		bot.Time = fromUnixNano(created)
+		bots = append(bots, bot)
+	}
+	return bots, rows.Err()
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"ws-chat/internal/adapters"
+	"ws-chat/internal/adapters/memrepo"
+	"ws-chat/internal/adapters/pgrepo"
+	"ws-chat/internal/adapters/sqliterepo"
+	"ws-chat/internal/domain"
+	"ws-chat/internal/migrate"
+)
+
+type Driver string
+
+const (
+	DriverPostgres Driver = "postgres"
+	DriverSQLite   Driver = "sqlite"
+	DriverMemory   Driver = "memory"
+)
+
+type Config struct {
+	Driver         Driver
+	SQLitePath     string
+	MigrateOnStart bool
+	// QueryTracer instruments Postgres queries; other drivers ignore it.
+	QueryTracer pgx.QueryTracer
+}
+
+type Storage struct {
+	Messages    domain.Repository
+	Moderation  domain.ModerationRepository
+	Attachments domain.AttachmentRepository
+	Webhooks    domain.WebhookRepository
+	Direct      domain.DirectRepository
+	Retention   domain.RetentionRepository
+	Close       func()
+}
+
+func New(ctx context.Context, cfg Config, logger *zap.Logger) (Storage, error) {
+	switch cfg.Driver {
+	case DriverPostgres:
+		pool, err := pgrepo.NewConnectionPool(ctx, cfg.QueryTracer)
+		if err != nil {
+			return Storage{}, err
+		}
+		if cfg.MigrateOnStart {
+			if err := migrateUp(ctx, pool, logger); err != nil {
+				pool.Close()
+				return Storage{}, err
+			}
+		}
+		messages := adapters.NewMessageRepo(pool)
+		return Storage{
+			Messages:    messages,
+			Moderation:  adapters.NewModerationRepo(pool),
+			Attachments: adapters.NewAttachmentRepo(pool),
+			Webhooks:    adapters.NewWebhookRepo(pool),
+			Direct:      adapters.NewDirectRepo(pool),
+			Retention:   messages,
+			Close:       pool.Close,
+		}, nil
+	case DriverSQLite:
+		repo, err := sqliterepo.New(ctx, cfg.SQLitePath)
+		if err != nil {
+			return Storage{}, err
+		}
+		return Storage{
+			Messages:    repo,
+			Moderation:  repo,
+			Attachments: repo,
+			Webhooks:    repo,
+			Direct:      repo,
+			Retention:   repo,
+			Close: func() {
+				_ = repo.Close()
+			},
+		}, nil
+	case DriverMemory:
+		repo := memrepo.New()
+		return Storage{
+			Messages:    repo,
+			Moderation:  repo,
+			Attachments: repo,
+			Webhooks:    repo,
+			Direct:      repo,
+			Retention:   repo,
+			Close:       func() {},
+		}, nil
+	default:
+		return Storage{}, errors.Errorf("unknown storage driver '%s'", cfg.Driver)
+	}
+}
+
+func migrateUp(ctx context.Context, pool *pgxpool.Pool, logger *zap.Logger) error {
+	migrator, err := migrate.New(pool, pgrepo.Migrations(), migrate.DefaultTable, logger)
+	if err != nil {
+		return errors.WithMessage(err, "load migrations")
+	}
+	if err := migrator.Up(ctx); err != nil {
+		return errors.WithMessage(err, "apply migrations")
+	}
+	return nil
+}
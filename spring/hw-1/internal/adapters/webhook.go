@@ -0,0 +1,219 @@
+package adapters
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+	"ws-chat/internal/domain"
+)
+
+type webhookRepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewWebhookRepo(pool *pgxpool.Pool) webhookRepo {
+	return webhookRepo{
+		pool: pool,
+	}
+}
+
+const (
+	saveSubscriptionQuery = `insert into webhook_subscriptions (id, room, url, events, secret, created_by, created_at)
+		values ($1, $2, $3, $4, $5, $6, $7)`
+	deleteSubscriptionQuery = `delete from webhook_subscriptions where id = $1`
+	listSubscriptionsQuery  = `select id, room, url, events, secret, created_by, created_at
+		from webhook_subscriptions where room = $1 order by created_at`
+	enqueueDeliveryQuery = `insert into webhook_deliveries (subscription_id, event, payload, next_attempt_at, created_at)
+		values ($1, $2, $3, $4, $5)`
+	claimDeliveriesQuery = `update webhook_deliveries d set next_attempt_at = $2
+		from webhook_subscriptions s
+		where s.id = d.subscription_id and d.id in (
+			select id from webhook_deliveries
+			where failed_at is null and next_attempt_at <= $1
+			order by next_attempt_at limit $3
+			for update skip locked
+		)
+		returning d.id, d.subscription_id, s.url, s.secret, d.event, d.payload,
+			d.attempts, d.next_attempt_at, d.last_error, d.created_at`
+	completeDeliveryQuery = `delete from webhook_deliveries where id = $1`
+	retryDeliveryQuery    = `update webhook_deliveries
+		set attempts = attempts + 1, next_attempt_at = $2, last_error = $3 where id = $1`
+	failDeliveryQuery = `update webhook_deliveries
+		set attempts = attempts + 1, failed_at = $2, last_error = $3 where id = $1`
+	saveBotQuery = `insert into bots (name, url, token, created_by, created_at) values ($1, $2, $3, $4, $5)
+		on conflict (name) do update set url = excluded.url, token = excluded.token,
+		created_by = excluded.created_by, created_at = excluded.created_at`
+	deleteBotQuery     = `delete from bots where name = $1`
+	getBotQuery        = `select name, url, token, created_by, created_at from bots where name = $1`
+	getBotByTokenQuery = `select name, url, token, created_by, created_at from bots where token = $1`
+	listBotsQuery      = `select name, url, token, created_by, created_at from bots order by name`
+)
+
+func (w webhookRepo) SaveSubscription(ctx context.Context, s domain.Subscription) error {
+	_, err := w.pool.Exec(
+		ctx, saveSubscriptionQuery,
+		s.ID, s.Room, s.URL, eventNames(s.Events), s.Secret, s.CreatedBy, s.Time,
+	)
+	if err != nil {
+		return errors.WithMessage(err, "insert subscription")
+	}
+	return nil
+}
+
+func (w webhookRepo) DeleteSubscription(ctx context.Context, id string) error {
+	tag, err := w.pool.Exec(ctx, deleteSubscriptionQuery, id)
+	if err != nil {
+		return errors.WithMessage(err, "delete subscription")
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (w webhookRepo) ListSubscriptions(ctx context.Context, room string) ([]domain.Subscription, error) {
+	subscriptions := make([]domain.Subscription, 0)
+	rows, err := w.pool.Query(ctx, listSubscriptionsQuery, room)
+	if err != nil {
+		return nil, errors.WithMessage(err, "select subscriptions")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			s      domain.Subscription
+			events []string
+		)
+		if err := rows.Scan(&s.ID, &s.Room, &s.URL, &events, &s.Secret, &s.CreatedBy, &s.Time); err != nil {
+			return nil, errors.WithMessage(err, "scan rows")
+		}
+		for _, event := range events {
+			s.Events = append(s.Events, domain.EventType(event))
+		}
+		subscriptions = append(subscriptions, s)
+	}
+	return subscriptions, rows.Err()
+}
+
+func (w webhookRepo) EnqueueDeliveries(ctx context.Context, deliveries []domain.Delivery) error {
+	batch := &pgx.Batch{}
+	for _, d := range deliveries {
+		batch.Queue(enqueueDeliveryQuery, d.SubscriptionID, d.Event, d.Payload, d.NextAttempt, d.Time)
+	}
+	if err := w.pool.SendBatch(ctx, batch).Close(); err != nil {
+		return errors.WithMessage(err, "insert deliveries")
+	}
+	return nil
+}
+
+func (w webhookRepo) ClaimDeliveries(
+	ctx context.Context,
+	now, leaseUntil time.Time,
+	limit int,
+) ([]domain.Delivery, error) {
+	deliveries := make([]domain.Delivery, 0)
+	rows, err := w.pool.Query(ctx, claimDeliveriesQuery, now, leaseUntil, limit)
+	if err != nil {
+		return nil, errors.WithMessage(err, "claim deliveries")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d domain.Delivery
+		err := rows.Scan(
+			&d.ID, &d.SubscriptionID, &d.URL, &d.Secret, &d.Event, &d.Payload,
+			&d.Attempts, &d.NextAttempt, &d.LastError, &d.Time,
+		)
+		if err != nil {
+			return nil, errors.WithMessage(err, "scan rows")
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (w webhookRepo) CompleteDelivery(ctx context.Context, id int64) error {
+	if _, err := w.pool.Exec(ctx, completeDeliveryQuery, id); err != nil {
+		return errors.WithMessage(err, "delete delivery")
+	}
+	return nil
+}
+
+func (w webhookRepo) RetryDelivery(ctx context.Context, id int64, next time.Time, lastErr string) error {
+	if _, err := w.pool.Exec(ctx, retryDeliveryQuery, id, next, lastErr); err != nil {
+		return errors.WithMessage(err, "reschedule delivery")
+	}
+	return nil
+}
+
+func (w webhookRepo) FailDelivery(ctx context.Context, id int64, lastErr string) error {
+	if _, err := w.pool.Exec(ctx, failDeliveryQuery, id, time.Now(), lastErr); err != nil {
+		return errors.WithMessage(err, "fail delivery")
+	}
+	return nil
+}
+
+func (w webhookRepo) SaveBot(ctx context.Context, bot domain.Bot) error {
+	_, err := w.pool.Exec(ctx, saveBotQuery, bot.Name, bot.URL, bot.Token, bot.CreatedBy, bot.Time)
+	if err != nil {
+		return errors.WithMessage(err, "upsert bot")
+	}
+	return nil
+}
+
+func (w webhookRepo) DeleteBot(ctx context.Context, name string) error {
+	tag, err := w.pool.Exec(ctx, deleteBotQuery, name)
+	if err != nil {
+		return errors.WithMessage(err, "delete bot")
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (w webhookRepo) GetBot(ctx context.Context, name string) (domain.Bot, error) {
+	return w.getBot(ctx, getBotQuery, name)
+}
+
+func (w webhookRepo) GetBotByToken(ctx context.Context, token string) (domain.Bot, error) {
+	return w.getBot(ctx, getBotByTokenQuery, token)
+}
+
+func (w webhookRepo) getBot(ctx context.Context, query string, arg string) (domain.Bot, error) {
+	var bot domain.Bot
+	err := w.pool.QueryRow(ctx, query, arg).Scan(&bot.Name, &bot.URL, &bot.Token, &bot.CreatedBy, &bot.Time)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.Bot{}, domain.ErrNotFound
+	}
+	if err != nil {
+		return domain.Bot{}, errors.WithMessage(err, "select bot")
+	}
+	return bot, nil
+}
+
+func (w webhookRepo) ListBots(ctx context.Context) ([]domain.Bot, error) {
+	bots := make([]domain.Bot, 0)
+	rows, err := w.pool.Query(ctx, listBotsQuery)
+	if err != nil {
+		return nil, errors.WithMessage(err, "select bots")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var bot domain.Bot
+		if err := rows.Scan(&bot.Name, &bot.URL, &bot.Token, &bot.CreatedBy, &bot.Time); err != nil {
+			return nil, errors.WithMessage(err, "scan rows")
+		}
+		bots = append(bots, bot)
+	}
+	return bots, rows.Err()
+}
+
+func eventNames(events []domain.EventType) []string {
+	names := make([]string, 0, len(events))
+	for _, event := range events {
+		names = append(names, string(event))
+	}
+	return names
+}
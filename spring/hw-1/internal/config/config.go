@@ -0,0 +1,109 @@
+package config
+
+import (
+	"time"
+
+	"github.com/ilyakaznacheev/cleanenv"
+	"github.com/pkg/errors"
+)
+
+type Config struct {
+	ServerAddr      string        `env:"SERVER_ADDR" env-default:"localhost:8000"`
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" env-default:"10s"`
+	StorageDriver   string        `env:"STORAGE_DRIVER" env-default:"postgres"`
+	SQLitePath      string        `env:"SQLITE_PATH" env-default:"chat.db"`
+	MigrateOnStart  bool          `env:"MIGRATE_ON_START" env-default:"false"`
+	AdminUsers      []string      `env:"ADMIN_USERS" env-separator:","`
+	AuthSecret      string        `env:"AUTH_SECRET"`
+	AllowedOrigins  []string      `env:"ALLOWED_ORIGINS" env-separator:","`
+	Filter          FilterConfig
+	Limits          LimitsConfig
+	Attachments     AttachmentsConfig
+	Webhooks        WebhooksConfig
+	Retention       RetentionConfig
+}
+
+type FilterConfig struct {
+	Action   string   `env:"FILTER_ACTION" env-default:"mask"`
+	Words    []string `env:"FILTER_WORDS" env-separator:","`
+	Patterns []string `env:"FILTER_PATTERNS" env-separator:";"`
+}
+
+type LimitsConfig struct {
+	MaxMessageSize    int64         `env:"MAX_MESSAGE_SIZE" env-default:"4096"`
+	MessagesPerSecond float64       `env:"RATE_LIMIT_PER_SECOND" env-default:"1"`
+	Burst             int           `env:"RATE_LIMIT_BURST" env-default:"5"`
+	MaxViolations     int           `env:"RATE_LIMIT_MAX_VIOLATIONS" env-default:"3"`
+	ViolationWindow   time.Duration `env:"RATE_LIMIT_VIOLATION_WINDOW" env-default:"1m"`
+	MuteDuration      time.Duration `env:"RATE_LIMIT_MUTE_DURATION" env-default:"5m"`
+}
+
+type AttachmentsConfig struct {
+	Dir          string        `env:"ATTACHMENT_DIR" env-default:"./attachments"`
+	MaxSize      int64         `env:"ATTACHMENT_MAX_SIZE" env-default:"10485760"`
+	AllowedTypes []string      `env:"ATTACHMENT_ALLOWED_TYPES" env-separator:"," env-default:"image/png,image/jpeg,image/gif,image/webp,application/pdf,text/plain"`
+	Secret       string        `env:"ATTACHMENT_SECRET" env-required:"true"`
+	LinkTTL      time.Duration `env:"ATTACHMENT_LINK_TTL" env-default:"24h"`
+}
+
+type WebhooksConfig struct {
+	MaxAttempts  int           `env:"WEBHOOK_MAX_ATTEMPTS" env-default:"10"`
+	MinBackoff   time.Duration `env:"WEBHOOK_MIN_BACKOFF" env-default:"5s"`
+	MaxBackoff   time.Duration `env:"WEBHOOK_MAX_BACKOFF" env-default:"1h"`
+	PollInterval time.Duration `env:"WEBHOOK_POLL_INTERVAL" env-default:"5s"`
+	Timeout      time.Duration `env:"WEBHOOK_TIMEOUT" env-default:"10s"`
+	BatchSize    int           `env:"WEBHOOK_BATCH_SIZE" env-default:"20"`
+}
+
+type RetentionConfig struct {
+	MaxAge             time.Duration `env:"RETENTION_MAX_AGE" env-default:"0"`
+	MaxMessagesPerRoom int           `env:"RETENTION_MAX_MESSAGES_PER_ROOM" env-default:"0"`
+	Interval           time.Duration `env:"RETENTION_INTERVAL" env-default:"1h"`
+	BatchSize          int           `env:"RETENTION_BATCH_SIZE" env-default:"1000"`
+	ForgetMode         string        `env:"FORGET_MODE" env-default:"anonymize"`
+}
+
+func New() (*Config, error) {
+	cfg := new(Config)
+	if err := cleanenv.ReadEnv(cfg); err != nil {
+		return nil, errors.WithMessage(err, "read env")
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, errors.WithMessage(err, "validate config")
+	}
+	return cfg, nil
+}
+
+func (c *Config) validate() error {
+	// without a secret nobody can authenticate, so the admins couldn't use their role
+	if len(c.AdminUsers) > 0 && c.AuthSecret == "" {
+		return errors.New("ADMIN_USERS requires AUTH_SECRET")
+	}
+	// the retention job ticks every interval and pages by the batch size; zero would panic or loop forever
+	if c.Retention.Interval <= 0 {
+		return errors.New("RETENTION_INTERVAL must be positive")
+	}
+	if c.Retention.BatchSize <= 0 {
+		return errors.New("RETENTION_BATCH_SIZE must be positive")
+	}
+	// the webhook worker polls, waits and pages by these; zero or less would spin, give up at once or panic
+	if c.Webhooks.MaxAttempts <= 0 {
+		return errors.New("WEBHOOK_MAX_ATTEMPTS must be positive")
+	}
+	if c.Webhooks.MinBackoff <= 0 {
+		return errors.New("WEBHOOK_MIN_BACKOFF must be positive")
+	}
+	if c.Webhooks.MaxBackoff < c.Webhooks.MinBackoff {
+		return errors.New("WEBHOOK_MAX_BACKOFF must not be less than WEBHOOK_MIN_BACKOFF")
+	}
+	if c.Webhooks.PollInterval <= 0 {
+		return errors.New("WEBHOOK_POLL_INTERVAL must be positive")
+	}
+	if c.Webhooks.Timeout <= 0 {
+		return errors.New("WEBHOOK_TIMEOUT must be positive")
+	}
+	if c.Webhooks.BatchSize <= 0 {
+		return errors.New("WEBHOOK_BATCH_SIZE must be positive")
+	}
+	return nil
+}
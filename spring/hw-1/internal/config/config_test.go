@@ -0,0 +1,52 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRejectsRetention(t *testing.T) {
+	for name, env := range map[string][2]string{
+		"zero batch":        {"RETENTION_BATCH_SIZE", "0"},
+		"negative batch":    {"RETENTION_BATCH_SIZE", "-1"},
+		"zero interval":     {"RETENTION_INTERVAL", "0s"},
+		"negative interval": {"RETENTION_INTERVAL", "-1m"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("ATTACHMENT_SECRET", "secret")
+			t.Setenv(env[0], env[1])
+			_, err := New()
+			require.ErrorContains(t, err, env[0])
+		})
+	}
+}
+
+func TestNewRejectsWebhooks(t *testing.T) {
+	for name, env := range map[string][2]string{
+		"zero attempts":         {"WEBHOOK_MAX_ATTEMPTS", "0"},
+		"negative min backoff":  {"WEBHOOK_MIN_BACKOFF", "-1s"},
+		"max backoff below min": {"WEBHOOK_MAX_BACKOFF", "1s"},
+		"zero poll interval":    {"WEBHOOK_POLL_INTERVAL", "0s"},
+		"negative timeout":      {"WEBHOOK_TIMEOUT", "-10s"},
+		"zero batch":            {"WEBHOOK_BATCH_SIZE", "0"},
+		"negative batch":        {"WEBHOOK_BATCH_SIZE", "-1"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("ATTACHMENT_SECRET", "secret")
+			t.Setenv(env[0], env[1])
+			_, err := New()
+			require.ErrorContains(t, err, env[0])
+		})
+	}
+}
+
+func TestNewDefaults(t *testing.T) {
+	t.Setenv("ATTACHMENT_SECRET", "secret")
+	cfg, err := New()
+	require.NoError(t, err)
+	require.Positive(t, cfg.Retention.Interval)
+	require.Positive(t, cfg.Retention.BatchSize)
+	require.Positive(t, cfg.Webhooks.MaxAttempts)
+	require.GreaterOrEqual(t, cfg.Webhooks.MaxBackoff, cfg.Webhooks.MinBackoff)
+}
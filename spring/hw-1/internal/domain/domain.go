@@ -2,25 +2,358 @@ package domain
 
 import (
 	"context"
+	"io"
+	"regexp"
 	"time"
 )
 
+const DefaultRoom = "general"
+
+var nameRegex = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+func ValidRoomName(name string) bool {
+	return nameRegex.MatchString(name)
+}
+
+func ValidBotName(name string) bool {
+	return nameRegex.MatchString(name)
+}
+
+type Room struct {
+	Name         string
+	Messages     int
+	LastActivity time.Time
+}
+
 type Message struct {
-	Author string
-	Text   string
-	Time   time.Time
+	ID          int64
+	Room        string
+	Author      string
+	Text        string
+	Time        time.Time
+	Attachments []string
+}
+
+// Sizes of the NaCl box primitives clients use for direct messages.
+const (
+	PublicKeySize = 32
+	NonceSize     = 24
+)
+
+type PublicKey struct {
+	User string
+	Key  []byte
+	Time time.Time
+}
+
+// DirectMessage is encrypted by the sender for the recipient; the server only sees the ciphertext.
+// SenderKey is the public key the sender had when the message was sent, so it can still be opened after a rotation.
+type DirectMessage struct {
+	ID         int64
+	From       string
+	To         string
+	SenderKey  []byte
+	Nonce      []byte
+	Ciphertext []byte
+	Time       time.Time
+}
+
+type Attachment struct {
+	ID    string
+	Owner string
+	Name  string
+	MIME  string
+	Size  int64
+	Time  time.Time
+}
+
+type FrameType string
+
+const (
+	FrameMessage   FrameType = "message"
+	FrameNotice    FrameType = "notice"
+	FrameError     FrameType = "error"
+	FrameAck       FrameType = "ack"
+	FrameUnread    FrameType = "unread"
+	FrameSeparator FrameType = "separator"
+	FrameHistory   FrameType = "history"
+	FrameRooms     FrameType = "rooms"
+	FrameKey       FrameType = "key"
+	FrameDirect    FrameType = "direct"
+	// FrameAuth is the first frame of a browser, which can't set headers on a handshake.
+	FrameAuth FrameType = "auth"
+)
+
+const (
+	CodeBanned       = "banned"
+	CodeMuted        = "muted"
+	CodeRejected     = "rejected"
+	CodeRateLimited  = "rate_limited"
+	CodeCommand      = "command"
+	CodeBadFrame     = "bad_frame"
+	CodeShuttingDown = "shutting_down"
+	CodeAttachment   = "attachment"
+	CodeInvalidRoom  = "invalid_room"
+	CodeNoKey        = "no_key"
+	CodeTooLarge     = "too_large"
+	CodeUnauthorized = "unauthorized"
+)
+
+type Frame struct {
+	Type        FrameType         `json:"type"`
+	ID          int64             `json:"id,omitempty"`
+	Room        string            `json:"room,omitempty"`
+	Author      string            `json:"author,omitempty"`
+	Text        string            `json:"text,omitempty"`
+	Time        time.Time         `json:"time"`
+	Code        string            `json:"code,omitempty"`
+	Count       int               `json:"count,omitempty"`
+	Attachments []FrameAttachment `json:"attachments,omitempty"`
+	Messages    []Frame           `json:"messages,omitempty"`
+	Rooms       []FrameRoom       `json:"rooms,omitempty"`
+	To          string            `json:"to,omitempty"`
+	Key         []byte            `json:"key,omitempty"`
+	Nonce       []byte            `json:"nonce,omitempty"`
+	Ciphertext  []byte            `json:"ciphertext,omitempty"`
+	Token       string            `json:"token,omitempty"`
+}
+
+type FrameRoom struct {
+	Name         string    `json:"name"`
+	Messages     int       `json:"messages"`
+	Online       int       `json:"online"`
+	LastActivity time.Time `json:"last_activity"`
+}
+
+type FrameAttachment struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	MIME string `json:"mime,omitempty"`
+	Size int64  `json:"size,omitempty"`
+	URL  string `json:"url,omitempty"`
+}
+
+type Role string
+
+const (
+	RoleMember    Role = "member"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+func (r Role) Rank() int {
+	switch r {
+	case RoleAdmin:
+		return 2
+	case RoleModerator:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (r Role) Valid() bool {
+	return r == RoleMember || r == RoleModerator || r == RoleAdmin
+}
+
+type SanctionKind string
+
+const (
+	SanctionMute SanctionKind = "mute"
+	SanctionBan  SanctionKind = "ban"
+)
+
+type Sanction struct {
+	User     string
+	Kind     SanctionKind
+	Until    time.Time
+	IssuedBy string
+	Time     time.Time
+}
+
+type AuditEntry struct {
+	Actor   string
+	Action  string
+	Target  string
+	Details string
+	Time    time.Time
 }
 
 type Repository interface {
-	SaveMessage(ctx context.Context, message Message) error
-	GetRecentMessages(ctx context.Context) ([]Message, error)
+	SaveMessage(ctx context.Context, message Message) (int64, error)
+	GetRecentMessages(ctx context.Context, room string) ([]Message, error)
+	GetMessagesAfter(ctx context.Context, room string, afterID int64, limit int) ([]Message, error)
+	GetMessagesBefore(ctx context.Context, room string, beforeID int64, limit int) ([]Message, error)
+	CountMessagesAfter(ctx context.Context, room string, afterID int64) (int, error)
+	ListRooms(ctx context.Context) ([]Room, error)
+	GetLastRead(ctx context.Context, user, room string) (int64, bool, error)
+	SetLastRead(ctx context.Context, user, room string, messageID int64) error
+}
+
+type ModerationRepository interface {
+	GetRole(ctx context.Context, user string) (Role, error)
+	SetRole(ctx context.Context, user string, role Role) error
+	AddSanction(ctx context.Context, sanction Sanction) error
+	GetActiveSanctions(ctx context.Context, user string, at time.Time) ([]Sanction, error)
+	SaveAuditEntry(ctx context.Context, entry AuditEntry) error
+}
+
+type AttachmentRepository interface {
+	SaveAttachment(ctx context.Context, attachment Attachment) error
+	GetAttachments(ctx context.Context, ids []string) ([]Attachment, error)
+}
+
+type EventType string
+
+const (
+	EventMessageCreated EventType = "message.created"
+	EventUserJoined     EventType = "user.joined"
+	EventUserLeft       EventType = "user.left"
+)
+
+var EventTypes = []EventType{EventMessageCreated, EventUserJoined, EventUserLeft}
+
+type Event struct {
+	Type    EventType
+	Room    string
+	User    string
+	Message *Message
+	Time    time.Time
+}
+
+type Subscription struct {
+	ID        string
+	Room      string
+	URL       string
+	Events    []EventType
+	Secret    string
+	CreatedBy string
+	Time      time.Time
+}
+
+// Delivery is an outbox entry: one event waiting to be sent to one subscription.
+type Delivery struct {
+	ID             int64
+	SubscriptionID string
+	URL            string
+	Secret         string
+	Event          EventType
+	Payload        []byte
+	Attempts       int
+	NextAttempt    time.Time
+	LastError      string
+	Time           time.Time
+}
+
+type Bot struct {
+	Name      string
+	URL       string
+	Token     string
+	CreatedBy string
+	Time      time.Time
+}
+
+type WebhookRepository interface {
+	SaveSubscription(ctx context.Context, subscription Subscription) error
+	DeleteSubscription(ctx context.Context, id string) error
+	ListSubscriptions(ctx context.Context, room string) ([]Subscription, error)
+	EnqueueDeliveries(ctx context.Context, deliveries []Delivery) error
+	// ClaimDeliveries returns due deliveries and postpones them until leaseUntil,
+	// so a crashed sender doesn't lose them and concurrent senders don't share them.
+	ClaimDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]Delivery, error)
+	CompleteDelivery(ctx context.Context, id int64) error
+	RetryDelivery(ctx context.Context, id int64, next time.Time, lastErr string) error
+	FailDelivery(ctx context.Context, id int64, lastErr string) error
+	SaveBot(ctx context.Context, bot Bot) error
+	DeleteBot(ctx context.Context, name string) error
+	GetBot(ctx context.Context, name string) (Bot, error)
+	GetBotByToken(ctx context.Context, token string) (Bot, error)
+	ListBots(ctx context.Context) ([]Bot, error)
+}
+
+type DirectRepository interface {
+	SetPublicKey(ctx context.Context, key PublicKey) error
+	GetPublicKey(ctx context.Context, user string) (PublicKey, error)
+	SaveDirectMessage(ctx context.Context, message DirectMessage) (int64, error)
+	// GetPendingDirectMessages returns messages to the user that haven't been delivered yet, oldest first.
+	GetPendingDirectMessages(ctx context.Context, user string, limit int) ([]DirectMessage, error)
+	MarkDirectDelivered(ctx context.Context, ids []int64) error
+}
+
+// RetentionRepository works in bounded batches, so it can run next to live traffic.
+type RetentionRepository interface {
+	DeleteMessagesBefore(ctx context.Context, before time.Time, limit int) (int, error)
+	// DeleteExcessMessages deletes up to limit of the oldest messages of the room beyond the newest keep.
+	DeleteExcessMessages(ctx context.Context, room string, keep, limit int) (int, error)
+	// ExportMessages returns messages of the room sent in [from, to) with ID greater than afterID, oldest first.
+	ExportMessages(ctx context.Context, room string, from, to time.Time, afterID int64, limit int) ([]Message, error)
+	AnonymizeMessages(ctx context.Context, author, alias string, limit int) (int, error)
+	DeleteUserMessages(ctx context.Context, author string, limit int) (int, error)
+	// DeleteUserData removes the read markers, role, sanctions, keys, direct messages and attachments
+	// of the user and puts alias in their place in the audit log, in the sanctions they issued and on
+	// the webhooks and bots they created. It returns the IDs of the deleted attachments, so their files
+	// can be removed too.
+	DeleteUserData(ctx context.Context, user, alias string) ([]string, error)
+	// DeleteOrphanAttachments deletes up to limit attachments uploaded before the time that no message
+	// refers to and returns their IDs.
+	DeleteOrphanAttachments(ctx context.Context, before time.Time, limit int) ([]string, error)
+}
+
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+type MessageFilter interface {
+	Apply(text string) (string, error)
+}
+
+type CloseReason int
+
+const (
+	CloseKicked CloseReason = iota
+	CloseGoingAway
+)
+
+type Session struct {
+	User       string
+	Room       string
+	LastSeenID int64
+	// Authenticated is set when the connection proved it owns User with a token;
+	// without it the user acts as a member whatever role the name has.
+	Authenticated bool
 }
 
 type Client interface {
-	WriteMessage(data []byte) error
-	ReadMessage() ([]byte, error)
+	WriteFrame(frame Frame) error
+	ReadFrame() (Frame, error)
+	Close(reason CloseReason) error
 }
 
 type UseCase interface {
-	Handle(ctx context.Context, clientName string, client Client) error
+	Handle(ctx context.Context, session Session, client Client) error
+}
+
+// Authenticator checks user tokens, so a connection can't take the role of a name it merely claims.
+type Authenticator interface {
+	Verify(user, token string) bool
+}
+
+type AttachmentUseCase interface {
+	Upload(ctx context.Context, owner, name string, r io.Reader) (Attachment, error)
+	Open(ctx context.Context, id, expires, signature string) (Attachment, io.ReadCloser, error)
+}
+
+type BotUseCase interface {
+	PostBotMessage(ctx context.Context, token, room, text string) (Message, error)
+}
+
+type ChatMetrics interface {
+	ClientConnected()
+	ClientDisconnected()
+	MessageReceived()
+	MessageBroadcast(took time.Duration)
+	MessageDropped(reason string)
+	WriteFailed()
 }
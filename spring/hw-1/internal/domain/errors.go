@@ -6,4 +6,15 @@ import (
 
 var (
 	ErrConnectionClosed = errors.New("connection closed")
+	ErrMessageRejected  = errors.New("message rejected by filter")
+	ErrUserBanned       = errors.New("user is banned")
+	ErrMessageTooLarge  = errors.New("message too large")
+	ErrBadFrame         = errors.New("malformed frame")
+	ErrShuttingDown     = errors.New("server is shutting down")
+	ErrNotFound         = errors.New("not found")
+	ErrForbidden        = errors.New("forbidden")
+	ErrFileTooLarge     = errors.New("file too large")
+	ErrFileType         = errors.New("file type is not allowed")
+	ErrInvalidRoom      = errors.New("invalid room name")
+	ErrUnauthorized     = errors.New("unauthorized")
 )
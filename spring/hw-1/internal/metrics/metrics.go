@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "ws_chat"
+
+type chat struct {
+	connectedClients  prometheus.Gauge
+	messagesReceived  prometheus.Counter
+	messagesBroadcast prometheus.Counter
+	broadcastDuration prometheus.Histogram
+	writeErrors       prometheus.Counter
+	messagesDropped   *prometheus.CounterVec
+}
+
+func NewChat(reg prometheus.Registerer) chat {
+	factory := promauto.With(reg)
+	return chat{
+		connectedClients: factory.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "connected_clients",
+			Help:      "Number of open websocket connections.",
+		}),
+		messagesReceived: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_received_total",
+			Help:      "Message frames received from clients and bots.",
+		}),
+		messagesBroadcast: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_broadcast_total",
+			Help:      "Messages fanned out to a room.",
+		}),
+		broadcastDuration: factory.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "broadcast_duration_seconds",
+			Help:      "Time to write a message to every client in its room.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+		}),
+		writeErrors: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "write_errors_total",
+			Help:      "Frames that failed to be written to a client.",
+		}),
+		messagesDropped: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_dropped_total",
+			Help:      "Messages that were received but never broadcast, by reason.",
+		}, []string{"reason"}),
+	}
+}
+
+func (c chat) ClientConnected() {
+	c.connectedClients.Inc()
+}
+
+func (c chat) ClientDisconnected() {
+	c.connectedClients.Dec()
+}
+
+func (c chat) MessageReceived() {
+	c.messagesReceived.Inc()
+}
+
+func (c chat) MessageBroadcast(took time.Duration) {
+	c.messagesBroadcast.Inc()
+	c.broadcastDuration.Observe(took.Seconds())
+}
+
+func (c chat) MessageDropped(reason string) {
+	c.messagesDropped.WithLabelValues(reason).Inc()
+}
+
+func (c chat) WriteFailed() {
+	c.writeErrors.Inc()
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const batchOperation = "batch"
+
+type traceStartKey struct{}
+
+type traceStart struct {
+	operation string
+	time      time.Time
+}
+
+// queryTracer records Postgres round trips the same way the tracelog example logs them,
+// but as a latency histogram labelled by the leading SQL keyword.
+type queryTracer struct {
+	duration *prometheus.HistogramVec
+}
+
+func NewQueryTracer(reg prometheus.Registerer) queryTracer {
+	return queryTracer{
+		duration: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "db_query_duration_seconds",
+			Help:      "Postgres query latency by operation and outcome.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+		}, []string{"operation", "status"}),
+	}
+}
+
+func (t queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, traceStartKey{}, traceStart{operation: operation(data.SQL), time: time.Now()})
+}
+
+func (t queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	t.observe(ctx, data.Err)
+}
+
+func (t queryTracer) TraceBatchStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceBatchStartData) context.Context {
+	return context.WithValue(ctx, traceStartKey{}, traceStart{operation: batchOperation, time: time.Now()})
+}
+
+func (t queryTracer) TraceBatchQuery(context.Context, *pgx.Conn, pgx.TraceBatchQueryData) {}
+
+func (t queryTracer) TraceBatchEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchEndData) {
+	t.observe(ctx, data.Err)
+}
+
+func (t queryTracer) observe(ctx context.Context, err error) {
+	start, ok := ctx.Value(traceStartKey{}).(traceStart)
+	if !ok {
+		return
+	}
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	t.duration.WithLabelValues(start.operation, status).Observe(time.Since(start.time).Seconds())
+}
+
+// operation keeps label cardinality bounded: only the statement keyword is used.
+func operation(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "unknown"
+	}
+	switch op := strings.ToLower(fields[0]); op {
+	case "select", "insert", "update", "delete", "with", "begin", "commit", "rollback":
+		return op
+	default:
+		return "other"
+	}
+}
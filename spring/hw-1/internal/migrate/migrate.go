@@ -0,0 +1,271 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// lockKey is an arbitrary application-wide key for pg_advisory_lock, so that
+// several instances starting at once don't apply the same migration twice.
+// The second half of the lock is the hash of the version table, so every source has its own lock.
+const lockKey = 7347812
+
+// DefaultTable keeps the version of the chat schema. Other sets of migrations need a table
+// of their own, or each would take the other's version for its own.
+const DefaultTable = "schema_migrations"
+
+// the version table name is put into the queries with %s, since it can't be a parameter.
+// The table keeps golang-migrate's layout, but a script and its version are committed in one
+// transaction, so a failed migration leaves the previous version and dirty is always false.
+const (
+	createVersionTableQuery = `create table if not exists %s (
+		version bigint not null primary key,
+		dirty boolean not null
+	)`
+	getVersionQuery   = `select version from %s limit 1`
+	clearVersionQuery = `delete from %s`
+	setVersionQuery   = `insert into %s (version, dirty) values ($1, false)`
+	lockQuery         = `select pg_advisory_lock($1, hashtext($2))`
+	unlockQuery       = `select pg_advisory_unlock($1, hashtext($2))`
+)
+
+var (
+	fileNameRegex = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+	tableRegex    = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,62}$`)
+)
+
+type Migration struct {
+	Version uint64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Version uint64
+	Applied []Migration
+	Pending []Migration
+}
+
+type Migrator struct {
+	pool       *pgxpool.Pool
+	migrations []Migration
+	table      string
+	logger     *zap.Logger
+}
+
+// New returns a migrator that keeps the version of the migrations from fsys in table.
+func New(pool *pgxpool.Pool, fsys fs.FS, table string, logger *zap.Logger) (Migrator, error) {
+	if !tableRegex.MatchString(table) {
+		return Migrator{}, errors.Errorf("invalid version table name '%s'", table)
+	}
+	migrations, err := Load(fsys)
+	if err != nil {
+		return Migrator{}, err
+	}
+	return Migrator{
+		pool:       pool,
+		migrations: migrations,
+		table:      table,
+		logger:     logger,
+	}, nil
+}
+
+// Load reads migrations in golang-migrate layout: <version>_<name>.up.sql and
+// <version>_<name>.down.sql in the root of fsys.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, errors.WithMessage(err, "read migrations dir")
+	}
+	byVersion := make(map[uint64]*Migration)
+	for _, entry := range entries {
+		match := fileNameRegex.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "parse version of '%s'", entry.Name())
+		}
+		body, err := fs.ReadFile(fsys, path.Clean(entry.Name()))
+		if err != nil {
+			return nil, errors.WithMessagef(err, "read '%s'", entry.Name())
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, errors.Errorf("version %d has two names: '%s' and '%s'", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, errors.Errorf("migration %d_%s has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		switch {
+		case a.Version < b.Version:
+			return -1
+		case a.Version > b.Version:
+			return 1
+		default:
+			return 0
+		}
+	})
+	return migrations, nil
+}
+
+func (m Migrator) Up(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *pgx.Conn) error {
+		version, err := m.version(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if migration.Version <= version {
+				continue
+			}
+			m.logger.Info("applying migration", zap.Uint64("version", migration.Version), zap.String("name", migration.Name))
+			if err := m.apply(ctx, conn, migration.Up, migration.Version); err != nil {
+				return errors.WithMessagef(err, "migration %d_%s up", migration.Version, migration.Name)
+			}
+		}
+		return nil
+	})
+}
+
+func (m Migrator) Down(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(conn *pgx.Conn) error {
+		version, err := m.version(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+			migration := m.migrations[i]
+			if migration.Version > version {
+				continue
+			}
+			var previous uint64
+			if i > 0 {
+				previous = m.migrations[i-1].Version
+			}
+			m.logger.Info("reverting migration", zap.Uint64("version", migration.Version), zap.String("name", migration.Name))
+			if err := m.apply(ctx, conn, migration.Down, previous); err != nil {
+				return errors.WithMessagef(err, "migration %d_%s down", migration.Version, migration.Name)
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+func (m Migrator) Status(ctx context.Context) (Status, error) {
+	var status Status
+	err := m.withLock(ctx, func(conn *pgx.Conn) error {
+		var err error
+		status.Version, err = m.version(ctx, conn)
+		return err
+	})
+	if err != nil {
+		return Status{}, err
+	}
+	for _, migration := range m.migrations {
+		if migration.Version <= status.Version {
+			status.Applied = append(status.Applied, migration)
+		} else {
+			status.Pending = append(status.Pending, migration)
+		}
+	}
+	return status, nil
+}
+
+// Force sets the schema version without running any migrations. It is meant for
+// manual recovery, e.g. after a schema was changed by hand.
+func (m Migrator) Force(ctx context.Context, version uint64) error {
+	return m.withLock(ctx, func(conn *pgx.Conn) error {
+		return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			return m.setVersion(ctx, tx, version)
+		})
+	})
+}
+
+func (m Migrator) apply(ctx context.Context, conn *pgx.Conn, script string, version uint64) error {
+	return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, script); err != nil {
+			return errors.WithMessage(err, "exec script")
+		}
+		return m.setVersion(ctx, tx, version)
+	})
+}
+
+func (m Migrator) version(ctx context.Context, conn *pgx.Conn) (uint64, error) {
+	var version int64
+	err := conn.QueryRow(ctx, m.query(getVersionQuery)).Scan(&version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.WithMessage(err, "select version")
+	}
+	return uint64(version), nil
+}
+
+func (m Migrator) withLock(ctx context.Context, fn func(conn *pgx.Conn) error) error {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return errors.WithMessage(err, "acquire connection")
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, lockQuery, lockKey, m.table); err != nil {
+		return errors.WithMessage(err, "acquire advisory lock")
+	}
+	defer func() {
+		// the lock must be released even if ctx is already cancelled
+		if _, err := conn.Exec(context.WithoutCancel(ctx), unlockQuery, lockKey, m.table); err != nil {
+			m.logger.Warn("release advisory lock: " + err.Error())
+		}
+	}()
+	if _, err := conn.Exec(ctx, m.query(createVersionTableQuery)); err != nil {
+		return errors.WithMessage(err, "create version table")
+	}
+	return fn(conn.Conn())
+}
+
+func (m Migrator) setVersion(ctx context.Context, tx pgx.Tx, version uint64) error {
+	if _, err := tx.Exec(ctx, m.query(clearVersionQuery)); err != nil {
+		return errors.WithMessage(err, "clear version")
+	}
+	if version == 0 {
+		return nil
+	}
+	if _, err := tx.Exec(ctx, m.query(setVersionQuery), int64(version)); err != nil {
+		return errors.WithMessage(err, "set version")
+	}
+	return nil
+}
+
+// query puts the version table into a query; New has checked the name is a plain identifier.
+func (m Migrator) query(format string) string {
+	return fmt.Sprintf(format, m.table)
+}
@@ -0,0 +1,76 @@
+package migrate_test
+
+import (
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"ws-chat/internal/adapters/pgrepo"
+	"ws-chat/internal/migrate"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000002_add_index.up.sql":    {Data: []byte("create index;")},
+		"000002_add_index.down.sql":  {Data: []byte("drop index;")},
+		"000001_create_table.up.sql": {Data: []byte("create table;")},
+		"README.md":                  {Data: []byte("not a migration")},
+	}
+	migrations, err := migrate.Load(fsys)
+	require.NoError(t, err)
+	require.Equal(t, []migrate.Migration{
+		{Version: 1, Name: "create_table", Up: "create table;"},
+		{Version: 2, Name: "add_index", Up: "create index;", Down: "drop index;"},
+	}, migrations)
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{
+			name: "down without up",
+			fsys: fstest.MapFS{"000001_create_table.down.sql": {Data: []byte("drop table;")}},
+		},
+		{
+			name: "one version with two names",
+			fsys: fstest.MapFS{
+				"000001_create_table.up.sql": {Data: []byte("create table;")},
+				"000001_other.down.sql":      {Data: []byte("drop table;")},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := migrate.Load(tt.fsys)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestLoadBundledMigrations(t *testing.T) {
+	migrations, err := migrate.Load(pgrepo.Migrations())
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	for i, m := range migrations {
+		require.Equal(t, uint64(i+1), m.Version)
+		require.NotEmpty(t, m.Down, "migration %d has no down script", m.Version)
+	}
+
+	migrations, err = migrate.Load(os.DirFS("../../examples/db/migrations"))
+	require.NoError(t, err)
+	require.Len(t, migrations, 1)
+}
+
+func TestNewTableName(t *testing.T) {
+	fsys := fstest.MapFS{"000001_create_table.up.sql": {Data: []byte("create table;")}}
+	for _, table := range []string{"", "Schema", "schema migrations", "users; drop table users", "1st"} {
+		_, err := migrate.New(nil, fsys, table, zap.NewNop())
+		require.Error(t, err, "table %q", table)
+	}
+	_, err := migrate.New(nil, fsys, "examples_schema_migrations", zap.NewNop())
+	require.NoError(t, err)
+}
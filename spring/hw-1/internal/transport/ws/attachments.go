@@ -0,0 +1,115 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"ws-chat/internal/domain"
+)
+
+const (
+	uploadFormField   = "file"
+	multipartOverhead = 1 << 20
+)
+
+type attachmentHandler struct {
+	service domain.AttachmentUseCase
+	maxSize int64
+	logger  *zap.Logger
+}
+
+func newAttachmentHandler(service domain.AttachmentUseCase, maxSize int64, logger *zap.Logger) attachmentHandler {
+	return attachmentHandler{
+		service: service,
+		maxSize: maxSize,
+		logger:  logger,
+	}
+}
+
+type uploadResponse struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	MIME string `json:"mime"`
+	Size int64  `json:"size"`
+}
+
+func (h attachmentHandler) upload(w http.ResponseWriter, r *http.Request) {
+	username := r.Header.Get(usernameKey)
+	if username == "" {
+		http.Error(w, fmt.Sprintf("empty '%s' header", usernameKey), http.StatusUnauthorized)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxSize+multipartOverhead)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			http.Error(w, fmt.Sprintf("no '%s' field in form", uploadFormField), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if part.FormName() != uploadFormField {
+			continue
+		}
+		attachment, err := h.service.Upload(r.Context(), username, part.FileName(), part)
+		if err != nil {
+			h.writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(uploadResponse{
+			ID:   attachment.ID,
+			Name: attachment.Name,
+			MIME: attachment.MIME,
+			Size: attachment.Size,
+		})
+		return
+	}
+}
+
+func (h attachmentHandler) download(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	attachment, body, err := h.service.Open(r.Context(), r.PathValue("id"), query.Get("expires"), query.Get("sig"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	defer func() {
+		_ = body.Close()
+	}()
+	w.Header().Set("Content-Type", attachment.MIME)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", attachment.Name))
+	if _, err := io.Copy(w, body); err != nil {
+		h.logger.Warn(err.Error(), zap.String("attachment", attachment.ID))
+	}
+}
+
+func (h attachmentHandler) writeError(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, domain.ErrFileTooLarge), errors.As(err, &maxBytesErr):
+		http.Error(w, domain.ErrFileTooLarge.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, domain.ErrFileType):
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+	case errors.Is(err, domain.ErrForbidden):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, domain.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		h.logger.Error(err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
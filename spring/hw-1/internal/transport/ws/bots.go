@@ -0,0 +1,77 @@
+package ws
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"ws-chat/internal/domain"
+)
+
+const (
+	bearerPrefix     = "Bearer "
+	maxBotPostBytes  = 64 << 10
+	botTokenParam    = "token"
+	authorizationKey = "Authorization"
+)
+
+type botHandler struct {
+	service domain.BotUseCase
+	logger  *zap.Logger
+}
+
+func newBotHandler(service domain.BotUseCase, logger *zap.Logger) botHandler {
+	return botHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+type botPostRequest struct {
+	Room string `json:"room"`
+	Text string `json:"text"`
+}
+
+type botPostResponse struct {
+	ID   int64     `json:"id"`
+	Room string    `json:"room"`
+	Time time.Time `json:"time"`
+}
+
+// post is the incoming webhook: a bot authenticates with its token either as
+// a bearer token or as the "token" query parameter for tools that can't set headers.
+func (h botHandler) post(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get(botTokenParam)
+	if auth := r.Header.Get(authorizationKey); strings.HasPrefix(auth, bearerPrefix) {
+		token = strings.TrimPrefix(auth, bearerPrefix)
+	}
+	var req botPostRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBotPostBytes)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	msg, err := h.service.PostBotMessage(r.Context(), token, req.Room, req.Text)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(botPostResponse{ID: msg.ID, Room: msg.Room, Time: msg.Time})
+}
+
+func (h botHandler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, domain.ErrUnauthorized):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, domain.ErrInvalidRoom), errors.Is(err, domain.ErrBadFrame):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, domain.ErrShuttingDown):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		h.logger.Error(err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
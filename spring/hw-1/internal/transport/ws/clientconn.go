@@ -1,26 +1,63 @@
 package ws
 
 import (
+	"encoding/json"
+	"sync"
+	"time"
+
 	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
 	"ws-chat/internal/domain"
 )
 
+const closeWriteTimeout = time.Second
+
 type client struct {
 	conn *websocket.Conn
+	mu   *sync.Mutex
 }
 
 func newClient(conn *websocket.Conn) client {
-	return client{conn: conn}
+	return client{conn: conn, mu: &sync.Mutex{}}
 }
 
-func (c client) WriteMessage(data []byte) error {
+func (c client) WriteFrame(frame domain.Frame) error {
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return errors.WithMessage(err, "marshal frame")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.conn.WriteMessage(websocket.TextMessage, data)
 }
 
-func (c client) ReadMessage() ([]byte, error) {
+func (c client) ReadFrame() (domain.Frame, error) {
 	msgType, msg, err := c.conn.ReadMessage()
 	if msgType == websocket.CloseMessage {
-		return nil, domain.ErrConnectionClosed
+		return domain.Frame{}, domain.ErrConnectionClosed
+	}
+	if errors.Is(err, websocket.ErrReadLimit) {
+		return domain.Frame{}, domain.ErrMessageTooLarge
+	}
+	if err != nil {
+		return domain.Frame{}, err
+	}
+	var frame domain.Frame
+	if err := json.Unmarshal(msg, &frame); err != nil {
+		return domain.Frame{}, domain.ErrBadFrame
+	}
+	return frame, nil
+}
+
+func (c client) Close(reason domain.CloseReason) error {
+	code, text := websocket.ClosePolicyViolation, ""
+	if reason == domain.CloseGoingAway {
+		code, text = websocket.CloseGoingAway, domain.ErrShuttingDown.Error()
 	}
-	return msg, err
+	_ = c.conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(code, text),
+		time.Now().Add(closeWriteTimeout),
+	)
+	return c.conn.Close()
 }
@@ -1,36 +1,127 @@
 package ws
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"ws-chat/internal/domain"
+	"ws-chat/internal/logctx"
 )
 
 type handler struct {
-	service  domain.UseCase
-	upgrader websocket.Upgrader
-	logger   *zap.Logger
+	service   domain.UseCase
+	auth      domain.Authenticator
+	upgrader  websocket.Upgrader
+	readLimit int64
+	logger    *zap.Logger
 }
 
-func newHandler(service domain.UseCase, logger *zap.Logger) handler {
+func newHandler(
+	service domain.UseCase,
+	auth domain.Authenticator,
+	readLimit int64,
+	allowedOrigins []string,
+	logger *zap.Logger,
+) handler {
 	return handler{
-		service: service,
+		service:   service,
+		auth:      auth,
+		readLimit: readLimit,
 		upgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool {
-				return true // Пропускаем любой запрос
-			},
+			CheckOrigin: checkOrigin(allowedOrigins),
 		},
 		logger: logger,
 	}
 }
 
-const usernameKey = "X-User-Name-Key"
+const (
+	usernameKey   = "X-User-Name-Key"
+	roomKey       = "X-Room"
+	lastSeenIDKey = "X-Last-Message-Id"
+)
+
+// Browsers can't set headers on a websocket handshake, so they pass the room as query parameters
+// and introduce themselves with an auth frame; a query parameter can't set the name.
+const (
+	roomParam       = "room"
+	lastSeenIDParam = "last_id"
+)
+
+const authTimeout = 10 * time.Second
+
+func sessionValue(r *http.Request, header, param string) string {
+	if value := r.Header.Get(header); value != "" {
+		return value
+	}
+	return r.URL.Query().Get(param)
+}
+
+// verify checks the token of the user. A connection without a token is a guest;
+// a wrong token is refused, so a typo doesn't silently drop the user's role.
+func (h handler) verify(username, token string) (bool, error) {
+	if token == "" {
+		return false, nil
+	}
+	if h.auth == nil || !h.auth.Verify(username, token) {
+		return false, domain.ErrUnauthorized
+	}
+	return true, nil
+}
+
+func headerToken(r *http.Request) (string, error) {
+	header := r.Header.Get(authorizationKey)
+	if header == "" {
+		return "", nil
+	}
+	token, ok := strings.CutPrefix(header, bearerPrefix)
+	if !ok || token == "" {
+		return "", domain.ErrUnauthorized
+	}
+	return token, nil
+}
+
+// readAuthFrame reads the name and token a browser sends as its first frame.
+func (h handler) readAuthFrame(conn *websocket.Conn, client client) (string, bool, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(authTimeout)); err != nil {
+		return "", false, errors.WithMessage(err, "set read deadline")
+	}
+	frame, err := client.ReadFrame()
+	if err != nil {
+		return "", false, errors.WithMessage(err, "read auth frame")
+	}
+	if frame.Type != domain.FrameAuth || frame.Author == "" {
+		return "", false, errors.WithMessagef(domain.ErrBadFrame, "expected '%s' frame with author", domain.FrameAuth)
+	}
+	authenticated, err := h.verify(frame.Author, frame.Token)
+	if err != nil {
+		return "", false, err
+	}
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return "", false, errors.WithMessage(err, "reset read deadline")
+	}
+	return frame.Author, authenticated, nil
+}
 
 func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	username := r.Header.Get(usernameKey)
+	token, err := headerToken(r)
+	authenticated := false
+	if err == nil {
+		authenticated, err = h.verify(username, token)
+	}
+	if err != nil {
+		h.logger.Info("invalid token", zap.String("user", username))
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
 	conn, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		h.logger.Error(err.Error())
@@ -39,15 +130,59 @@ func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	defer func() {
 		_ = conn.Close()
 	}()
-	username := r.Header.Get(usernameKey)
+	if h.readLimit > 0 {
+		conn.SetReadLimit(h.readLimit)
+	}
+	client := newClient(conn)
+	connID := newConnID()
 	if username == "" {
-		h.logger.Info(fmt.Sprintf("empty '%s' header", usernameKey))
-		return
+		username, authenticated, err = h.readAuthFrame(conn, client)
+		if err != nil {
+			h.logger.Info("authentication failed", zap.String("conn_id", connID), zap.Error(err))
+			code := domain.CodeBadFrame
+			if errors.Is(err, domain.ErrUnauthorized) {
+				code = domain.CodeUnauthorized
+			}
+			_ = client.WriteFrame(domain.Frame{Type: domain.FrameError, Code: code, Text: err.Error(), Time: time.Now()})
+			_ = client.Close(domain.CloseKicked)
+			return
+		}
 	}
-	err = h.service.Handle(r.Context(), username, newClient(conn))
-	if err != nil && !errors.Is(err, domain.ErrConnectionClosed) {
-		h.logger.Error(err.Error())
-	} else {
-		h.logger.Info(fmt.Sprintf("user '%s' closed connection", username))
+	logger := h.logger.With(zap.String("conn_id", connID), zap.String("user", username))
+	session := domain.Session{
+		User:          username,
+		Room:          sessionValue(r, roomKey, roomParam),
+		Authenticated: authenticated,
+	}
+	if session.Room == "" {
+		session.Room = domain.DefaultRoom
 	}
+	if lastSeen := sessionValue(r, lastSeenIDKey, lastSeenIDParam); lastSeen != "" {
+		session.LastSeenID, err = strconv.ParseInt(lastSeen, 10, 64)
+		if err != nil {
+			logger.Info(fmt.Sprintf("invalid '%s' header", lastSeenIDKey), zap.String("value", lastSeen))
+			return
+		}
+	}
+	err = h.service.Handle(logctx.With(r.Context(), logger), session, client)
+	switch {
+	case errors.Is(err, domain.ErrShuttingDown):
+		_ = client.Close(domain.CloseGoingAway)
+	case errors.Is(err, domain.ErrUserBanned):
+		_ = client.Close(domain.CloseKicked)
+		logger.Info("banned user tried to connect")
+	case errors.Is(err, domain.ErrInvalidRoom):
+		_ = client.Close(domain.CloseKicked)
+		logger.Info("user tried to join invalid room", zap.String("room", session.Room))
+	case err != nil && !errors.Is(err, domain.ErrConnectionClosed):
+		logger.Error(err.Error())
+	default:
+		logger.Info("user closed connection")
+	}
+}
+
+func newConnID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
 }
@@ -0,0 +1,97 @@
+package ws
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"ws-chat/internal/domain"
+)
+
+type tokenAuth map[string]string
+
+func (a tokenAuth) Verify(user, token string) bool {
+	return a[user] == token
+}
+
+// sessionRecorder ends every connection at once and hands its session to the test.
+type sessionRecorder chan domain.Session
+
+func (s sessionRecorder) Handle(_ context.Context, session domain.Session, _ domain.Client) error {
+	s <- session
+	return nil
+}
+
+func TestHandlerIdentity(t *testing.T) {
+	sessions := make(sessionRecorder, 1)
+	server := httptest.NewServer(newHandler(sessions, tokenAuth{"alice": "good"}, 0, nil, zap.NewNop()))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	dial := func(t *testing.T, query string, header http.Header) (*websocket.Conn, *http.Response, error) {
+		t.Helper()
+		header.Set("Origin", server.URL)
+		return websocket.DefaultDialer.Dial(url+query, header)
+	}
+
+	t.Run("header token", func(t *testing.T) {
+		conn, _, err := dial(t, "", http.Header{usernameKey: {"alice"}, authorizationKey: {"Bearer good"}})
+		require.NoError(t, err)
+		defer conn.Close()
+		require.Equal(t, domain.Session{User: "alice", Room: domain.DefaultRoom, Authenticated: true}, <-sessions)
+	})
+
+	t.Run("header without token is a guest", func(t *testing.T) {
+		conn, _, err := dial(t, "", http.Header{usernameKey: {"alice"}})
+		require.NoError(t, err)
+		defer conn.Close()
+		require.Equal(t, domain.Session{User: "alice", Room: domain.DefaultRoom}, <-sessions)
+	})
+
+	t.Run("wrong header token", func(t *testing.T) {
+		_, resp, err := dial(t, "", http.Header{usernameKey: {"alice"}, authorizationKey: {"Bearer bad"}})
+		require.Error(t, err)
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("missing origin", func(t *testing.T) {
+		_, resp, err := websocket.DefaultDialer.Dial(url, http.Header{usernameKey: {"alice"}})
+		require.Error(t, err)
+		require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("auth frame", func(t *testing.T) {
+		conn, _, err := dial(t, "?room=dev", http.Header{})
+		require.NoError(t, err)
+		defer conn.Close()
+		require.NoError(t, conn.WriteJSON(domain.Frame{Type: domain.FrameAuth, Author: "alice", Token: "good"}))
+		require.Equal(t, domain.Session{User: "alice", Room: "dev", Authenticated: true}, <-sessions)
+	})
+
+	t.Run("query name is ignored", func(t *testing.T) {
+		conn, _, err := dial(t, "?name=alice", http.Header{})
+		require.NoError(t, err)
+		defer conn.Close()
+		require.NoError(t, conn.WriteJSON(domain.Frame{Type: domain.FrameMessage, Text: "hi"}))
+		var frame domain.Frame
+		require.NoError(t, conn.ReadJSON(&frame))
+		require.Equal(t, domain.CodeBadFrame, frame.Code)
+		require.Empty(t, sessions)
+	})
+
+	t.Run("wrong frame token", func(t *testing.T) {
+		conn, _, err := dial(t, "", http.Header{})
+		require.NoError(t, err)
+		defer conn.Close()
+		require.NoError(t, conn.WriteJSON(domain.Frame{Type: domain.FrameAuth, Author: "alice", Token: "bad"}))
+		var frame domain.Frame
+		require.NoError(t, conn.ReadJSON(&frame))
+		require.Equal(t, domain.CodeUnauthorized, frame.Code)
+		require.Empty(t, sessions)
+	})
+}
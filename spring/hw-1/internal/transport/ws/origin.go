@@ -0,0 +1,51 @@
+package ws
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const (
+	anyOrigin = "*"
+	// noOrigin in the list accepts handshakes without an Origin header. Browsers always send one,
+	// so only other clients omit it, and the shipped ones send the server's own origin instead.
+	noOrigin = "none"
+)
+
+// checkOrigin accepts the server's own origin for an empty list, any origin for "*",
+// and otherwise only the listed ones. A missing Origin header is refused unless "none" is listed.
+func checkOrigin(allowed []string) func(r *http.Request) bool {
+	allowMissing := false
+	normalized := make([]string, 0, len(allowed))
+	for _, origin := range allowed {
+		origin = strings.ToLower(strings.TrimRight(strings.TrimSpace(origin), "/"))
+		if origin == noOrigin {
+			allowMissing = true
+			continue
+		}
+		normalized = append(normalized, origin)
+	}
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		switch {
+		case origin == "":
+			return allowMissing
+		case len(normalized) == 0:
+			return sameOrigin(r, origin)
+		case slices.Contains(normalized, anyOrigin):
+			return true
+		default:
+			return slices.Contains(normalized, strings.ToLower(origin))
+		}
+	}
+}
+
+func sameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
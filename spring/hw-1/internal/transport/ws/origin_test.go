@@ -0,0 +1,36 @@
+package ws
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		origin  string
+		want    bool
+	}{
+		{name: "same origin", origin: "http://chat.example", want: true},
+		{name: "other origin", origin: "http://evil.example"},
+		{name: "no origin", origin: ""},
+		{name: "no origin allowed", allowed: []string{"none"}, origin: "", want: true},
+		{name: "same origin with none", allowed: []string{"none"}, origin: "http://chat.example", want: true},
+		{name: "any origin", allowed: []string{"*"}, origin: "http://evil.example", want: true},
+		{name: "any origin without origin", allowed: []string{"*"}, origin: ""},
+		{name: "listed", allowed: []string{" https://App.example/ "}, origin: "https://app.example", want: true},
+		{name: "not listed", allowed: []string{"https://app.example"}, origin: "http://chat.example"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://chat.example/ws", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			require.Equal(t, tt.want, checkOrigin(tt.allowed)(r))
+		})
+	}
+}
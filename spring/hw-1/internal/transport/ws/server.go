@@ -7,9 +7,39 @@ import (
 	"ws-chat/internal/domain"
 )
 
-func New(port string, service domain.UseCase, logger *zap.Logger) *http.Server {
+type Config struct {
+	ReadLimit         int64
+	MaxAttachmentSize int64
+	// AllowedOrigins lists origins allowed to open a websocket; empty means same-origin only, "*" allows any.
+	AllowedOrigins []string
+	// Auth verifies the tokens clients send; without it every connection is a guest.
+	Auth domain.Authenticator
+	// MetricsHandler is served at /metrics when set.
+	MetricsHandler http.Handler
+}
+
+func New(
+	port string,
+	service domain.UseCase,
+	attachments domain.AttachmentUseCase,
+	bots domain.BotUseCase,
+	cfg Config,
+	logger *zap.Logger,
+) *http.Server {
+	attachmentHandler := newAttachmentHandler(attachments, cfg.MaxAttachmentSize, logger)
+	chatHandler := newHandler(service, cfg.Auth, cfg.ReadLimit, cfg.AllowedOrigins, logger)
+	staticHandler := newStaticHandler()
+	mux := http.NewServeMux()
+	mux.Handle("/ws", chatHandler)
+	mux.Handle("/", staticHandler)
+	mux.HandleFunc("POST /attachments", attachmentHandler.upload)
+	mux.HandleFunc("GET /attachments/{id}", attachmentHandler.download)
+	mux.HandleFunc("POST /bots/messages", newBotHandler(bots, logger).post)
+	if cfg.MetricsHandler != nil {
+		mux.Handle("GET /metrics", cfg.MetricsHandler)
+	}
 	return &http.Server{
 		Addr:    port,
-		Handler: newHandler(service, logger),
+		Handler: mux,
 	}
 }
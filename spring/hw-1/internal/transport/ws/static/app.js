@@ -0,0 +1,299 @@
+"use strict";
+
+const nameKey = "ws-chat:name";
+const roomKey = "ws-chat:room";
+const tokenKey = "ws-chat:token";
+const defaultRoom = "general";
+const policyViolation = 1008;
+const ackInterval = 1000;
+const roomsInterval = 10000;
+
+const $ = (id) => document.getElementById(id);
+
+const state = {
+  name: localStorage.getItem(nameKey) || "",
+  // the token only lives as long as the tab, unlike the name
+  token: sessionStorage.getItem(tokenKey) || "",
+  room: localStorage.getItem(roomKey) || defaultRoom,
+  socket: null,
+  lastID: 0,
+  ackedID: 0,
+  oldestID: 0,
+  backoff: 500,
+  reconnectTimer: 0,
+};
+
+function socketURL() {
+  const scheme = location.protocol === "https:" ? "wss" : "ws";
+  const params = new URLSearchParams({ room: state.room });
+  if (state.lastID > 0) {
+    params.set("last_id", state.lastID);
+  }
+  return `${scheme}://${location.host}/ws?${params}`;
+}
+
+function connect() {
+  clearTimeout(state.reconnectTimer);
+  setStatus("connecting…");
+  const socket = new WebSocket(socketURL());
+  state.socket = socket;
+  socket.onopen = () => {
+    state.backoff = 500;
+    setStatus("online");
+    // the browser can't set headers on the handshake, so the first frame says who we are
+    send({ type: "auth", author: state.name, token: state.token || undefined });
+    send({ type: "rooms" });
+  };
+  socket.onmessage = (event) => handleFrame(JSON.parse(event.data));
+  socket.onclose = (event) => {
+    if (state.socket !== socket) {
+      return;
+    }
+    state.socket = null;
+    if (event.code === policyViolation) {
+      setStatus("disconnected by server");
+      return;
+    }
+    setStatus(`reconnecting in ${Math.round(state.backoff / 1000)}s…`);
+    state.reconnectTimer = setTimeout(connect, state.backoff + Math.random() * state.backoff / 2);
+    state.backoff = Math.min(state.backoff * 2, 30000);
+  };
+}
+
+function disconnect() {
+  clearTimeout(state.reconnectTimer);
+  const socket = state.socket;
+  state.socket = null;
+  if (socket) {
+    socket.close(1000);
+  }
+}
+
+function send(frame) {
+  if (!state.socket || state.socket.readyState !== WebSocket.OPEN) {
+    return false;
+  }
+  state.socket.send(JSON.stringify({ time: new Date().toISOString(), ...frame }));
+  return true;
+}
+
+function handleFrame(frame) {
+  switch (frame.type) {
+    case "message":
+      if (frame.id <= state.lastID) {
+        return;
+      }
+      appendMessage(frame);
+      state.lastID = frame.id;
+      if (!state.oldestID) {
+        state.oldestID = frame.id;
+        $("older").hidden = false;
+      }
+      break;
+    case "history":
+      prependHistory(frame.messages || []);
+      break;
+    case "rooms":
+      renderRooms(frame.rooms || []);
+      break;
+    case "notice":
+      appendLine("notice", `*** ${frame.text}`);
+      break;
+    case "error":
+      appendLine("error", `error (${frame.code}): ${frame.text}`);
+      break;
+    case "unread":
+      appendLine("banner", `===== ${frame.count} unread =====`);
+      break;
+    case "separator":
+      appendLine("banner", "===== end of unread =====");
+      break;
+  }
+}
+
+function messageElement(frame) {
+  const item = document.createElement("li");
+  item.className = "message";
+  const author = document.createElement("span");
+  author.className = "author";
+  author.textContent = frame.author;
+  const time = document.createElement("time");
+  time.dateTime = frame.time;
+  time.textContent = new Date(frame.time).toLocaleTimeString();
+  const text = document.createElement("div");
+  text.textContent = frame.text || "";
+  item.append(author, time, text);
+  for (const at of frame.attachments || []) {
+    const line = document.createElement("div");
+    if (at.url) {
+      const link = document.createElement("a");
+      link.href = at.url;
+      link.target = "_blank";
+      link.textContent = `${at.name} (${formatSize(at.size)})`;
+      line.append(link);
+    } else {
+      line.textContent = `[attachment ${at.id} is unavailable]`;
+    }
+    item.append(line);
+  }
+  return item;
+}
+
+function appendMessage(frame) {
+  appendElement(messageElement(frame));
+}
+
+function appendLine(className, text) {
+  const item = document.createElement("li");
+  item.className = className;
+  item.textContent = text;
+  appendElement(item);
+}
+
+function appendElement(element) {
+  const box = $("messages");
+  const atBottom = box.scrollHeight - box.scrollTop - box.clientHeight < 40;
+  $("message-list").append(element);
+  if (atBottom) {
+    box.scrollTop = box.scrollHeight;
+  }
+}
+
+function prependHistory(messages) {
+  if (messages.length === 0) {
+    $("older").hidden = true;
+    return;
+  }
+  const box = $("messages");
+  const list = $("message-list");
+  const height = box.scrollHeight;
+  const fragment = document.createDocumentFragment();
+  for (const frame of messages) {
+    fragment.append(messageElement(frame));
+  }
+  list.prepend(fragment);
+  state.oldestID = messages[0].id;
+  box.scrollTop += box.scrollHeight - height;
+}
+
+function loadOlder() {
+  if (state.oldestID) {
+    send({ type: "history", id: state.oldestID });
+  }
+}
+
+function renderRooms(rooms) {
+  if (!rooms.some((room) => room.name === state.room)) {
+    rooms.unshift({ name: state.room, messages: 0, online: 0 });
+  }
+  const list = $("rooms");
+  list.replaceChildren();
+  for (const room of rooms) {
+    const item = document.createElement("li");
+    item.className = room.name === state.room ? "active" : "";
+    item.textContent = `#${room.name} `;
+    const info = document.createElement("small");
+    info.textContent = `${room.online} online`;
+    item.append(info);
+    item.onclick = () => switchRoom(room.name);
+    list.append(item);
+  }
+}
+
+function switchRoom(room) {
+  if (room === state.room && state.socket) {
+    return;
+  }
+  disconnect();
+  state.room = room;
+  state.lastID = 0;
+  state.ackedID = 0;
+  state.oldestID = 0;
+  localStorage.setItem(roomKey, room);
+  $("room-title").textContent = `#${room}`;
+  $("message-list").replaceChildren();
+  $("older").hidden = true;
+  connect();
+}
+
+function setStatus(text) {
+  $("status").textContent = text;
+}
+
+function formatSize(size) {
+  const units = ["B", "KiB", "MiB", "GiB"];
+  let i = 0;
+  while (size >= 1024 && i < units.length - 1) {
+    size /= 1024;
+    i++;
+  }
+  return `${i === 0 ? size : size.toFixed(1)} ${units[i]}`;
+}
+
+function showChat() {
+  $("login").hidden = true;
+  $("chat").hidden = false;
+  $("me").textContent = state.name;
+  switchRoom(state.room);
+}
+
+$("login").onsubmit = (event) => {
+  event.preventDefault();
+  const name = $("login-name").value.trim();
+  if (!name) {
+    return;
+  }
+  state.name = name;
+  state.token = $("login-token").value.trim();
+  $("login-token").value = "";
+  localStorage.setItem(nameKey, name);
+  sessionStorage.setItem(tokenKey, state.token);
+  showChat();
+};
+
+$("logout").onclick = () => {
+  disconnect();
+  localStorage.removeItem(nameKey);
+  sessionStorage.removeItem(tokenKey);
+  state.name = "";
+  state.token = "";
+  $("chat").hidden = true;
+  $("login").hidden = false;
+};
+
+$("join-room").onsubmit = (event) => {
+  event.preventDefault();
+  const room = $("room-name").value.trim();
+  if (room) {
+    $("room-name").value = "";
+    switchRoom(room);
+  }
+};
+
+$("send").onsubmit = (event) => {
+  event.preventDefault();
+  const text = $("text").value.trim();
+  if (text && send({ type: "message", text })) {
+    $("text").value = "";
+  }
+};
+
+$("older").onclick = loadOlder;
+
+$("messages").onscroll = () => {
+  if ($("messages").scrollTop === 0 && !$("older").hidden) {
+    loadOlder();
+  }
+};
+
+setInterval(() => {
+  if (state.lastID > state.ackedID && send({ type: "ack", id: state.lastID })) {
+    state.ackedID = state.lastID;
+  }
+}, ackInterval);
+
+setInterval(() => send({ type: "rooms" }), roomsInterval);
+
+if (state.name) {
+  showChat();
+}
@@ -0,0 +1,211 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"ws-chat/internal/domain"
+)
+
+const sniffLen = 512
+
+type AttachmentConfig struct {
+	MaxSize      int64
+	AllowedTypes []string
+	Secret       []byte
+	LinkTTL      time.Duration
+}
+
+type attachments struct {
+	repo       domain.AttachmentRepository
+	store      domain.BlobStore
+	moderation domain.ModerationRepository
+	cfg        AttachmentConfig
+	logger     *zap.Logger
+}
+
+func NewAttachments(
+	repo domain.AttachmentRepository,
+	store domain.BlobStore,
+	moderation domain.ModerationRepository,
+	cfg AttachmentConfig,
+	logger *zap.Logger,
+) attachments {
+	return attachments{
+		repo:       repo,
+		store:      store,
+		moderation: moderation,
+		cfg:        cfg,
+		logger:     logger,
+	}
+}
+
+func (a attachments) Upload(ctx context.Context, owner, name string, r io.Reader) (domain.Attachment, error) {
+	sanctions, err := a.moderation.GetActiveSanctions(ctx, owner, time.Now())
+	if err != nil {
+		return domain.Attachment{}, errors.WithMessage(err, "get active sanctions")
+	}
+	if len(sanctions) > 0 {
+		return domain.Attachment{}, domain.ErrForbidden
+	}
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return domain.Attachment{}, errors.WithMessage(err, "read file")
+	}
+	head = head[:n]
+	mimeType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if !slices.Contains(a.cfg.AllowedTypes, mimeType) {
+		return domain.Attachment{}, errors.WithMessage(domain.ErrFileType, mimeType)
+	}
+	id, err := newAttachmentID()
+	if err != nil {
+		return domain.Attachment{}, err
+	}
+	body := &countingReader{r: io.LimitReader(io.MultiReader(bytes.NewReader(head), r), a.cfg.MaxSize+1)}
+	if err := a.store.Put(ctx, id, body); err != nil {
+		return domain.Attachment{}, errors.WithMessage(err, "store file")
+	}
+	if body.n > a.cfg.MaxSize {
+		if err := a.store.Delete(ctx, id); err != nil {
+			a.logger.Warn(err.Error(), zap.String("attachment", id))
+		}
+		return domain.Attachment{}, domain.ErrFileTooLarge
+	}
+	attachment := domain.Attachment{
+		ID:    id,
+		Owner: owner,
+		Name:  filepath.Base(name),
+		MIME:  mimeType,
+		Size:  body.n,
+		Time:  time.Now(),
+	}
+	if err := a.repo.SaveAttachment(ctx, attachment); err != nil {
+		_ = a.store.Delete(ctx, id)
+		return domain.Attachment{}, errors.WithMessage(err, "save attachment")
+	}
+	a.logger.Info("attachment uploaded", zap.String("client", owner), zap.String("attachment", id))
+	return attachment, nil
+}
+
+func (a attachments) Open(
+	ctx context.Context,
+	id, expires, signature string,
+) (domain.Attachment, io.ReadCloser, error) {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return domain.Attachment{}, nil, domain.ErrForbidden
+	}
+	expected := a.sign(id, expiresAt)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return domain.Attachment{}, nil, domain.ErrForbidden
+	}
+	found, err := a.repo.GetAttachments(ctx, []string{id})
+	if err != nil {
+		return domain.Attachment{}, nil, errors.WithMessage(err, "get attachment")
+	}
+	if len(found) == 0 {
+		return domain.Attachment{}, nil, domain.ErrNotFound
+	}
+	body, err := a.store.Get(ctx, id)
+	if err != nil {
+		return domain.Attachment{}, nil, errors.WithMessage(err, "open file")
+	}
+	return found[0], body, nil
+}
+
+// resolve checks that every referenced attachment exists and belongs to the sender.
+func (a attachments) resolve(ctx context.Context, owner string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	found, err := a.repo.GetAttachments(ctx, ids)
+	if err != nil {
+		return errors.WithMessage(err, "get attachments")
+	}
+	for _, id := range ids {
+		i := slices.IndexFunc(found, func(at domain.Attachment) bool { return at.ID == id })
+		if i < 0 {
+			return errors.WithMessagef(domain.ErrNotFound, "attachment '%s'", id)
+		}
+		if found[i].Owner != owner {
+			return errors.WithMessagef(domain.ErrForbidden, "attachment '%s'", id)
+		}
+	}
+	return nil
+}
+
+func (a attachments) describe(ctx context.Context, ids []string) []domain.FrameAttachment {
+	if len(ids) == 0 {
+		return nil
+	}
+	found, err := a.repo.GetAttachments(ctx, ids)
+	if err != nil {
+		a.logger.Warn(err.Error())
+	}
+	described := make([]domain.FrameAttachment, 0, len(ids))
+	for _, id := range ids {
+		i := slices.IndexFunc(found, func(at domain.Attachment) bool { return at.ID == id })
+		if i < 0 {
+			described = append(described, domain.FrameAttachment{ID: id})
+			continue
+		}
+		described = append(described, domain.FrameAttachment{
+			ID:   id,
+			Name: found[i].Name,
+			MIME: found[i].MIME,
+			Size: found[i].Size,
+			URL:  a.link(id),
+		})
+	}
+	return described
+}
+
+func (a attachments) link(id string) string {
+	expires := time.Now().Add(a.cfg.LinkTTL).Unix()
+	query := url.Values{
+		"expires": {strconv.FormatInt(expires, 10)},
+		"sig":     {a.sign(id, expires)},
+	}
+	return fmt.Sprintf("/attachments/%s?%s", id, query.Encode())
+}
+
+func (a attachments) sign(id string, expires int64) string {
+	mac := hmac.New(sha256.New, a.cfg.Secret)
+	_, _ = fmt.Fprintf(mac, "%s:%d", id, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newAttachmentID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.WithMessage(err, "generate attachment id")
+	}
+	return hex.EncodeToString(b), nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
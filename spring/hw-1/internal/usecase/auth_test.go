@@ -0,0 +1,17 @@
+package usecase
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuth(t *testing.T) {
+	a := NewAuth([]byte("secret"))
+	token := a.Token("alice")
+	require.True(t, a.Verify("alice", token))
+	require.False(t, a.Verify("bob", token), "token of another user")
+	require.False(t, a.Verify("alice", ""), "empty token")
+	require.False(t, NewAuth([]byte("other")).Verify("alice", token), "token signed with another secret")
+	require.False(t, NewAuth(nil).Verify("alice", NewAuth(nil).Token("alice")), "empty secret")
+}
@@ -0,0 +1,326 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"ws-chat/internal/domain"
+	"ws-chat/internal/logctx"
+)
+
+const (
+	cmdWebhook = "/webhook"
+	cmdBot     = "/bot"
+)
+
+const (
+	botCommandEvent  = "command"
+	maxBotReplyBytes = 64 << 10
+)
+
+func (h hub) webhookCommand(ctx context.Context, key clientKey, role domain.Role, args []string) (string, error) {
+	if role.Rank() < domain.RoleAdmin.Rank() {
+		return "", errForbidden
+	}
+	if len(args) == 0 {
+		return "", errors.New("usage: /webhook add <url> [event,...] | list | remove <id>")
+	}
+	switch args[0] {
+	case "add":
+		if len(args) < 2 || len(args) > 3 {
+			return "", errors.New("usage: /webhook add <url> [event,...]")
+		}
+		events := domain.EventTypes
+		if len(args) == 3 {
+			events = make([]domain.EventType, 0)
+			for _, name := range strings.Split(args[2], ",") {
+				if !slices.Contains(domain.EventTypes, domain.EventType(name)) {
+					return "", errors.Errorf("unknown event '%s'", name)
+				}
+				events = append(events, domain.EventType(name))
+			}
+		}
+		return h.addWebhook(ctx, key, args[1], events)
+	case "list":
+		return h.listWebhooks(ctx, key.room)
+	case "remove":
+		if len(args) != 2 {
+			return "", errors.New("usage: /webhook remove <id>")
+		}
+		return h.removeWebhook(ctx, key, args[1])
+	default:
+		return "", errors.Errorf("unknown webhook action '%s'", args[0])
+	}
+}
+
+func (h hub) addWebhook(ctx context.Context, key clientKey, rawURL string, events []domain.EventType) (string, error) {
+	if err := validateHookURL(rawURL); err != nil {
+		return "", err
+	}
+	id, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	secret, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	subscription := domain.Subscription{
+		ID:        id[:16],
+		Room:      key.room,
+		URL:       rawURL,
+		Events:    events,
+		Secret:    secret,
+		CreatedBy: key.user,
+		Time:      time.Now(),
+	}
+	if err := h.webhooks.repo.SaveSubscription(ctx, subscription); err != nil {
+		return "", errors.WithMessage(err, "save subscription")
+	}
+	details := fmt.Sprintf("room=%s url=%s", key.room, rawURL)
+	if err := h.audit(ctx, key.user, "webhook.add", subscription.ID, details); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("webhook %s added to #%s for %s, signing secret: %s",
+		subscription.ID, key.room, joinEvents(events), secret), nil
+}
+
+// removeWebhook only removes a subscription of the current room, like list only shows those.
+func (h hub) removeWebhook(ctx context.Context, key clientKey, id string) (string, error) {
+	subscriptions, err := h.webhooks.repo.ListSubscriptions(ctx, key.room)
+	if err != nil {
+		return "", errors.WithMessage(err, "list subscriptions")
+	}
+	if !slices.ContainsFunc(subscriptions, func(s domain.Subscription) bool { return s.ID == id }) {
+		return "", errors.WithMessagef(domain.ErrNotFound, "webhook '%s' in #%s", id, key.room)
+	}
+	if err := h.webhooks.repo.DeleteSubscription(ctx, id); err != nil {
+		return "", errors.WithMessagef(err, "webhook '%s'", id)
+	}
+	if err := h.audit(ctx, key.user, "webhook.remove", id, "room="+key.room); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("webhook %s removed", id), nil
+}
+
+func (h hub) listWebhooks(ctx context.Context, room string) (string, error) {
+	subscriptions, err := h.webhooks.repo.ListSubscriptions(ctx, room)
+	if err != nil {
+		return "", errors.WithMessage(err, "list subscriptions")
+	}
+	if len(subscriptions) == 0 {
+		return fmt.Sprintf("no webhooks in #%s", room), nil
+	}
+	lines := make([]string, 0, len(subscriptions))
+	for _, s := range subscriptions {
+		lines = append(lines, fmt.Sprintf("%s %s (%s)", s.ID, s.URL, joinEvents(s.Events)))
+	}
+	return strings.Join(lines, "; "), nil
+}
+
+func (h hub) botCommand(ctx context.Context, actor string, role domain.Role, args []string) (string, error) {
+	if role.Rank() < domain.RoleAdmin.Rank() {
+		return "", errForbidden
+	}
+	if len(args) == 0 {
+		return "", errors.New("usage: /bot add <name> [url] | list | remove <name>")
+	}
+	switch args[0] {
+	case "add":
+		if len(args) < 2 || len(args) > 3 {
+			return "", errors.New("usage: /bot add <name> [url]")
+		}
+		bot := domain.Bot{Name: args[1], CreatedBy: actor, Time: time.Now()}
+		if len(args) == 3 {
+			bot.URL = args[2]
+		}
+		return h.addBot(ctx, bot)
+	case "list":
+		bots, err := h.webhooks.repo.ListBots(ctx)
+		if err != nil {
+			return "", errors.WithMessage(err, "list bots")
+		}
+		if len(bots) == 0 {
+			return "no bots registered", nil
+		}
+		names := make([]string, 0, len(bots))
+		for _, bot := range bots {
+			names = append(names, fmt.Sprintf("%s %s", bot.Name, bot.URL))
+		}
+		return strings.Join(names, "; "), nil
+	case "remove":
+		if len(args) != 2 {
+			return "", errors.New("usage: /bot remove <name>")
+		}
+		if err := h.webhooks.repo.DeleteBot(ctx, args[1]); err != nil {
+			return "", errors.WithMessagef(err, "bot '%s'", args[1])
+		}
+		if err := h.audit(ctx, actor, "bot.remove", args[1], ""); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("bot %s removed", args[1]), nil
+	default:
+		return "", errors.Errorf("unknown bot action '%s'", args[0])
+	}
+}
+
+// addBot registers the bot or rotates the token of an existing one.
+func (h hub) addBot(ctx context.Context, bot domain.Bot) (string, error) {
+	if !domain.ValidBotName(bot.Name) || isBuiltinCommand(commandPrefix+bot.Name) {
+		return "", errors.Errorf("invalid bot name '%s'", bot.Name)
+	}
+	if bot.URL != "" {
+		if err := validateHookURL(bot.URL); err != nil {
+			return "", err
+		}
+	}
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	bot.Token = token
+	if err := h.webhooks.repo.SaveBot(ctx, bot); err != nil {
+		return "", errors.WithMessage(err, "save bot")
+	}
+	if err := h.audit(ctx, bot.CreatedBy, "bot.add", bot.Name, "url="+bot.URL); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("bot %s registered, token: %s", bot.Name, token), nil
+}
+
+type botCommandPayload struct {
+	Event   string    `json:"event"`
+	Command string    `json:"command"`
+	Args    []string  `json:"args"`
+	User    string    `json:"user"`
+	Room    string    `json:"room"`
+	Time    time.Time `json:"time"`
+}
+
+type botReply struct {
+	Text string `json:"text"`
+}
+
+// routeToBot hands a slash command that isn't built in to the bot registered under its name.
+func (h hub) routeToBot(ctx context.Context, key clientKey, client domain.Client, args []string) (string, error) {
+	name := strings.TrimPrefix(args[0], commandPrefix)
+	bot, err := h.webhooks.repo.GetBot(ctx, name)
+	if errors.Is(err, domain.ErrNotFound) || (err == nil && bot.URL == "") {
+		return "", errors.Errorf("unknown command '%s'", args[0])
+	}
+	if err != nil {
+		return "", errors.WithMessage(err, "get bot")
+	}
+	payload := botCommandPayload{
+		Event:   botCommandEvent,
+		Command: name,
+		Args:    args[1:],
+		User:    key.user,
+		Room:    key.room,
+		Time:    time.Now(),
+	}
+	go h.invokeBot(context.WithoutCancel(ctx), bot, client, payload)
+	return fmt.Sprintf("%s sent to bot %s", args[0], bot.Name), nil
+}
+
+func (h hub) invokeBot(ctx context.Context, bot domain.Bot, client domain.Client, payload botCommandPayload) {
+	ctx, cancel := context.WithTimeout(ctx, h.webhooks.cfg.Timeout)
+	defer cancel()
+	reply, err := h.callBot(ctx, bot, payload)
+	if err != nil {
+		h.log(ctx).Info("bot command failed", zap.String("bot", bot.Name), zap.Error(err))
+		h.sendError(client, domain.CodeCommand, fmt.Sprintf("bot %s failed: %s", bot.Name, err.Error()))
+		return
+	}
+	if reply.Text == "" {
+		return
+	}
+	msg := domain.Message{Room: payload.Room, Author: bot.Name, Text: reply.Text, Time: time.Now()}
+	if _, err := h.postMessage(ctx, msg); err != nil {
+		h.logger.Warn(err.Error(), zap.String("bot", bot.Name))
+	}
+}
+
+func (h hub) callBot(ctx context.Context, bot domain.Bot, payload botCommandPayload) (botReply, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return botReply{}, errors.WithMessage(err, "marshal command")
+	}
+	req, err := signedRequest(ctx, bot.URL, bot.Token, body)
+	if err != nil {
+		return botReply{}, err
+	}
+	req.Header.Set(eventHeader, botCommandEvent)
+	resp, err := h.webhooks.client.Do(req)
+	if err != nil {
+		return botReply{}, errors.WithMessage(err, "send request")
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return botReply{}, errors.New(resp.Status)
+	}
+	var reply botReply
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxBotReplyBytes))
+	if err != nil {
+		return botReply{}, errors.WithMessage(err, "read reply")
+	}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &reply); err != nil {
+			return botReply{}, errors.WithMessage(err, "decode reply")
+		}
+	}
+	return reply, nil
+}
+
+// PostBotMessage posts a message on behalf of the bot that owns the token.
+func (h hub) PostBotMessage(ctx context.Context, token, room, text string) (domain.Message, error) {
+	if token == "" {
+		return domain.Message{}, domain.ErrUnauthorized
+	}
+	bot, err := h.webhooks.repo.GetBotByToken(ctx, token)
+	if errors.Is(err, domain.ErrNotFound) {
+		return domain.Message{}, domain.ErrUnauthorized
+	}
+	if err != nil {
+		return domain.Message{}, errors.WithMessage(err, "get bot")
+	}
+	if room == "" {
+		room = domain.DefaultRoom
+	}
+	if !domain.ValidRoomName(room) {
+		return domain.Message{}, domain.ErrInvalidRoom
+	}
+	if strings.TrimSpace(text) == "" {
+		return domain.Message{}, errors.WithMessage(domain.ErrBadFrame, "empty text")
+	}
+	h.metrics.MessageReceived()
+	ctx = logctx.With(ctx, h.log(ctx).With(zap.String("bot", bot.Name), zap.String("room", room)))
+	msg := domain.Message{Room: room, Author: bot.Name, Text: text, Time: time.Now()}
+	return h.postMessage(ctx, msg)
+}
+
+func validateHookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.Errorf("invalid url '%s'", rawURL)
+	}
+	return nil
+}
+
+func joinEvents(events []domain.EventType) string {
+	names := make([]string, 0, len(events))
+	for _, event := range events {
+		names = append(names, string(event))
+	}
+	return strings.Join(names, ",")
+}
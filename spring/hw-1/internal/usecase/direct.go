@@ -0,0 +1,160 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"ws-chat/internal/domain"
+)
+
+const pendingDirectBatch = 100
+
+// handleKey stores the sender's public key, or, when the frame names another user, replies with theirs.
+// The server never sees private keys: clients compare fingerprints out of band with /verify.
+// Anyone may publish the first key of a name, but only an authenticated peer may replace it,
+// otherwise whoever takes the name could read the direct messages sent to it.
+func (h hub) handleKey(ctx context.Context, self peer, client domain.Client, frame domain.Frame) {
+	if frame.To != "" {
+		theirs, err := h.direct.GetPublicKey(ctx, frame.To)
+		if errors.Is(err, domain.ErrNotFound) {
+			h.sendError(client, domain.CodeNoKey, fmt.Sprintf("%s has not published a key yet", frame.To))
+			return
+		}
+		if err != nil {
+			h.log(ctx).Warn(err.Error())
+			h.sendError(client, domain.CodeBadFrame, "failed to load key")
+			return
+		}
+		h.writeFrame(client, domain.Frame{Type: domain.FrameKey, Author: theirs.User, Key: theirs.Key, Time: theirs.Time})
+		return
+	}
+	if len(frame.Key) != domain.PublicKeySize {
+		h.sendError(client, domain.CodeBadFrame, fmt.Sprintf("public key must be %d bytes", domain.PublicKeySize))
+		return
+	}
+	if !self.authenticated {
+		current, err := h.direct.GetPublicKey(ctx, self.user)
+		switch {
+		case errors.Is(err, domain.ErrNotFound):
+		case err != nil:
+			h.log(ctx).Warn(err.Error())
+			h.sendError(client, domain.CodeBadFrame, "failed to load key")
+			return
+		case bytes.Equal(current.Key, frame.Key):
+			return
+		default:
+			h.log(ctx).Info("guest tried to replace a public key")
+			h.sendError(client, domain.CodeUnauthorized, "connect with a token to replace your key")
+			return
+		}
+	}
+	err := h.direct.SetPublicKey(ctx, domain.PublicKey{User: self.user, Key: frame.Key, Time: time.Now()})
+	if err != nil {
+		h.log(ctx).Warn(err.Error())
+		h.sendError(client, domain.CodeBadFrame, "failed to save key")
+	}
+}
+
+// handleDirect stores an encrypted message and relays it to every authenticated connection of the recipient;
+// guests using the name don't count as delivery.
+func (h hub) handleDirect(ctx context.Context, key clientKey, client domain.Client, frame domain.Frame) error {
+	if frame.To == "" || len(frame.Nonce) != domain.NonceSize || len(frame.Ciphertext) == 0 {
+		h.sendError(client, domain.CodeBadFrame, "direct message needs a recipient, a nonce and a ciphertext")
+		return nil
+	}
+	if !h.allowMessage(ctx, key.user, client) {
+		return nil
+	}
+	if !h.checkMuted(ctx, key.user, client) {
+		return nil
+	}
+	sender, err := h.direct.GetPublicKey(ctx, key.user)
+	if errors.Is(err, domain.ErrNotFound) {
+		h.sendError(client, domain.CodeNoKey, "publish your public key before sending direct messages")
+		return nil
+	}
+	if err != nil {
+		return errors.WithMessage(err, "get sender key")
+	}
+	if !h.drainer.begin() {
+		h.metrics.MessageDropped(domain.CodeShuttingDown)
+		h.sendError(client, domain.CodeShuttingDown, domain.ErrShuttingDown.Error())
+		return nil
+	}
+	defer h.drainer.done()
+	msg := domain.DirectMessage{
+		From:       key.user,
+		To:         frame.To,
+		SenderKey:  sender.Key,
+		Nonce:      frame.Nonce,
+		Ciphertext: frame.Ciphertext,
+		Time:       time.Now(),
+	}
+	msg.ID, err = h.direct.SaveDirectMessage(ctx, msg)
+	if err != nil {
+		h.metrics.MessageDropped(dropReasonStorage)
+		return errors.WithMessage(err, "save direct message")
+	}
+	h.log(ctx).Info("direct message", zap.String("to", msg.To), zap.Int64("id", msg.ID))
+	delivered := false
+	for _, recipient := range h.ownerClients(msg.To) {
+		if err := recipient.WriteFrame(directFrame(msg)); err != nil {
+			h.metrics.WriteFailed()
+			h.log(ctx).Warn(err.Error())
+			continue
+		}
+		delivered = true
+	}
+	if delivered {
+		if err := h.direct.MarkDirectDelivered(ctx, []int64{msg.ID}); err != nil {
+			h.log(ctx).Warn(err.Error())
+		}
+	}
+	return nil
+}
+
+// deliverPending hands over direct messages that arrived while the user was offline.
+// The connection must be authenticated as the user.
+func (h hub) deliverPending(ctx context.Context, user string, client domain.Client) {
+	for {
+		messages, err := h.direct.GetPendingDirectMessages(ctx, user, pendingDirectBatch)
+		if err != nil {
+			h.log(ctx).Warn(err.Error())
+			return
+		}
+		ids := make([]int64, 0, len(messages))
+		for _, msg := range messages {
+			if err := client.WriteFrame(directFrame(msg)); err != nil {
+				h.metrics.WriteFailed()
+				break
+			}
+			ids = append(ids, msg.ID)
+		}
+		if len(ids) > 0 {
+			if err := h.direct.MarkDirectDelivered(ctx, ids); err != nil {
+				h.log(ctx).Warn(err.Error())
+				return
+			}
+		}
+		if len(ids) < pendingDirectBatch {
+			return
+		}
+	}
+}
+
+func directFrame(msg domain.DirectMessage) domain.Frame {
+	return domain.Frame{
+		Type:       domain.FrameDirect,
+		ID:         msg.ID,
+		Author:     msg.From,
+		To:         msg.To,
+		Key:        msg.SenderKey,
+		Nonce:      msg.Nonce,
+		Ciphertext: msg.Ciphertext,
+		Time:       msg.Time,
+	}
+}
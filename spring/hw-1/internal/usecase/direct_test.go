@@ -0,0 +1,93 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"ws-chat/internal/domain"
+)
+
+func TestPublicKeyOwnership(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHub(t)
+	key := clientKey{user: "alice", room: domain.DefaultRoom}
+	guest, owner := peer{clientKey: key}, peer{clientKey: key, authenticated: true}
+	first := bytes.Repeat([]byte{1}, domain.PublicKeySize)
+	second := bytes.Repeat([]byte{2}, domain.PublicKeySize)
+	third := bytes.Repeat([]byte{3}, domain.PublicKeySize)
+	publish := func(self peer, pub []byte) *fakeClient {
+		client := newFakeClient()
+		h.handleKey(ctx, self, client, domain.Frame{Type: domain.FrameKey, Key: pub})
+		return client
+	}
+	stored := func() []byte {
+		pub, err := h.direct.GetPublicKey(ctx, "alice")
+		require.NoError(t, err)
+		return pub.Key
+	}
+
+	require.Empty(t, publish(guest, first).errorCodes(), "anyone may publish the first key")
+	require.Equal(t, first, stored())
+	require.Empty(t, publish(guest, first).errorCodes(), "republishing the same key")
+	require.Equal(t, []string{domain.CodeUnauthorized}, publish(guest, second).errorCodes())
+	require.Equal(t, first, stored())
+	require.Empty(t, publish(owner, third).errorCodes())
+	require.Equal(t, third, stored())
+}
+
+func TestDirectMessagesWaitForOwner(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHub(t)
+	require.NoError(t, h.direct.SetPublicKey(ctx, domain.PublicKey{
+		User: "alice", Key: bytes.Repeat([]byte{1}, domain.PublicKeySize), Time: time.Now(),
+	}))
+	sender := peer{clientKey: clientKey{user: "alice", room: domain.DefaultRoom}, authenticated: true}
+	send := func() {
+		err := h.handleDirect(ctx, sender.clientKey, newFakeClient(), domain.Frame{
+			Type:       domain.FrameDirect,
+			To:         "bob",
+			Nonce:      bytes.Repeat([]byte{2}, domain.NonceSize),
+			Ciphertext: []byte("ciphertext"),
+		})
+		require.NoError(t, err)
+	}
+	directFrames := func(client *fakeClient) int {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		n := 0
+		for _, frame := range client.frames {
+			if frame.Type == domain.FrameDirect {
+				n++
+			}
+		}
+		return n
+	}
+	pending := func() int {
+		messages, err := h.direct.GetPendingDirectMessages(ctx, "bob", pendingDirectBatch)
+		require.NoError(t, err)
+		return len(messages)
+	}
+
+	send()
+	guest := newFakeClient()
+	close(guest.in)
+	require.NoError(t, h.Handle(ctx, domain.Session{User: "bob", Room: domain.DefaultRoom}, guest))
+	require.Zero(t, directFrames(guest), "a guest got the pending messages")
+	require.Equal(t, 1, pending())
+
+	live := newFakeClient()
+	require.NoError(t, h.addClient(peer{clientKey: clientKey{user: "bob", room: domain.DefaultRoom}}, live))
+	send()
+	h.removeClient(clientKey{user: "bob", room: domain.DefaultRoom})
+	require.Zero(t, directFrames(live), "a guest got a live message")
+	require.Equal(t, 2, pending())
+
+	owner := newFakeClient()
+	close(owner.in)
+	require.NoError(t, h.Handle(ctx, domain.Session{User: "bob", Room: domain.DefaultRoom, Authenticated: true}, owner))
+	require.Equal(t, 2, directFrames(owner))
+	require.Zero(t, pending())
+}
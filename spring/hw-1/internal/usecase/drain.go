@@ -0,0 +1,63 @@
+package usecase
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"ws-chat/internal/domain"
+)
+
+type drainer struct {
+	mu       sync.Mutex
+	draining bool
+	inflight sync.WaitGroup
+}
+
+// begin registers an in-flight operation unless the hub is already draining.
+func (d *drainer) begin() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.draining {
+		return false
+	}
+	d.inflight.Add(1)
+	return true
+}
+
+func (d *drainer) done() {
+	d.inflight.Done()
+}
+
+func (d *drainer) isDraining() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.draining
+}
+
+func (d *drainer) drain(ctx context.Context) error {
+	d.mu.Lock()
+	d.draining = true
+	d.mu.Unlock()
+	finished := make(chan struct{})
+	go func() {
+		d.inflight.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return errors.WithMessage(ctx.Err(), "wait for in-flight messages")
+	}
+}
+
+// Shutdown stops accepting messages, waits for in-flight saves to finish
+// and then tells every connected client that the server is going away.
+func (h hub) Shutdown(ctx context.Context) error {
+	err := h.drainer.drain(ctx)
+	for _, client := range h.snapshotClients() {
+		_ = client.Close(domain.CloseGoingAway)
+	}
+	return err
+}
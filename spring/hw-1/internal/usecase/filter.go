@@ -0,0 +1,103 @@
+package usecase
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"ws-chat/internal/domain"
+)
+
+type FilterAction string
+
+const (
+	FilterReject FilterAction = "reject"
+	FilterMask   FilterAction = "mask"
+)
+
+type filter struct {
+	action FilterAction
+	// words match only whole words, patterns anywhere in the text
+	words    []*regexp.Regexp
+	patterns []*regexp.Regexp
+}
+
+func NewFilter(action FilterAction, words []string, patterns []string) (filter, error) {
+	if action != FilterReject && action != FilterMask {
+		return filter{}, errors.Errorf("unknown filter action '%s'", action)
+	}
+	f := filter{action: action}
+	for _, word := range words {
+		word = strings.TrimSpace(word)
+		if word == "" {
+			continue
+		}
+		f.words = append(f.words, regexp.MustCompile(`(?i)`+regexp.QuoteMeta(word)))
+	}
+	for _, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return filter{}, errors.WithMessagef(err, "compile pattern '%s'", pattern)
+		}
+		f.patterns = append(f.patterns, re)
+	}
+	return f, nil
+}
+
+func (f filter) Apply(text string) (string, error) {
+	for _, re := range f.words {
+		var err error
+		if text, err = f.apply(text, wordMatches(re, text)); err != nil {
+			return "", err
+		}
+	}
+	for _, re := range f.patterns {
+		var err error
+		if text, err = f.apply(text, re.FindAllStringIndex(text, -1)); err != nil {
+			return "", err
+		}
+	}
+	return text, nil
+}
+
+// apply rejects the text or masks the matches, given as index pairs in order.
+func (f filter) apply(text string, matches [][]int) (string, error) {
+	if len(matches) == 0 {
+		return text, nil
+	}
+	if f.action == FilterReject {
+		return "", domain.ErrMessageRejected
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(text[last:m[0]])
+		b.WriteString(strings.Repeat("*", utf8.RuneCountInString(text[m[0]:m[1]])))
+		last = m[1]
+	}
+	b.WriteString(text[last:])
+	return b.String(), nil
+}
+
+// wordMatches returns the matches of re that are whole words. The boundaries are checked here
+// because \b only knows ASCII letters and would never match a Cyrillic word.
+func wordMatches(re *regexp.Regexp, text string) [][]int {
+	var matches [][]int
+	for _, m := range re.FindAllStringIndex(text, -1) {
+		before, _ := utf8.DecodeLastRuneInString(text[:m[0]])
+		after, _ := utf8.DecodeRuneInString(text[m[1]:])
+		if !isWordRune(before) && !isWordRune(after) {
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsNumber(r)
+}
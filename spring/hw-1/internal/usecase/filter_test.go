@@ -0,0 +1,58 @@
+package usecase
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"ws-chat/internal/domain"
+)
+
+func TestFilter(t *testing.T) {
+	t.Run("mask", func(t *testing.T) {
+		f, err := NewFilter(FilterMask, []string{"darn", " "}, []string{`\d{4}-\d{4}`})
+		require.NoError(t, err)
+		text, err := f.Apply("Darn, my card is 1234-5678, darnit")
+		require.NoError(t, err)
+		require.Equal(t, "****, my card is *********, darnit", text)
+	})
+
+	t.Run("cyrillic", func(t *testing.T) {
+		f, err := NewFilter(FilterMask, []string{"дурак"}, nil)
+		require.NoError(t, err)
+		text, err := f.Apply("ты дурак! Дурак, дураками не рождаются")
+		require.NoError(t, err)
+		require.Equal(t, "ты *****! *****, дураками не рождаются", text)
+	})
+
+	t.Run("adjacent words", func(t *testing.T) {
+		f, err := NewFilter(FilterMask, []string{"darn"}, nil)
+		require.NoError(t, err)
+		text, err := f.Apply("darn darn_it (darn)")
+		require.NoError(t, err)
+		require.Equal(t, "**** darn_it (****)", text)
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		f, err := NewFilter(FilterReject, []string{"darn"}, nil)
+		require.NoError(t, err)
+		_, err = f.Apply("oh darn")
+		require.ErrorIs(t, err, domain.ErrMessageRejected)
+		f, err = NewFilter(FilterReject, []string{"дурак"}, nil)
+		require.NoError(t, err)
+		_, err = f.Apply("ты ДУРАК")
+		require.ErrorIs(t, err, domain.ErrMessageRejected)
+		text, err := f.Apply("all fine")
+		require.NoError(t, err)
+		require.Equal(t, "all fine", text)
+	})
+
+	t.Run("bad pattern", func(t *testing.T) {
+		_, err := NewFilter(FilterMask, nil, []string{"("})
+		require.Error(t, err)
+	})
+
+	t.Run("unknown action", func(t *testing.T) {
+		_, err := NewFilter("drop", nil, nil)
+		require.Error(t, err)
+	})
+}
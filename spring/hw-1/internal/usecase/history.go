@@ -0,0 +1,143 @@
+package usecase
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"ws-chat/internal/domain"
+)
+
+const historyPageSize = 100
+
+// replayClient holds back frames broadcast while history is being replayed,
+// so live messages don't interleave with or duplicate the replayed ones.
+type replayClient struct {
+	domain.Client
+	mu      *sync.Mutex
+	live    bool
+	pending []domain.Frame
+}
+
+func newReplayClient(client domain.Client) *replayClient {
+	return &replayClient{Client: client, mu: &sync.Mutex{}}
+}
+
+func (c *replayClient) WriteFrame(frame domain.Frame) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.live {
+		c.pending = append(c.pending, frame)
+		return nil
+	}
+	return c.Client.WriteFrame(frame)
+}
+
+func (c *replayClient) writeReplayed(frame domain.Frame) error {
+	return c.Client.WriteFrame(frame)
+}
+
+func (c *replayClient) goLive(lastReplayedID int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.live = true
+	for _, frame := range c.pending {
+		if frame.Type == domain.FrameMessage && frame.ID <= lastReplayedID {
+			continue
+		}
+		if err := c.Client.WriteFrame(frame); err != nil {
+			return err
+		}
+	}
+	c.pending = nil
+	return nil
+}
+
+func (h hub) replayHistory(ctx context.Context, session domain.Session, client *replayClient) (int64, error) {
+	clientName := session.User
+	if session.LastSeenID > 0 {
+		h.log(ctx).Info("resuming session", zap.Int64("after", session.LastSeenID))
+		return h.replayAfter(ctx, client, session.Room, session.LastSeenID)
+	}
+	lastRead, ok, err := h.repo.GetLastRead(ctx, clientName, session.Room)
+	if err != nil {
+		return 0, errors.WithMessage(err, "get last read")
+	}
+	unread := 0
+	if ok {
+		unread, err = h.repo.CountMessagesAfter(ctx, session.Room, lastRead)
+		if err != nil {
+			return 0, errors.WithMessage(err, "count unread")
+		}
+	}
+	if unread == 0 {
+		return h.sendRecentMessages(ctx, client, session.Room)
+	}
+	h.log(ctx).Info("replaying unread messages", zap.Int("count", unread))
+	h.replay(client, domain.Frame{Type: domain.FrameUnread, Count: unread, Time: time.Now()})
+	lastID, err := h.replayAfter(ctx, client, session.Room, lastRead)
+	if err != nil {
+		return lastID, err
+	}
+	h.replay(client, domain.Frame{Type: domain.FrameSeparator, Time: time.Now()})
+	return lastID, nil
+}
+
+func (h hub) replayAfter(ctx context.Context, client *replayClient, room string, afterID int64) (int64, error) {
+	lastID := afterID
+	for {
+		messages, err := h.repo.GetMessagesAfter(ctx, room, lastID, historyPageSize)
+		if err != nil {
+			return lastID, errors.WithMessage(err, "get messages")
+		}
+		for _, msg := range messages {
+			h.replay(client, h.messageFrame(ctx, msg))
+			lastID = msg.ID
+		}
+		if len(messages) < historyPageSize {
+			return lastID, nil
+		}
+	}
+}
+
+func (h hub) sendRecentMessages(ctx context.Context, client *replayClient, room string) (int64, error) {
+	recentMessages, err := h.repo.GetRecentMessages(ctx, room)
+	if err != nil {
+		return 0, errors.WithMessage(err, "get recent messages")
+	}
+	var lastID int64
+	for _, msg := range recentMessages {
+		h.replay(client, h.messageFrame(ctx, msg))
+		lastID = msg.ID
+	}
+	return lastID, nil
+}
+
+func (h hub) replay(client *replayClient, frame domain.Frame) {
+	if err := client.writeReplayed(frame); err != nil {
+		h.logger.Warn(err.Error())
+	}
+}
+
+func (h hub) ack(ctx context.Context, key clientKey, messageID int64) {
+	if messageID <= 0 {
+		return
+	}
+	if err := h.repo.SetLastRead(ctx, key.user, key.room, messageID); err != nil {
+		h.log(ctx).Warn(err.Error())
+	}
+}
+
+func (h hub) messageFrame(ctx context.Context, msg domain.Message) domain.Frame {
+	return domain.Frame{
+		Type:        domain.FrameMessage,
+		ID:          msg.ID,
+		Room:        msg.Room,
+		Author:      msg.Author,
+		Text:        msg.Text,
+		Time:        msg.Time,
+		Attachments: h.attachments.describe(ctx, msg.Attachments),
+	}
+}
@@ -0,0 +1,202 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"ws-chat/internal/domain"
+)
+
+const (
+	commandPrefix = "/"
+	systemActor   = "system"
+)
+
+const (
+	cmdMute = "/mute"
+	cmdKick = "/kick"
+	cmdBan  = "/ban"
+	cmdRole = "/role"
+)
+
+var errForbidden = errors.New("not enough rights")
+
+func (h hub) handleCommand(ctx context.Context, self peer, client domain.Client, line string) {
+	reply, err := h.runCommand(ctx, self, client, strings.Fields(line))
+	if err != nil {
+		h.log(ctx).Info("command failed", zap.String("command", line), zap.Error(err))
+		h.sendError(client, domain.CodeCommand, err.Error())
+		return
+	}
+	h.notify(client, reply)
+}
+
+func (h hub) runCommand(ctx context.Context, self peer, client domain.Client, args []string) (string, error) {
+	actor := self.user
+	role, err := h.role(ctx, self)
+	if err != nil {
+		return "", err
+	}
+	switch args[0] {
+	case cmdMute:
+		return h.sanction(ctx, actor, role, domain.SanctionMute, args[1:])
+	case cmdBan:
+		return h.sanction(ctx, actor, role, domain.SanctionBan, args[1:])
+	case cmdKick:
+		return h.kick(ctx, actor, role, args[1:])
+	case cmdRole:
+		return h.setRole(ctx, actor, role, args[1:])
+	case cmdWebhook:
+		return h.webhookCommand(ctx, self.clientKey, role, args[1:])
+	case cmdBot:
+		return h.botCommand(ctx, actor, role, args[1:])
+	default:
+		return h.routeToBot(ctx, self.clientKey, client, args)
+	}
+}
+
+func isBuiltinCommand(name string) bool {
+	switch name {
+	case cmdMute, cmdBan, cmdKick, cmdRole, cmdWebhook, cmdBot:
+		return true
+	default:
+		return false
+	}
+}
+
+func (h hub) sanction(
+	ctx context.Context,
+	actor string,
+	actorRole domain.Role,
+	kind domain.SanctionKind,
+	args []string,
+) (string, error) {
+	if len(args) != 2 {
+		return "", errors.Errorf("usage: /%s <user> <duration>", kind)
+	}
+	target := args[0]
+	duration, err := time.ParseDuration(args[1])
+	if err != nil || duration <= 0 {
+		return "", errors.Errorf("invalid duration '%s'", args[1])
+	}
+	if err := h.authorize(ctx, actorRole, domain.RoleModerator, target); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	sanction := domain.Sanction{
+		User:     target,
+		Kind:     kind,
+		Until:    now.Add(duration),
+		IssuedBy: actor,
+		Time:     now,
+	}
+	if err := h.moderation.AddSanction(ctx, sanction); err != nil {
+		return "", errors.WithMessage(err, "add sanction")
+	}
+	until := sanction.Until.Format(time.RFC1123)
+	for _, client := range h.userClients(target) {
+		switch kind {
+		case domain.SanctionBan:
+			h.sendError(client, domain.CodeBanned, fmt.Sprintf("you were banned by %s until %s", actor, until))
+			_ = client.Close(domain.CloseKicked)
+		case domain.SanctionMute:
+			h.sendError(client, domain.CodeMuted, fmt.Sprintf("you were muted by %s until %s", actor, until))
+		}
+	}
+	if err := h.audit(ctx, actor, string(kind), target, "duration="+duration.String()); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s: %s until %s", kind, target, until), nil
+}
+
+func (h hub) kick(ctx context.Context, actor string, actorRole domain.Role, args []string) (string, error) {
+	if len(args) != 1 {
+		return "", errors.New("usage: /kick <user>")
+	}
+	target := args[0]
+	if err := h.authorize(ctx, actorRole, domain.RoleModerator, target); err != nil {
+		return "", err
+	}
+	clients := h.userClients(target)
+	if len(clients) == 0 {
+		return "", errors.Errorf("user '%s' is not in chat", target)
+	}
+	for _, client := range clients {
+		h.notify(client, fmt.Sprintf("you were kicked by %s", actor))
+		_ = client.Close(domain.CloseKicked)
+	}
+	if err := h.audit(ctx, actor, "kick", target, ""); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("kick: %s", target), nil
+}
+
+func (h hub) setRole(ctx context.Context, actor string, actorRole domain.Role, args []string) (string, error) {
+	if len(args) != 2 {
+		return "", errors.New("usage: /role <user> <member|moderator|admin>")
+	}
+	target, role := args[0], domain.Role(args[1])
+	if !role.Valid() {
+		return "", errors.Errorf("unknown role '%s'", role)
+	}
+	if target == actor {
+		return "", errors.New("you can't change your own role")
+	}
+	if err := h.authorize(ctx, actorRole, domain.RoleAdmin, target); err != nil {
+		return "", err
+	}
+	if err := h.moderation.SetRole(ctx, target, role); err != nil {
+		return "", errors.WithMessage(err, "set role")
+	}
+	if err := h.audit(ctx, actor, "role", target, "role="+string(role)); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("role: %s is now %s", target, role), nil
+}
+
+// role returns the role of the peer. A peer that didn't authenticate acts as a member,
+// so taking the name of a moderator grants none of their rights.
+func (h hub) role(ctx context.Context, self peer) (domain.Role, error) {
+	if !self.authenticated {
+		return domain.RoleMember, nil
+	}
+	role, err := h.moderation.GetRole(ctx, self.user)
+	if err != nil {
+		return "", errors.WithMessage(err, "get role")
+	}
+	return role, nil
+}
+
+// authorize checks that the actor has at least the required role and
+// outranks the target, so moderators can't act on each other or on admins.
+func (h hub) authorize(ctx context.Context, actorRole, required domain.Role, target string) error {
+	if actorRole.Rank() < required.Rank() {
+		return errForbidden
+	}
+	targetRole, err := h.moderation.GetRole(ctx, target)
+	if err != nil {
+		return errors.WithMessage(err, "get target role")
+	}
+	if targetRole.Rank() >= actorRole.Rank() {
+		return errForbidden
+	}
+	return nil
+}
+
+func (h hub) audit(ctx context.Context, actor, action, target, details string) error {
+	err := h.moderation.SaveAuditEntry(ctx, domain.AuditEntry{
+		Actor:   actor,
+		Action:  action,
+		Target:  target,
+		Details: details,
+		Time:    time.Now(),
+	})
+	if err != nil {
+		return errors.WithMessage(err, "save audit entry")
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package usecase
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+const limiterSweepInterval = time.Minute
+
+type RateLimitConfig struct {
+	MessagesPerSecond float64
+	Burst             int
+	MaxViolations     int
+	ViolationWindow   time.Duration
+	MuteDuration      time.Duration
+}
+
+type userLimit struct {
+	limiter    *rate.Limiter
+	violations []time.Time
+}
+
+// rateLimiter keeps token buckets by user name rather than by connection,
+// so reconnecting doesn't refill the bucket or forget recent violations.
+type rateLimiter struct {
+	cfg   RateLimitConfig
+	users map[string]*userLimit
+	mu    *sync.Mutex
+}
+
+func newRateLimiter(cfg RateLimitConfig) rateLimiter {
+	return rateLimiter{
+		cfg:   cfg,
+		users: make(map[string]*userLimit),
+		mu:    &sync.Mutex{},
+	}
+}
+
+func (r rateLimiter) Allow(user string, now time.Time) bool {
+	if r.cfg.MessagesPerSecond <= 0 {
+		return true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.get(user).limiter.AllowN(now, 1)
+}
+
+// AddViolation records a violation and reports whether the user has reached
+// the limit within the window. The counter is reset once the limit is hit.
+func (r rateLimiter) AddViolation(user string, now time.Time) bool {
+	if r.cfg.MaxViolations <= 0 {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u := r.get(user)
+	u.violations = append(r.recentViolations(u, now), now)
+	if len(u.violations) < r.cfg.MaxViolations {
+		return false
+	}
+	u.violations = nil
+	return true
+}
+
+// Release forgets the user if their state is indistinguishable from a fresh one.
+func (r rateLimiter) Release(user string, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.users[user]
+	if !ok {
+		return
+	}
+	if r.fresh(u, now) {
+		delete(r.users, user)
+	}
+}
+
+// Sweep forgets every user whose state is indistinguishable from a fresh one, connected or not.
+// Release misses users who disconnect with a drained bucket or a recent violation, and names are
+// free to choose, so without the sweep the map would grow with every name ever used.
+func (r rateLimiter) Sweep(now time.Time) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for user, u := range r.users {
+		if r.fresh(u, now) {
+			delete(r.users, user)
+			n++
+		}
+	}
+	return n
+}
+
+func (r rateLimiter) fresh(u *userLimit, now time.Time) bool {
+	return len(r.recentViolations(u, now)) == 0 && u.limiter.TokensAt(now) >= float64(r.cfg.Burst)
+}
+
+// Run sweeps the rate limits of users who went quiet every minute until ctx is cancelled.
+func (h hub) Run(ctx context.Context) error {
+	ticker := time.NewTicker(limiterSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			if n := h.limiter.Sweep(now); n > 0 {
+				h.logger.Debug("forgot rate limits of quiet users", zap.Int("count", n))
+			}
+		}
+	}
+}
+
+func (r rateLimiter) get(user string) *userLimit {
+	u, ok := r.users[user]
+	if !ok {
+		u = &userLimit{limiter: rate.NewLimiter(rate.Limit(r.cfg.MessagesPerSecond), r.cfg.Burst)}
+		r.users[user] = u
+	}
+	return u
+}
+
+func (r rateLimiter) recentViolations(u *userLimit, now time.Time) []time.Time {
+	threshold := now.Add(-r.cfg.ViolationWindow)
+	i := 0
+	for i < len(u.violations) && !u.violations[i].After(threshold) {
+		i++
+	}
+	return u.violations[i:]
+}
@@ -0,0 +1,81 @@
+package usecase
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	cfg := RateLimitConfig{
+		MessagesPerSecond: 1,
+		Burst:             2,
+		MaxViolations:     3,
+		ViolationWindow:   time.Minute,
+		MuteDuration:      time.Minute,
+	}
+	start := time.Now()
+
+	t.Run("allows a burst and refills", func(t *testing.T) {
+		r := newRateLimiter(cfg)
+		require.True(t, r.Allow("bob", start))
+		require.True(t, r.Allow("bob", start))
+		require.False(t, r.Allow("bob", start))
+		require.True(t, r.Allow("alice", start), "every user has a bucket of their own")
+		require.True(t, r.Allow("bob", start.Add(time.Second)))
+	})
+
+	t.Run("no limit", func(t *testing.T) {
+		r := newRateLimiter(RateLimitConfig{})
+		for range 100 {
+			require.True(t, r.Allow("bob", start))
+		}
+		require.False(t, r.AddViolation("bob", start))
+	})
+
+	t.Run("violations within the window", func(t *testing.T) {
+		r := newRateLimiter(cfg)
+		require.False(t, r.AddViolation("bob", start))
+		require.False(t, r.AddViolation("bob", start.Add(10*time.Second)))
+		require.True(t, r.AddViolation("bob", start.Add(20*time.Second)))
+		require.False(t, r.AddViolation("bob", start.Add(30*time.Second)), "the counter resets once the limit is hit")
+	})
+
+	t.Run("old violations expire", func(t *testing.T) {
+		r := newRateLimiter(cfg)
+		require.False(t, r.AddViolation("bob", start))
+		require.False(t, r.AddViolation("bob", start.Add(10*time.Second)))
+		require.False(t, r.AddViolation("bob", start.Add(cfg.ViolationWindow+5*time.Second)))
+	})
+
+	t.Run("release forgets only fresh users", func(t *testing.T) {
+		r := newRateLimiter(cfg)
+		r.Allow("bob", start)
+		r.Release("bob", start)
+		require.Contains(t, r.users, "bob", "a drained bucket is kept")
+		r.Release("bob", start.Add(time.Second))
+		require.NotContains(t, r.users, "bob")
+
+		r.AddViolation("alice", start)
+		r.Release("alice", start.Add(time.Second))
+		require.Contains(t, r.users, "alice", "a recent violation is kept")
+		r.Release("alice", start.Add(cfg.ViolationWindow+time.Second))
+		require.NotContains(t, r.users, "alice")
+	})
+	t.Run("sweep forgets users who left without release", func(t *testing.T) {
+		r := newRateLimiter(cfg)
+		r.Allow("bob", start)
+		r.Allow("bob", start)
+		r.AddViolation("alice", start)
+		r.Allow("carol", start)
+		require.Equal(t, 0, r.Sweep(start), "drained buckets and recent violations are kept")
+		require.Len(t, r.users, 3)
+
+		require.Equal(t, 2, r.Sweep(start.Add(2*time.Second)), "refilled buckets are forgotten")
+		require.Len(t, r.users, 1)
+		require.Contains(t, r.users, "alice")
+		require.Equal(t, 1, r.Sweep(start.Add(cfg.ViolationWindow+time.Second)))
+		require.Empty(t, r.users)
+	})
+}
@@ -0,0 +1,267 @@
+package usecase
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"ws-chat/internal/domain"
+)
+
+type ExportFormat string
+
+const (
+	ExportJSONLines ExportFormat = "jsonl"
+	ExportCSV       ExportFormat = "csv"
+)
+
+type ForgetMode string
+
+const (
+	// ForgetAnonymize keeps the messages but replaces the author, so conversations stay readable.
+	ForgetAnonymize ForgetMode = "anonymize"
+	ForgetDelete    ForgetMode = "delete"
+)
+
+const forgottenAuthor = "[deleted]"
+
+// orphanAttachmentAge is how long an upload may wait for the message that refers to it;
+// clients post it right after the upload, so an older unreferenced attachment is garbage.
+const orphanAttachmentAge = time.Hour
+
+type RetentionConfig struct {
+	// MaxAge and MaxMessagesPerRoom disable their policy when zero.
+	MaxAge             time.Duration
+	MaxMessagesPerRoom int
+	Interval           time.Duration
+	BatchSize          int
+}
+
+type retention struct {
+	repo     domain.RetentionRepository
+	messages domain.Repository
+	blobs    domain.BlobStore
+	cfg      RetentionConfig
+	logger   *zap.Logger
+}
+
+func NewRetention(
+	repo domain.RetentionRepository,
+	messages domain.Repository,
+	blobs domain.BlobStore,
+	cfg RetentionConfig,
+	logger *zap.Logger,
+) retention {
+	return retention{
+		repo:     repo,
+		messages: messages,
+		blobs:    blobs,
+		cfg:      cfg,
+		logger:   logger,
+	}
+}
+
+// Run enforces the retention policy every interval until ctx is cancelled. It runs even with
+// both policies disabled, since uploads that were never posted still have to be swept.
+func (r retention) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		deleted, err := r.Enforce(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.logger.Warn("retention: " + err.Error())
+		}
+		if deleted > 0 {
+			r.logger.Info("retention: deleted old messages", zap.Int("count", deleted))
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r retention) Enforce(ctx context.Context) (int, error) {
+	total := 0
+	if r.cfg.MaxAge > 0 {
+		before := time.Now().Add(-r.cfg.MaxAge)
+		n, err := r.inBatches(ctx, func(limit int) (int, error) {
+			return r.repo.DeleteMessagesBefore(ctx, before, limit)
+		})
+		total += n
+		if err != nil {
+			return total, errors.WithMessage(err, "delete expired messages")
+		}
+	}
+	if r.cfg.MaxMessagesPerRoom > 0 {
+		rooms, err := r.messages.ListRooms(ctx)
+		if err != nil {
+			return total, errors.WithMessage(err, "list rooms")
+		}
+		for _, room := range rooms {
+			if room.Messages <= r.cfg.MaxMessagesPerRoom {
+				continue
+			}
+			n, err := r.inBatches(ctx, func(limit int) (int, error) {
+				return r.repo.DeleteExcessMessages(ctx, room.Name, r.cfg.MaxMessagesPerRoom, limit)
+			})
+			total += n
+			if err != nil {
+				return total, errors.WithMessagef(err, "trim room '%s'", room.Name)
+			}
+		}
+	}
+	if err := r.deleteOrphanAttachments(ctx); err != nil {
+		return total, errors.WithMessage(err, "delete orphan attachments")
+	}
+	return total, nil
+}
+
+// deleteOrphanAttachments removes the attachments of the deleted messages and uploads nobody posted.
+func (r retention) deleteOrphanAttachments(ctx context.Context) error {
+	before := time.Now().Add(-orphanAttachmentAge)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		ids, err := r.repo.DeleteOrphanAttachments(ctx, before, r.cfg.BatchSize)
+		if err != nil {
+			return err
+		}
+		r.deleteBlobs(ctx, ids)
+		if len(ids) < r.cfg.BatchSize {
+			return nil
+		}
+	}
+}
+
+func (r retention) deleteBlobs(ctx context.Context, ids []string) {
+	for _, id := range ids {
+		if err := r.blobs.Delete(ctx, id); err != nil {
+			r.logger.Warn(err.Error(), zap.String("attachment", id))
+		}
+	}
+}
+
+// ForgetUser anonymizes or deletes the user's messages and removes everything else stored about them;
+// the records other users need, like the audit log, keep the placeholder author instead of the name.
+func (r retention) ForgetUser(ctx context.Context, user string, mode ForgetMode) (int, error) {
+	var (
+		n   int
+		err error
+	)
+	switch mode {
+	case ForgetAnonymize:
+		n, err = r.inBatches(ctx, func(limit int) (int, error) {
+			return r.repo.AnonymizeMessages(ctx, user, forgottenAuthor, limit)
+		})
+	case ForgetDelete:
+		n, err = r.inBatches(ctx, func(limit int) (int, error) {
+			return r.repo.DeleteUserMessages(ctx, user, limit)
+		})
+	default:
+		return 0, errors.Errorf("unknown forget mode '%s'", mode)
+	}
+	if err != nil {
+		return n, errors.WithMessage(err, "forget messages")
+	}
+	ids, err := r.repo.DeleteUserData(ctx, user, forgottenAuthor)
+	if err != nil {
+		return n, errors.WithMessage(err, "delete user data")
+	}
+	r.deleteBlobs(ctx, ids)
+	return n, nil
+}
+
+type exportRecord struct {
+	ID          int64     `json:"id"`
+	Room        string    `json:"room"`
+	Author      string    `json:"author"`
+	Text        string    `json:"text"`
+	Time        time.Time `json:"time"`
+	Attachments []string  `json:"attachments,omitempty"`
+}
+
+var csvHeader = []string{"id", "room", "author", "text", "time", "attachments"}
+
+// Export writes the room history sent in [from, to) page by page, so it doesn't hold the whole room in memory.
+func (r retention) Export(
+	ctx context.Context,
+	w io.Writer,
+	room string,
+	from, to time.Time,
+	format ExportFormat,
+) (int, error) {
+	var write func(msg domain.Message) error
+	finish := func() error { return nil }
+	switch format {
+	case ExportJSONLines:
+		encoder := json.NewEncoder(w)
+		write = func(msg domain.Message) error {
+			return encoder.Encode(exportRecord(msg))
+		}
+	case ExportCSV:
+		writer := csv.NewWriter(w)
+		finish = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+		if err := writer.Write(csvHeader); err != nil {
+			return 0, errors.WithMessage(err, "write header")
+		}
+		write = func(msg domain.Message) error {
+			return writer.Write([]string{
+				strconv.FormatInt(msg.ID, 10),
+				msg.Room,
+				msg.Author,
+				msg.Text,
+				msg.Time.UTC().Format(time.RFC3339Nano),
+				strings.Join(msg.Attachments, " "),
+			})
+		}
+	default:
+		return 0, errors.Errorf("unknown export format '%s'", format)
+	}
+	var (
+		afterID int64
+		total   int
+	)
+	for {
+		page, err := r.repo.ExportMessages(ctx, room, from, to, afterID, r.cfg.BatchSize)
+		if err != nil {
+			return total, errors.WithMessage(err, "export messages")
+		}
+		for _, msg := range page {
+			if err := write(msg); err != nil {
+				return total, errors.WithMessage(err, "write message")
+			}
+			afterID = msg.ID
+			total++
+		}
+		if len(page) < r.cfg.BatchSize {
+			return total, finish()
+		}
+	}
+}
+
+// inBatches repeats op until a batch comes back short, so no single statement locks many rows.
+func (r retention) inBatches(ctx context.Context, op func(limit int) (int, error)) (int, error) {
+	total := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		n, err := op(r.cfg.BatchSize)
+		total += n
+		if err != nil || n < r.cfg.BatchSize {
+			return total, err
+		}
+	}
+}
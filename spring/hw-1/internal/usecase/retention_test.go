@@ -0,0 +1,239 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"ws-chat/internal/adapters/diskstore"
+	"ws-chat/internal/adapters/memrepo"
+	"ws-chat/internal/domain"
+)
+
+type retentionFixture struct {
+	retention
+	repo interface {
+		domain.Repository
+		domain.RetentionRepository
+		domain.AttachmentRepository
+	}
+	blobs domain.BlobStore
+}
+
+func newTestRetention(t *testing.T, cfg RetentionConfig) retentionFixture {
+	t.Helper()
+	repo := memrepo.New()
+	blobs, err := diskstore.New(t.TempDir())
+	require.NoError(t, err)
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = 2
+	}
+	return retentionFixture{
+		retention: NewRetention(repo, repo, blobs, cfg, zap.NewNop()),
+		repo:      repo,
+		blobs:     blobs,
+	}
+}
+
+func (f retentionFixture) saveMessage(t *testing.T, room, author string, at time.Time, attachments ...string) int64 {
+	t.Helper()
+	id, err := f.repo.SaveMessage(context.Background(), domain.Message{
+		Room: room, Author: author, Text: fmt.Sprintf("%s at %s", author, at), Time: at, Attachments: attachments,
+	})
+	require.NoError(t, err)
+	return id
+}
+
+func (f retentionFixture) saveAttachment(t *testing.T, id, owner string, at time.Time) {
+	t.Helper()
+	ctx := context.Background()
+	require.NoError(t, f.blobs.Put(ctx, id, strings.NewReader("data")))
+	require.NoError(t, f.repo.SaveAttachment(ctx, domain.Attachment{
+		ID: id, Owner: owner, Name: id + ".txt", MIME: "text/plain", Size: 4, Time: at,
+	}))
+}
+
+func (f retentionFixture) requireBlob(t *testing.T, id string, exists bool) {
+	t.Helper()
+	r, err := f.blobs.Get(context.Background(), id)
+	if !exists {
+		require.Error(t, err, "blob '%s' should be deleted", id)
+		return
+	}
+	require.NoError(t, err, "blob '%s' should be kept", id)
+	_ = r.Close()
+}
+
+func (f retentionFixture) authors(t *testing.T, room string) []string {
+	t.Helper()
+	messages, err := f.repo.GetMessagesAfter(context.Background(), room, 0, 100)
+	require.NoError(t, err)
+	authors := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		authors = append(authors, msg.Author)
+	}
+	return authors
+}
+
+func TestEnforceMaxAge(t *testing.T) {
+	f := newTestRetention(t, RetentionConfig{MaxAge: time.Hour})
+	now := time.Now()
+	for i := range 5 {
+		f.saveMessage(t, domain.DefaultRoom, "old", now.Add(-2*time.Hour+time.Duration(i)*time.Minute))
+	}
+	f.saveMessage(t, domain.DefaultRoom, "new", now)
+
+	deleted, err := f.Enforce(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 5, deleted, "all expired messages are deleted across batches")
+	require.Equal(t, []string{"new"}, f.authors(t, domain.DefaultRoom))
+}
+
+func TestEnforceMaxMessagesPerRoom(t *testing.T) {
+	f := newTestRetention(t, RetentionConfig{MaxMessagesPerRoom: 2})
+	now := time.Now()
+	for i := range 5 {
+		f.saveMessage(t, domain.DefaultRoom, fmt.Sprint("user", i), now.Add(time.Duration(i)*time.Second))
+	}
+	f.saveMessage(t, "other", "alice", now)
+
+	deleted, err := f.Enforce(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 3, deleted)
+	require.ElementsMatch(t, []string{"user3", "user4"}, f.authors(t, domain.DefaultRoom), "the newest messages are kept")
+	require.Equal(t, []string{"alice"}, f.authors(t, "other"))
+}
+
+func TestEnforceDeletesOrphanAttachments(t *testing.T) {
+	f := newTestRetention(t, RetentionConfig{MaxAge: time.Hour})
+	now := time.Now()
+	old := now.Add(-2 * time.Hour)
+	f.saveAttachment(t, "expired", "alice", old)
+	f.saveAttachment(t, "kept", "alice", old)
+	f.saveAttachment(t, "unposted", "alice", old)
+	f.saveAttachment(t, "uploading", "alice", now)
+	f.saveMessage(t, domain.DefaultRoom, "alice", old, "expired")
+	f.saveMessage(t, domain.DefaultRoom, "alice", now, "kept")
+
+	_, err := f.Enforce(context.Background())
+	require.NoError(t, err)
+	f.requireBlob(t, "expired", false)
+	f.requireBlob(t, "unposted", false)
+	f.requireBlob(t, "kept", true)
+	f.requireBlob(t, "uploading", true)
+	left, err := f.repo.GetAttachments(context.Background(), []string{"expired", "kept", "unposted", "uploading"})
+	require.NoError(t, err)
+	require.Len(t, left, 2)
+}
+
+func TestRunSweepsOrphansWithoutPolicies(t *testing.T) {
+	f := newTestRetention(t, RetentionConfig{Interval: time.Hour})
+	f.saveAttachment(t, "unposted", "alice", time.Now().Add(-2*time.Hour))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- f.Run(ctx)
+	}()
+	require.Eventually(t, func() bool {
+		left, err := f.repo.GetAttachments(context.Background(), []string{"unposted"})
+		return err == nil && len(left) == 0
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+	f.requireBlob(t, "unposted", false)
+}
+
+func TestExport(t *testing.T) {
+	f := newTestRetention(t, RetentionConfig{})
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+	f.saveMessage(t, domain.DefaultRoom, "early", from.Add(-time.Second))
+	for i := range 5 {
+		f.saveMessage(t, domain.DefaultRoom, fmt.Sprint("user", i), from.Add(time.Duration(i)*time.Hour), "file")
+	}
+	f.saveMessage(t, "other", "alice", from)
+	f.saveMessage(t, domain.DefaultRoom, "late", to)
+
+	t.Run("jsonl", func(t *testing.T) {
+		var buf bytes.Buffer
+		n, err := f.Export(context.Background(), &buf, domain.DefaultRoom, from, to, ExportJSONLines)
+		require.NoError(t, err)
+		require.Equal(t, 5, n, "every page of the range is exported")
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Len(t, lines, 5)
+		for i, line := range lines {
+			var record exportRecord
+			require.NoError(t, json.Unmarshal([]byte(line), &record))
+			require.Equal(t, fmt.Sprint("user", i), record.Author)
+			require.Equal(t, domain.DefaultRoom, record.Room)
+			require.Equal(t, []string{"file"}, record.Attachments)
+		}
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		var buf bytes.Buffer
+		n, err := f.Export(context.Background(), &buf, domain.DefaultRoom, from, to, ExportCSV)
+		require.NoError(t, err)
+		require.Equal(t, 5, n)
+		rows, err := csv.NewReader(&buf).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, rows, 6)
+		require.Equal(t, csvHeader, rows[0])
+		require.Equal(t, "user0", rows[1][2])
+		require.Equal(t, from.Format(time.RFC3339Nano), rows[1][4])
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		_, err := f.Export(context.Background(), &bytes.Buffer{}, domain.DefaultRoom, from, to, "xml")
+		require.Error(t, err)
+	})
+}
+
+func TestForgetUser(t *testing.T) {
+	now := time.Now()
+	setup := func(t *testing.T) retentionFixture {
+		f := newTestRetention(t, RetentionConfig{})
+		for range 3 {
+			f.saveMessage(t, domain.DefaultRoom, "bob", now)
+		}
+		f.saveMessage(t, domain.DefaultRoom, "alice", now)
+		f.saveAttachment(t, "bob-file", "bob", now)
+		f.saveAttachment(t, "alice-file", "alice", now)
+		return f
+	}
+
+	t.Run("anonymize", func(t *testing.T) {
+		f := setup(t)
+		n, err := f.ForgetUser(context.Background(), "bob", ForgetAnonymize)
+		require.NoError(t, err)
+		require.Equal(t, 3, n)
+		require.Equal(t, []string{forgottenAuthor, forgottenAuthor, forgottenAuthor, "alice"}, f.authors(t, domain.DefaultRoom))
+		f.requireBlob(t, "bob-file", false)
+		f.requireBlob(t, "alice-file", true)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		f := setup(t)
+		n, err := f.ForgetUser(context.Background(), "bob", ForgetDelete)
+		require.NoError(t, err)
+		require.Equal(t, 3, n)
+		require.Equal(t, []string{"alice"}, f.authors(t, domain.DefaultRoom))
+		f.requireBlob(t, "bob-file", false)
+		f.requireBlob(t, "alice-file", true)
+	})
+
+	t.Run("unknown mode", func(t *testing.T) {
+		f := setup(t)
+		_, err := f.ForgetUser(context.Background(), "bob", "shred")
+		require.Error(t, err)
+		require.Len(t, f.authors(t, domain.DefaultRoom), 4, "nothing is forgotten")
+		f.requireBlob(t, "bob-file", true)
+	})
+}
@@ -0,0 +1,73 @@
+package usecase
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"slices"
+	"time"
+
+	"ws-chat/internal/domain"
+)
+
+const scrollbackPageSize = 50
+
+// sendHistory answers a scroll-back request with the page of messages that
+// precede beforeID in the client's room; zero asks for the newest page.
+func (h hub) sendHistory(ctx context.Context, key clientKey, client domain.Client, beforeID int64) {
+	before := beforeID
+	if before <= 0 {
+		before = math.MaxInt64
+	}
+	messages, err := h.repo.GetMessagesBefore(ctx, key.room, before, scrollbackPageSize)
+	if err != nil {
+		h.log(ctx).Warn(err.Error())
+		h.sendError(client, domain.CodeBadFrame, "failed to load history")
+		return
+	}
+	frames := make([]domain.Frame, 0, len(messages))
+	for _, msg := range messages {
+		frames = append(frames, h.messageFrame(ctx, msg))
+	}
+	h.writeFrame(client, domain.Frame{
+		Type:     domain.FrameHistory,
+		ID:       beforeID,
+		Room:     key.room,
+		Count:    len(frames),
+		Time:     time.Now(),
+		Messages: frames,
+	})
+}
+
+// sendRooms lists rooms that have messages or connected users, most recently active first.
+func (h hub) sendRooms(ctx context.Context, key clientKey, client domain.Client) {
+	rooms, err := h.repo.ListRooms(ctx)
+	if err != nil {
+		h.log(ctx).Warn(err.Error())
+		h.sendError(client, domain.CodeBadFrame, "failed to list rooms")
+		return
+	}
+	online := h.onlineByRoom()
+	frames := make([]domain.FrameRoom, 0, len(rooms)+len(online))
+	for _, room := range rooms {
+		frames = append(frames, domain.FrameRoom{
+			Name:         room.Name,
+			Messages:     room.Messages,
+			Online:       online[room.Name],
+			LastActivity: room.LastActivity,
+		})
+		delete(online, room.Name)
+	}
+	empty := make([]domain.FrameRoom, 0, len(online))
+	for name, count := range online {
+		empty = append(empty, domain.FrameRoom{Name: name, Online: count})
+	}
+	slices.SortFunc(empty, func(a, b domain.FrameRoom) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	h.writeFrame(client, domain.Frame{
+		Type:  domain.FrameRooms,
+		Time:  time.Now(),
+		Rooms: append(frames, empty...),
+	})
+}
@@ -3,96 +3,433 @@ package usecase
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"ws-chat/internal/domain"
+	"ws-chat/internal/logctx"
+)
+
+// drop reasons reported to metrics besides the error codes sent to clients
+const (
+	dropReasonStorage = "storage"
+	dropReasonFilter  = "filter"
 )
 
 type hub struct {
-	repo    domain.Repository
-	logger  *zap.Logger
-	clients map[string]domain.Client
-	mu      *sync.Mutex
+	repo        domain.Repository
+	moderation  domain.ModerationRepository
+	direct      domain.DirectRepository
+	filter      domain.MessageFilter
+	limiter     rateLimiter
+	attachments attachments
+	webhooks    webhooks
+	metrics     domain.ChatMetrics
+	logger      *zap.Logger
+	clients     map[clientKey]connection
+	mu          *sync.Mutex
+	drainer     *drainer
+}
+
+// clientKey identifies a connection: a user may sit in several rooms at once, but only once per room.
+type clientKey struct {
+	user string
+	room string
+}
+
+// connection is a registered client and whether it proved it owns its name.
+type connection struct {
+	client        domain.Client
+	authenticated bool
+}
+
+// peer is a connection as the commands see it: only an authenticated peer gets the role of its name.
+type peer struct {
+	clientKey
+	authenticated bool
 }
 
-func New(repo domain.Repository, logger *zap.Logger) hub {
+func New(
+	repo domain.Repository,
+	moderation domain.ModerationRepository,
+	direct domain.DirectRepository,
+	filter domain.MessageFilter,
+	limits RateLimitConfig,
+	attachments attachments,
+	webhooks webhooks,
+	metrics domain.ChatMetrics,
+	logger *zap.Logger,
+) hub {
 	return hub{
-		repo:    repo,
-		logger:  logger,
-		clients: make(map[string]domain.Client),
-		mu:      &sync.Mutex{},
+		repo:        repo,
+		moderation:  moderation,
+		direct:      direct,
+		filter:      filter,
+		limiter:     newRateLimiter(limits),
+		attachments: attachments,
+		webhooks:    webhooks,
+		metrics:     metrics,
+		logger:      logger,
+		clients:     make(map[clientKey]connection),
+		mu:          &sync.Mutex{},
+		drainer:     &drainer{},
 	}
 }
 
-func (h hub) Handle(ctx context.Context, clientName string, client domain.Client) error {
-	if err := h.addClient(clientName, client); err != nil {
+// Handle serves one connection. A request-scoped logger can be put into ctx with
+// logctx.With; the hub adds the room to it and uses it for everything about this client.
+func (h hub) Handle(ctx context.Context, session domain.Session, conn domain.Client) error {
+	if h.drainer.isDraining() {
+		return domain.ErrShuttingDown
+	}
+	ctx = logctx.With(ctx, h.log(ctx).With(zap.String("room", session.Room)))
+	clientName := session.User
+	if !domain.ValidRoomName(session.Room) {
+		h.sendError(conn, domain.CodeInvalidRoom, fmt.Sprintf("invalid room name '%s'", session.Room))
+		return domain.ErrInvalidRoom
+	}
+	key := clientKey{user: clientName, room: session.Room}
+	self := peer{clientKey: key, authenticated: session.Authenticated}
+	ban, banned, err := h.activeSanction(ctx, clientName, domain.SanctionBan)
+	if err != nil {
+		return errors.WithMessage(err, "check ban")
+	}
+	if banned {
+		h.sendError(conn, domain.CodeBanned, fmt.Sprintf("you are banned until %s", ban.Until.Format(time.RFC1123)))
+		return domain.ErrUserBanned
+	}
+	client := newReplayClient(conn)
+	if err := h.addClient(self, client); err != nil {
 		return errors.WithMessage(err, "add client")
 	}
-	defer h.removeClient(clientName)
-	h.sendRecentMessages(ctx, client)
+	h.metrics.ClientConnected()
+	defer func() {
+		h.removeClient(key)
+		h.publish(context.WithoutCancel(ctx), domain.Event{Type: domain.EventUserLeft, Room: key.room, User: clientName})
+	}()
+	h.publish(ctx, domain.Event{Type: domain.EventUserJoined, Room: key.room, User: clientName})
+	lastID, err := h.replayHistory(ctx, session, client)
+	if err != nil {
+		h.log(ctx).Warn(err.Error())
+	}
+	if err := client.goLive(lastID); err != nil {
+		return errors.WithMessage(err, "flush pending frames")
+	}
+	// a guest only claims the name, so the messages sent to it wait for its owner
+	if session.Authenticated {
+		h.deliverPending(ctx, clientName, client)
+	}
 	for {
-		msg, err := client.ReadMessage()
-		if err != nil {
+		frame, err := client.ReadFrame()
+		if errors.Is(err, domain.ErrMessageTooLarge) {
+			h.log(ctx).Info("message size limit exceeded")
+			h.sendError(client, domain.CodeTooLarge, "your message is too large, the connection is closed")
+			h.metrics.MessageDropped(domain.CodeTooLarge)
+			h.addViolation(ctx, clientName, client)
 			break
 		}
-		if len(msg) == 0 {
+		if errors.Is(err, domain.ErrBadFrame) {
+			h.sendError(client, domain.CodeBadFrame, err.Error())
 			continue
 		}
-		h.logger.Info(string(msg), zap.String("client", clientName))
-		err = h.repo.SaveMessage(ctx, domain.Message{
-			Author: clientName,
-			Text:   string(msg),
-			Time:   time.Now(),
-		})
 		if err != nil {
-			return errors.WithMessage(err, "save message")
+			break
+		}
+		switch frame.Type {
+		case domain.FrameAck:
+			h.ack(ctx, key, frame.ID)
+		case domain.FrameHistory:
+			h.sendHistory(ctx, key, client, frame.ID)
+		case domain.FrameRooms:
+			h.sendRooms(ctx, key, client)
+		case domain.FrameKey:
+			h.handleKey(ctx, self, client, frame)
+		case domain.FrameDirect:
+			h.metrics.MessageReceived()
+			if err := h.handleDirect(ctx, key, client, frame); err != nil {
+				return err
+			}
+		case domain.FrameMessage:
+			h.metrics.MessageReceived()
+			if err := h.handleMessage(ctx, self, client, frame); err != nil {
+				return err
+			}
+		default:
+			h.sendError(client, domain.CodeBadFrame, fmt.Sprintf("unexpected frame type '%s'", frame.Type))
 		}
-		go h.writeMessage(clientName, msg)
 	}
 	return nil
 }
 
-func (h hub) writeMessage(clientName string, message []byte) {
-	msg := append([]byte(clientName+": "), message...)
-	for _, client := range h.clients {
-		err := client.WriteMessage(msg)
+func (h hub) handleMessage(ctx context.Context, self peer, client domain.Client, frame domain.Frame) error {
+	clientName := self.user
+	text, attachmentIDs := frame.Text, make([]string, 0, len(frame.Attachments))
+	for _, at := range frame.Attachments {
+		attachmentIDs = append(attachmentIDs, at.ID)
+	}
+	if text == "" && len(attachmentIDs) == 0 {
+		return nil
+	}
+	if !h.allowMessage(ctx, clientName, client) {
+		return nil
+	}
+	if isCommand(text) && len(attachmentIDs) == 0 {
+		// a bot posts its reply to the room, so a muted user must not reach one
+		if !isBuiltinCommand(strings.Fields(text)[0]) && !h.checkMuted(ctx, clientName, client) {
+			return nil
+		}
+		h.handleCommand(ctx, self, client, text)
+		return nil
+	}
+	text, ok := h.checkMessage(ctx, clientName, client, text)
+	if !ok {
+		return nil
+	}
+	if err := h.attachments.resolve(ctx, clientName, attachmentIDs); err != nil {
+		h.sendError(client, domain.CodeAttachment, err.Error())
+		h.metrics.MessageDropped(domain.CodeAttachment)
+		return nil
+	}
+	msg := domain.Message{
+		Room:        self.room,
+		Author:      clientName,
+		Text:        text,
+		Time:        time.Now(),
+		Attachments: attachmentIDs,
+	}
+	_, err := h.postMessage(ctx, msg)
+	if errors.Is(err, domain.ErrShuttingDown) {
+		h.sendError(client, domain.CodeShuttingDown, err.Error())
+		return nil
+	}
+	return err
+}
+
+// postMessage stores the message, broadcasts it to the room and queues webhook deliveries.
+func (h hub) postMessage(ctx context.Context, msg domain.Message) (domain.Message, error) {
+	if !h.drainer.begin() {
+		h.metrics.MessageDropped(domain.CodeShuttingDown)
+		return domain.Message{}, domain.ErrShuttingDown
+	}
+	defer h.drainer.done()
+	h.log(ctx).Info(msg.Text, zap.String("author", msg.Author))
+	id, err := h.repo.SaveMessage(ctx, msg)
+	if err != nil {
+		h.metrics.MessageDropped(dropReasonStorage)
+		return domain.Message{}, errors.WithMessage(err, "save message")
+	}
+	msg.ID = id
+	go h.writeMessage(context.WithoutCancel(ctx), msg)
+	h.publish(ctx, domain.Event{Type: domain.EventMessageCreated, Room: msg.Room, Message: &msg, Time: msg.Time})
+	return msg, nil
+}
+
+func (h hub) publish(ctx context.Context, event domain.Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if err := h.webhooks.publish(ctx, event); err != nil {
+		h.logger.Warn(err.Error(), zap.String("event", string(event.Type)), zap.String("room", event.Room))
+	}
+}
+
+func (h hub) addViolation(ctx context.Context, clientName string, client domain.Client) {
+	if !h.limiter.AddViolation(clientName, time.Now()) {
+		return
+	}
+	duration := h.limiter.cfg.MuteDuration
+	now := time.Now()
+	err := h.moderation.AddSanction(ctx, domain.Sanction{
+		User:     clientName,
+		Kind:     domain.SanctionMute,
+		Until:    now.Add(duration),
+		IssuedBy: systemActor,
+		Time:     now,
+	})
+	if err != nil {
+		h.log(ctx).Warn(err.Error())
+		return
+	}
+	h.log(ctx).Info("user muted for repeated violations")
+	h.sendError(client, domain.CodeMuted, fmt.Sprintf("you were muted for %s for flooding", duration))
+	if err := h.audit(ctx, systemActor, string(domain.SanctionMute), clientName, "duration="+duration.String()); err != nil {
+		h.log(ctx).Warn(err.Error())
+	}
+}
+
+func (h hub) allowMessage(ctx context.Context, clientName string, client domain.Client) bool {
+	if h.limiter.Allow(clientName, time.Now()) {
+		return true
+	}
+	h.log(ctx).Info("message rate limit exceeded")
+	h.sendError(client, domain.CodeRateLimited, "you are sending messages too fast")
+	h.metrics.MessageDropped(domain.CodeRateLimited)
+	h.addViolation(ctx, clientName, client)
+	return false
+}
+
+func (h hub) checkMuted(ctx context.Context, clientName string, client domain.Client) bool {
+	mute, muted, err := h.activeSanction(ctx, clientName, domain.SanctionMute)
+	if err != nil {
+		h.log(ctx).Warn(err.Error())
+	}
+	if muted {
+		h.sendError(client, domain.CodeMuted, fmt.Sprintf("you are muted until %s", mute.Until.Format(time.RFC1123)))
+		h.metrics.MessageDropped(domain.CodeMuted)
+		return false
+	}
+	return true
+}
+
+func (h hub) checkMessage(ctx context.Context, clientName string, client domain.Client, text string) (string, bool) {
+	if !h.checkMuted(ctx, clientName, client) {
+		return "", false
+	}
+	text, err := h.filter.Apply(text)
+	if errors.Is(err, domain.ErrMessageRejected) {
+		h.log(ctx).Info("message rejected by filter")
+		h.sendError(client, domain.CodeRejected, "your message was rejected by the filter")
+		h.metrics.MessageDropped(domain.CodeRejected)
+		return "", false
+	}
+	if err != nil {
+		h.log(ctx).Warn(err.Error())
+		h.metrics.MessageDropped(dropReasonFilter)
+		return "", false
+	}
+	return text, true
+}
+
+func (h hub) activeSanction(
+	ctx context.Context,
+	clientName string,
+	kind domain.SanctionKind,
+) (domain.Sanction, bool, error) {
+	sanctions, err := h.moderation.GetActiveSanctions(ctx, clientName, time.Now())
+	if err != nil {
+		return domain.Sanction{}, false, errors.WithMessage(err, "get active sanctions")
+	}
+	for _, s := range sanctions {
+		if s.Kind == kind {
+			return s, true, nil
+		}
+	}
+	return domain.Sanction{}, false, nil
+}
+
+func (h hub) writeMessage(ctx context.Context, msg domain.Message) {
+	frame := h.messageFrame(ctx, msg)
+	start := time.Now()
+	for _, client := range h.roomClients(msg.Room) {
+		err := client.WriteFrame(frame)
 		if err != nil {
+			h.metrics.WriteFailed()
 			h.logger.Warn(err.Error())
 		}
 	}
+	h.metrics.MessageBroadcast(time.Since(start))
+}
+
+func (h hub) notify(client domain.Client, text string) {
+	h.writeFrame(client, domain.Frame{Type: domain.FrameNotice, Text: text, Time: time.Now()})
+}
+
+func (h hub) sendError(client domain.Client, code, text string) {
+	h.writeFrame(client, domain.Frame{Type: domain.FrameError, Code: code, Text: text, Time: time.Now()})
+}
+
+func (h hub) writeFrame(client domain.Client, frame domain.Frame) {
+	if err := client.WriteFrame(frame); err != nil {
+		h.metrics.WriteFailed()
+		h.logger.Warn(err.Error())
+	}
+}
+
+func (h hub) log(ctx context.Context) *zap.Logger {
+	return logctx.From(ctx, h.logger)
 }
 
-func (h hub) removeClient(clientName string) {
+func (h hub) snapshotClients() []domain.Client {
 	h.mu.Lock()
-	delete(h.clients, clientName)
-	h.mu.Unlock()
+	defer h.mu.Unlock()
+	clients := make([]domain.Client, 0, len(h.clients))
+	for _, conn := range h.clients {
+		clients = append(clients, conn.client)
+	}
+	return clients
 }
 
-func (h hub) addClient(clientName string, client domain.Client) error {
+func (h hub) roomClients(room string) []domain.Client {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	if _, ok := h.clients[clientName]; ok {
-		h.logger.Info(fmt.Sprintf("client with name '%s' is already in chat", clientName))
-		return errors.New("client with such name is already in chat")
+	clients := make([]domain.Client, 0)
+	for key, conn := range h.clients {
+		if key.room == room {
+			clients = append(clients, conn.client)
+		}
 	}
-	h.clients[clientName] = client
-	return nil
+	return clients
 }
 
-func (h hub) sendRecentMessages(ctx context.Context, client domain.Client) {
-	recentMessages, err := h.repo.GetRecentMessages(ctx)
-	if err != nil {
-		h.logger.Warn(err.Error())
-		return
+// userClients returns every connection of the user, one per room they joined.
+func (h hub) userClients(clientName string) []domain.Client {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	clients := make([]domain.Client, 0)
+	for key, conn := range h.clients {
+		if key.user == clientName {
+			clients = append(clients, conn.client)
+		}
 	}
-	for _, msg := range recentMessages {
-		message := fmt.Sprintf("%s: %s", msg.Author, msg.Text)
-		err := client.WriteMessage([]byte(message))
-		if err != nil {
-			h.logger.Warn(err.Error())
+	return clients
+}
+
+// ownerClients returns the connections of the user that authenticated as them.
+func (h hub) ownerClients(clientName string) []domain.Client {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	clients := make([]domain.Client, 0)
+	for key, conn := range h.clients {
+		if key.user == clientName && conn.authenticated {
+			clients = append(clients, conn.client)
 		}
 	}
+	return clients
+}
+
+func (h hub) onlineByRoom() map[string]int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	online := make(map[string]int)
+	for key := range h.clients {
+		online[key.room]++
+	}
+	return online
+}
+
+func (h hub) removeClient(key clientKey) {
+	h.mu.Lock()
+	delete(h.clients, key)
+	h.mu.Unlock()
+	h.metrics.ClientDisconnected()
+	h.limiter.Release(key.user, time.Now())
+}
+
+func (h hub) addClient(self peer, client domain.Client) error {
+	key := self.clientKey
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[key]; ok {
+		h.logger.Info(fmt.Sprintf("client with name '%s' is already in room '%s'", key.user, key.room))
+		return errors.New("client with such name is already in this room")
+	}
+	h.clients[key] = connection{client: client, authenticated: self.authenticated}
+	return nil
+}
+
+func isCommand(text string) bool {
+	return strings.HasPrefix(text, commandPrefix)
 }
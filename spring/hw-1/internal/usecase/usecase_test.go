@@ -0,0 +1,206 @@
+package usecase
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"ws-chat/internal/adapters/diskstore"
+	"ws-chat/internal/adapters/memrepo"
+	"ws-chat/internal/domain"
+	"ws-chat/internal/metrics"
+)
+
+func newTestHub(t *testing.T) hub {
+	t.Helper()
+	repo := memrepo.New()
+	blobs, err := diskstore.New(t.TempDir())
+	require.NoError(t, err)
+	filter, err := NewFilter(FilterMask, nil, nil)
+	require.NoError(t, err)
+	logger := zap.NewNop()
+	return New(
+		repo,
+		repo,
+		repo,
+		filter,
+		RateLimitConfig{MessagesPerSecond: 100, Burst: 100, MaxViolations: 3, ViolationWindow: time.Minute, MuteDuration: time.Minute},
+		NewAttachments(repo, blobs, repo, AttachmentConfig{Secret: []byte("secret"), LinkTTL: time.Hour}, logger),
+		NewWebhooks(repo, WebhookConfig{MaxAttempts: 3, MinBackoff: time.Second, MaxBackoff: time.Minute}, logger),
+		metrics.NewChat(prometheus.NewRegistry()),
+		logger,
+	)
+}
+
+// fakeClient feeds the hub the frames sent to in and records everything the hub writes.
+// Once in is closed, reads fail with readErr, or ErrConnectionClosed if it is nil.
+type fakeClient struct {
+	in      chan domain.Frame
+	readErr error
+	mu      sync.Mutex
+	frames  []domain.Frame
+	closed  bool
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{in: make(chan domain.Frame, 16)}
+}
+
+func (c *fakeClient) WriteFrame(frame domain.Frame) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.frames = append(c.frames, frame)
+	return nil
+}
+
+func (c *fakeClient) ReadFrame() (domain.Frame, error) {
+	frame, ok := <-c.in
+	if !ok && c.readErr != nil {
+		return domain.Frame{}, c.readErr
+	}
+	if !ok {
+		return domain.Frame{}, domain.ErrConnectionClosed
+	}
+	return frame, nil
+}
+
+func (c *fakeClient) Close(domain.CloseReason) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *fakeClient) errorCodes() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var codes []string
+	for _, frame := range c.frames {
+		if frame.Type == domain.FrameError {
+			codes = append(codes, frame.Code)
+		}
+	}
+	return codes
+}
+
+func TestAuthorize(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHub(t)
+	require.NoError(t, h.moderation.SetRole(ctx, "mod", domain.RoleModerator))
+	require.NoError(t, h.moderation.SetRole(ctx, "root", domain.RoleAdmin))
+
+	tests := []struct {
+		name     string
+		actor    domain.Role
+		required domain.Role
+		target   string
+		allowed  bool
+	}{
+		{name: "moderator on member", actor: domain.RoleModerator, required: domain.RoleModerator, target: "bob", allowed: true},
+		{name: "admin on moderator", actor: domain.RoleAdmin, required: domain.RoleModerator, target: "mod", allowed: true},
+		{name: "member lacks the role", actor: domain.RoleMember, required: domain.RoleModerator, target: "bob"},
+		{name: "moderator on moderator", actor: domain.RoleModerator, required: domain.RoleModerator, target: "mod"},
+		{name: "moderator on admin", actor: domain.RoleModerator, required: domain.RoleModerator, target: "root"},
+		{name: "moderator below admin command", actor: domain.RoleModerator, required: domain.RoleAdmin, target: "bob"},
+		{name: "admin on admin", actor: domain.RoleAdmin, required: domain.RoleAdmin, target: "root"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := h.authorize(ctx, tt.actor, tt.required, tt.target)
+			if tt.allowed {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, errForbidden)
+			}
+		})
+	}
+}
+
+func TestCommandsNeedAuthentication(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHub(t)
+	require.NoError(t, h.moderation.SetRole(ctx, "alice", domain.RoleAdmin))
+	key := clientKey{user: "alice", room: domain.DefaultRoom}
+	client := newFakeClient()
+
+	guest := peer{clientKey: key}
+	commands := [][]string{
+		{cmdBan, "bob", "1h"},
+		{cmdMute, "bob", "1h"},
+		{cmdRole, "bob", "admin"},
+		// these reply with secrets
+		{cmdWebhook, "add", "https://hooks.example"},
+		{cmdBot, "add", "deploy"},
+	}
+	for _, command := range commands {
+		_, err := h.runCommand(ctx, guest, client, command)
+		require.ErrorIs(t, err, errForbidden, command[0])
+	}
+	_, banned, err := h.activeSanction(ctx, "bob", domain.SanctionBan)
+	require.NoError(t, err)
+	require.False(t, banned)
+
+	admin := peer{clientKey: key, authenticated: true}
+	_, err = h.runCommand(ctx, admin, client, []string{cmdBan, "bob", "1h"})
+	require.NoError(t, err)
+	_, banned, err = h.activeSanction(ctx, "bob", domain.SanctionBan)
+	require.NoError(t, err)
+	require.True(t, banned)
+}
+
+func TestMutedUserCantReachBots(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHub(t)
+	server := newHookServer(t)
+	require.NoError(t, h.webhooks.repo.SaveBot(ctx, domain.Bot{
+		Name: "deploy", URL: server.URL, Token: "token", CreatedBy: "root", Time: time.Now(),
+	}))
+	require.NoError(t, h.moderation.AddSanction(ctx, domain.Sanction{
+		User: "bob", Kind: domain.SanctionMute, Until: time.Now().Add(time.Hour), IssuedBy: "mod", Time: time.Now(),
+	}))
+	client := newFakeClient()
+	self := peer{clientKey: clientKey{user: "bob", room: domain.DefaultRoom}, authenticated: true}
+
+	require.NoError(t, h.handleMessage(ctx, self, client, domain.Frame{Type: domain.FrameMessage, Text: "/deploy prod"}))
+	require.Equal(t, []string{domain.CodeMuted}, client.errorCodes())
+	require.Len(t, client.frames, 1, "the command was sent to the bot")
+	require.Zero(t, server.received())
+}
+
+func TestMessageTooLarge(t *testing.T) {
+	h := newTestHub(t)
+	client := newFakeClient()
+	client.readErr = domain.ErrMessageTooLarge
+	close(client.in)
+	err := h.Handle(context.Background(), domain.Session{User: "bob", Room: domain.DefaultRoom}, client)
+	require.NoError(t, err)
+	require.Equal(t, []string{domain.CodeTooLarge}, client.errorCodes())
+}
+
+func TestSanctionExpiry(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHub(t)
+	now := time.Now()
+	require.NoError(t, h.moderation.AddSanction(ctx, domain.Sanction{
+		User: "bob", Kind: domain.SanctionMute, Until: now.Add(-time.Second), IssuedBy: "mod", Time: now.Add(-time.Minute),
+	}))
+	_, muted, err := h.activeSanction(ctx, "bob", domain.SanctionMute)
+	require.NoError(t, err)
+	require.False(t, muted, "an expired mute is still active")
+
+	require.NoError(t, h.moderation.AddSanction(ctx, domain.Sanction{
+		User: "bob", Kind: domain.SanctionMute, Until: now.Add(time.Hour), IssuedBy: "mod", Time: now,
+	}))
+	mute, muted, err := h.activeSanction(ctx, "bob", domain.SanctionMute)
+	require.NoError(t, err)
+	require.True(t, muted)
+	require.WithinDuration(t, now.Add(time.Hour), mute.Until, time.Second)
+
+	_, banned, err := h.activeSanction(ctx, "bob", domain.SanctionBan)
+	require.NoError(t, err)
+	require.False(t, banned, "a mute is reported as a ban")
+}
@@ -0,0 +1,247 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"ws-chat/internal/domain"
+)
+
+const (
+	eventHeader     = "X-Chat-Event"
+	deliveryHeader  = "X-Chat-Delivery"
+	timestampHeader = "X-Chat-Timestamp"
+	signatureHeader = "X-Chat-Signature"
+	signaturePrefix = "sha256="
+)
+
+type WebhookConfig struct {
+	MaxAttempts  int
+	MinBackoff   time.Duration
+	MaxBackoff   time.Duration
+	PollInterval time.Duration
+	Timeout      time.Duration
+	BatchSize    int
+}
+
+type webhooks struct {
+	repo   domain.WebhookRepository
+	client *http.Client
+	cfg    WebhookConfig
+	logger *zap.Logger
+	wake   chan struct{}
+}
+
+func NewWebhooks(repo domain.WebhookRepository, cfg WebhookConfig, logger *zap.Logger) webhooks {
+	return webhooks{
+		repo:   repo,
+		client: &http.Client{Timeout: cfg.Timeout},
+		cfg:    cfg,
+		logger: logger,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+type eventPayload struct {
+	Event   domain.EventType `json:"event"`
+	Room    string           `json:"room"`
+	User    string           `json:"user,omitempty"`
+	Message *payloadMessage  `json:"message,omitempty"`
+	Time    time.Time        `json:"time"`
+}
+
+type payloadMessage struct {
+	ID          int64     `json:"id"`
+	Author      string    `json:"author"`
+	Text        string    `json:"text"`
+	Time        time.Time `json:"time"`
+	Attachments []string  `json:"attachments,omitempty"`
+}
+
+// publish puts the event into the outbox of every subscription of its room that asked for it.
+func (w webhooks) publish(ctx context.Context, event domain.Event) error {
+	subscriptions, err := w.repo.ListSubscriptions(ctx, event.Room)
+	if err != nil {
+		return errors.WithMessage(err, "list subscriptions")
+	}
+	payload := eventPayload{Event: event.Type, Room: event.Room, User: event.User, Time: event.Time}
+	if msg := event.Message; msg != nil {
+		payload.Message = &payloadMessage{
+			ID:          msg.ID,
+			Author:      msg.Author,
+			Text:        msg.Text,
+			Time:        msg.Time,
+			Attachments: msg.Attachments,
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return errors.WithMessage(err, "marshal event")
+	}
+	deliveries := make([]domain.Delivery, 0, len(subscriptions))
+	for _, s := range subscriptions {
+		if !slices.Contains(s.Events, event.Type) {
+			continue
+		}
+		deliveries = append(deliveries, domain.Delivery{
+			SubscriptionID: s.ID,
+			Event:          event.Type,
+			Payload:        body,
+			NextAttempt:    event.Time,
+			Time:           event.Time,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	if err := w.repo.EnqueueDeliveries(ctx, deliveries); err != nil {
+		return errors.WithMessage(err, "enqueue deliveries")
+	}
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run sends outbox deliveries until ctx is cancelled. Deliveries that were claimed
+// when the process died are picked up again once their lease runs out.
+func (w webhooks) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		w.flush(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-w.wake:
+		}
+	}
+}
+
+func (w webhooks) flush(ctx context.Context) {
+	for ctx.Err() == nil {
+		now := time.Now()
+		deliveries, err := w.repo.ClaimDeliveries(ctx, now, now.Add(2*w.cfg.Timeout), w.cfg.BatchSize)
+		if err != nil {
+			w.logger.Warn(err.Error())
+			return
+		}
+		wg := &sync.WaitGroup{}
+		for _, d := range deliveries {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				w.attempt(ctx, d)
+			}()
+		}
+		wg.Wait()
+		if len(deliveries) < w.cfg.BatchSize {
+			return
+		}
+	}
+}
+
+func (w webhooks) attempt(ctx context.Context, d domain.Delivery) {
+	err := w.deliver(ctx, d)
+	// bookkeeping must survive shutdown, otherwise the delivery waits out its lease
+	ctx = context.WithoutCancel(ctx)
+	logger := w.logger.With(zap.Int64("delivery", d.ID), zap.String("subscription", d.SubscriptionID))
+	if err == nil {
+		if err := w.repo.CompleteDelivery(ctx, d.ID); err != nil {
+			logger.Warn(err.Error())
+		}
+		return
+	}
+	attempts := d.Attempts + 1
+	if errors.Is(err, errPermanent) || attempts >= w.cfg.MaxAttempts {
+		logger.Warn("webhook delivery failed for good", zap.Int("attempts", attempts), zap.Error(err))
+		if err := w.repo.FailDelivery(ctx, d.ID, err.Error()); err != nil {
+			logger.Warn(err.Error())
+		}
+		return
+	}
+	next := time.Now().Add(w.backoff(attempts))
+	logger.Info("webhook delivery will be retried", zap.Int("attempts", attempts), zap.Time("next", next), zap.Error(err))
+	if err := w.repo.RetryDelivery(ctx, d.ID, next, err.Error()); err != nil {
+		logger.Warn(err.Error())
+	}
+}
+
+var errPermanent = errors.New("endpoint is gone")
+
+func (w webhooks) deliver(ctx context.Context, d domain.Delivery) error {
+	req, err := signedRequest(ctx, d.URL, d.Secret, d.Payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(eventHeader, string(d.Event))
+	req.Header.Set(deliveryHeader, strconv.FormatInt(d.ID, 10))
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return errors.WithMessage(err, "send request")
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+		_ = resp.Body.Close()
+	}()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusGone:
+		return errors.WithMessage(errPermanent, resp.Status)
+	default:
+		return errors.New(resp.Status)
+	}
+}
+
+// backoff doubles the delay with every attempt and spreads retries
+// over the upper half of the interval so failed receivers aren't hit in bursts.
+func (w webhooks) backoff(attempts int) time.Duration {
+	delay := w.cfg.MinBackoff
+	for i := 1; i < attempts && delay < w.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, w.cfg.MaxBackoff)
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// signedRequest builds a JSON POST that receivers verify by computing
+// HMAC-SHA256 over "<timestamp>.<body>" with the shared secret.
+func signedRequest(ctx context.Context, url, secret string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.WithMessage(err, "build request")
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = fmt.Fprintf(mac, "%s.%s", timestamp, body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(timestampHeader, timestamp)
+	req.Header.Set(signatureHeader, signaturePrefix+hex.EncodeToString(mac.Sum(nil)))
+	return req, nil
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := crand.Read(b); err != nil {
+		return "", errors.WithMessage(err, "generate token")
+	}
+	return hex.EncodeToString(b), nil
+}
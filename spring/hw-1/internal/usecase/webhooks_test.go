@@ -0,0 +1,157 @@
+package usecase
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"ws-chat/internal/adapters/memrepo"
+	"ws-chat/internal/domain"
+)
+
+func TestSignedRequest(t *testing.T) {
+	body := []byte(`{"event":"message.created"}`)
+	before := time.Now().Unix()
+	req, err := signedRequest(context.Background(), "http://hooks.example/chat", "secret", body)
+	require.NoError(t, err)
+	require.Equal(t, http.MethodPost, req.Method)
+	require.Equal(t, "application/json", req.Header.Get("Content-Type"))
+
+	timestamp := req.Header.Get(timestampHeader)
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, sent, before)
+
+	got, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	require.Equal(t, body, got)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(timestamp + "." + string(body)))
+	require.Equal(t, signaturePrefix+hex.EncodeToString(mac.Sum(nil)), req.Header.Get(signatureHeader))
+
+	_, err = signedRequest(context.Background(), "://bad", "secret", body)
+	require.Error(t, err)
+}
+
+func TestBackoff(t *testing.T) {
+	w := NewWebhooks(memrepo.New(), WebhookConfig{MinBackoff: time.Second, MaxBackoff: 10 * time.Second}, zap.NewNop())
+	for attempts, want := range map[int]time.Duration{
+		1:  time.Second,
+		2:  2 * time.Second,
+		3:  4 * time.Second,
+		4:  8 * time.Second,
+		5:  10 * time.Second,
+		50: 10 * time.Second,
+	} {
+		for range 20 {
+			delay := w.backoff(attempts)
+			require.GreaterOrEqual(t, delay, want/2, "attempt %d", attempts)
+			require.LessOrEqual(t, delay, want, "attempt %d", attempts)
+		}
+	}
+}
+
+// hookServer answers webhook deliveries with the given statuses, then with 200.
+type hookServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	requests int
+}
+
+func newHookServer(t *testing.T, statuses ...int) *hookServer {
+	s := &hookServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		status := http.StatusOK
+		if s.requests < len(s.statuses) {
+			status = s.statuses[s.requests]
+		}
+		s.requests++
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *hookServer) received() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func TestOutboxRetry(t *testing.T) {
+	cfg := WebhookConfig{
+		MaxAttempts: 3,
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  time.Millisecond,
+		Timeout:     time.Second,
+		BatchSize:   10,
+	}
+	// flushAll sends everything that is due, waiting out the backoff of the retries
+	flushAll := func(w webhooks, rounds int) {
+		for range rounds {
+			w.flush(context.Background())
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	setup := func(t *testing.T, statuses ...int) (webhooks, *hookServer) {
+		ctx := context.Background()
+		repo := memrepo.New()
+		server := newHookServer(t, statuses...)
+		require.NoError(t, repo.SaveSubscription(ctx, domain.Subscription{
+			ID: "hook", Room: domain.DefaultRoom, URL: server.URL, Events: domain.EventTypes, Secret: "secret", Time: time.Now(),
+		}))
+		w := NewWebhooks(repo, cfg, zap.NewNop())
+		require.NoError(t, w.publish(ctx, domain.Event{Type: domain.EventUserJoined, Room: domain.DefaultRoom, User: "bob", Time: time.Now()}))
+		return w, server
+	}
+
+	t.Run("retries until delivered", func(t *testing.T) {
+		w, server := setup(t, http.StatusInternalServerError, http.StatusBadGateway)
+		flushAll(w, 5)
+		require.Equal(t, 3, server.received())
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		w, server := setup(t, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError)
+		flushAll(w, 5)
+		require.Equal(t, cfg.MaxAttempts, server.received())
+	})
+
+	t.Run("gone stops at once", func(t *testing.T) {
+		w, server := setup(t, http.StatusGone)
+		flushAll(w, 3)
+		require.Equal(t, 1, server.received())
+	})
+}
+
+func TestWebhookRemoveIsScopedToRoom(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHub(t)
+	require.NoError(t, h.webhooks.repo.SaveSubscription(ctx, domain.Subscription{
+		ID: "hook", Room: "other", URL: "http://hooks.example", Events: domain.EventTypes, Secret: "secret", Time: time.Now(),
+	}))
+	_, err := h.webhookCommand(ctx, clientKey{user: "alice", room: domain.DefaultRoom}, domain.RoleAdmin, []string{"remove", "hook"})
+	require.ErrorIs(t, err, domain.ErrNotFound)
+	subscriptions, err := h.webhooks.repo.ListSubscriptions(ctx, "other")
+	require.NoError(t, err)
+	require.Len(t, subscriptions, 1)
+
+	_, err = h.webhookCommand(ctx, clientKey{user: "alice", room: "other"}, domain.RoleAdmin, []string{"remove", "hook"})
+	require.NoError(t, err)
+	subscriptions, err = h.webhooks.repo.ListSubscriptions(ctx, "other")
+	require.NoError(t, err)
+	require.Empty(t, subscriptions)
+}
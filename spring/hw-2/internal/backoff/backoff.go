@@ -0,0 +1,59 @@
+package backoff
+
+import (
+	"math"
+	"time"
+)
+
+// Policy spaces out retries: the delay starts at Initial, grows by Multiplier after every
+// attempt up to Max and is spread by Jitter, a fraction of the delay, so nodes that failed
+// together don't retry together. MaxAttempts and MaxElapsed cap the retries, zero means no cap.
+type Policy struct {
+	Initial     time.Duration
+	Max         time.Duration
+	Multiplier  float64
+	Jitter      float64
+	MaxAttempts int
+	MaxElapsed  time.Duration
+}
+
+// Start begins a series of retries at now. rand returns numbers in [0, 1) to draw the jitter from.
+func (p Policy) Start(now time.Time, rand func() float64) *Backoff {
+	return &Backoff{policy: p, rand: rand, start: now}
+}
+
+// Backoff is a series of retries under a Policy.
+type Backoff struct {
+	policy   Policy
+	rand     func() float64
+	start    time.Time
+	attempts int
+}
+
+// Next counts a failed attempt and returns the delay before the next one. It reports false
+// once the attempts or the time allowed by the policy are used up; the delays it returns
+// after that stay at the maximum.
+func (b *Backoff) Next(now time.Time) (time.Duration, bool) {
+	b.attempts++
+	delay := b.delay()
+	exhausted := b.policy.MaxAttempts > 0 && b.attempts >= b.policy.MaxAttempts ||
+		b.policy.MaxElapsed > 0 && now.Sub(b.start) >= b.policy.MaxElapsed
+	return delay, !exhausted
+}
+
+// Attempts returns the number of failed attempts so far.
+func (b *Backoff) Attempts() int {
+	return b.attempts
+}
+
+// Elapsed returns the time since the series started.
+func (b *Backoff) Elapsed(now time.Time) time.Duration {
+	return now.Sub(b.start)
+}
+
+func (b *Backoff) delay() time.Duration {
+	delay := float64(b.policy.Initial) * math.Pow(b.policy.Multiplier, float64(b.attempts-1))
+	delay = math.Min(delay, float64(b.policy.Max))
+	delay *= 1 + b.policy.Jitter*(2*b.rand()-1)
+	return time.Duration(delay)
+}
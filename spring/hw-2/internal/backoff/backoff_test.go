@@ -0,0 +1,81 @@
+package backoff_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/backoff"
+)
+
+func fixed(v float64) func() float64 {
+	return func() float64 { return v }
+}
+
+func TestBackoff(t *testing.T) {
+	now := time.Now()
+	policy := backoff.Policy{
+		Initial:    time.Second,
+		Max:        10 * time.Second,
+		Multiplier: 2,
+		Jitter:     0.5,
+	}
+
+	t.Run("grows up to the max", func(t *testing.T) {
+		b := policy.Start(now, fixed(0.5))
+		want := []time.Duration{1, 2, 4, 8, 10, 10}
+		for i, w := range want {
+			delay, ok := b.Next(now)
+			if !ok {
+				t.Fatalf("attempt %d: uncapped policy gave up", i+1)
+			}
+			if delay != w*time.Second {
+				t.Errorf("attempt %d: delay %s, want %s", i+1, delay, w*time.Second)
+			}
+		}
+	})
+
+	t.Run("jitter", func(t *testing.T) {
+		for _, tt := range []struct {
+			rand float64
+			want time.Duration
+		}{
+			{rand: 0, want: 500 * time.Millisecond},
+			{rand: 0.75, want: 1250 * time.Millisecond},
+		} {
+			delay, _ := policy.Start(now, fixed(tt.rand)).Next(now)
+			if delay != tt.want {
+				t.Errorf("rand %v: delay %s, want %s", tt.rand, delay, tt.want)
+			}
+		}
+	})
+
+	t.Run("max attempts", func(t *testing.T) {
+		capped := policy
+		capped.MaxAttempts = 3
+		b := capped.Start(now, fixed(0.5))
+		for i := 1; i < 3; i++ {
+			if _, ok := b.Next(now); !ok {
+				t.Fatalf("gave up after %d attempts", i)
+			}
+		}
+		delay, ok := b.Next(now)
+		if ok {
+			t.Error("didn't give up after max attempts")
+		}
+		if delay != 4*time.Second || b.Attempts() != 3 {
+			t.Errorf("got delay %s after %d attempts", delay, b.Attempts())
+		}
+	})
+
+	t.Run("max elapsed", func(t *testing.T) {
+		capped := policy
+		capped.MaxElapsed = time.Minute
+		b := capped.Start(now, fixed(0.5))
+		if _, ok := b.Next(now.Add(time.Minute - time.Second)); !ok {
+			t.Fatal("gave up before max elapsed")
+		}
+		if _, ok := b.Next(now.Add(time.Minute)); ok {
+			t.Error("didn't give up after max elapsed")
+		}
+	})
+}
@@ -0,0 +1,139 @@
+package clock
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+var _ Clock = &Fake{}
+
+func NewFake(now time.Time) *Fake {
+	f := &Fake{now: now}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+// Fake only moves when Advance is called; timers fire from inside Advance.
+type Fake struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	pending []*fakeTimer
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{clock: f, c: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	t := &fakeTimer{clock: f, c: make(chan time.Time, 1), period: d}
+	t.Reset(d)
+	return fakeTicker{fakeTimer: t}
+}
+
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+// Advance moves the time forward by d, firing due timers in deadline order.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	target := f.now.Add(d)
+	for {
+		next := f.earliest()
+		if next == nil || next.deadline.After(target) {
+			break
+		}
+		f.now = next.deadline
+		select {
+		case next.c <- f.now:
+		default:
+			// like time.Ticker, drop ticks nobody has read
+		}
+		if next.period > 0 {
+			next.deadline = next.deadline.Add(next.period)
+		} else {
+			f.remove(next)
+		}
+	}
+	f.now = target
+}
+
+// BlockUntil waits until at least n timers or tickers are pending.
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.pending) < n {
+		f.cond.Wait()
+	}
+}
+
+func (f *Fake) earliest() *fakeTimer {
+	if len(f.pending) == 0 {
+		return nil
+	}
+	return slices.MinFunc(f.pending, func(a, b *fakeTimer) int {
+		return a.deadline.Compare(b.deadline)
+	})
+}
+
+func (f *Fake) remove(t *fakeTimer) bool {
+	i := slices.Index(f.pending, t)
+	if i < 0 {
+		return false
+	}
+	f.pending = slices.Delete(f.pending, i, i+1)
+	return true
+}
+
+type fakeTimer struct {
+	clock    *Fake
+	c        chan time.Time
+	deadline time.Time
+	period   time.Duration
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.clock.remove(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	active := t.clock.remove(t)
+	if t.period > 0 {
+		t.period = d
+	}
+	t.deadline = t.clock.now.Add(d)
+	t.clock.pending = append(t.clock.pending, t)
+	t.clock.cond.Broadcast()
+	return active
+}
+
+type fakeTicker struct {
+	*fakeTimer
+}
+
+func (t fakeTicker) Stop() {
+	t.fakeTimer.Stop()
+}
+
+func (t fakeTicker) Reset(d time.Duration) {
+	t.fakeTimer.Reset(d)
+}
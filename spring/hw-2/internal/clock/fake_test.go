@@ -0,0 +1,89 @@
+package clock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/clock"
+)
+
+var start = time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+
+func fired(c <-chan time.Time) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestFakeTimer(t *testing.T) {
+	clk := clock.NewFake(start)
+	timer := clk.NewTimer(time.Second)
+	clk.Advance(999 * time.Millisecond)
+	if fired(timer.C()) {
+		t.Fatal("timer fired early")
+	}
+	clk.Advance(time.Millisecond)
+	if !fired(timer.C()) {
+		t.Fatal("timer didn't fire at its deadline")
+	}
+	if timer.Stop() {
+		t.Error("Stop reported a fired timer as active")
+	}
+	if !clk.Now().Equal(start.Add(time.Second)) {
+		t.Errorf("now is %s", clk.Now())
+	}
+}
+
+func TestFakeTimerStopAndReset(t *testing.T) {
+	clk := clock.NewFake(start)
+	timer := clk.NewTimer(time.Second)
+	if !timer.Stop() {
+		t.Fatal("Stop reported an active timer as fired")
+	}
+	clk.Advance(time.Hour)
+	if fired(timer.C()) {
+		t.Fatal("stopped timer fired")
+	}
+	timer.Reset(time.Minute)
+	clk.Advance(time.Minute)
+	if !fired(timer.C()) {
+		t.Fatal("reset timer didn't fire")
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	clk := clock.NewFake(start)
+	ticker := clk.NewTicker(time.Second)
+	defer ticker.Stop()
+	for i := range 3 {
+		clk.Advance(time.Second)
+		select {
+		case now := <-ticker.C():
+			if want := start.Add(time.Duration(i+1) * time.Second); !now.Equal(want) {
+				t.Errorf("tick %d at %s, want %s", i, now, want)
+			}
+		default:
+			t.Fatalf("tick %d missing", i)
+		}
+	}
+	// unread ticks are dropped, not queued
+	clk.Advance(5 * time.Second)
+	if !fired(ticker.C()) || fired(ticker.C()) {
+		t.Error("want exactly one buffered tick")
+	}
+}
+
+func TestFakeBlockUntil(t *testing.T) {
+	clk := clock.NewFake(start)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-clk.After(time.Minute)
+	}()
+	clk.BlockUntil(1)
+	clk.Advance(time.Minute)
+	<-done
+}
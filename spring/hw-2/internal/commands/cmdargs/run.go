@@ -1,5 +1,35 @@
 package cmdargs
 
+import "time"
+
+const (
+	BackendZookeeper = "zookeeper"
+	BackendEtcd      = "etcd"
+	BackendInProc    = "inproc"
+)
+
 type RunArgs struct {
-	ZookeeperServers []string
+	Backend                string
+	ZookeeperServers       []string
+	EtcdEndpoints          []string
+	LeaderTimeout          time.Duration
+	AttempterTimeout       time.Duration
+	FileDir                string
+	StorageCapacity        int
+	HTTPAddr               string
+	Workloads              []string
+	WorkloadGrace          time.Duration
+	CronSchedule           string
+	CronCommand            string
+	StepDownCooldown       time.Duration
+	StepDownToken          string
+	FailoverInitialBackoff time.Duration
+	FailoverMaxBackoff     time.Duration
+	FailoverMultiplier     float64
+	FailoverJitter         float64
+	FailoverMaxAttempts    int
+	FailoverMaxTime        time.Duration
+	FailoverMode           string
+	Shards                 []string
+	ShardCount             int
 }
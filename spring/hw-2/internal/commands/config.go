@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/commands/cmdargs"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	configFlag        = "config"
+	stepDownTokenFlag = "step-down-token"
+)
+
+// secrets lists the run flags config print doesn't show.
+var secrets = []string{stepDownTokenFlag}
+
+// reloadable lists the run flags SIGHUP applies without a restart.
+var reloadable = []string{"leader-timeout", "attempter-timeout", "storage-capacity"}
+
+func InitConfigCommand() (cobra.Command, error) {
+	cmd := cobra.Command{
+		Use:   "config",
+		Short: "Inspects the configuration of the run command",
+	}
+	var path string
+	var runArgs cmdargs.RunArgs
+	printCmd := cobra.Command{
+		Use:   "print",
+		Short: "Prints the effective run configuration",
+		Long: `This command layers the flag defaults, the config file, ELECTION_* variables
+		and the given run flags the way run does and prints every setting with its source`,
+		Args: cobra.NoArgs,
+		// a bad config file isn't a usage error
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			loaded, err := newConfigSource(cmd.Flags(), path).load()
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tVALUE\tSOURCE")
+			loaded.flags.VisitAll(func(flag *pflag.Flag) {
+				value := config.Value(flag)
+				if value != "" && slices.Contains(secrets, flag.Name) {
+					value = "***"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\n", flag.Name, value, loaded.sources[flag.Name])
+			})
+			return w.Flush()
+		},
+	}
+	addRunFlags(printCmd.Flags(), &runArgs)
+	addConfigFlag(printCmd.Flags(), &path)
+	cmd.AddCommand(&printCmd)
+	return cmd, nil
+}
+
+func addConfigFlag(flags *pflag.FlagSet, path *string) {
+	flags.StringVar(path, configFlag, "", "Set the YAML or TOML config file, ELECTION_CONFIG if empty.")
+}
+
+// configSource remembers where the run configuration comes from, so SIGHUP can load it again.
+type configSource struct {
+	path        string
+	commandLine map[string][]string
+}
+
+func newConfigSource(flags *pflag.FlagSet, path string) configSource {
+	if path == "" {
+		path = os.Getenv(config.EnvName(configFlag))
+	}
+	commandLine := config.CommandLine(flags)
+	delete(commandLine, configFlag)
+	return configSource{path: path, commandLine: commandLine}
+}
+
+// runConfig is the validated run configuration with the layer every flag came from.
+type runConfig struct {
+	args    cmdargs.RunArgs
+	flags   *pflag.FlagSet
+	sources config.Sources
+}
+
+func (s configSource) load() (*runConfig, error) {
+	c := &runConfig{flags: pflag.NewFlagSet("run", pflag.ContinueOnError)}
+	addRunFlags(c.flags, &c.args)
+	sources, err := config.Load(c.flags, s.path, s.commandLine)
+	if err != nil {
+		return nil, fmt.Errorf("load config: %w", err)
+	}
+	if err := validateRunArgs(c.args); err != nil {
+		return nil, err
+	}
+	c.sources = sources
+	return c, nil
+}
+
+// changed returns the flags whose values differ from the other configuration.
+func (c *runConfig) changed(other *runConfig) []string {
+	var names []string
+	c.flags.VisitAll(func(flag *pflag.Flag) {
+		if config.Value(flag) != config.Value(other.flags.Lookup(flag.Name)) {
+			names = append(names, flag.Name)
+		}
+	})
+	return names
+}
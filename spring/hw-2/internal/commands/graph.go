@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states"
+	"github.com/spf13/cobra"
+)
+
+const (
+	graphFormatMermaid = "mermaid"
+	graphFormatDOT     = "dot"
+)
+
+func InitGraphCommand() (cobra.Command, error) {
+	var (
+		format string
+		shard  bool
+	)
+	cmd := cobra.Command{
+		Use:   "graph",
+		Short: "Prints the state transition graph",
+		Long: `This command prints the transitions the state runner allows,
+		as a mermaid diagram for the README or in the graphviz DOT language`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			graph := states.Election
+			if shard {
+				graph = states.Shard
+			}
+			switch format {
+			case graphFormatMermaid:
+				_, err := fmt.Fprint(cmd.OutOrStdout(), graph.Mermaid())
+				return err
+			case graphFormatDOT:
+				_, err := fmt.Fprint(cmd.OutOrStdout(), graph.DOT())
+				return err
+			default:
+				return fmt.Errorf("unknown format %q", format)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", graphFormatMermaid, "Set the output format: mermaid or dot.")
+	cmd.Flags().BoolVar(&shard, "shard", false, "Print the graph of the machine run for every shard instead.")
+
+	return cmd, nil
+}
@@ -0,0 +1,32 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func InitRootCommand() (cobra.Command, error) {
+	cmd := cobra.Command{
+		Use:   "election",
+		Short: "Leader election service",
+	}
+	runCmd, err := InitRunCommand()
+	if err != nil {
+		return cobra.Command{}, fmt.Errorf("init run command: %w", err)
+	}
+	graphCmd, err := InitGraphCommand()
+	if err != nil {
+		return cobra.Command{}, fmt.Errorf("init graph command: %w", err)
+	}
+	verifyCmd, err := InitVerifyCommand()
+	if err != nil {
+		return cobra.Command{}, fmt.Errorf("init verify command: %w", err)
+	}
+	configCmd, err := InitConfigCommand()
+	if err != nil {
+		return cobra.Command{}, fmt.Errorf("init config command: %w", err)
+	}
+	cmd.AddCommand(&runCmd, &graphCmd, &verifyCmd, &configCmd)
+	return cmd, nil
+}
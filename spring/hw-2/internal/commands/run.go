@@ -1,40 +1,128 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/commands/cmdargs"
 	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/depgraph"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states/failover"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/workload"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 func InitRunCommand() (cobra.Command, error) {
 	cmdArgs := cmdargs.RunArgs{}
+	var (
+		configPath string
+		source     configSource
+		startup    *runConfig
+	)
 	cmd := cobra.Command{
 		Use:   "run",
 		Short: "Starts a leader election node",
 		Long: `This command starts the leader election node that connects to zookeeper
 		and starts to try to acquire leadership by creation of ephemeral node`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			source = newConfigSource(cmd.Flags(), configPath)
+			loaded, err := source.load()
+			if err != nil {
+				return err
+			}
+			startup, cmdArgs = loaded, loaded.args
+			return nil
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			dg := depgraph.New()
-			// zkConn, err := dg.GetZkConn()
+			ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM)
+			defer stop()
+			dg := depgraph.New(cmdArgs)
 			logger, err := dg.GetLogger()
 			if err != nil {
 				return fmt.Errorf("get logger: %w", err)
 			}
-			logger.Info("args received", slog.String("servers", strings.Join(cmdArgs.ZookeeperServers, ", ")))
+			defer func() {
+				if err := dg.Close(); err != nil {
+					logger.Error("close dependencies", slog.String("error", err.Error()))
+				}
+			}()
+			logger.Info("args received",
+				slog.String("config", source.path),
+				slog.String("backend", cmdArgs.Backend),
+				slog.String("etcd_endpoints", strings.Join(cmdArgs.EtcdEndpoints, ", ")),
+				slog.String("servers", strings.Join(cmdArgs.ZookeeperServers, ", ")),
+				slog.Duration("leader_timeout", cmdArgs.LeaderTimeout),
+				slog.Duration("attempter_timeout", cmdArgs.AttempterTimeout),
+				slog.String("file_dir", cmdArgs.FileDir),
+				slog.Int("storage_capacity", cmdArgs.StorageCapacity),
+				slog.String("http_addr", cmdArgs.HTTPAddr),
+				slog.String("workloads", strings.Join(cmdArgs.Workloads, ", ")),
+				slog.Duration("workload_grace", cmdArgs.WorkloadGrace),
+				slog.String("cron_schedule", cmdArgs.CronSchedule),
+				slog.String("cron_command", cmdArgs.CronCommand),
+				slog.Duration("step_down_cooldown", cmdArgs.StepDownCooldown),
+				slog.Bool("step_down_token", cmdArgs.StepDownToken != ""),
+				slog.Duration("failover_initial_backoff", cmdArgs.FailoverInitialBackoff),
+				slog.Duration("failover_max_backoff", cmdArgs.FailoverMaxBackoff),
+				slog.Float64("failover_multiplier", cmdArgs.FailoverMultiplier),
+				slog.Float64("failover_jitter", cmdArgs.FailoverJitter),
+				slog.Int("failover_max_attempts", cmdArgs.FailoverMaxAttempts),
+				slog.Duration("failover_max_time", cmdArgs.FailoverMaxTime),
+				slog.String("failover_mode", cmdArgs.FailoverMode),
+				slog.String("shards", strings.Join(cmdArgs.Shards, ", ")),
+				slog.Int("shard_count", cmdArgs.ShardCount),
+			)
+			stepDown, err := dg.GetStepDown()
+			if err != nil {
+				return fmt.Errorf("get step-down requests: %w", err)
+			}
+			stepDownSignals := make(chan os.Signal, 1)
+			signal.Notify(stepDownSignals, syscall.SIGUSR1)
+			defer signal.Stop(stepDownSignals)
+			go func() {
+				for range stepDownSignals {
+					if !stepDown.Request() {
+						logger.Info("ignoring SIGUSR1, the node isn't the leader")
+					}
+				}
+			}()
+			reloads := make(chan os.Signal, 1)
+			signal.Notify(reloads, syscall.SIGHUP)
+			defer signal.Stop(reloads)
+			go func() {
+				for range reloads {
+					reload(logger, dg, source, startup)
+				}
+			}()
+			if cmdArgs.HTTPAddr != "" {
+				server, err := dg.GetHTTPServer()
+				if err != nil {
+					return fmt.Errorf("get http server: %w", err)
+				}
+				go func() {
+					if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+						logger.Error("http server failed", slog.String("error", err.Error()))
+					}
+				}()
+			}
 
 			runner, err := dg.GetRunner()
 			if err != nil {
 				return fmt.Errorf("get runner: %w", err)
 			}
-			firstState, err := dg.GetEmptyState()
+			firstState, err := dg.GetInitState()
 			if err != nil {
 				return fmt.Errorf("get first state: %w", err)
 			}
-			err = runner.Run(cmd.Context(), firstState)
+			err = runner.Run(ctx, firstState)
 			if err != nil {
 				return fmt.Errorf("run states: %w", err)
 			}
@@ -42,7 +130,150 @@ func InitRunCommand() (cobra.Command, error) {
 		},
 	}
 
-	cmd.Flags().StringSliceVarP(&(cmdArgs.ZookeeperServers), "zk-servers", "s", []string{}, "Set the zookeeper servers.")
+	addRunFlags(cmd.Flags(), &cmdArgs)
+	addConfigFlag(cmd.Flags(), &configPath)
 
 	return cmd, nil
 }
+
+// reload loads the configuration again and applies the settings that don't need a restart,
+// keeping the running configuration if the new one is invalid.
+func reload(logger *slog.Logger, dg *depgraph.DepGraph, source configSource, startup *runConfig) {
+	loaded, err := source.load()
+	if err != nil {
+		logger.Error("reload config, keeping the current one", slog.String("error", err.Error()))
+		return
+	}
+	changed := loaded.changed(startup)
+	restart := slices.DeleteFunc(slices.Clone(changed), func(name string) bool {
+		return slices.Contains(reloadable, name)
+	})
+	if len(restart) > 0 {
+		logger.Warn("changed settings take effect after a restart", slog.String("settings", strings.Join(restart, ", ")))
+	}
+	if err := dg.Reload(loaded.args); err != nil {
+		logger.Error("apply reloaded config", slog.String("error", err.Error()))
+		return
+	}
+	logger.Info("config reloaded",
+		slog.String("changed", strings.Join(changed, ", ")),
+		slog.Duration("leader_timeout", loaded.args.LeaderTimeout),
+		slog.Duration("attempter_timeout", loaded.args.AttempterTimeout),
+		slog.Int("storage_capacity", loaded.args.StorageCapacity),
+	)
+}
+
+func addRunFlags(flags *pflag.FlagSet, args *cmdargs.RunArgs) {
+	flags.StringVar(&(args.Backend), "backend", cmdargs.BackendZookeeper, "Set the coordination backend: zookeeper, etcd or inproc.")
+	flags.StringSliceVarP(&(args.ZookeeperServers), "zk-servers", "s", []string{}, "Set the zookeeper servers.")
+	flags.StringSliceVar(&(args.EtcdEndpoints), "etcd-endpoints", []string{}, "Set the etcd endpoints.")
+	flags.DurationVar(&(args.LeaderTimeout), "leader-timeout", 10*time.Second, "Set how often the leader writes a file.")
+	flags.DurationVar(&(args.AttempterTimeout), "attempter-timeout", 10*time.Second, "Set how often a follower tries to become the leader.")
+	flags.StringVar(&(args.FileDir), "file-dir", "/tmp/election", "Set the directory the leader writes files to.")
+	flags.IntVar(&(args.StorageCapacity), "storage-capacity", 10, "Set the maximum number of files in file-dir.")
+	flags.StringVar(&(args.HTTPAddr), "http-addr", "127.0.0.1:8080", "Set the address of the metrics and status server, empty to disable.")
+	flags.StringSliceVar(&(args.Workloads), "workloads", []string{workload.FilesName}, "Set the workloads the leader runs: files, cron.")
+	flags.DurationVar(&(args.WorkloadGrace), "workload-grace", 5*time.Second, "Set how long stopping workloads may take.")
+	flags.StringVar(&(args.CronSchedule), "cron-schedule", "", "Set the schedule of the cron workload, e.g. '*/5 * * * *' or '@every 30s'.")
+	flags.StringVar(&(args.CronCommand), "cron-command", "", "Set the shell command of the cron workload.")
+	flags.DurationVar(&(args.StepDownCooldown), "step-down-cooldown", 30*time.Second, "Set how long a leader that stepped down sits out of elections.")
+	flags.StringVar(&(args.StepDownToken), stepDownTokenFlag, "", "Set the bearer token POST /stepdown requires, empty to accept it only from localhost.")
+	flags.DurationVar(&(args.FailoverInitialBackoff), "failover-initial-backoff", 500*time.Millisecond, "Set the first delay between reconnect attempts.")
+	flags.DurationVar(&(args.FailoverMaxBackoff), "failover-max-backoff", 30*time.Second, "Set the delay reconnect attempts back off to.")
+	flags.Float64Var(&(args.FailoverMultiplier), "failover-multiplier", 2, "Set how much the delay grows after every reconnect attempt.")
+	flags.Float64Var(&(args.FailoverJitter), "failover-jitter", 0.2, "Set the fraction of the delay it is randomly spread by, from 0 to 1.")
+	flags.IntVar(&(args.FailoverMaxAttempts), "failover-max-attempts", 0, "Set how many reconnect attempts to make before failover-mode applies, 0 for no limit.")
+	flags.DurationVar(&(args.FailoverMaxTime), "failover-max-time", 0, "Set how long to reconnect before failover-mode applies, 0 for no limit.")
+	flags.StringVar(&(args.FailoverMode), "failover-mode", string(failover.ModeExit), "Set what to do once reconnect attempts run out: exit or degraded.")
+	flags.StringSliceVar(&(args.Shards), "shards", []string{}, "Set the shards to elect a leader for each, empty for a single election.")
+	flags.IntVar(&(args.ShardCount), "shard-count", 0, "Set the number of shards named shard-0, shard-1 and so on instead of listing them in shards.")
+}
+
+func validateRunArgs(args cmdargs.RunArgs) error {
+	var errs []error
+	switch args.Backend {
+	case cmdargs.BackendZookeeper:
+		if len(args.ZookeeperServers) == 0 {
+			errs = append(errs, errors.New("zk-servers must not be empty"))
+		}
+	case cmdargs.BackendEtcd:
+		if len(args.EtcdEndpoints) == 0 {
+			errs = append(errs, errors.New("etcd-endpoints must not be empty"))
+		}
+	case cmdargs.BackendInProc:
+	default:
+		errs = append(errs, fmt.Errorf("unknown backend %q", args.Backend))
+	}
+	if args.LeaderTimeout <= 0 {
+		errs = append(errs, errors.New("leader-timeout must be positive"))
+	}
+	if args.AttempterTimeout <= 0 {
+		errs = append(errs, errors.New("attempter-timeout must be positive"))
+	}
+	if args.FileDir == "" {
+		errs = append(errs, errors.New("file-dir must not be empty"))
+	}
+	if args.StorageCapacity < 1 {
+		errs = append(errs, errors.New("storage-capacity must be at least 1"))
+	}
+	if args.StepDownCooldown < 0 {
+		errs = append(errs, errors.New("step-down-cooldown must not be negative"))
+	}
+	if args.FailoverInitialBackoff <= 0 {
+		errs = append(errs, errors.New("failover-initial-backoff must be positive"))
+	}
+	if args.FailoverMaxBackoff < args.FailoverInitialBackoff {
+		errs = append(errs, errors.New("failover-max-backoff must not be less than failover-initial-backoff"))
+	}
+	if args.FailoverMultiplier < 1 {
+		errs = append(errs, errors.New("failover-multiplier must be at least 1"))
+	}
+	if args.FailoverJitter < 0 || args.FailoverJitter > 1 {
+		errs = append(errs, errors.New("failover-jitter must be between 0 and 1"))
+	}
+	if args.FailoverMaxAttempts < 0 {
+		errs = append(errs, errors.New("failover-max-attempts must not be negative"))
+	}
+	if args.FailoverMaxTime < 0 {
+		errs = append(errs, errors.New("failover-max-time must not be negative"))
+	}
+	switch failover.Mode(args.FailoverMode) {
+	case failover.ModeExit, failover.ModeDegraded:
+	default:
+		errs = append(errs, fmt.Errorf("unknown failover-mode %q", args.FailoverMode))
+	}
+	if args.WorkloadGrace <= 0 {
+		errs = append(errs, errors.New("workload-grace must be positive"))
+	}
+	if len(args.Shards) > 0 && args.ShardCount > 0 {
+		errs = append(errs, errors.New("shards and shard-count are mutually exclusive"))
+	}
+	if args.ShardCount < 0 {
+		errs = append(errs, errors.New("shard-count must not be negative"))
+	}
+	for i, shard := range args.Shards {
+		switch {
+		case shard == "" || shard == "." || shard == "..":
+			errs = append(errs, fmt.Errorf("invalid shard name %q", shard))
+		case strings.Contains(shard, "/"):
+			errs = append(errs, fmt.Errorf("shard %q must not contain a slash", shard))
+		case slices.Contains(args.Shards[:i], shard):
+			errs = append(errs, fmt.Errorf("shard %q is listed twice", shard))
+		}
+	}
+	for _, name := range args.Workloads {
+		switch name {
+		case workload.FilesName:
+		case workload.CronName:
+			if args.CronCommand == "" {
+				errs = append(errs, errors.New("cron-command must not be empty for the cron workload"))
+			}
+			if _, err := workload.ParseSchedule(args.CronSchedule); err != nil {
+				errs = append(errs, fmt.Errorf("cron-schedule: %w", err))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("unknown workload %q", name))
+		}
+	}
+	return errors.Join(errs...)
+}
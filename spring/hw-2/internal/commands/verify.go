@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/config"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/filestore"
+	"github.com/spf13/cobra"
+)
+
+func InitVerifyCommand() (cobra.Command, error) {
+	var fileDir string
+	cmd := cobra.Command{
+		Use:   "verify",
+		Short: "Checks the fencing tokens of the leader's files",
+		Long: `This command scans file-dir from the oldest file to the newest and reports
+		files written with the fencing token of an earlier leadership term`,
+		Args: cobra.NoArgs,
+		// violations are the expected failure, usage wouldn't help
+		SilenceUsage: true,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := config.Load(cmd.Flags(), "", config.CommandLine(cmd.Flags())); err != nil {
+				return err
+			}
+			if fileDir == "" {
+				return errors.New("file-dir must not be empty")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			violations, err := filestore.Verify(fileDir)
+			for _, violation := range violations {
+				fmt.Fprintln(cmd.OutOrStdout(), violation)
+			}
+			if err != nil {
+				return fmt.Errorf("verify %s: %w", fileDir, err)
+			}
+			if len(violations) > 0 {
+				return fmt.Errorf("found %d files of out-of-order terms", len(violations))
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "all terms are in order")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&fileDir, "file-dir", "/tmp/election", "Set the directory the leader writes files to.")
+
+	return cmd, nil
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix starts the variable of every flag, e.g. ELECTION_FILE_DIR for --file-dir.
+const EnvPrefix = "ELECTION_"
+
+// Source is the layer a setting came from, from the weakest to the strongest.
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+)
+
+// Sources maps flag names to the layer their values came from.
+type Sources map[string]Source
+
+// CommandLine returns the values of the flags set on the command line, so they can be
+// layered on top again when the configuration is reloaded.
+func CommandLine(flags *pflag.FlagSet) map[string][]string {
+	values := make(map[string][]string)
+	flags.Visit(func(flag *pflag.Flag) {
+		values[flag.Name] = rawValue(flag)
+	})
+	return values
+}
+
+// Load sets flags from the layers in the order of precedence: flag defaults, the config file
+// at path (skipped if empty), ELECTION_* variables and the command line values. Keys of the
+// file are flag names.
+func Load(flags *pflag.FlagSet, path string, commandLine map[string][]string) (Sources, error) {
+	sources := make(Sources)
+	flags.VisitAll(func(flag *pflag.Flag) {
+		sources[flag.Name] = SourceDefault
+	})
+	var errs []error
+	set := func(name string, value []string, source Source) {
+		flag := flags.Lookup(name)
+		if err := setValue(flag, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s from %s: %w", name, source, err))
+			return
+		}
+		sources[name] = source
+	}
+
+	if path != "" {
+		values, err := ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range sortedKeys(values) {
+			if flags.Lookup(name) == nil {
+				errs = append(errs, fmt.Errorf("unknown key %q in %s", name, path))
+				continue
+			}
+			set(name, values[name], SourceFile)
+		}
+	}
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if value, ok := os.LookupEnv(EnvName(flag.Name)); ok && flag.Name != "help" {
+			set(flag.Name, split(flag, value), SourceEnv)
+		}
+	})
+	for _, name := range sortedKeys(commandLine) {
+		set(name, commandLine[name], SourceFlag)
+	}
+	return sources, errors.Join(errs...)
+}
+
+// ReadFile reads a YAML or TOML file, chosen by its extension, into flag values.
+func ReadFile(path string) (map[string][]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	var raw map[string]any
+	switch ext := filepath.Ext(path); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		_, err = toml.NewDecoder(bytes.NewReader(data)).Decode(&raw)
+	default:
+		return nil, fmt.Errorf("config %s: unknown format %q, want .yaml, .yml or .toml", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	values := make(map[string][]string, len(raw))
+	for key, value := range raw {
+		switch v := value.(type) {
+		case []any:
+			list := make([]string, 0, len(v))
+			for _, item := range v {
+				list = append(list, fmt.Sprint(item))
+			}
+			values[key] = list
+		case map[string]any:
+			return nil, fmt.Errorf("config %s: %s must not be a table", path, key)
+		default:
+			values[key] = []string{fmt.Sprint(v)}
+		}
+	}
+	return values, nil
+}
+
+// EnvName returns the variable that sets a flag.
+func EnvName(flag string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// Value formats the value of a flag the way it's written on the command line.
+func Value(flag *pflag.Flag) string {
+	if _, ok := flag.Value.(pflag.SliceValue); ok {
+		return strings.Join(rawValue(flag), ",")
+	}
+	return flag.Value.String()
+}
+
+func rawValue(flag *pflag.Flag) []string {
+	if slice, ok := flag.Value.(pflag.SliceValue); ok {
+		return slice.GetSlice()
+	}
+	return []string{flag.Value.String()}
+}
+
+// setValue replaces the value of flag; Set would append to slices that were set before.
+func setValue(flag *pflag.Flag, value []string) error {
+	if slice, ok := flag.Value.(pflag.SliceValue); ok {
+		if err := slice.Replace(value); err != nil {
+			return err
+		}
+	} else {
+		if len(value) != 1 {
+			return fmt.Errorf("want a single value, got %d", len(value))
+		}
+		if err := flag.Value.Set(value[0]); err != nil {
+			return err
+		}
+	}
+	flag.Changed = true
+	return nil
+}
+
+// split parses a slice value written as comma separated values, the way pflag does.
+func split(flag *pflag.Flag, value string) []string {
+	if _, ok := flag.Value.(pflag.SliceValue); !ok {
+		return []string{value}
+	}
+	if value == "" {
+		return []string{}
+	}
+	fields, err := csv.NewReader(strings.NewReader(value)).Read()
+	if err != nil {
+		return []string{value}
+	}
+	return fields
+}
+
+func sortedKeys(values map[string][]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,155 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/config"
+	"github.com/spf13/pflag"
+)
+
+type settings struct {
+	dir      string
+	timeout  time.Duration
+	capacity int
+	servers  []string
+}
+
+func newFlags(s *settings) *pflag.FlagSet {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.StringVar(&s.dir, "file-dir", "/tmp/election", "")
+	flags.DurationVar(&s.timeout, "leader-timeout", 10*time.Second, "")
+	flags.IntVar(&s.capacity, "storage-capacity", 10, "")
+	flags.StringSliceVar(&s.servers, "zk-servers", []string{}, "")
+	return flags
+}
+
+func writeFile(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("layers", func(t *testing.T) {
+		path := writeFile(t, "election.yaml", `
+file-dir: /from/file
+leader-timeout: 5s
+storage-capacity: 3
+zk-servers: [a:2181, b:2181]
+`)
+		t.Setenv("ELECTION_LEADER_TIMEOUT", "7s")
+		t.Setenv("ELECTION_STORAGE_CAPACITY", "4")
+
+		var s settings
+		flags := newFlags(&s)
+		if err := flags.Parse([]string{"--storage-capacity=5"}); err != nil {
+			t.Fatal(err)
+		}
+		sources, err := config.Load(flags, path, config.CommandLine(flags))
+		if err != nil {
+			t.Fatalf("load: %v", err)
+		}
+		if s.dir != "/from/file" || s.timeout != 7*time.Second || s.capacity != 5 ||
+			!slices.Equal(s.servers, []string{"a:2181", "b:2181"}) {
+			t.Errorf("got %+v", s)
+		}
+		want := config.Sources{
+			"file-dir":         config.SourceFile,
+			"leader-timeout":   config.SourceEnv,
+			"storage-capacity": config.SourceFlag,
+			"zk-servers":       config.SourceFile,
+		}
+		for name, source := range want {
+			if sources[name] != source {
+				t.Errorf("%s comes from %s, want %s", name, sources[name], source)
+			}
+		}
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		var s settings
+		flags := newFlags(&s)
+		sources, err := config.Load(flags, "", nil)
+		if err != nil {
+			t.Fatalf("load: %v", err)
+		}
+		if s.timeout != 10*time.Second || sources["leader-timeout"] != config.SourceDefault {
+			t.Errorf("got %s from %s, want the default", s.timeout, sources["leader-timeout"])
+		}
+	})
+
+	t.Run("toml", func(t *testing.T) {
+		path := writeFile(t, "election.toml", `
+leader-timeout = "5s"
+storage-capacity = 3
+zk-servers = ["a:2181"]
+`)
+		var s settings
+		if _, err := config.Load(newFlags(&s), path, nil); err != nil {
+			t.Fatalf("load: %v", err)
+		}
+		if s.timeout != 5*time.Second || s.capacity != 3 || !slices.Equal(s.servers, []string{"a:2181"}) {
+			t.Errorf("got %+v", s)
+		}
+	})
+
+	t.Run("env slices replace the file", func(t *testing.T) {
+		path := writeFile(t, "election.yml", "zk-servers: [a:2181]\n")
+		t.Setenv("ELECTION_ZK_SERVERS", "b:2181,c:2181")
+		var s settings
+		if _, err := config.Load(newFlags(&s), path, nil); err != nil {
+			t.Fatalf("load: %v", err)
+		}
+		if !slices.Equal(s.servers, []string{"b:2181", "c:2181"}) {
+			t.Errorf("got servers %v", s.servers)
+		}
+	})
+
+	t.Run("reload keeps the command line", func(t *testing.T) {
+		path := writeFile(t, "election.yaml", "leader-timeout: 5s\nzk-servers: [a:2181]\n")
+		var first settings
+		flags := newFlags(&first)
+		if err := flags.Parse([]string{"--zk-servers=z:2181"}); err != nil {
+			t.Fatal(err)
+		}
+		commandLine := config.CommandLine(flags)
+		if _, err := config.Load(flags, path, commandLine); err != nil {
+			t.Fatalf("load: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("leader-timeout: 1s\nzk-servers: [b:2181]\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		var reloaded settings
+		if _, err := config.Load(newFlags(&reloaded), path, commandLine); err != nil {
+			t.Fatalf("reload: %v", err)
+		}
+		if reloaded.timeout != time.Second || !slices.Equal(reloaded.servers, []string{"z:2181"}) {
+			t.Errorf("got %+v", reloaded)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for name, tt := range map[string]struct {
+			file string
+			data string
+		}{
+			"unknown key":    {file: "election.yaml", data: "leader-timout: 5s\n"},
+			"bad value":      {file: "election.yaml", data: "leader-timeout: soon\n"},
+			"table":          {file: "election.toml", data: "[zk]\nservers = 1\n"},
+			"unknown format": {file: "election.json", data: "{}"},
+			"bad syntax":     {file: "election.yaml", data: "leader-timeout: [\n"},
+		} {
+			var s settings
+			if _, err := config.Load(newFlags(&s), writeFile(t, tt.file, tt.data), nil); err == nil {
+				t.Errorf("%s: loaded without an error", name)
+			}
+		}
+	})
+}
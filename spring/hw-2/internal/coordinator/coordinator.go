@@ -0,0 +1,87 @@
+package coordinator
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrLeaderExists   = errors.New("leadership is held by another node")
+	ErrNoLeader       = errors.New("no leader elected")
+	ErrDisconnected   = errors.New("disconnected from coordinator")
+	ErrSessionExpired = errors.New("coordinator session expired")
+)
+
+// Coordinator elects a single leader among the nodes connected to the same backend.
+type Coordinator interface {
+	// Check blocks until the backend is reachable or ctx is done.
+	Check(ctx context.Context) error
+	// TryAcquire makes this node the leader or fails with ErrLeaderExists.
+	TryAcquire(ctx context.Context) (Lease, error)
+	// Leader returns the ID of the current leader or ErrNoLeader.
+	Leader(ctx context.Context) (string, error)
+	// Vacant returns a channel that is closed once no node holds the leadership, right away
+	// if it is free already, so followers can take over a released leadership without
+	// waiting for their next attempt. The channel may stay open on backend errors.
+	Vacant(ctx context.Context) <-chan struct{}
+	// Watch streams session events until ctx is done.
+	Watch(ctx context.Context) <-chan SessionEvent
+	// Close ends the session, giving up the leadership; closing again does nothing.
+	Close() error
+}
+
+// Sharded elects a leader per shard over the session of the coordinator and tracks the
+// nodes taking part, so the shards can be spread between them.
+type Sharded interface {
+	Coordinator
+	// Shard returns the election of the named shard. Its Check and Watch report on the
+	// shared session and its Close does nothing: a shard is given up by releasing its lease.
+	Shard(name string) Coordinator
+	// Members registers this node for as long as its session lives and returns the sorted
+	// IDs of the registered nodes with a channel that is closed once they change. The
+	// channel may stay open on backend errors.
+	Members(ctx context.Context) ([]string, <-chan struct{}, error)
+}
+
+// Lease is held by the leader until it is released or lost.
+type Lease interface {
+	// Token is the fencing token of the leadership term: it is greater than the token
+	// of any term that ended before this one started.
+	Token() uint64
+	// Lost is closed once the leadership can no longer be trusted.
+	Lost() <-chan struct{}
+	Release(ctx context.Context) error
+}
+
+type SessionEvent int
+
+const (
+	SessionConnected SessionEvent = iota + 1
+	SessionDisconnected
+	SessionExpired
+)
+
+func (e SessionEvent) String() string {
+	switch e {
+	case SessionConnected:
+		return "connected"
+	case SessionDisconnected:
+		return "disconnected"
+	case SessionExpired:
+		return "expired"
+	default:
+		return "unknown"
+	}
+}
+
+// Err is the error a state fails with after the event, nil for SessionConnected.
+func (e SessionEvent) Err() error {
+	switch e {
+	case SessionDisconnected:
+		return ErrDisconnected
+	case SessionExpired:
+		return ErrSessionExpired
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,233 @@
+package coordinatortest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator"
+)
+
+// handoverTimeout bounds how long a backend may take to notice a gone leader.
+const handoverTimeout = 10 * time.Second
+
+// NewPair returns two nodes competing on a fresh, isolated election.
+type NewPair func(t *testing.T) (coordinator.Coordinator, coordinator.Coordinator)
+
+// Run checks the behaviour every backend has to provide.
+func Run(t *testing.T, newPair NewPair) {
+	t.Run("Check", func(t *testing.T) {
+		a, _ := newPair(t)
+		ctx, cancel := context.WithTimeout(context.Background(), handoverTimeout)
+		defer cancel()
+		if err := a.Check(ctx); err != nil {
+			t.Fatalf("check: %v", err)
+		}
+	})
+
+	t.Run("SingleLeader", func(t *testing.T) {
+		a, b := newPair(t)
+		if _, err := b.Leader(context.Background()); !errors.Is(err, coordinator.ErrNoLeader) {
+			t.Fatalf("leader before election: %v, want %v", err, coordinator.ErrNoLeader)
+		}
+		lease := acquire(t, a)
+		if _, err := b.TryAcquire(context.Background()); !errors.Is(err, coordinator.ErrLeaderExists) {
+			t.Fatalf("second node got %v, want %v", err, coordinator.ErrLeaderExists)
+		}
+		select {
+		case <-lease.Lost():
+			t.Fatal("leader lost its lease to a competitor")
+		default:
+		}
+		aID, err := a.Leader(context.Background())
+		if err != nil {
+			t.Fatalf("leader: %v", err)
+		}
+		bID, err := b.Leader(context.Background())
+		if err != nil {
+			t.Fatalf("leader: %v", err)
+		}
+		if aID == "" || aID != bID {
+			t.Errorf("nodes disagree on the leader: %q and %q", aID, bID)
+		}
+	})
+
+	t.Run("ReleaseHandsOver", func(t *testing.T) {
+		a, b := newPair(t)
+		lease := acquire(t, a)
+		if err := lease.Release(context.Background()); err != nil {
+			t.Fatalf("release: %v", err)
+		}
+		select {
+		case <-lease.Lost():
+		default:
+			t.Error("released lease isn't marked lost")
+		}
+		next := eventuallyAcquire(t, b)
+		if next.Token() <= lease.Token() {
+			t.Errorf("token of the next term %d isn't greater than %d", next.Token(), lease.Token())
+		}
+	})
+
+	t.Run("CloseHandsOver", func(t *testing.T) {
+		a, b := newPair(t)
+		lease := acquire(t, a)
+		if err := a.Close(); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+		if err := a.Close(); err != nil {
+			t.Errorf("close again: %v", err)
+		}
+		next := eventuallyAcquire(t, b)
+		if next.Token() <= lease.Token() {
+			t.Errorf("token of the next term %d isn't greater than %d", next.Token(), lease.Token())
+		}
+		select {
+		case <-lease.Lost():
+		case <-time.After(handoverTimeout):
+			t.Error("lease of a closed node isn't lost")
+		}
+	})
+
+	t.Run("VacantAfterRelease", func(t *testing.T) {
+		a, b := newPair(t)
+		select {
+		case <-b.Vacant(context.Background()):
+		case <-time.After(handoverTimeout):
+			t.Fatal("free leadership isn't reported vacant")
+		}
+		lease := acquire(t, a)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		vacant := b.Vacant(ctx)
+		select {
+		case <-vacant:
+			t.Fatal("held leadership is reported vacant")
+		case <-time.After(100 * time.Millisecond):
+		}
+		if err := lease.Release(context.Background()); err != nil {
+			t.Fatalf("release: %v", err)
+		}
+		select {
+		case <-vacant:
+		case <-time.After(handoverTimeout):
+			t.Error("released leadership isn't reported vacant")
+		}
+	})
+
+	t.Run("ShardsAreSeparateElections", func(t *testing.T) {
+		a, b := sharded(t, newPair)
+		acquire(t, a)
+		shard := acquire(t, b.Shard("shard-0"))
+		if _, err := a.Shard("shard-0").TryAcquire(context.Background()); !errors.Is(err, coordinator.ErrLeaderExists) {
+			t.Fatalf("second node got %v, want %v", err, coordinator.ErrLeaderExists)
+		}
+		acquire(t, a.Shard("shard-1"))
+		bID, err := b.Leader(context.Background())
+		if err != nil {
+			t.Fatalf("leader: %v", err)
+		}
+		shardID, err := a.Shard("shard-0").Leader(context.Background())
+		if err != nil {
+			t.Fatalf("shard leader: %v", err)
+		}
+		if shardID == bID {
+			t.Errorf("shard leader %q is the leader of the node election", shardID)
+		}
+		if err := shard.Release(context.Background()); err != nil {
+			t.Fatalf("release: %v", err)
+		}
+		next := eventuallyAcquire(t, a.Shard("shard-0"))
+		if next.Token() <= shard.Token() {
+			t.Errorf("token of the next term %d isn't greater than %d", next.Token(), shard.Token())
+		}
+	})
+
+	t.Run("Members", func(t *testing.T) {
+		a, b := sharded(t, newPair)
+		members, changed, err := a.Members(context.Background())
+		if err != nil {
+			t.Fatalf("members: %v", err)
+		}
+		if len(members) != 1 {
+			t.Fatalf("got members %v, want only the first node", members)
+		}
+		both, _, err := b.Members(context.Background())
+		if err != nil {
+			t.Fatalf("members: %v", err)
+		}
+		if len(both) != 2 || !slices.Contains(both, members[0]) {
+			t.Fatalf("got members %v, want both nodes", both)
+		}
+		select {
+		case <-changed:
+		case <-time.After(handoverTimeout):
+			t.Fatal("a joining node doesn't change the members")
+		}
+		again, changed, err := a.Members(context.Background())
+		if err != nil || !slices.Equal(again, both) {
+			t.Fatalf("got members %v, %v, want %v", again, err, both)
+		}
+		if err := b.Close(); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+		select {
+		case <-changed:
+		case <-time.After(handoverTimeout):
+			t.Fatal("a closed node doesn't change the members")
+		}
+		left, _, err := a.Members(context.Background())
+		if err != nil {
+			t.Fatalf("members: %v", err)
+		}
+		if !slices.Equal(left, members) {
+			t.Errorf("got members %v after the second node left, want %v", left, members)
+		}
+	})
+
+	t.Run("WatchEndsWithContext", func(t *testing.T) {
+		a, _ := newPair(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		events := a.Watch(ctx)
+		cancel()
+		for range events {
+		}
+	})
+}
+
+func sharded(t *testing.T, newPair NewPair) (coordinator.Sharded, coordinator.Sharded) {
+	t.Helper()
+	a, b := newPair(t)
+	shardedA, okA := a.(coordinator.Sharded)
+	shardedB, okB := b.(coordinator.Sharded)
+	if !okA || !okB {
+		t.Skip("the backend has no shards")
+	}
+	return shardedA, shardedB
+}
+
+func acquire(t *testing.T, c coordinator.Coordinator) coordinator.Lease {
+	t.Helper()
+	lease, err := c.TryAcquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	return lease
+}
+
+func eventuallyAcquire(t *testing.T, c coordinator.Coordinator) coordinator.Lease {
+	t.Helper()
+	deadline := time.Now().Add(handoverTimeout)
+	for {
+		lease, err := c.TryAcquire(context.Background())
+		if err == nil {
+			return lease
+		}
+		if !errors.Is(err, coordinator.ErrLeaderExists) || time.Now().After(deadline) {
+			t.Fatalf("acquire after handover: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,318 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+var _ coordinator.Sharded = &Coordinator{}
+
+type Config struct {
+	Endpoints  []string
+	SessionTTL time.Duration
+	// Prefix is the election prefix; the candidate with the oldest key under it is the leader.
+	// Shards and members are kept next to it, under shards/<name> and members/<node>.
+	Prefix string
+	NodeID string
+}
+
+func New(cfg Config, logger *slog.Logger) (*Coordinator, error) {
+	logger = logger.With("subsystem", "Etcd")
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   cfg.Endpoints,
+		DialTimeout: cfg.SessionTTL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("connect to etcd: %w", err)
+	}
+	return &Coordinator{
+		client:  client,
+		cfg:     cfg,
+		logger:  logger,
+		session: &session{},
+	}, nil
+}
+
+// Coordinator campaigns in an etcd election with a key bound to the session lease,
+// so leadership ends when the lease does.
+type Coordinator struct {
+	client *clientv3.Client
+	cfg    Config
+	logger *slog.Logger
+	// session is shared by the node and its shards
+	session *session
+	// shard is set on the elections returned by Shard
+	shard bool
+}
+
+type session struct {
+	events coordinator.Broadcaster
+
+	mu      sync.Mutex
+	current *concurrency.Session
+	closed  bool
+}
+
+func (c *Coordinator) Shard(name string) coordinator.Coordinator {
+	shard := *c
+	shard.cfg.Prefix = path.Join(path.Dir(c.cfg.Prefix), "shards", name)
+	shard.logger = c.logger.With("shard", name)
+	shard.shard = true
+	return &shard
+}
+
+func (c *Coordinator) Check(ctx context.Context) error {
+	if _, err := c.client.Get(ctx, c.cfg.Prefix, clientv3.WithPrefix(), clientv3.WithCountOnly()); err != nil {
+		return fmt.Errorf("read %s: %w", c.cfg.Prefix, err)
+	}
+	return nil
+}
+
+// currentSession returns the live session, granting a new lease if the previous one expired.
+func (c *Coordinator) currentSession(ctx context.Context) (*concurrency.Session, error) {
+	c.session.mu.Lock()
+	defer c.session.mu.Unlock()
+	if c.session.current != nil {
+		select {
+		case <-c.session.current.Done():
+		default:
+			return c.session.current, nil
+		}
+	}
+	// NewSession would grant the lease without a deadline, so grant it here
+	grant, err := c.client.Grant(ctx, int64(c.cfg.SessionTTL.Seconds()))
+	if err != nil {
+		return nil, fmt.Errorf("grant lease: %w", err)
+	}
+	session, err := concurrency.NewSession(c.client, concurrency.WithLease(grant.ID))
+	if err != nil {
+		return nil, fmt.Errorf("start session: %w", err)
+	}
+	c.session.current = session
+	c.logger.LogAttrs(ctx, slog.LevelInfo, "session started", slog.Int64("lease", int64(grant.ID)))
+	c.session.events.Publish(coordinator.SessionConnected)
+	go func() {
+		<-session.Done()
+		c.logger.LogAttrs(context.Background(), slog.LevelWarn, "session expired", slog.Int64("lease", int64(grant.ID)))
+		c.session.events.Publish(coordinator.SessionExpired)
+	}()
+	return session, nil
+}
+
+func (c *Coordinator) TryAcquire(ctx context.Context) (coordinator.Lease, error) {
+	session, err := c.currentSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// the same steps as Election.Campaign without blocking until elected;
+	// the key stays in the queue, so the next attempt may find it first
+	key := fmt.Sprintf("%s/%x", c.cfg.Prefix, session.Lease())
+	resp, err := c.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, c.cfg.NodeID, clientv3.WithLease(session.Lease()))).
+		Else(clientv3.OpGet(key)).
+		Commit()
+	if err != nil {
+		return nil, fmt.Errorf("put %s: %w", key, err)
+	}
+	revision := resp.Header.Revision
+	if !resp.Succeeded {
+		revision = resp.Responses[0].GetResponseRange().Kvs[0].CreateRevision
+	}
+	election := concurrency.ResumeElection(session, c.cfg.Prefix, key, revision)
+	leader, err := election.Leader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get leader: %w", err)
+	}
+	if string(leader.Kvs[0].Key) != key {
+		if c.shard {
+			// a shard is only contested while it's assigned to the node; a key left in the
+			// queue would take the shard over once it's released, even from its new owner
+			if _, err := c.client.Delete(ctx, key); err != nil {
+				return nil, fmt.Errorf("delete %s: %w", key, err)
+			}
+		}
+		return nil, coordinator.ErrLeaderExists
+	}
+	watchCtx, cancel := context.WithCancel(context.Background())
+	l := &lease{
+		election: election,
+		token:    uint64(revision),
+		cancel:   cancel,
+		lost:     make(chan struct{}),
+	}
+	go l.watch(watchCtx, c.client, session, key, revision)
+	return l, nil
+}
+
+func (c *Coordinator) Leader(ctx context.Context) (string, error) {
+	resp, err := c.client.Get(ctx, c.cfg.Prefix+"/", clientv3.WithFirstCreate()...)
+	if err != nil {
+		return "", fmt.Errorf("get leader: %w", err)
+	}
+	if len(resp.Kvs) == 0 {
+		return "", coordinator.ErrNoLeader
+	}
+	return string(resp.Kvs[0].Value), nil
+}
+
+func (c *Coordinator) Vacant(ctx context.Context) <-chan struct{} {
+	vacant := make(chan struct{})
+	go func() {
+		resp, err := c.client.Get(ctx, c.cfg.Prefix+"/", clientv3.WithFirstCreate()...)
+		if err != nil {
+			return
+		}
+		if len(resp.Kvs) == 0 {
+			close(vacant)
+			return
+		}
+		// the next candidate in the queue takes over once the leader key is gone
+		changes := c.client.Watch(ctx, string(resp.Kvs[0].Key), clientv3.WithRev(resp.Header.Revision+1))
+		for resp := range changes {
+			if resp.Err() != nil {
+				return
+			}
+			for _, event := range resp.Events {
+				if event.Type == clientv3.EventTypeDelete {
+					close(vacant)
+					return
+				}
+			}
+		}
+	}()
+	return vacant
+}
+
+func (c *Coordinator) Watch(ctx context.Context) <-chan coordinator.SessionEvent {
+	return c.session.events.Watch(ctx)
+}
+
+// Members keeps a key of the node bound to the session lease, rewriting it only when the
+// lease changes so the nodes don't wake each other up.
+func (c *Coordinator) Members(ctx context.Context) ([]string, <-chan struct{}, error) {
+	session, err := c.currentSession(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	prefix := path.Join(path.Dir(c.cfg.Prefix), "members") + "/"
+	key := prefix + c.cfg.NodeID
+	list := clientv3.OpGet(prefix, clientv3.WithPrefix())
+	resp, err := c.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.LeaseValue(key), "=", session.Lease())).
+		Then(list).
+		Else(clientv3.OpPut(key, c.cfg.NodeID, clientv3.WithLease(session.Lease())), list).
+		Commit()
+	if err != nil {
+		return nil, nil, fmt.Errorf("register %s: %w", key, err)
+	}
+	kvs := resp.Responses[len(resp.Responses)-1].GetResponseRange().Kvs
+	members := make([]string, 0, len(kvs))
+	for _, kv := range kvs {
+		members = append(members, string(kv.Value))
+	}
+	changed := make(chan struct{})
+	go func() {
+		watchCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		changes := c.client.Watch(watchCtx, prefix, clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1))
+		for resp := range changes {
+			if resp.Err() != nil {
+				return
+			}
+			if len(resp.Events) > 0 {
+				close(changed)
+				return
+			}
+		}
+	}()
+	return members, changed, nil
+}
+
+// Close ends the session of the node; closing a shard does nothing.
+func (c *Coordinator) Close() error {
+	if c.shard {
+		return nil
+	}
+	c.session.mu.Lock()
+	defer c.session.mu.Unlock()
+	if c.session.closed {
+		return nil
+	}
+	c.session.closed = true
+	var errs []error
+	if c.session.current != nil {
+		// revokes the lease, so the leader key goes away immediately
+		if err := c.session.current.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close session: %w", err))
+		}
+	}
+	if err := c.client.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("close client: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+type lease struct {
+	election *concurrency.Election
+	token    uint64
+	cancel   context.CancelFunc
+	lost     chan struct{}
+	once     sync.Once
+}
+
+// Token is the create revision of the candidate key; a later leader's key is always created later.
+func (l *lease) Token() uint64 {
+	return l.token
+}
+
+func (l *lease) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *lease) lose() {
+	l.once.Do(func() {
+		l.cancel()
+		close(l.lost)
+	})
+}
+
+// watch loses the lease when the session ends or the leader key is deleted.
+func (l *lease) watch(ctx context.Context, client *clientv3.Client, session *concurrency.Session, key string, revision int64) {
+	defer l.lose()
+	changes := client.Watch(ctx, key, clientv3.WithRev(revision+1))
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-session.Done():
+			return
+		case resp, ok := <-changes:
+			if !ok || resp.Err() != nil {
+				return
+			}
+			for _, event := range resp.Events {
+				if event.Type == clientv3.EventTypeDelete {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (l *lease) Release(ctx context.Context) error {
+	defer l.lose()
+	if err := l.election.Resign(ctx); err != nil {
+		return fmt.Errorf("resign: %w", err)
+	}
+	return nil
+}
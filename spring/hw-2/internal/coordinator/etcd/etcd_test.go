@@ -0,0 +1,42 @@
+package etcd_test
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator/coordinatortest"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator/etcd"
+)
+
+// ELECTION_TEST_ETCD_ENDPOINTS points the test at a running cluster, e.g. localhost:2379.
+func TestContract(t *testing.T) {
+	endpoints := os.Getenv("ELECTION_TEST_ETCD_ENDPOINTS")
+	if endpoints == "" {
+		t.Skip("ELECTION_TEST_ETCD_ENDPOINTS is not set")
+	}
+	coordinatortest.Run(t, func(t *testing.T) (coordinator.Coordinator, coordinator.Coordinator) {
+		prefix := "/election-test/" + strconv.FormatInt(time.Now().UnixNano(), 10)
+		nodes := make([]coordinator.Coordinator, 2)
+		for i := range nodes {
+			c, err := etcd.New(etcd.Config{
+				Endpoints:  strings.Split(endpoints, ","),
+				SessionTTL: 5 * time.Second,
+				Prefix:     prefix,
+				NodeID:     "node-" + strconv.Itoa(i),
+			}, slog.Default())
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() {
+				_ = c.Close()
+			})
+			nodes[i] = c
+		}
+		return nodes[0], nodes[1]
+	})
+}
@@ -0,0 +1,44 @@
+package coordinator
+
+import (
+	"context"
+	"sync"
+)
+
+const watchBuffer = 16
+
+// Broadcaster fans session events out to watchers; a watcher that falls behind misses events
+// instead of blocking the backend. The zero value is ready to use.
+type Broadcaster struct {
+	mu       sync.Mutex
+	watchers map[chan SessionEvent]struct{}
+}
+
+func (b *Broadcaster) Watch(ctx context.Context) <-chan SessionEvent {
+	ch := make(chan SessionEvent, watchBuffer)
+	b.mu.Lock()
+	if b.watchers == nil {
+		b.watchers = make(map[chan SessionEvent]struct{})
+	}
+	b.watchers[ch] = struct{}{}
+	b.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.watchers, ch)
+		close(ch)
+	}()
+	return ch
+}
+
+func (b *Broadcaster) Publish(event SessionEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.watchers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package inproc
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator"
+)
+
+var _ coordinator.Sharded = &Coordinator{}
+
+var errClosed = errors.New("coordinator closed")
+
+// New starts an in-memory backend with a single node; use Peer to add competitors.
+// It serves single-node runs and tests.
+func New(id string) *Coordinator {
+	return newNode(&cluster{
+		elections: make(map[string]*election),
+		changed:   make(chan struct{}),
+	}, id)
+}
+
+type cluster struct {
+	mu sync.Mutex
+	// elections are keyed by shard, the empty name is the leadership of the cluster
+	elections map[string]*election
+	err       error
+	nodes     []*Coordinator
+	// members are the IDs of the nodes that called Members, changed is closed when they change
+	members []string
+	changed chan struct{}
+}
+
+// election returns the election of a shard, starting it on first use; callers hold mu.
+func (c *cluster) election(shard string) *election {
+	e, ok := c.elections[shard]
+	if !ok {
+		e = &election{}
+		c.elections[shard] = e
+	}
+	return e
+}
+
+// vacateHeld ends the terms the node leads in any election; callers hold mu.
+func (c *cluster) vacateHeld(node *Coordinator) {
+	for _, e := range c.elections {
+		if e.holder != nil && e.holder.node.node == node {
+			e.vacate()
+		}
+	}
+}
+
+// leave drops a member; callers hold mu.
+func (c *cluster) leave(id string) {
+	if i := slices.Index(c.members, id); i >= 0 {
+		c.members = slices.Delete(c.members, i, i+1)
+		close(c.changed)
+		c.changed = make(chan struct{})
+	}
+}
+
+type election struct {
+	holder *Lease
+	// vacant is closed when the holder gives up the leadership
+	vacant chan struct{}
+	terms  uint64
+}
+
+// vacate ends the current term; callers hold the cluster's mu.
+func (e *election) vacate() {
+	e.holder.lose()
+	e.holder = nil
+	close(e.vacant)
+}
+
+func newNode(c *cluster, id string) *Coordinator {
+	node := &Coordinator{cluster: c, id: id}
+	node.node = node
+	c.mu.Lock()
+	c.nodes = append(c.nodes, node)
+	c.mu.Unlock()
+	return node
+}
+
+// Coordinator is one node of the in-memory backend, or the view of a shard election it takes part in.
+type Coordinator struct {
+	id      string
+	cluster *cluster
+	// shard is the election of the coordinator, empty for the leadership of the cluster
+	shard string
+	// node owns the session: the coordinator itself unless it is a shard
+	node   *Coordinator
+	events coordinator.Broadcaster
+	closed bool
+}
+
+// Peer returns another node competing on the same backend.
+func (c *Coordinator) Peer(id string) *Coordinator {
+	return newNode(c.cluster, id)
+}
+
+func (c *Coordinator) Shard(name string) coordinator.Coordinator {
+	return &Coordinator{id: c.id, cluster: c.cluster, shard: name, node: c.node}
+}
+
+// SetUnavailable makes Check and TryAcquire fail with err until it is reset with nil.
+// Nodes see it as a disconnect and a reconnect.
+func (c *Coordinator) SetUnavailable(err error) {
+	c.cluster.mu.Lock()
+	defer c.cluster.mu.Unlock()
+	c.cluster.err = err
+	event := coordinator.SessionConnected
+	if err != nil {
+		event = coordinator.SessionDisconnected
+	}
+	for _, node := range c.cluster.nodes {
+		node.events.Publish(event)
+	}
+}
+
+func (c *Coordinator) Check(ctx context.Context) error {
+	c.cluster.mu.Lock()
+	defer c.cluster.mu.Unlock()
+	if c.cluster.err != nil {
+		return c.cluster.err
+	}
+	return ctx.Err()
+}
+
+func (c *Coordinator) TryAcquire(ctx context.Context) (coordinator.Lease, error) {
+	c.cluster.mu.Lock()
+	defer c.cluster.mu.Unlock()
+	if c.cluster.err != nil {
+		return nil, c.cluster.err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	e := c.cluster.election(c.shard)
+	if e.holder != nil {
+		return nil, coordinator.ErrLeaderExists
+	}
+	e.terms++
+	e.holder = &Lease{node: c, election: e, token: e.terms, lost: make(chan struct{})}
+	e.vacant = make(chan struct{})
+	return e.holder, nil
+}
+
+func (c *Coordinator) Leader(context.Context) (string, error) {
+	c.cluster.mu.Lock()
+	defer c.cluster.mu.Unlock()
+	if c.cluster.err != nil {
+		return "", c.cluster.err
+	}
+	holder := c.cluster.election(c.shard).holder
+	if holder == nil {
+		return "", coordinator.ErrNoLeader
+	}
+	return holder.node.id, nil
+}
+
+func (c *Coordinator) Vacant(context.Context) <-chan struct{} {
+	c.cluster.mu.Lock()
+	defer c.cluster.mu.Unlock()
+	e := c.cluster.election(c.shard)
+	if e.holder == nil {
+		vacant := make(chan struct{})
+		close(vacant)
+		return vacant
+	}
+	return e.vacant
+}
+
+func (c *Coordinator) Watch(ctx context.Context) <-chan coordinator.SessionEvent {
+	return c.node.events.Watch(ctx)
+}
+
+func (c *Coordinator) Members(context.Context) ([]string, <-chan struct{}, error) {
+	c.cluster.mu.Lock()
+	defer c.cluster.mu.Unlock()
+	if c.cluster.err != nil {
+		return nil, nil, c.cluster.err
+	}
+	if c.node.closed {
+		return nil, nil, errClosed
+	}
+	if !slices.Contains(c.cluster.members, c.id) {
+		c.cluster.members = append(c.cluster.members, c.id)
+		slices.Sort(c.cluster.members)
+		close(c.cluster.changed)
+		c.cluster.changed = make(chan struct{})
+	}
+	return slices.Clone(c.cluster.members), c.cluster.changed, nil
+}
+
+// Expire ends the node's session: it drops the node's leases and membership and reports
+// the expiry to the node.
+func (c *Coordinator) Expire() {
+	c.cluster.mu.Lock()
+	defer c.cluster.mu.Unlock()
+	c.cluster.vacateHeld(c.node)
+	c.cluster.leave(c.id)
+	c.node.events.Publish(coordinator.SessionExpired)
+}
+
+// Held reports whether any node leads the coordinator's election.
+func (c *Coordinator) Held() bool {
+	c.cluster.mu.Lock()
+	defer c.cluster.mu.Unlock()
+	return c.cluster.election(c.shard).holder != nil
+}
+
+// Close ends the node's session, which like an ephemeral node gives up its leadership
+// of the cluster and the shards. Closing a shard does nothing.
+func (c *Coordinator) Close() error {
+	if c.node != c {
+		return nil
+	}
+	c.cluster.mu.Lock()
+	defer c.cluster.mu.Unlock()
+	c.closed = true
+	c.cluster.vacateHeld(c)
+	c.cluster.leave(c.id)
+	return nil
+}
+
+func (c *Coordinator) Closed() bool {
+	c.cluster.mu.Lock()
+	defer c.cluster.mu.Unlock()
+	return c.node.closed
+}
+
+type Lease struct {
+	node     *Coordinator
+	election *election
+	token    uint64
+	lost     chan struct{}
+	once     sync.Once
+}
+
+// Token counts the terms of the election.
+func (l *Lease) Token() uint64 {
+	return l.token
+}
+
+func (l *Lease) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *Lease) lose() {
+	l.once.Do(func() {
+		close(l.lost)
+	})
+}
+
+func (l *Lease) Release(context.Context) error {
+	l.node.cluster.mu.Lock()
+	defer l.node.cluster.mu.Unlock()
+	if l.election.holder == l {
+		l.election.vacate()
+	}
+	l.lose()
+	return nil
+}
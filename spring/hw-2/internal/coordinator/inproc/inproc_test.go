@@ -0,0 +1,16 @@
+package inproc_test
+
+import (
+	"testing"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator/coordinatortest"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator/inproc"
+)
+
+func TestContract(t *testing.T) {
+	coordinatortest.Run(t, func(*testing.T) (coordinator.Coordinator, coordinator.Coordinator) {
+		a := inproc.New("node-0")
+		return a, a.Peer("node-1")
+	})
+}
@@ -0,0 +1,302 @@
+package zookeeper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator"
+	"github.com/go-zookeeper/zk"
+)
+
+var _ coordinator.Sharded = &Coordinator{}
+
+const checkInterval = 100 * time.Millisecond
+
+type Config struct {
+	Servers        []string
+	SessionTimeout time.Duration
+	// Path is the ephemeral znode whose owner is the leader. Shards and members are kept
+	// next to it, under shards/<name> and members/<node>.
+	Path   string
+	NodeID string
+}
+
+func New(cfg Config, logger *slog.Logger) (*Coordinator, error) {
+	logger = logger.With("subsystem", "ZooKeeper")
+	conn, events, err := zk.Connect(cfg.Servers, cfg.SessionTimeout, zk.WithLogger(zkLogger{logger: logger}))
+	if err != nil {
+		return nil, fmt.Errorf("connect to zookeeper: %w", err)
+	}
+	c := &Coordinator{
+		conn:    conn,
+		cfg:     cfg,
+		logger:  logger,
+		session: &session{leases: make(map[*lease]struct{})},
+	}
+	go c.watchSession(events)
+	return c, nil
+}
+
+// Coordinator holds leadership as an ephemeral znode, so it is gone together with the session.
+type Coordinator struct {
+	conn   *zk.Conn
+	cfg    Config
+	logger *slog.Logger
+	// session is shared by the node and its shards
+	session *session
+	// shard is set on the elections returned by Shard
+	shard bool
+}
+
+type session struct {
+	events coordinator.Broadcaster
+
+	mu sync.Mutex
+	// leases are the ones held by the node and its shards
+	leases map[*lease]struct{}
+}
+
+func (s *session) track(l *lease) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.leases[l] = struct{}{}
+}
+
+func (s *session) forget(l *lease) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.leases, l)
+}
+
+func (s *session) loseLeases() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for l := range s.leases {
+		l.lose()
+	}
+	clear(s.leases)
+}
+
+func (c *Coordinator) Shard(name string) coordinator.Coordinator {
+	shard := *c
+	shard.cfg.Path = path.Join(path.Dir(c.cfg.Path), "shards", name)
+	shard.logger = c.logger.With("shard", name)
+	shard.shard = true
+	return &shard
+}
+
+func (c *Coordinator) watchSession(events <-chan zk.Event) {
+	for event := range events {
+		if event.Type != zk.EventSession {
+			continue
+		}
+		c.logger.LogAttrs(context.Background(), slog.LevelInfo, "session event", slog.String("state", event.State.String()))
+		switch event.State {
+		case zk.StateHasSession:
+			c.session.events.Publish(coordinator.SessionConnected)
+		case zk.StateDisconnected:
+			c.session.loseLeases()
+			c.session.events.Publish(coordinator.SessionDisconnected)
+		case zk.StateExpired:
+			c.session.loseLeases()
+			c.session.events.Publish(coordinator.SessionExpired)
+		default:
+		}
+	}
+}
+
+func (c *Coordinator) Check(ctx context.Context) error {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for c.conn.State() != zk.StateHasSession {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("wait for zookeeper session (state %s): %w", c.conn.State(), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+func (c *Coordinator) TryAcquire(context.Context) (coordinator.Lease, error) {
+	if err := c.createParents(c.cfg.Path); err != nil {
+		return nil, err
+	}
+	_, err := c.conn.Create(c.cfg.Path, []byte(c.cfg.NodeID), zk.FlagEphemeral, zk.WorldACL(zk.PermAll))
+	if err != nil && !errors.Is(err, zk.ErrNodeExists) {
+		return nil, fmt.Errorf("create %s: %w", c.cfg.Path, err)
+	}
+	exists, stat, watch, err := c.conn.ExistsW(c.cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("watch %s: %w", c.cfg.Path, err)
+	}
+	// the node may still be ours after a reconnect within the session timeout
+	if !exists || stat.EphemeralOwner != c.conn.SessionID() {
+		return nil, coordinator.ErrLeaderExists
+	}
+	l := &lease{
+		conn:  c.conn,
+		path:  c.cfg.Path,
+		token: uint64(stat.Czxid),
+		lost:  make(chan struct{}),
+	}
+	c.session.track(l)
+	go func() {
+		event := <-watch
+		c.logger.LogAttrs(context.Background(), slog.LevelInfo, "leader node changed", slog.String("event", event.Type.String()))
+		l.lose()
+		c.session.forget(l)
+	}()
+	return l, nil
+}
+
+func (c *Coordinator) Leader(context.Context) (string, error) {
+	data, _, err := c.conn.Get(c.cfg.Path)
+	if errors.Is(err, zk.ErrNoNode) {
+		return "", coordinator.ErrNoLeader
+	}
+	if err != nil {
+		return "", fmt.Errorf("get %s: %w", c.cfg.Path, err)
+	}
+	return string(data), nil
+}
+
+func (c *Coordinator) Vacant(ctx context.Context) <-chan struct{} {
+	vacant := make(chan struct{})
+	go func() {
+		for {
+			exists, _, watch, err := c.conn.ExistsW(c.cfg.Path)
+			if err != nil {
+				// session problems reach the states through Watch
+				return
+			}
+			if !exists {
+				close(vacant)
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-watch:
+				if event.Type == zk.EventNotWatching {
+					return
+				}
+			}
+		}
+	}()
+	return vacant
+}
+
+func (c *Coordinator) Watch(ctx context.Context) <-chan coordinator.SessionEvent {
+	return c.session.events.Watch(ctx)
+}
+
+// Members keeps an ephemeral znode of the node, so it leaves together with the session.
+func (c *Coordinator) Members(ctx context.Context) ([]string, <-chan struct{}, error) {
+	dir := path.Join(path.Dir(c.cfg.Path), "members")
+	node := path.Join(dir, c.cfg.NodeID)
+	if err := c.createParents(node); err != nil {
+		return nil, nil, err
+	}
+	_, err := c.conn.Create(node, []byte(c.cfg.NodeID), zk.FlagEphemeral, zk.WorldACL(zk.PermAll))
+	if err != nil && !errors.Is(err, zk.ErrNodeExists) {
+		return nil, nil, fmt.Errorf("create %s: %w", node, err)
+	}
+	members, _, watch, err := c.conn.ChildrenW(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list %s: %w", dir, err)
+	}
+	slices.Sort(members)
+	changed := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case event := <-watch:
+			if event.Type != zk.EventNotWatching {
+				close(changed)
+			}
+		}
+	}()
+	return members, changed, nil
+}
+
+// createParents creates the missing parents of the znode at p.
+func (c *Coordinator) createParents(p string) error {
+	dir := path.Dir(p)
+	parts := strings.Split(strings.Trim(dir, "/"), "/")
+	for i := range parts {
+		if parts[i] == "" {
+			continue
+		}
+		node := "/" + strings.Join(parts[:i+1], "/")
+		_, err := c.conn.Create(node, nil, 0, zk.WorldACL(zk.PermAll))
+		if err != nil && !errors.Is(err, zk.ErrNodeExists) {
+			return fmt.Errorf("create %s: %w", node, err)
+		}
+	}
+	return nil
+}
+
+// Close ends the session of the node; closing a shard does nothing.
+func (c *Coordinator) Close() error {
+	if c.shard {
+		return nil
+	}
+	c.conn.Close()
+	return nil
+}
+
+type lease struct {
+	conn  *zk.Conn
+	path  string
+	token uint64
+	lost  chan struct{}
+	once  sync.Once
+}
+
+// Token is the zxid that created the leader node; each new node gets a greater one.
+func (l *lease) Token() uint64 {
+	return l.token
+}
+
+func (l *lease) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *lease) lose() {
+	l.once.Do(func() {
+		close(l.lost)
+	})
+}
+
+func (l *lease) Release(context.Context) error {
+	defer l.lose()
+	// after a session expiry the node may already belong to the next leader
+	exists, stat, err := l.conn.Exists(l.path)
+	if err != nil {
+		return fmt.Errorf("check %s: %w", l.path, err)
+	}
+	if !exists || stat.EphemeralOwner != l.conn.SessionID() {
+		return nil
+	}
+	err = l.conn.Delete(l.path, stat.Version)
+	if err != nil && !errors.Is(err, zk.ErrNoNode) {
+		return fmt.Errorf("delete %s: %w", l.path, err)
+	}
+	return nil
+}
+
+type zkLogger struct {
+	logger *slog.Logger
+}
+
+func (l zkLogger) Printf(format string, args ...any) {
+	l.logger.LogAttrs(context.Background(), slog.LevelDebug, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,42 @@
+package zookeeper_test
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator/coordinatortest"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator/zookeeper"
+)
+
+// ELECTION_TEST_ZK_SERVERS points the test at a running ensemble, e.g. the one from docker-compose.yaml.
+func TestContract(t *testing.T) {
+	servers := os.Getenv("ELECTION_TEST_ZK_SERVERS")
+	if servers == "" {
+		t.Skip("ELECTION_TEST_ZK_SERVERS is not set")
+	}
+	coordinatortest.Run(t, func(t *testing.T) (coordinator.Coordinator, coordinator.Coordinator) {
+		path := "/election-test/" + strconv.FormatInt(time.Now().UnixNano(), 10) + "/leader"
+		nodes := make([]coordinator.Coordinator, 2)
+		for i := range nodes {
+			c, err := zookeeper.New(zookeeper.Config{
+				Servers:        strings.Split(servers, ","),
+				SessionTimeout: 5 * time.Second,
+				Path:           path,
+				NodeID:         "node-" + strconv.Itoa(i),
+			}, slog.Default())
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() {
+				_ = c.Close()
+			})
+			nodes[i] = c
+		}
+		return nodes[0], nodes[1]
+	})
+}
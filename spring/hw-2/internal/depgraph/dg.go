@@ -3,65 +3,165 @@ package depgraph
 import (
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
-	"sync"
+	"strconv"
+	"sync/atomic"
+	"time"
 
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/clock"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/commands/cmdargs"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/di"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/filestore"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/stepdown"
 	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run"
-	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states/empty"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/workload"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
-type dgEntity[T any] struct {
-	sync.Once
-	value   T
-	initErr error
+const (
+	leaderPath      = "/election/leader"
+	sessionTimeout  = 5 * time.Second
+	stopTimeout     = 5 * time.Second
+	shutdownTimeout = time.Second
+)
+
+// DepGraph wires the election service on a di.Container: every dependency is built
+// on first use and closed in reverse order by Close.
+type DepGraph struct {
+	args cmdargs.RunArgs
+	// live is args with the settings applied by Reload
+	live      atomic.Pointer[cmdargs.RunArgs]
+	container *di.Container
 }
 
-func (e *dgEntity[T]) get(init func() (T, error)) (T, error) {
-	e.Do(func() {
-		e.value, e.initErr = init()
-	})
-	if e.initErr != nil {
-		return *new(T), e.initErr
+func New(args cmdargs.RunArgs) *DepGraph {
+	dg := &DepGraph{
+		args:      args,
+		container: di.New(),
 	}
-	return e.value, nil
+	dg.live.Store(&args)
+	c := dg.container
+	di.Provide(c, dg.newLogger)
+	di.Provide(c, dg.newClock)
+	di.Provide(c, dg.newRegistry)
+	di.Provide(c, dg.newCoordinator, di.WithClose(coordinator.Coordinator.Close))
+	di.Provide(c, dg.newFileStore)
+	di.Provide(c, dg.newFileWriter)
+	di.Provide(c, dg.newWorkloadRegistry)
+	di.Provide(c, dg.newWorkloads)
+	di.Provide(c, dg.newStepDown)
+	di.Provide(c, dg.newFailoverMetrics)
+	di.Provide(c, dg.newShardTable)
+	di.Provide(c, dg.newShardRunners)
+	di.Provide(c, dg.newShardSet)
+	di.Provide(c, dg.newStateFactory)
+	di.Provide(c, dg.newRunner)
+	di.Provide(c, dg.newHTTPServer, di.WithClose(shutdown))
+	return dg
 }
 
-type DepGraph struct {
-	logger      *dgEntity[*slog.Logger]
-	stateRunner *dgEntity[*run.LoopRunner]
-	emptyState  *dgEntity[*empty.State]
+// Close releases the dependencies built so far, the ones built last first.
+func (dg *DepGraph) Close() error {
+	return dg.container.Close()
 }
 
-func New() *DepGraph {
-	return &DepGraph{
-		logger:      &dgEntity[*slog.Logger]{},
-		stateRunner: &dgEntity[*run.LoopRunner]{},
-		emptyState:  &dgEntity[*empty.State]{},
+// Reload applies the settings that can change while the node runs: leader-timeout,
+// attempter-timeout and storage-capacity. The leader keeps its lease, the new values take
+// effect from the next write or election attempt.
+func (dg *DepGraph) Reload(args cmdargs.RunArgs) error {
+	live := *dg.live.Load()
+	live.LeaderTimeout = args.LeaderTimeout
+	live.AttempterTimeout = args.AttempterTimeout
+	live.StorageCapacity = args.StorageCapacity
+	dg.live.Store(&live)
+	files, err := dg.GetFileStore()
+	if err != nil {
+		return fmt.Errorf("get file store: %w", err)
+	}
+	files.SetCapacity(live.StorageCapacity)
+	writer, err := dg.GetFileWriter()
+	if err != nil {
+		return fmt.Errorf("get file writer: %w", err)
 	}
+	writer.SetInterval(live.LeaderTimeout)
+	if len(shardNames(dg.args)) > 0 {
+		shards, err := di.Resolve[*shardSet](dg.container)
+		if err != nil {
+			return fmt.Errorf("get shards: %w", err)
+		}
+		shards.reload(live)
+	}
+	return nil
+}
+
+func (dg *DepGraph) liveArgs() cmdargs.RunArgs {
+	return *dg.live.Load()
 }
 
 func (dg *DepGraph) GetLogger() (*slog.Logger, error) {
-	return dg.logger.get(func() (*slog.Logger, error) {
-		return slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{})), nil
-	})
+	return di.Resolve[*slog.Logger](dg.container)
 }
 
-func (dg *DepGraph) GetEmptyState() (*empty.State, error) {
-	return dg.emptyState.get(func() (*empty.State, error) {
-		logger, err := dg.GetLogger()
-		if err != nil {
-			return nil, fmt.Errorf("get logger: %w", err)
-		}
-		return empty.New(logger), nil
-	})
+func (dg *DepGraph) GetClock() (clock.Clock, error) {
+	return di.Resolve[clock.Clock](dg.container)
+}
+
+func (dg *DepGraph) GetCoordinator() (coordinator.Coordinator, error) {
+	return di.Resolve[coordinator.Coordinator](dg.container)
+}
+
+func (dg *DepGraph) GetFileStore() (*filestore.Store, error) {
+	return di.Resolve[*filestore.Store](dg.container)
+}
+
+// GetFileWriter returns the workload that writes a file every leader-timeout.
+func (dg *DepGraph) GetFileWriter() (*workload.FileWriter, error) {
+	return di.Resolve[*workload.FileWriter](dg.container)
+}
+
+// GetWorkloadRegistry lists the built-in workloads the leader can run.
+func (dg *DepGraph) GetWorkloadRegistry() (*workload.Registry, error) {
+	return di.Resolve[*workload.Registry](dg.container)
+}
+
+// GetWorkloads returns the configured workloads the leader starts on every term.
+func (dg *DepGraph) GetWorkloads() (*workload.Group, error) {
+	return di.Resolve[*workload.Group](dg.container)
+}
+
+// GetStepDown returns the channel SIGUSR1 and the admin endpoint ask the leader to step down through.
+func (dg *DepGraph) GetStepDown() (*stepdown.Requests, error) {
+	return di.Resolve[*stepdown.Requests](dg.container)
+}
+
+// GetInitState returns the first state of the election state machine.
+func (dg *DepGraph) GetInitState() (states.AutomataState, error) {
+	factory, err := di.Resolve[*stateFactory](dg.container)
+	if err != nil {
+		return nil, err
+	}
+	return factory.Init(), nil
+}
+
+func (dg *DepGraph) GetRegistry() (*prometheus.Registry, error) {
+	return di.Resolve[*prometheus.Registry](dg.container)
 }
 
 func (dg *DepGraph) GetRunner() (run.Runner, error) {
-	return dg.stateRunner.get(func() (*run.LoopRunner, error) {
-		logger, err := dg.GetLogger()
-		if err != nil {
-			return nil, fmt.Errorf("get logger: %w", err)
-		}
-		return run.NewLoopRunner(logger), nil
-	})
+	return di.Resolve[*run.ObservedRunner](dg.container)
+}
+
+func (dg *DepGraph) GetHTTPServer() (*http.Server, error) {
+	return di.Resolve[*http.Server](dg.container)
+}
+
+func nodeID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return host + "-" + strconv.Itoa(os.Getpid())
 }
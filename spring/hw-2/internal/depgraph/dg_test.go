@@ -0,0 +1,127 @@
+package depgraph
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/commands/cmdargs"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator/inproc"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/di"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/filestore"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states/shards"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/workload"
+)
+
+func inprocArgs(t *testing.T) cmdargs.RunArgs {
+	args := handoverArgs
+	args.Backend = cmdargs.BackendInProc
+	args.FileDir = t.TempDir()
+	args.HTTPAddr = "127.0.0.1:0"
+	args.Workloads = []string{workload.FilesName}
+	return args
+}
+
+func TestDepGraph(t *testing.T) {
+	t.Run("close releases the coordinator", func(t *testing.T) {
+		dg := New(inprocArgs(t))
+		if _, err := dg.GetInitState(); err != nil {
+			t.Fatalf("get first state: %v", err)
+		}
+		if _, err := dg.GetHTTPServer(); err != nil {
+			t.Fatalf("get http server: %v", err)
+		}
+		coord, err := dg.GetCoordinator()
+		if err != nil {
+			t.Fatalf("get coordinator: %v", err)
+		}
+		if err := dg.Close(); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+		if !coord.(*inproc.Coordinator).Closed() {
+			t.Error("coordinator is still open")
+		}
+		if _, err := dg.GetCoordinator(); !errors.Is(err, di.ErrClosed) {
+			t.Errorf("got %v, want %v", err, di.ErrClosed)
+		}
+	})
+
+	t.Run("init error carries the path", func(t *testing.T) {
+		args := inprocArgs(t)
+		args.Workloads = []string{"unknown"}
+		dg := New(args)
+		defer dg.Close()
+		_, err := dg.GetInitState()
+		var resolveErr *di.Error
+		if !errors.As(err, &resolveErr) {
+			t.Fatalf("got %v, want a %T", err, resolveErr)
+		}
+		if want := "*depgraph.stateFactory -> *workload.Group"; !strings.Contains(err.Error(), want) {
+			t.Errorf("got %q, want the path %q", err, want)
+		}
+	})
+
+	t.Run("shards write to their own directories", func(t *testing.T) {
+		args := inprocArgs(t)
+		args.ShardCount = 2
+		dg := New(args)
+		defer dg.Close()
+		runner, err := dg.GetRunner()
+		if err != nil {
+			t.Fatalf("get runner: %v", err)
+		}
+		first, err := dg.GetInitState()
+		if err != nil {
+			t.Fatalf("get first state: %v", err)
+		}
+		owned, err := di.Resolve[*shards.Table](dg.container)
+		if err != nil {
+			t.Fatalf("get shards: %v", err)
+		}
+		observed, err := di.Resolve[*run.ShardRunners](dg.container)
+		if err != nil {
+			t.Fatalf("get shard runners: %v", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- runner.Run(ctx, first)
+		}()
+
+		want := []string{"shard-0", "shard-1"}
+		written := func() bool {
+			for _, shard := range want {
+				if files, _ := filepath.Glob(filepath.Join(args.FileDir, shard, "*")); len(files) == 0 {
+					return false
+				}
+			}
+			return slices.Equal(owned.Owned(), want)
+		}
+		for deadline := time.Now().Add(5 * time.Second); !written(); time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("owns %v, want %v with files in each", owned.Owned(), want)
+			}
+		}
+		for _, shard := range want {
+			if state := observed.Current()[shard].State; state != states.LeaderName {
+				t.Errorf("%s is observed in %q, want %s", shard, state, states.LeaderName)
+			}
+		}
+		cancel()
+		if err := <-done; err != nil {
+			t.Fatalf("run: %v", err)
+		}
+		for _, shard := range want {
+			violations, err := filestore.Verify(filepath.Join(args.FileDir, shard))
+			if err != nil || len(violations) != 0 {
+				t.Errorf("verify %s: %v, %v", shard, violations, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,204 @@
+package depgraph
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/clock"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/commands/cmdargs"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator/inproc"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/filestore"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/stepdown"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states/failover"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/workload"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var handoverArgs = cmdargs.RunArgs{
+	LeaderTimeout:    time.Second,
+	AttempterTimeout: 10 * time.Second,
+	StorageCapacity:  100,
+	WorkloadGrace:    5 * time.Second,
+	StepDownCooldown: 15 * time.Second,
+}
+
+// clockSpeed is how many times faster than the wall clock runClock moves the fake one.
+const clockSpeed = 10
+
+// runClock keeps the fake clock going until the test ends, so the handover times measured on it
+// include every timer the nodes wait for and not only the instant the leadership was free.
+func runClock(t *testing.T, clk *clock.Fake) {
+	t.Helper()
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				clk.Advance(clockSpeed * time.Millisecond)
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		close(done)
+		<-stopped
+	})
+}
+
+// node is a full election state machine on the in-memory backend.
+type node struct {
+	runner   *run.ObservedRunner
+	stepDown *stepdown.Requests
+	stop     context.CancelFunc
+	done     chan struct{}
+	err      error
+}
+
+func startNode(t *testing.T, clk *clock.Fake, coord *inproc.Coordinator, dir string) *node {
+	t.Helper()
+	logger := slog.Default()
+	files := filestore.New(dir, handoverArgs.StorageCapacity, clk)
+	writer := workload.NewFileWriter(logger, clk, files, "node", handoverArgs.LeaderTimeout)
+	n := &node{
+		runner:   run.NewObservedRunner(run.NewLoopRunner(logger, states.Election), clk, prometheus.NewRegistry()),
+		stepDown: stepdown.New(),
+		done:     make(chan struct{}),
+	}
+	factory := &stateFactory{
+		logger:    logger,
+		clock:     clk,
+		coord:     coord,
+		files:     files,
+		workloads: workload.NewGroup(logger, clk, handoverArgs.WorkloadGrace, []workload.Workload{writer}),
+		stepDown:  n.stepDown,
+		failovers: failover.NewMetrics(prometheus.NewRegistry()),
+		args:      func() cmdargs.RunArgs { return handoverArgs },
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	n.stop = stop
+	go func() {
+		defer close(n.done)
+		n.err = n.runner.Run(ctx, factory.Init())
+	}()
+	t.Cleanup(func() {
+		_ = n.shutdown()
+	})
+	return n
+}
+
+// shutdown stops the node like SIGTERM does and waits for its state machine to finish.
+func (n *node) shutdown() error {
+	n.stop()
+	<-n.done
+	return n.err
+}
+
+// waitFor polls the node's state in real time.
+func (n *node) waitFor(t *testing.T, state string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for n.runner.Current().State != state {
+		if time.Now().After(deadline) {
+			t.Fatalf("node is %s, want %s", n.runner.Current().State, state)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHandover(t *testing.T) {
+	// every case starts with a leading a and an attempting b, and measures on the running clock
+	// how long b takes to lead once a goes away
+	start := func(t *testing.T) (*clock.Fake, *inproc.Coordinator, string) {
+		clk := clock.NewFake(time.Now())
+		runClock(t, clk)
+		return clk, inproc.New("a"), filepath.Join(t.TempDir(), "election")
+	}
+	var graceful, crash time.Duration
+
+	t.Run("shutdown", func(t *testing.T) {
+		clk, coordA, dir := start(t)
+		a := startNode(t, clk, coordA, dir)
+		a.waitFor(t, states.LeaderName)
+		b := startNode(t, clk, coordA.Peer("b"), dir)
+		b.waitFor(t, states.AttempterName)
+
+		started := clk.Now()
+		if err := a.shutdown(); err != nil {
+			t.Fatalf("leader stopped with %v", err)
+		}
+		b.waitFor(t, states.LeaderName)
+		graceful = clk.Now().Sub(started)
+		t.Logf("failover on shutdown took %s", graceful)
+		if graceful >= sessionTimeout {
+			t.Errorf("failover took %s, the follower waited for the session of the leader to expire", graceful)
+		}
+		if violations, err := filestore.Verify(dir); err != nil || len(violations) > 0 {
+			t.Errorf("verify: %v, %v", violations, err)
+		}
+	})
+
+	t.Run("crash", func(t *testing.T) {
+		clk, coordA, dir := start(t)
+		// a dies while leading: nothing releases its lease, and like ZooKeeper and etcd
+		// the backend drops it only when the session times out
+		if _, err := coordA.TryAcquire(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		started := clk.Now()
+		expired := clk.After(sessionTimeout)
+		go func() {
+			<-expired
+			coordA.Expire()
+		}()
+		b := startNode(t, clk, coordA.Peer("b"), dir)
+		b.waitFor(t, states.LeaderName)
+		crash = clk.Now().Sub(started)
+		t.Logf("failover on crash took %s", crash)
+		if crash < sessionTimeout {
+			t.Errorf("failover took %s, the follower took the leadership of a live session", crash)
+		}
+	})
+
+	if graceful > 0 && crash > 0 && graceful >= crash {
+		t.Errorf("graceful failover took %s, no faster than %s after a crash", graceful, crash)
+	}
+
+	t.Run("step-down", func(t *testing.T) {
+		clk, coordA, dir := start(t)
+		a := startNode(t, clk, coordA, dir)
+		a.waitFor(t, states.LeaderName)
+		b := startNode(t, clk, coordA.Peer("b"), dir)
+		b.waitFor(t, states.AttempterName)
+
+		started := clk.Now()
+		for !a.stepDown.Request() {
+			time.Sleep(time.Millisecond)
+		}
+		b.waitFor(t, states.LeaderName)
+		failover := clk.Now().Sub(started)
+		t.Logf("failover on step-down took %s", failover)
+		if failover >= sessionTimeout {
+			t.Errorf("failover took %s, the follower waited for the session of the leader to expire", failover)
+		}
+		a.waitFor(t, states.AttempterName)
+
+		// a sits out even when the leadership is free again
+		if err := b.shutdown(); err != nil {
+			t.Fatalf("leader stopped with %v", err)
+		}
+		a.waitFor(t, states.LeaderName)
+		if back := clk.Now().Sub(started); back < handoverArgs.StepDownCooldown {
+			t.Errorf("node that stepped down took the leadership back after %s, during its cooldown", back)
+		}
+	})
+}
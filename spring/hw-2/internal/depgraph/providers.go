@@ -0,0 +1,310 @@
+package depgraph
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/clock"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/commands/cmdargs"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator/etcd"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator/inproc"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator/zookeeper"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/di"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/filestore"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/httpapi"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/stepdown"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states/failover"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states/shards"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/workload"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Providers resolve their dependencies through the scope and return resolution errors
+// as they are: the container adds the dependency path.
+
+func (dg *DepGraph) newLogger(di.Scope) (*slog.Logger, error) {
+	return slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{})), nil
+}
+
+func (dg *DepGraph) newClock(di.Scope) (clock.Clock, error) {
+	return clock.New(), nil
+}
+
+func (dg *DepGraph) newRegistry(di.Scope) (*prometheus.Registry, error) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return registry, nil
+}
+
+func (dg *DepGraph) newCoordinator(s di.Scope) (coordinator.Coordinator, error) {
+	logger, err := di.Resolve[*slog.Logger](s)
+	if err != nil {
+		return nil, err
+	}
+	switch dg.args.Backend {
+	case cmdargs.BackendEtcd:
+		return etcd.New(etcd.Config{
+			Endpoints:  dg.args.EtcdEndpoints,
+			SessionTTL: sessionTimeout,
+			Prefix:     leaderPath,
+			NodeID:     nodeID(),
+		}, logger)
+	case cmdargs.BackendInProc:
+		return inproc.New(nodeID()), nil
+	default:
+		return zookeeper.New(zookeeper.Config{
+			Servers:        dg.args.ZookeeperServers,
+			SessionTimeout: sessionTimeout,
+			Path:           leaderPath,
+			NodeID:         nodeID(),
+		}, logger)
+	}
+}
+
+func (dg *DepGraph) newFileStore(s di.Scope) (*filestore.Store, error) {
+	clk, err := di.Resolve[clock.Clock](s)
+	if err != nil {
+		return nil, err
+	}
+	return filestore.New(dg.args.FileDir, dg.liveArgs().StorageCapacity, clk), nil
+}
+
+func (dg *DepGraph) newFileWriter(s di.Scope) (*workload.FileWriter, error) {
+	logger, err := di.Resolve[*slog.Logger](s)
+	if err != nil {
+		return nil, err
+	}
+	clk, err := di.Resolve[clock.Clock](s)
+	if err != nil {
+		return nil, err
+	}
+	files, err := di.Resolve[*filestore.Store](s)
+	if err != nil {
+		return nil, err
+	}
+	return workload.NewFileWriter(logger, clk, files, nodeID(), dg.liveArgs().LeaderTimeout), nil
+}
+
+// newWorkloadRegistry registers the built-in workloads; only the configured ones get built,
+// by newWorkloads while the same resolution runs.
+func (dg *DepGraph) newWorkloadRegistry(s di.Scope) (*workload.Registry, error) {
+	logger, err := di.Resolve[*slog.Logger](s)
+	if err != nil {
+		return nil, err
+	}
+	clk, err := di.Resolve[clock.Clock](s)
+	if err != nil {
+		return nil, err
+	}
+	return dg.workloadRegistry(logger, clk, func() (workload.Workload, error) {
+		return di.Resolve[*workload.FileWriter](s)
+	}), nil
+}
+
+// workloadRegistry registers the built-in workloads with files building the file writer,
+// which differs between the node and its shards.
+func (dg *DepGraph) workloadRegistry(logger *slog.Logger, clk clock.Clock, files workload.Factory) *workload.Registry {
+	registry := workload.NewRegistry()
+	registry.Register(workload.FilesName, files)
+	registry.Register(workload.CronName, func() (workload.Workload, error) {
+		schedule, err := workload.ParseSchedule(dg.args.CronSchedule)
+		if err != nil {
+			return nil, err
+		}
+		return workload.NewCommand(logger, clk, schedule, dg.args.CronCommand, dg.args.WorkloadGrace), nil
+	})
+	return registry
+}
+
+func (dg *DepGraph) newWorkloads(s di.Scope) (*workload.Group, error) {
+	logger, err := di.Resolve[*slog.Logger](s)
+	if err != nil {
+		return nil, err
+	}
+	clk, err := di.Resolve[clock.Clock](s)
+	if err != nil {
+		return nil, err
+	}
+	registry, err := di.Resolve[*workload.Registry](s)
+	if err != nil {
+		return nil, err
+	}
+	workloads, err := registry.Build(dg.args.Workloads)
+	if err != nil {
+		return nil, err
+	}
+	return workload.NewGroup(logger, clk, dg.args.WorkloadGrace, workloads), nil
+}
+
+func (dg *DepGraph) newStepDown(di.Scope) (*stepdown.Requests, error) {
+	return stepdown.New(), nil
+}
+
+func (dg *DepGraph) newFailoverMetrics(s di.Scope) (*failover.Metrics, error) {
+	registry, err := di.Resolve[*prometheus.Registry](s)
+	if err != nil {
+		return nil, err
+	}
+	return failover.NewMetrics(registry), nil
+}
+
+func (dg *DepGraph) newShardTable(s di.Scope) (*shards.Table, error) {
+	registry, err := di.Resolve[*prometheus.Registry](s)
+	if err != nil {
+		return nil, err
+	}
+	return shards.NewTable(registry), nil
+}
+
+func (dg *DepGraph) newShardRunners(s di.Scope) (*run.ShardRunners, error) {
+	logger, err := di.Resolve[*slog.Logger](s)
+	if err != nil {
+		return nil, err
+	}
+	clk, err := di.Resolve[clock.Clock](s)
+	if err != nil {
+		return nil, err
+	}
+	registry, err := di.Resolve[*prometheus.Registry](s)
+	if err != nil {
+		return nil, err
+	}
+	return run.NewShardRunners(run.NewLoopRunner(logger, states.Shard), clk, registry), nil
+}
+
+func (dg *DepGraph) newShardSet(s di.Scope) (*shardSet, error) {
+	logger, err := di.Resolve[*slog.Logger](s)
+	if err != nil {
+		return nil, err
+	}
+	clk, err := di.Resolve[clock.Clock](s)
+	if err != nil {
+		return nil, err
+	}
+	coord, err := di.Resolve[coordinator.Coordinator](s)
+	if err != nil {
+		return nil, err
+	}
+	sharded, ok := coord.(coordinator.Sharded)
+	if !ok {
+		return nil, fmt.Errorf("backend %s doesn't support shards", dg.args.Backend)
+	}
+	return &shardSet{
+		dg:     dg,
+		logger: logger,
+		clock:  clk,
+		coord:  sharded,
+		built:  make(map[string]*shardFactory),
+	}, nil
+}
+
+func (dg *DepGraph) newStateFactory(s di.Scope) (*stateFactory, error) {
+	logger, err := di.Resolve[*slog.Logger](s)
+	if err != nil {
+		return nil, err
+	}
+	clk, err := di.Resolve[clock.Clock](s)
+	if err != nil {
+		return nil, err
+	}
+	coord, err := di.Resolve[coordinator.Coordinator](s)
+	if err != nil {
+		return nil, err
+	}
+	files, err := di.Resolve[*filestore.Store](s)
+	if err != nil {
+		return nil, err
+	}
+	workloads, err := di.Resolve[*workload.Group](s)
+	if err != nil {
+		return nil, err
+	}
+	stepDown, err := di.Resolve[*stepdown.Requests](s)
+	if err != nil {
+		return nil, err
+	}
+	failovers, err := di.Resolve[*failover.Metrics](s)
+	if err != nil {
+		return nil, err
+	}
+	factory := &stateFactory{
+		logger:    logger,
+		clock:     clk,
+		coord:     coord,
+		files:     files,
+		workloads: workloads,
+		stepDown:  stepDown,
+		failovers: failovers,
+		args:      dg.liveArgs,
+	}
+	if names := shardNames(dg.args); len(names) > 0 {
+		if factory.shardSet, err = di.Resolve[*shardSet](s); err != nil {
+			return nil, err
+		}
+		if factory.owned, err = di.Resolve[*shards.Table](s); err != nil {
+			return nil, err
+		}
+		if factory.shardRunners, err = di.Resolve[*run.ShardRunners](s); err != nil {
+			return nil, err
+		}
+		factory.shardNames = names
+	}
+	return factory, nil
+}
+
+func (dg *DepGraph) newRunner(s di.Scope) (*run.ObservedRunner, error) {
+	logger, err := di.Resolve[*slog.Logger](s)
+	if err != nil {
+		return nil, err
+	}
+	clk, err := di.Resolve[clock.Clock](s)
+	if err != nil {
+		return nil, err
+	}
+	registry, err := di.Resolve[*prometheus.Registry](s)
+	if err != nil {
+		return nil, err
+	}
+	return run.NewObservedRunner(run.NewLoopRunner(logger, states.Election), clk, registry), nil
+}
+
+func (dg *DepGraph) newHTTPServer(s di.Scope) (*http.Server, error) {
+	logger, err := di.Resolve[*slog.Logger](s)
+	if err != nil {
+		return nil, err
+	}
+	runner, err := di.Resolve[*run.ObservedRunner](s)
+	if err != nil {
+		return nil, err
+	}
+	coord, err := di.Resolve[coordinator.Coordinator](s)
+	if err != nil {
+		return nil, err
+	}
+	registry, err := di.Resolve[*prometheus.Registry](s)
+	if err != nil {
+		return nil, err
+	}
+	stepDown, err := di.Resolve[*stepdown.Requests](s)
+	if err != nil {
+		return nil, err
+	}
+	shardRunners, err := di.Resolve[*run.ShardRunners](s)
+	if err != nil {
+		return nil, err
+	}
+	return httpapi.New(dg.args.HTTPAddr, nodeID(), runner, coord, stepDown, dg.args.StepDownToken, shardRunners, registry, logger), nil
+}
+
+func shutdown(server *http.Server) error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return server.Shutdown(ctx)
+}
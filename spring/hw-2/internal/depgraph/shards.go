@@ -0,0 +1,96 @@
+package depgraph
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/clock"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/commands/cmdargs"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/filestore"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/stepdown"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/workload"
+)
+
+// shardNames returns the shards the node competes for, named shard-0, shard-1 and so on
+// if only their number is set; none means a single election.
+func shardNames(args cmdargs.RunArgs) []string {
+	if args.ShardCount == 0 {
+		return args.Shards
+	}
+	names := make([]string, args.ShardCount)
+	for i := range names {
+		names[i] = "shard-" + strconv.Itoa(i)
+	}
+	return names
+}
+
+// shardSet builds the states of a shard the first time the shard is assigned to the node
+// and keeps them for the next time. Every shard writes to its own subdirectory of file-dir,
+// since the fencing tokens of different shards don't compare.
+type shardSet struct {
+	dg     *DepGraph
+	logger *slog.Logger
+	clock  clock.Clock
+	coord  coordinator.Sharded
+	mu     sync.Mutex
+	built  map[string]*shardFactory
+}
+
+// machine returns the first state of the shard's machine.
+func (s *shardSet) machine(shard string) (states.AutomataState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.built[shard]
+	if !ok {
+		var err error
+		if f, err = s.build(shard); err != nil {
+			return nil, fmt.Errorf("build workloads: %w", err)
+		}
+		s.built[shard] = f
+	}
+	if err := f.files.Check(); err != nil {
+		return nil, fmt.Errorf("check file dir: %w", err)
+	}
+	return f.Init(), nil
+}
+
+func (s *shardSet) build(shard string) (*shardFactory, error) {
+	args := s.dg.liveArgs()
+	logger := s.logger.With("shard", shard)
+	f := &shardFactory{
+		logger: logger,
+		clock:  s.clock,
+		coord:  s.coord.Shard(shard),
+		files:  filestore.New(filepath.Join(s.dg.args.FileDir, shard), args.StorageCapacity, s.clock),
+		// nothing requests a step-down of a shard, the shards move by rendezvous hashing
+		stepDown: stepdown.New(),
+		args:     s.dg.liveArgs,
+	}
+	registry := s.dg.workloadRegistry(logger, s.clock, func() (workload.Workload, error) {
+		f.writer = workload.NewFileWriter(logger, s.clock, f.files, nodeID(), args.LeaderTimeout)
+		return f.writer, nil
+	})
+	workloads, err := registry.Build(s.dg.args.Workloads)
+	if err != nil {
+		return nil, err
+	}
+	f.workloads = workload.NewGroup(logger, s.clock, s.dg.args.WorkloadGrace, workloads)
+	return f, nil
+}
+
+// reload applies the reloaded settings to the shards built so far.
+func (s *shardSet) reload(args cmdargs.RunArgs) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range s.built {
+		f.files.SetCapacity(args.StorageCapacity)
+		if f.writer != nil {
+			f.writer.SetInterval(args.LeaderTimeout)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package depgraph
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/backoff"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/clock"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/commands/cmdargs"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/filestore"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/stepdown"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states/attempter"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states/failover"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states/initstate"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states/leader"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states/shards"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states/stopping"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/workload"
+)
+
+var (
+	_ states.Factory = &stateFactory{}
+	_ states.Factory = &shardFactory{}
+)
+
+// stateFactory creates states on every transition since they carry per-transition data such as the lease.
+type stateFactory struct {
+	logger    *slog.Logger
+	clock     clock.Clock
+	coord     coordinator.Coordinator
+	files     *filestore.Store
+	workloads *workload.Group
+	stepDown  *stepdown.Requests
+	failovers *failover.Metrics
+	// args returns the run arguments with the reloaded settings applied
+	args func() cmdargs.RunArgs
+	// shardSet is nil unless the node competes for shards instead of a single election
+	shardSet     *shardSet
+	shardNames   []string
+	shardRunners *run.ShardRunners
+	owned        *shards.Table
+}
+
+func (f *stateFactory) Init() states.AutomataState {
+	return initstate.New(f.logger, f.coord, f.files, f.args().AttempterTimeout, f)
+}
+
+func (f *stateFactory) Attempter(cooldown time.Duration) states.AutomataState {
+	if f.shardSet != nil {
+		return shards.New(f.logger, f.shardSet.coord, nodeID(), f.shardNames, f.shardRunners.For, f.shardSet.machine, f.owned, f)
+	}
+	return attempter.New(f.logger, f.clock, f.coord, func() time.Duration {
+		return f.args().AttempterTimeout
+	}, cooldown, f)
+}
+
+func (f *stateFactory) Leader(lease coordinator.Lease) states.AutomataState {
+	return leader.New(f.logger, lease, f.workloads, f.stepDown, f.args().StepDownCooldown, f)
+}
+
+func (f *stateFactory) Failover(cause error) states.AutomataState {
+	args := f.args()
+	cfg := failover.Config{
+		Timeout: args.AttempterTimeout,
+		Backoff: backoff.Policy{
+			Initial:     args.FailoverInitialBackoff,
+			Max:         args.FailoverMaxBackoff,
+			Multiplier:  args.FailoverMultiplier,
+			Jitter:      args.FailoverJitter,
+			MaxAttempts: args.FailoverMaxAttempts,
+			MaxElapsed:  args.FailoverMaxTime,
+		},
+		Mode: failover.Mode(args.FailoverMode),
+		Rand: rand.Float64,
+	}
+	return failover.New(f.logger, f.clock, f.coord, cause, cfg, f.failovers, f)
+}
+
+func (f *stateFactory) Stopping(lease coordinator.Lease) states.AutomataState {
+	return stopping.New(f.logger, f.coord, lease, stopTimeout)
+}
+
+// shardFactory creates the states of a shard's machine. Shards watches the session for all
+// shards, so Failover ends the machine and leaves the recovery to the node.
+type shardFactory struct {
+	logger    *slog.Logger
+	clock     clock.Clock
+	coord     coordinator.Coordinator
+	files     *filestore.Store
+	writer    *workload.FileWriter
+	workloads *workload.Group
+	stepDown  *stepdown.Requests
+	args      func() cmdargs.RunArgs
+}
+
+func (f *shardFactory) Init() states.AutomataState {
+	return f.Attempter(0)
+}
+
+func (f *shardFactory) Attempter(cooldown time.Duration) states.AutomataState {
+	return attempter.New(f.logger, f.clock, f.coord, func() time.Duration {
+		return f.args().AttempterTimeout
+	}, cooldown, f)
+}
+
+func (f *shardFactory) Leader(lease coordinator.Lease) states.AutomataState {
+	return leader.New(f.logger, lease, f.workloads, f.stepDown, 0, f)
+}
+
+func (f *shardFactory) Failover(cause error) states.AutomataState {
+	return shards.Failed(cause)
+}
+
+func (f *shardFactory) Stopping(lease coordinator.Lease) states.AutomataState {
+	return stopping.New(f.logger, f.coord, lease, stopTimeout)
+}
@@ -0,0 +1,172 @@
+package di
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrCycle is returned when a dependency ends up depending on itself.
+	ErrCycle = errors.New("dependency cycle")
+	// ErrNoProvider is returned for a type nothing was registered for.
+	ErrNoProvider = errors.New("no provider")
+	// ErrClosed is returned when resolving from a closed container.
+	ErrClosed = errors.New("container closed")
+)
+
+// Error is a failed resolution with the dependency path that led to it, from the type
+// asked for to the one that failed.
+type Error struct {
+	Path []reflect.Type
+	Err  error
+}
+
+func (e *Error) Error() string {
+	names := make([]string, 0, len(e.Path))
+	for _, t := range e.Path {
+		names = append(names, t.String())
+	}
+	return fmt.Sprintf("resolve %s: %v", strings.Join(names, " -> "), e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Scope resolves dependencies: the container at the top level and, inside a provider,
+// the resolution the provider runs in, which carries the path for cycle detection.
+type Scope interface {
+	resolve(t reflect.Type) (any, error)
+}
+
+// Option configures a provider.
+type Option[T any] func(*provider)
+
+// WithClose registers a hook the container runs on the value when it is closed.
+func WithClose[T any](hook func(T) error) Option[T] {
+	return func(p *provider) {
+		p.close = func(v any) error {
+			return hook(v.(T))
+		}
+	}
+}
+
+type provider struct {
+	build func(Scope) (any, error)
+	close func(any) error
+
+	done  bool
+	value any
+	err   error
+}
+
+type closer struct {
+	t     reflect.Type
+	value any
+	close func(any) error
+}
+
+// Container builds every registered type once, on first use, and closes them in reverse.
+type Container struct {
+	mu        sync.Mutex
+	providers map[reflect.Type]*provider
+	// closers are in the order the values were built
+	closers []closer
+	closed  bool
+}
+
+func New() *Container {
+	return &Container{providers: make(map[reflect.Type]*provider)}
+}
+
+// Provide registers how to build a T, replacing an earlier provider of the type.
+// build must resolve its dependencies through the scope it is given: resolving from
+// the container itself would wait for the resolution that runs build.
+func Provide[T any](c *Container, build func(Scope) (T, error), opts ...Option[T]) {
+	p := &provider{
+		build: func(s Scope) (any, error) {
+			return build(s)
+		},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.providers[reflect.TypeFor[T]()] = p
+}
+
+// Resolve returns the T of the scope's container, building it and its dependencies
+// on first use. A failed build is remembered and returned on every later call.
+func Resolve[T any](s Scope) (T, error) {
+	v, err := s.resolve(reflect.TypeFor[T]())
+	if err != nil {
+		return *new(T), err
+	}
+	return v.(T), nil
+}
+
+func (c *Container) resolve(t reflect.Type) (any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, &Error{Path: []reflect.Type{t}, Err: ErrClosed}
+	}
+	return (&resolution{container: c}).resolve(t)
+}
+
+// Close runs the close hooks of the built values in reverse build order, so values are
+// closed before their dependencies. Later calls do nothing.
+func (c *Container) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	var errs []error
+	for _, cl := range slices.Backward(c.closers) {
+		if err := cl.close(cl.value); err != nil {
+			errs = append(errs, fmt.Errorf("close %s: %w", cl.t, err))
+		}
+	}
+	c.closers = nil
+	return errors.Join(errs...)
+}
+
+// resolution is a single top-level Resolve; the container is locked while it runs.
+type resolution struct {
+	container *Container
+	path      []reflect.Type
+}
+
+func (r *resolution) resolve(t reflect.Type) (any, error) {
+	path := append(slices.Clone(r.path), t)
+	if slices.Contains(r.path, t) {
+		return nil, &Error{Path: path, Err: ErrCycle}
+	}
+	p, ok := r.container.providers[t]
+	if !ok {
+		return nil, &Error{Path: path, Err: ErrNoProvider}
+	}
+	if p.done {
+		return p.value, p.err
+	}
+	value, err := p.build(&resolution{container: r.container, path: path})
+	if err != nil {
+		// the deepest failure already knows the whole path
+		var resolveErr *Error
+		if !errors.As(err, &resolveErr) {
+			err = &Error{Path: path, Err: err}
+		}
+	}
+	p.done, p.value, p.err = true, value, err
+	if err == nil && p.close != nil {
+		r.container.closers = append(r.container.closers, closer{t: t, value: value, close: p.close})
+	}
+	return value, err
+}
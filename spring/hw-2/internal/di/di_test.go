@@ -0,0 +1,206 @@
+package di_test
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/di"
+)
+
+type (
+	config struct{ name string }
+	store  struct{ cfg *config }
+	server struct{ store *store }
+)
+
+// chain registers server -> store -> config, recording builds and closes.
+func chain(c *di.Container, log *[]string) {
+	di.Provide(c, func(di.Scope) (*config, error) {
+		*log = append(*log, "build config")
+		return &config{name: "test"}, nil
+	}, di.WithClose(func(*config) error {
+		*log = append(*log, "close config")
+		return nil
+	}))
+	di.Provide(c, func(s di.Scope) (*store, error) {
+		cfg, err := di.Resolve[*config](s)
+		if err != nil {
+			return nil, err
+		}
+		*log = append(*log, "build store")
+		return &store{cfg: cfg}, nil
+	}, di.WithClose(func(*store) error {
+		*log = append(*log, "close store")
+		return nil
+	}))
+	di.Provide(c, func(s di.Scope) (*server, error) {
+		st, err := di.Resolve[*store](s)
+		if err != nil {
+			return nil, err
+		}
+		*log = append(*log, "build server")
+		return &server{store: st}, nil
+	}, di.WithClose(func(*server) error {
+		*log = append(*log, "close server")
+		return nil
+	}))
+}
+
+func TestResolve(t *testing.T) {
+	t.Run("builds once on first use", func(t *testing.T) {
+		var log []string
+		c := di.New()
+		chain(c, &log)
+		if len(log) != 0 {
+			t.Fatalf("built before use: %v", log)
+		}
+		first, err := di.Resolve[*server](c)
+		if err != nil {
+			t.Fatalf("resolve: %v", err)
+		}
+		second, err := di.Resolve[*server](c)
+		if err != nil {
+			t.Fatalf("resolve: %v", err)
+		}
+		if first != second {
+			t.Error("resolved two servers")
+		}
+		if want := []string{"build config", "build store", "build server"}; !slices.Equal(log, want) {
+			t.Errorf("got %v, want %v", log, want)
+		}
+	})
+
+	t.Run("interfaces", func(t *testing.T) {
+		c := di.New()
+		di.Provide(c, func(di.Scope) (fmt.Stringer, error) {
+			return &strings.Builder{}, nil
+		})
+		if _, err := di.Resolve[fmt.Stringer](c); err != nil {
+			t.Errorf("resolve: %v", err)
+		}
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		var log []string
+		c := di.New()
+		chain(c, &log)
+		// config now needs the server, which needs config through the store
+		di.Provide(c, func(s di.Scope) (*config, error) {
+			if _, err := di.Resolve[*server](s); err != nil {
+				return nil, fmt.Errorf("look up server: %w", err)
+			}
+			return &config{}, nil
+		})
+		_, err := di.Resolve[*server](c)
+		if !errors.Is(err, di.ErrCycle) {
+			t.Fatalf("got %v, want %v", err, di.ErrCycle)
+		}
+		want := "resolve *di_test.server -> *di_test.store -> *di_test.config -> *di_test.server: dependency cycle"
+		if !strings.HasSuffix(err.Error(), want) {
+			t.Errorf("got %q, want the path %q", err, want)
+		}
+	})
+
+	t.Run("init error", func(t *testing.T) {
+		var log []string
+		c := di.New()
+		chain(c, &log)
+		errBroken := errors.New("broken")
+		builds := 0
+		di.Provide(c, func(di.Scope) (*config, error) {
+			builds++
+			return nil, errBroken
+		})
+		for range 2 {
+			_, err := di.Resolve[*server](c)
+			if !errors.Is(err, errBroken) {
+				t.Fatalf("got %v, want %v", err, errBroken)
+			}
+			var resolveErr *di.Error
+			if !errors.As(err, &resolveErr) || len(resolveErr.Path) != 3 {
+				t.Errorf("error %v doesn't carry the path to config", err)
+			}
+		}
+		if builds != 1 {
+			t.Errorf("failed provider ran %d times, want once", builds)
+		}
+	})
+
+	t.Run("no provider", func(t *testing.T) {
+		c := di.New()
+		di.Provide(c, func(s di.Scope) (*store, error) {
+			cfg, err := di.Resolve[*config](s)
+			return &store{cfg: cfg}, err
+		})
+		_, err := di.Resolve[*store](c)
+		if !errors.Is(err, di.ErrNoProvider) || !strings.Contains(err.Error(), "*di_test.store -> *di_test.config") {
+			t.Errorf("got %v, want %v with the path", err, di.ErrNoProvider)
+		}
+	})
+}
+
+func TestClose(t *testing.T) {
+	t.Run("reverse build order", func(t *testing.T) {
+		var log []string
+		c := di.New()
+		chain(c, &log)
+		if _, err := di.Resolve[*server](c); err != nil {
+			t.Fatalf("resolve: %v", err)
+		}
+		log = nil
+		if err := c.Close(); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+		if err := c.Close(); err != nil {
+			t.Fatalf("close again: %v", err)
+		}
+		if want := []string{"close server", "close store", "close config"}; !slices.Equal(log, want) {
+			t.Errorf("got %v, want %v", log, want)
+		}
+		if _, err := di.Resolve[*server](c); !errors.Is(err, di.ErrClosed) {
+			t.Errorf("resolve after close: %v, want %v", err, di.ErrClosed)
+		}
+	})
+
+	t.Run("only built values", func(t *testing.T) {
+		var log []string
+		c := di.New()
+		chain(c, &log)
+		if _, err := di.Resolve[*config](c); err != nil {
+			t.Fatalf("resolve: %v", err)
+		}
+		log = nil
+		if err := c.Close(); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+		if want := []string{"close config"}; !slices.Equal(log, want) {
+			t.Errorf("got %v, want %v", log, want)
+		}
+	})
+
+	t.Run("runs every hook", func(t *testing.T) {
+		var log []string
+		c := di.New()
+		chain(c, &log)
+		errStuck := errors.New("stuck")
+		di.Provide(c, func(s di.Scope) (*store, error) {
+			cfg, err := di.Resolve[*config](s)
+			return &store{cfg: cfg}, err
+		}, di.WithClose(func(*store) error {
+			return errStuck
+		}))
+		if _, err := di.Resolve[*server](c); err != nil {
+			t.Fatalf("resolve: %v", err)
+		}
+		log = nil
+		if err := c.Close(); !errors.Is(err, errStuck) {
+			t.Errorf("got %v, want %v", err, errStuck)
+		}
+		if want := []string{"close server", "close config"}; !slices.Equal(log, want) {
+			t.Errorf("got %v, want %v", log, want)
+		}
+	})
+}
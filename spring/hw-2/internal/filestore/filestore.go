@@ -0,0 +1,212 @@
+package filestore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/clock"
+)
+
+const (
+	filePrefix  = "election-"
+	fileSuffix  = ".txt"
+	tokenHeader = "token: "
+)
+
+var (
+	// ErrTermLost is returned when the term a write belongs to has already ended.
+	ErrTermLost = errors.New("leadership term lost")
+	// ErrStaleTerm is returned when the directory holds a file of a later term.
+	ErrStaleTerm = errors.New("a later term has written to the directory")
+	// ErrNoToken is returned for files that don't start with a fencing token.
+	ErrNoToken = errors.New("no fencing token")
+)
+
+// Term is the leadership term a write belongs to, coordinator.Lease implements it.
+type Term interface {
+	Token() uint64
+	Lost() <-chan struct{}
+}
+
+func New(dir string, capacity int, clk clock.Clock) *Store {
+	s := &Store{
+		dir:   dir,
+		clock: clk,
+	}
+	s.capacity.Store(int64(capacity))
+	return s
+}
+
+// Store writes the leader's files and keeps at most capacity of them, removing the oldest.
+type Store struct {
+	dir      string
+	capacity atomic.Int64
+	clock    clock.Clock
+}
+
+// SetCapacity changes how many files the store keeps, starting from the next write.
+func (s *Store) SetCapacity(capacity int) {
+	s.capacity.Store(int64(capacity))
+}
+
+// Check makes sure the directory exists and is writable.
+func (s *Store) Check() error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("create %s: %w", s.dir, err)
+	}
+	probe, err := os.CreateTemp(s.dir, ".probe-")
+	if err != nil {
+		return fmt.Errorf("write to %s: %w", s.dir, err)
+	}
+	_ = probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// Write stores data in a new file headed by the term's fencing token and returns its path.
+// It refuses to write once the term is lost or a later term has written to the directory.
+func (s *Store) Write(term Term, data []byte) (string, error) {
+	latest, err := s.latestToken()
+	if err != nil {
+		return "", err
+	}
+	if latest > term.Token() {
+		return "", fmt.Errorf("%w: token %d is behind %d", ErrStaleTerm, term.Token(), latest)
+	}
+	select {
+	case <-term.Lost():
+		return "", fmt.Errorf("%w: token %d", ErrTermLost, term.Token())
+	default:
+	}
+	// fixed-width names sort in creation order
+	name := filepath.Join(s.dir, fmt.Sprintf("%s%019d%s", filePrefix, s.clock.Now().UnixNano(), fileSuffix))
+	content := append([]byte(tokenHeader+strconv.FormatUint(term.Token(), 10)+"\n"), data...)
+	if err := os.WriteFile(name, content, 0o644); err != nil {
+		return "", fmt.Errorf("write %s: %w", name, err)
+	}
+	if err := s.rotate(); err != nil {
+		return name, err
+	}
+	return name, nil
+}
+
+// Files lists stored files from oldest to newest.
+func (s *Store) Files() ([]string, error) {
+	return listFiles(s.dir)
+}
+
+func listFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", dir, err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, filePrefix) && strings.HasSuffix(name, fileSuffix) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func (s *Store) rotate() error {
+	names, err := s.Files()
+	if err != nil {
+		return err
+	}
+	for int64(len(names)) > s.capacity.Load() {
+		if err := os.Remove(filepath.Join(s.dir, names[0])); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove %s: %w", names[0], err)
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// latestToken returns the greatest fencing token in the directory, skipping files written without one.
+func (s *Store) latestToken() (uint64, error) {
+	names, err := s.Files()
+	if err != nil {
+		return 0, err
+	}
+	var latest uint64
+	for _, name := range names {
+		token, err := ReadToken(filepath.Join(s.dir, name))
+		if errors.Is(err, ErrNoToken) || errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		latest = max(latest, token)
+	}
+	return latest, nil
+}
+
+// ReadToken returns the fencing token a file was written with.
+func ReadToken(path string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("open %s: %w", path, err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	line, err := bufio.NewReader(f).ReadString('\n')
+	value, ok := strings.CutPrefix(strings.TrimSuffix(line, "\n"), tokenHeader)
+	if !ok {
+		return 0, fmt.Errorf("%s: %w", path, ErrNoToken)
+	}
+	token, parseErr := strconv.ParseUint(value, 10, 64)
+	if err != nil || parseErr != nil {
+		return 0, fmt.Errorf("%s: %w", path, ErrNoToken)
+	}
+	return token, nil
+}
+
+// Violation is a file written with a smaller token than a file written before it.
+type Violation struct {
+	File          string
+	Token         uint64
+	Previous      string
+	PreviousToken uint64
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s has token %d after %s with token %d", v.File, v.Token, v.Previous, v.PreviousToken)
+}
+
+// Verify scans the files in dir from oldest to newest and reports the ones whose term is
+// older than the term of a file written before them, i.e. writes of a deposed leader.
+// The order comes from the leaders' clocks, so a skew between nodes shows up as well.
+func Verify(dir string) ([]Violation, error) {
+	names, err := listFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		violations []Violation
+		previous   string
+		latest     uint64
+	)
+	for _, name := range names {
+		token, err := ReadToken(filepath.Join(dir, name))
+		if err != nil {
+			return violations, err
+		}
+		if token < latest {
+			violations = append(violations, Violation{File: name, Token: token, Previous: previous, PreviousToken: latest})
+			continue
+		}
+		previous, latest = name, token
+	}
+	return violations, nil
+}
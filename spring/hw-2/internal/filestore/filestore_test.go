@@ -0,0 +1,158 @@
+package filestore_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/clock"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/filestore"
+)
+
+// term is a filestore.Term that is lost once lost is closed.
+type term struct {
+	token uint64
+	lost  chan struct{}
+}
+
+func (t term) Token() uint64 {
+	return t.token
+}
+
+func (t term) Lost() <-chan struct{} {
+	return t.lost
+}
+
+func TestWriteKeepsNewestFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "election")
+	clk := clock.NewFake(time.Now())
+	store := filestore.New(dir, 3, clk)
+	if err := store.Check(); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	written := make([]string, 0)
+	for range 5 {
+		name, err := store.Write(term{token: 1}, []byte("data"))
+		if err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		written = append(written, filepath.Base(name))
+		clk.Advance(time.Second)
+	}
+	files, err := store.Files()
+	if err != nil {
+		t.Fatalf("files: %v", err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("got %d files, want 3", len(files))
+	}
+	for i, name := range files {
+		if name != written[i+2] {
+			t.Errorf("file %d is %s, want %s", i, name, written[i+2])
+		}
+	}
+}
+
+func TestSetCapacity(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	store := filestore.New(t.TempDir(), 5, clk)
+	for range 4 {
+		if _, err := store.Write(term{token: 1}, []byte("data")); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		clk.Advance(time.Second)
+	}
+	store.SetCapacity(2)
+	if _, err := store.Write(term{token: 1}, []byte("data")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if files, err := store.Files(); err != nil || len(files) != 2 {
+		t.Errorf("got files %v (%v), want 2 after lowering the capacity", files, err)
+	}
+}
+
+func TestWriteIgnoresForeignFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	clk := clock.NewFake(time.Now())
+	store := filestore.New(dir, 1, clk)
+	for range 2 {
+		if _, err := store.Write(term{token: 1}, []byte("data")); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		clk.Advance(time.Second)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err != nil {
+		t.Errorf("foreign file removed: %v", err)
+	}
+}
+
+func TestWriteFencing(t *testing.T) {
+	dir := t.TempDir()
+	clk := clock.NewFake(time.Now())
+	store := filestore.New(dir, 10, clk)
+
+	name, err := store.Write(term{token: 7}, []byte("data"))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if token, err := filestore.ReadToken(name); err != nil || token != 7 {
+		t.Errorf("read token %d (%v), want 7", token, err)
+	}
+	clk.Advance(time.Second)
+	if _, err := store.Write(term{token: 5}, []byte("data")); !errors.Is(err, filestore.ErrStaleTerm) {
+		t.Errorf("write of an older term: %v, want %v", err, filestore.ErrStaleTerm)
+	}
+	lost := term{token: 9, lost: make(chan struct{})}
+	close(lost.lost)
+	if _, err := store.Write(lost, []byte("data")); !errors.Is(err, filestore.ErrTermLost) {
+		t.Errorf("write of a lost term: %v, want %v", err, filestore.ErrTermLost)
+	}
+	if _, err := store.Write(term{token: 9}, []byte("data")); err != nil {
+		t.Errorf("write of a later term: %v", err)
+	}
+	files, err := store.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("got %d files, want 2", len(files))
+	}
+}
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	clk := clock.NewFake(time.Now())
+	store := filestore.New(dir, 10, clk)
+	var names []string
+	for _, token := range []uint64{3, 3, 8} {
+		name, err := store.Write(term{token: token}, []byte("data"))
+		if err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		names = append(names, filepath.Base(name))
+		clk.Advance(time.Second)
+	}
+	if violations, err := filestore.Verify(dir); err != nil || len(violations) != 0 {
+		t.Fatalf("verify ordered terms: %v, %v", violations, err)
+	}
+
+	// a deposed leader that skipped the check, e.g. on another host with its own view of the directory
+	stale := filepath.Join(dir, fmt.Sprintf("election-%019d.txt", clk.Now().UnixNano()))
+	if err := os.WriteFile(stale, []byte("token: 3\ndata"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	violations, err := filestore.Verify(dir)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	want := filestore.Violation{File: filepath.Base(stale), Token: 3, Previous: names[2], PreviousToken: 8}
+	if len(violations) != 1 || violations[0] != want {
+		t.Errorf("got violations %v, want %v", violations, want)
+	}
+}
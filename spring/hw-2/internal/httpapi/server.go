@@ -0,0 +1,183 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const leaderLookupTimeout = time.Second
+
+type StateSource interface {
+	Current() run.StateInfo
+}
+
+type LeaderSource interface {
+	Leader(ctx context.Context) (string, error)
+}
+
+// StepDowner asks the leader to give up the leadership, reporting false if the node isn't leading.
+type StepDowner interface {
+	Request() bool
+}
+
+// ShardSource returns the state of every shard machine the node runs, none unless the node runs sharded.
+type ShardSource interface {
+	Current() map[string]run.StateInfo
+}
+
+type Status struct {
+	Node   string    `json:"node"`
+	State  string    `json:"state"`
+	Since  time.Time `json:"since"`
+	Leader string    `json:"leader,omitempty"`
+	Ready  bool      `json:"ready"`
+	// Shards lists the shards the node leads, ShardStates the state of every shard it runs.
+	Shards      []string               `json:"shards,omitempty"`
+	ShardStates map[string]ShardStatus `json:"shard_states,omitempty"`
+}
+
+type ShardStatus struct {
+	State string    `json:"state"`
+	Since time.Time `json:"since"`
+}
+
+// New serves the status and metrics on addr. POST /stepdown needs the bearer stepDownToken,
+// or comes from the loopback interface if the token is empty.
+func New(
+	addr string,
+	nodeID string,
+	stateSource StateSource,
+	leaders LeaderSource,
+	stepDown StepDowner,
+	stepDownToken string,
+	shards ShardSource,
+	gatherer prometheus.Gatherer,
+	logger *slog.Logger,
+) *http.Server {
+	h := &handler{
+		nodeID:   nodeID,
+		states:   stateSource,
+		leaders:  leaders,
+		stepDown: stepDown,
+		token:    stepDownToken,
+		shards:   shards,
+		logger:   logger.With("subsystem", "HTTP"),
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+	mux.HandleFunc("GET /status", h.status)
+	mux.HandleFunc("GET /healthz", h.healthz)
+	mux.HandleFunc("GET /readyz", h.readyz)
+	mux.HandleFunc("POST /stepdown", h.stepdown)
+	return &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+}
+
+type handler struct {
+	nodeID   string
+	states   StateSource
+	leaders  LeaderSource
+	stepDown StepDowner
+	token    string
+	shards   ShardSource
+	logger   *slog.Logger
+}
+
+// ready reports whether the node got through Init and takes part in the election or the shards.
+func ready(state string) bool {
+	return state == states.AttempterName || state == states.LeaderName || state == states.ShardsName
+}
+
+func (h *handler) status(w http.ResponseWriter, r *http.Request) {
+	current := h.states.Current()
+	status := Status{
+		Node:  h.nodeID,
+		State: current.State,
+		Since: current.Since,
+		Ready: ready(current.State),
+	}
+	for shard, info := range h.shards.Current() {
+		if status.ShardStates == nil {
+			status.ShardStates = make(map[string]ShardStatus)
+		}
+		status.ShardStates[shard] = ShardStatus{State: info.State, Since: info.Since}
+		if info.State == states.LeaderName {
+			status.Shards = append(status.Shards, shard)
+		}
+	}
+	slices.Sort(status.Shards)
+	ctx, cancel := context.WithTimeout(r.Context(), leaderLookupTimeout)
+	defer cancel()
+	leader, err := h.leaders.Leader(ctx)
+	switch {
+	case err == nil:
+		status.Leader = leader
+	case errors.Is(err, coordinator.ErrNoLeader):
+	default:
+		h.logger.LogAttrs(ctx, slog.LevelWarn, "look up leader", slog.String("error", err.Error()))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		h.logger.LogAttrs(ctx, slog.LevelWarn, "write status", slog.String("error", err.Error()))
+	}
+}
+
+func (h *handler) healthz(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *handler) readyz(w http.ResponseWriter, _ *http.Request) {
+	if !ready(h.states.Current().State) {
+		http.Error(w, "not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// mayStepDown checks the token of a step-down request, so anyone who reaches the metrics can't
+// move the leadership around; without a token only the node's own host may ask.
+func (h *handler) mayStepDown(r *http.Request) (bool, int) {
+	if h.token == "" {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+			return false, http.StatusForbidden
+		}
+		return true, 0
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+		return false, http.StatusUnauthorized
+	}
+	return true, 0
+}
+
+func (h *handler) stepdown(w http.ResponseWriter, r *http.Request) {
+	if ok, code := h.mayStepDown(r); !ok {
+		h.logger.LogAttrs(r.Context(), slog.LevelWarn, "step-down refused", slog.String("remote", r.RemoteAddr))
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+	if !h.stepDown.Request() {
+		http.Error(w, "not the leader", http.StatusConflict)
+		return
+	}
+	h.logger.LogAttrs(r.Context(), slog.LevelInfo, "step-down requested", slog.String("remote", r.RemoteAddr))
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,139 @@
+package httpapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator/inproc"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/httpapi"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type fixedState run.StateInfo
+
+func (s *fixedState) Current() run.StateInfo {
+	return run.StateInfo(*s)
+}
+
+// leading stands in for the step-down requests of a node that is or isn't the leader.
+type leading bool
+
+func (l leading) Request() bool {
+	return bool(l)
+}
+
+// shardStates stands in for the shard machines a node runs.
+type shardStates map[string]run.StateInfo
+
+func (s shardStates) Current() map[string]run.StateInfo {
+	return s
+}
+
+func get(t *testing.T, server *http.Server, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	return recorder
+}
+
+func TestServer(t *testing.T) {
+	since := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	state := &fixedState{State: states.InitName, Since: since}
+	coord := inproc.New("node-1")
+	server := httpapi.New(":0", "node-1", state, coord, leading(false), "", shardStates(nil), prometheus.NewRegistry(), slog.Default())
+
+	if code := get(t, server, "/healthz").Code; code != http.StatusOK {
+		t.Errorf("healthz: %d", code)
+	}
+	if code := get(t, server, "/readyz").Code; code != http.StatusServiceUnavailable {
+		t.Errorf("readyz during Init: %d", code)
+	}
+
+	if _, err := coord.TryAcquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	*state = fixedState{State: states.LeaderName, Since: since}
+	if code := get(t, server, "/readyz").Code; code != http.StatusOK {
+		t.Errorf("readyz as leader: %d", code)
+	}
+	var status httpapi.Status
+	if err := json.NewDecoder(get(t, server, "/status").Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	want := httpapi.Status{Node: "node-1", State: states.LeaderName, Since: since, Leader: "node-1", Ready: true}
+	if !reflect.DeepEqual(status, want) {
+		t.Errorf("status is %+v, want %+v", status, want)
+	}
+	if code := get(t, server, "/metrics").Code; code != http.StatusOK {
+		t.Errorf("metrics: %d", code)
+	}
+}
+
+func TestStepDown(t *testing.T) {
+	state := &fixedState{State: states.LeaderName}
+	for _, c := range []struct {
+		name    string
+		leading bool
+		token   string
+		remote  string
+		header  string
+		code    int
+	}{
+		{"leader from localhost", true, "", "127.0.0.1:4321", "", http.StatusAccepted},
+		{"follower from localhost", false, "", "[::1]:4321", "", http.StatusConflict},
+		{"remote without token", true, "", "192.0.2.1:4321", "", http.StatusForbidden},
+		{"remote with token", true, "secret", "192.0.2.1:4321", "Bearer secret", http.StatusAccepted},
+		{"wrong token", true, "secret", "192.0.2.1:4321", "Bearer guess", http.StatusUnauthorized},
+		{"missing token", true, "secret", "127.0.0.1:4321", "", http.StatusUnauthorized},
+	} {
+		server := httpapi.New(":0", "node-1", state, inproc.New("node-1"), leading(c.leading), c.token, shardStates(nil), prometheus.NewRegistry(), slog.Default())
+		request := httptest.NewRequest(http.MethodPost, "/stepdown", nil)
+		request.RemoteAddr = c.remote
+		if c.header != "" {
+			request.Header.Set("Authorization", c.header)
+		}
+		recorder := httptest.NewRecorder()
+		server.Handler.ServeHTTP(recorder, request)
+		if recorder.Code != c.code {
+			t.Errorf("%s: %d, want %d", c.name, recorder.Code, c.code)
+		}
+	}
+}
+
+func TestShardStatus(t *testing.T) {
+	since := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	state := &fixedState{State: states.ShardsName, Since: since}
+	server := httpapi.New(":0", "node-1", state, inproc.New("node-1"), leading(false), "", shardStates{
+		"shard-0": {State: states.LeaderName, Since: since},
+		"shard-1": {State: states.AttempterName, Since: since},
+		"shard-2": {State: states.LeaderName, Since: since},
+	}, prometheus.NewRegistry(), slog.Default())
+
+	if code := get(t, server, "/readyz").Code; code != http.StatusOK {
+		t.Errorf("readyz with shards: %d", code)
+	}
+	var status httpapi.Status
+	if err := json.NewDecoder(get(t, server, "/status").Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	want := httpapi.Status{
+		Node: "node-1", State: states.ShardsName, Since: since, Ready: true,
+		Shards: []string{"shard-0", "shard-2"},
+		ShardStates: map[string]httpapi.ShardStatus{
+			"shard-0": {State: states.LeaderName, Since: since},
+			"shard-1": {State: states.AttempterName, Since: since},
+			"shard-2": {State: states.LeaderName, Since: since},
+		},
+	}
+	if !reflect.DeepEqual(status, want) {
+		t.Errorf("status is %+v, want %+v", status, want)
+	}
+}
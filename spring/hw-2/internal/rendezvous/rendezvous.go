@@ -0,0 +1,50 @@
+package rendezvous
+
+import (
+	"hash/fnv"
+)
+
+// Owner returns the node a key belongs to by rendezvous hashing: every node scores the key
+// and the highest score wins, so a node that joins or leaves only moves the keys it wins or
+// held. It returns an empty string if there are no nodes.
+func Owner(key string, nodes []string) string {
+	var owner string
+	var best uint64
+	for _, node := range nodes {
+		s := score(key, node)
+		// ties go to the smaller ID, so the order of nodes doesn't matter
+		if owner == "" || s > best || s == best && node < owner {
+			owner, best = node, s
+		}
+	}
+	return owner
+}
+
+// Owned returns the keys that belong to node, in the order they are given.
+func Owned(keys, nodes []string, node string) []string {
+	var owned []string
+	for _, key := range keys {
+		if Owner(key, nodes) == node {
+			owned = append(owned, key)
+		}
+	}
+	return owned
+}
+
+func score(key, node string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(node))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(key))
+	return mix(h.Sum64())
+}
+
+// mix is the splitmix64 finalizer; FNV alone leaves close inputs with close hashes.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,57 @@
+package rendezvous_test
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/rendezvous"
+)
+
+func names(prefix string, n int) []string {
+	list := make([]string, n)
+	for i := range list {
+		list[i] = fmt.Sprintf("%s-%d", prefix, i)
+	}
+	return list
+}
+
+func TestOwner(t *testing.T) {
+	keys := names("shard", 4000)
+	nodes := names("node", 4)
+
+	t.Run("no nodes", func(t *testing.T) {
+		if owner := rendezvous.Owner("shard-0", nil); owner != "" {
+			t.Errorf("got owner %q without nodes", owner)
+		}
+	})
+
+	t.Run("ignores the order of nodes", func(t *testing.T) {
+		reversed := slices.Clone(nodes)
+		slices.Reverse(reversed)
+		for _, key := range keys {
+			if a, b := rendezvous.Owner(key, nodes), rendezvous.Owner(key, reversed); a != b {
+				t.Fatalf("%s belongs to %s or %s depending on the order", key, a, b)
+			}
+		}
+	})
+
+	t.Run("spreads evenly", func(t *testing.T) {
+		for _, node := range nodes {
+			// a fair share is 1000
+			if n := len(rendezvous.Owned(keys, nodes, node)); n < 900 || n > 1100 {
+				t.Errorf("%s owns %d of %d keys", node, n, len(keys))
+			}
+		}
+	})
+
+	t.Run("a leaving node only moves its keys", func(t *testing.T) {
+		left := nodes[:3]
+		for _, key := range keys {
+			before, after := rendezvous.Owner(key, nodes), rendezvous.Owner(key, left)
+			if before != nodes[3] && before != after {
+				t.Errorf("%s moved from %s to %s", key, before, after)
+			}
+		}
+	})
+}
@@ -0,0 +1,27 @@
+package stepdown
+
+// Requests carries step-down requests from SIGUSR1 and the admin endpoint to the leader state.
+// The zero value isn't usable, create it with New.
+type Requests struct {
+	ch chan struct{}
+}
+
+func New() *Requests {
+	return &Requests{ch: make(chan struct{})}
+}
+
+// Request asks the leader to step down. It reports false when the node isn't leading,
+// in which case the request is dropped rather than kept for the next term.
+func (r *Requests) Request() bool {
+	select {
+	case r.ch <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// C delivers requests to the leader state while it waits on it.
+func (r *Requests) C() <-chan struct{} {
+	return r.ch
+}
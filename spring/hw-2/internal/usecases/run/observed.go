@@ -0,0 +1,201 @@
+package run
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/clock"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	_ Runner = &ObservedRunner{}
+	_ Runner = &shardRunner{}
+)
+
+// StateInfo describes the state the machine is in.
+type StateInfo struct {
+	State string
+	Since time.Time
+}
+
+// ObservedRunner decorates a Runner with state metrics and remembers the current state.
+type ObservedRunner struct {
+	inner Runner
+	clock clock.Clock
+
+	mu      sync.Mutex
+	current StateInfo
+
+	stateGauge  *prometheus.GaugeVec
+	durations   *prometheus.HistogramVec
+	transitions *prometheus.CounterVec
+}
+
+func NewObservedRunner(inner Runner, clk clock.Clock, registerer prometheus.Registerer) *ObservedRunner {
+	r := &ObservedRunner{
+		inner: inner,
+		clock: clk,
+		stateGauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "election_state",
+			Help: "1 for the state the node is in, 0 for the others.",
+		}, []string{"state"}),
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "election_state_duration_seconds",
+			Help:    "Time spent in a state before leaving it.",
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+		}, []string{"state"}),
+		transitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "election_state_transitions_total",
+			Help: "State changes by source and target state.",
+		}, []string{"from", "to"}),
+	}
+	timeInState := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "election_current_state_seconds",
+		Help: "Time spent in the current state so far.",
+	}, func() float64 {
+		current := r.Current()
+		if current.State == "" {
+			return 0
+		}
+		return r.clock.Now().Sub(current.Since).Seconds()
+	})
+	registerer.MustRegister(r.stateGauge, r.durations, r.transitions, timeInState)
+	return r
+}
+
+func (r *ObservedRunner) Run(ctx context.Context, state states.AutomataState) error {
+	return r.inner.Run(ctx, r.observe(state))
+}
+
+func (r *ObservedRunner) Current() StateInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+func (r *ObservedRunner) observe(state states.AutomataState) states.AutomataState {
+	return observe(state, r.enter)
+}
+
+func (r *ObservedRunner) enter(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.clock.Now()
+	if r.current.State != "" {
+		r.stateGauge.WithLabelValues(r.current.State).Set(0)
+		r.durations.WithLabelValues(r.current.State).Observe(now.Sub(r.current.Since).Seconds())
+		r.transitions.WithLabelValues(r.current.State, name).Inc()
+	}
+	r.stateGauge.WithLabelValues(name).Set(1)
+	r.current = StateInfo{State: name, Since: now}
+}
+
+// observe wraps state to report entering it and every state after it to enter.
+func observe(state states.AutomataState, enter func(name string)) states.AutomataState {
+	if state == nil {
+		return nil
+	}
+	return &observedState{AutomataState: state, enter: enter}
+}
+
+// observedState reports entering the wrapped state and wraps the state it returns.
+type observedState struct {
+	states.AutomataState
+	enter func(name string)
+}
+
+func (s *observedState) Run(ctx context.Context) (states.AutomataState, error) {
+	s.enter(s.AutomataState.String())
+	next, err := s.AutomataState.Run(ctx)
+	return observe(next, s.enter), err
+}
+
+// ShardRunners decorates the Runner of the shard machines with the state metrics of
+// ObservedRunner labelled by the shard and remembers the state of every running machine.
+type ShardRunners struct {
+	inner Runner
+	clock clock.Clock
+
+	mu      sync.Mutex
+	current map[string]StateInfo
+
+	stateGauge  *prometheus.GaugeVec
+	durations   *prometheus.HistogramVec
+	transitions *prometheus.CounterVec
+}
+
+func NewShardRunners(inner Runner, clk clock.Clock, registerer prometheus.Registerer) *ShardRunners {
+	r := &ShardRunners{
+		inner:   inner,
+		clock:   clk,
+		current: make(map[string]StateInfo),
+		stateGauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "election_shard_state",
+			Help: "1 for the state the machine of a shard is in, 0 for the others.",
+		}, []string{"shard", "state"}),
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "election_shard_state_duration_seconds",
+			Help:    "Time the machine of a shard spent in a state before leaving it.",
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+		}, []string{"state"}),
+		transitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "election_shard_state_transitions_total",
+			Help: "State changes of the shard machines by shard, source and target state.",
+		}, []string{"shard", "from", "to"}),
+	}
+	registerer.MustRegister(r.stateGauge, r.durations, r.transitions)
+	return r
+}
+
+// For returns the runner of the machine of a shard.
+func (r *ShardRunners) For(shard string) Runner {
+	return &shardRunner{runners: r, shard: shard}
+}
+
+// Current returns the state of every shard whose machine is running.
+func (r *ShardRunners) Current() map[string]StateInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return maps.Clone(r.current)
+}
+
+func (r *ShardRunners) enter(shard, name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.clock.Now()
+	if current, ok := r.current[shard]; ok {
+		r.stateGauge.WithLabelValues(shard, current.State).Set(0)
+		r.durations.WithLabelValues(current.State).Observe(now.Sub(current.Since).Seconds())
+		r.transitions.WithLabelValues(shard, current.State, name).Inc()
+	}
+	r.stateGauge.WithLabelValues(shard, name).Set(1)
+	r.current[shard] = StateInfo{State: name, Since: now}
+}
+
+// leave forgets the shard once its machine ends, so a shard that moved to another node
+// doesn't show up in its last state.
+func (r *ShardRunners) leave(shard string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if current, ok := r.current[shard]; ok {
+		r.durations.WithLabelValues(current.State).Observe(r.clock.Now().Sub(current.Since).Seconds())
+		delete(r.current, shard)
+	}
+	r.stateGauge.DeletePartialMatch(prometheus.Labels{"shard": shard})
+}
+
+type shardRunner struct {
+	runners *ShardRunners
+	shard   string
+}
+
+func (r *shardRunner) Run(ctx context.Context, state states.AutomataState) error {
+	defer r.runners.leave(r.shard)
+	return r.runners.inner.Run(ctx, observe(state, func(name string) {
+		r.runners.enter(r.shard, name)
+	}))
+}
@@ -0,0 +1,145 @@
+package run_test
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/clock"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// step spends its duration on the fake clock and moves to next.
+type step struct {
+	name     string
+	clock    *clock.Fake
+	duration time.Duration
+	next     states.AutomataState
+}
+
+func (s *step) Run(context.Context) (states.AutomataState, error) {
+	s.clock.Advance(s.duration)
+	return s.next, nil
+}
+
+func (s *step) String() string {
+	return s.name
+}
+
+func TestObservedRunner(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC))
+	registry := prometheus.NewRegistry()
+	runner := run.NewObservedRunner(run.NewLoopRunner(slog.Default(), states.Election), clk, registry)
+
+	last := &step{name: states.StoppingName, clock: clk}
+	leader := &step{name: states.LeaderName, clock: clk, duration: time.Minute, next: last}
+	attempter := &step{name: states.AttempterName, clock: clk, duration: time.Second, next: leader}
+	first := &step{name: states.InitName, clock: clk, next: attempter}
+	if err := runner.Run(context.Background(), first); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	current := runner.Current()
+	if current.State != states.StoppingName || !current.Since.Equal(clk.Now()) {
+		t.Errorf("current state is %+v", current)
+	}
+	expected := `
+# HELP election_state_transitions_total State changes by source and target state.
+# TYPE election_state_transitions_total counter
+election_state_transitions_total{from="Attempter",to="Leader"} 1
+election_state_transitions_total{from="Init",to="Attempter"} 1
+election_state_transitions_total{from="Leader",to="Stopping"} 1
+# HELP election_state 1 for the state the node is in, 0 for the others.
+# TYPE election_state gauge
+election_state{state="Attempter"} 0
+election_state{state="Init"} 0
+election_state{state="Leader"} 0
+election_state{state="Stopping"} 1
+`
+	err := testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"election_state_transitions_total", "election_state")
+	if err != nil {
+		t.Error(err)
+	}
+	if n, err := testutil.GatherAndCount(registry, "election_state_duration_seconds"); err != nil || n != 3 {
+		t.Errorf("got durations for %d states (%v), want 3", n, err)
+	}
+}
+
+// blocked stays in its state until release is closed and moves to next.
+type blocked struct {
+	name    string
+	release chan struct{}
+	next    states.AutomataState
+}
+
+func (s *blocked) Run(context.Context) (states.AutomataState, error) {
+	<-s.release
+	return s.next, nil
+}
+
+func (s *blocked) String() string {
+	return s.name
+}
+
+func TestShardRunners(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC))
+	registry := prometheus.NewRegistry()
+	runners := run.NewShardRunners(run.NewLoopRunner(slog.Default(), states.Shard), clk, registry)
+
+	leading := &blocked{name: states.LeaderName, release: make(chan struct{}), next: &step{name: states.StoppingName, clock: clk}}
+	done := make(chan error, 1)
+	go func() {
+		done <- runners.For("shard-1").Run(context.Background(), &step{name: states.AttempterName, clock: clk, next: leading})
+	}()
+	for deadline := time.Now().Add(5 * time.Second); runners.Current()["shard-1"].State != states.LeaderName; {
+		if time.Now().After(deadline) {
+			t.Fatalf("shard-1 is %+v, want %s", runners.Current()["shard-1"], states.LeaderName)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	last := &step{name: states.StoppingName, clock: clk}
+	leader := &step{name: states.LeaderName, clock: clk, duration: time.Minute, next: last}
+	attempter := &step{name: states.AttempterName, clock: clk, duration: time.Second, next: leader}
+	if err := runners.For("shard-0").Run(context.Background(), attempter); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	current := runners.Current()
+	if _, ok := current["shard-0"]; ok || len(current) != 1 {
+		t.Errorf("current states are %+v, want only shard-1 once shard-0 ended", current)
+	}
+	expected := `
+# HELP election_shard_state_transitions_total State changes of the shard machines by shard, source and target state.
+# TYPE election_shard_state_transitions_total counter
+election_shard_state_transitions_total{from="Attempter",shard="shard-0",to="Leader"} 1
+election_shard_state_transitions_total{from="Attempter",shard="shard-1",to="Leader"} 1
+election_shard_state_transitions_total{from="Leader",shard="shard-0",to="Stopping"} 1
+# HELP election_shard_state 1 for the state the machine of a shard is in, 0 for the others.
+# TYPE election_shard_state gauge
+election_shard_state{shard="shard-1",state="Attempter"} 0
+election_shard_state{shard="shard-1",state="Leader"} 1
+`
+	err := testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"election_shard_state_transitions_total", "election_shard_state")
+	if err != nil {
+		t.Error(err)
+	}
+	if n, err := testutil.GatherAndCount(registry, "election_shard_state_duration_seconds"); err != nil || n != 3 {
+		t.Errorf("got durations for %d states (%v), want 3", n, err)
+	}
+
+	close(leading.release)
+	if err := <-done; err != nil {
+		t.Fatalf("run shard-1: %v", err)
+	}
+	if current := runners.Current(); len(current) != 0 {
+		t.Errorf("current states are %+v after every machine ended", current)
+	}
+}
@@ -14,26 +14,64 @@ type Runner interface {
 	Run(ctx context.Context, state states.AutomataState) error
 }
 
-func NewLoopRunner(logger *slog.Logger) *LoopRunner {
+// TransitionError is returned when a state moves to a state the graph has no edge to.
+// An empty From or To stands for the start or the end of the machine.
+type TransitionError struct {
+	From string
+	To   string
+}
+
+func (e *TransitionError) Error() string {
+	from, to := e.From, e.To
+	if from == "" {
+		from = "start"
+	}
+	if to == "" {
+		to = "end"
+	}
+	return fmt.Sprintf("illegal transition from %s to %s", from, to)
+}
+
+func NewLoopRunner(logger *slog.Logger, graph states.Graph) *LoopRunner {
 	logger = logger.With("subsystem", "StateRunner")
 	return &LoopRunner{
 		logger: logger,
+		graph:  graph,
 	}
 }
 
+// LoopRunner runs states one after another while the graph allows the transitions between them.
 type LoopRunner struct {
 	logger *slog.Logger
+	graph  states.Graph
 }
 
 func (r *LoopRunner) Run(ctx context.Context, state states.AutomataState) error {
-	for state != nil {
-		r.logger.LogAttrs(ctx, slog.LevelInfo, "start running state", slog.String("state", state.String()))
-		var err error
-		state, err = state.Run(ctx)
+	var prev string
+	for {
+		name := stateName(state)
+		if !r.graph.Allows(prev, name) {
+			r.logger.LogAttrs(ctx, slog.LevelError, "illegal transition",
+				slog.String("from", prev), slog.String("to", name))
+			return &TransitionError{From: prev, To: name}
+		}
+		if state == nil {
+			break
+		}
+		r.logger.LogAttrs(ctx, slog.LevelInfo, "start running state", slog.String("state", name))
+		next, err := state.Run(ctx)
 		if err != nil {
-			return fmt.Errorf("state %s run: %w", state.String(), err)
+			return fmt.Errorf("state %s run: %w", name, err)
 		}
+		prev, state = name, next
 	}
 	r.logger.LogAttrs(ctx, slog.LevelInfo, "no new state, finish")
 	return nil
 }
+
+func stateName(state states.AutomataState) string {
+	if state == nil {
+		return ""
+	}
+	return state.String()
+}
@@ -0,0 +1,64 @@
+package run_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/clock"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states"
+)
+
+func TestLoopRunnerTransitions(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC))
+	chain := func(names ...string) states.AutomataState {
+		var next states.AutomataState
+		for i := len(names) - 1; i >= 0; i-- {
+			next = &step{name: names[i], clock: clk, next: next}
+		}
+		return next
+	}
+	cases := []struct {
+		name  string
+		chain []string
+		want  *run.TransitionError
+	}{
+		{
+			name:  "leader and back through failover",
+			chain: []string{states.InitName, states.AttempterName, states.LeaderName, states.FailoverName, states.InitName, states.StoppingName},
+		},
+		{
+			name:  "failover to leader",
+			chain: []string{states.InitName, states.FailoverName, states.LeaderName},
+			want:  &run.TransitionError{From: states.FailoverName, To: states.LeaderName},
+		},
+		{
+			name:  "start outside init",
+			chain: []string{states.AttempterName},
+			want:  &run.TransitionError{To: states.AttempterName},
+		},
+		{
+			name:  "finish outside stopping",
+			chain: []string{states.InitName, states.AttempterName},
+			want:  &run.TransitionError{From: states.AttempterName},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := run.NewLoopRunner(slog.Default(), states.Election).Run(context.Background(), chain(c.chain...))
+			if c.want == nil {
+				if err != nil {
+					t.Fatalf("run: %v", err)
+				}
+				return
+			}
+			var got *run.TransitionError
+			if !errors.As(err, &got) || *got != *c.want {
+				t.Fatalf("got %v, want %v", err, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package attempter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/clock"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states"
+)
+
+func New(
+	logger *slog.Logger,
+	clk clock.Clock,
+	coord coordinator.Coordinator,
+	timeout func() time.Duration,
+	cooldown time.Duration,
+	next states.Factory,
+) *State {
+	logger = logger.With("subsystem", "AttempterState")
+	return &State{
+		logger:   logger,
+		clock:    clk,
+		coord:    coord,
+		timeout:  timeout,
+		cooldown: cooldown,
+		next:     next,
+	}
+}
+
+// State tries to take the leadership every timeout and as soon as the leader gives it up.
+// After a step-down it waits for cooldown before the first attempt. The timeout is read
+// before every wait, so a reloaded one applies without leaving the state.
+type State struct {
+	logger   *slog.Logger
+	clock    clock.Clock
+	coord    coordinator.Coordinator
+	timeout  func() time.Duration
+	cooldown time.Duration
+	next     states.Factory
+}
+
+func (s *State) String() string {
+	return states.AttempterName
+}
+
+func (s *State) Run(ctx context.Context) (states.AutomataState, error) {
+	watchCtx, stopWatch := context.WithCancel(ctx)
+	defer stopWatch()
+	events := s.coord.Watch(watchCtx)
+	if s.cooldown > 0 {
+		s.logger.LogAttrs(ctx, slog.LevelInfo, "sitting out of elections", slog.Duration("cooldown", s.cooldown))
+		if err := s.sitOut(ctx, events); err != nil {
+			return s.next.Failover(fmt.Errorf("cool down: %w", err)), nil
+		}
+		if ctx.Err() != nil {
+			return s.next.Stopping(nil), nil
+		}
+	}
+	for {
+		lease, err := s.coord.TryAcquire(ctx)
+		switch {
+		case err == nil:
+			s.logger.LogAttrs(ctx, slog.LevelInfo, "became the leader")
+			return s.next.Leader(lease), nil
+		case ctx.Err() != nil:
+			return s.next.Stopping(nil), nil
+		case errors.Is(err, coordinator.ErrLeaderExists):
+			s.logger.LogAttrs(ctx, slog.LevelDebug, "another node is the leader")
+		default:
+			return s.next.Failover(fmt.Errorf("try to acquire leadership: %w", err)), nil
+		}
+		if err := s.wait(ctx, events); err != nil {
+			return s.next.Failover(fmt.Errorf("wait for the next attempt: %w", err)), nil
+		}
+	}
+}
+
+// wait sleeps until the next attempt, returning early when the leadership is vacated
+// or the session changes.
+func (s *State) wait(ctx context.Context, events <-chan coordinator.SessionEvent) error {
+	vacantCtx, stopVacant := context.WithCancel(ctx)
+	defer stopVacant()
+	vacant := s.coord.Vacant(vacantCtx)
+	timer := s.clock.NewTimer(s.timeout())
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		// the next TryAcquire sees the cancelled context
+		return nil
+	case event := <-events:
+		s.logger.LogAttrs(ctx, slog.LevelInfo, "session event", slog.String("event", event.String()))
+		return event.Err()
+	case <-vacant:
+		s.logger.LogAttrs(ctx, slog.LevelInfo, "leadership vacated")
+		return nil
+	case <-timer.C():
+		return nil
+	}
+}
+
+// sitOut waits for the cooldown, returning early on shutdown or a session failure.
+func (s *State) sitOut(ctx context.Context, events <-chan coordinator.SessionEvent) error {
+	timer := s.clock.NewTimer(s.cooldown)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-events:
+			s.logger.LogAttrs(ctx, slog.LevelInfo, "session event", slog.String("event", event.String()))
+			if err := event.Err(); err != nil {
+				return err
+			}
+		case <-timer.C():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package attempter_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/clock"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator/inproc"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states/attempter"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states/statestest"
+)
+
+const timeout = 10 * time.Second
+
+func every(d time.Duration) func() time.Duration {
+	return func() time.Duration { return d }
+}
+
+func TestAttempter(t *testing.T) {
+	t.Run("free leadership", func(t *testing.T) {
+		coord := inproc.New("node")
+		state := attempter.New(slog.Default(), clock.NewFake(time.Now()), coord, every(timeout), 0, statestest.Factory{})
+		next, err := state.Run(context.Background())
+		leader := statestest.AssertNext(t, next, err, "Leader")
+		if leader.Lease == nil || !coord.Held() {
+			t.Error("leader has no lease")
+		}
+	})
+
+	t.Run("retries every timeout", func(t *testing.T) {
+		clk := clock.NewFake(time.Now())
+		coord := inproc.New("node")
+		other, err := coord.Peer("other").TryAcquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		wait := statestest.Start(context.Background(), attempter.New(slog.Default(), clk, coord, every(timeout), 0, statestest.Factory{}))
+		clk.BlockUntil(1)
+		clk.Advance(timeout)
+		// second attempt fails too, the state waits again
+		clk.BlockUntil(1)
+		if err := other.Release(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		clk.Advance(timeout)
+		next, err := wait()
+		statestest.AssertNext(t, next, err, "Leader")
+	})
+
+	t.Run("coordinator failure", func(t *testing.T) {
+		coord := inproc.New("node")
+		coord.SetUnavailable(errors.New("connection lost"))
+		state := attempter.New(slog.Default(), clock.NewFake(time.Now()), coord, every(timeout), 0, statestest.Factory{})
+		next, err := state.Run(context.Background())
+		statestest.AssertNext(t, next, err, "Failover")
+	})
+
+	t.Run("disconnected while waiting", func(t *testing.T) {
+		clk := clock.NewFake(time.Now())
+		coord := inproc.New("node")
+		if _, err := coord.Peer("other").TryAcquire(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		wait := statestest.Start(context.Background(), attempter.New(slog.Default(), clk, coord, every(timeout), 0, statestest.Factory{}))
+		clk.BlockUntil(1)
+		coord.SetUnavailable(errors.New("connection lost"))
+		next, err := wait()
+		failover := statestest.AssertNext(t, next, err, "Failover")
+		if !errors.Is(failover.Cause, coordinator.ErrDisconnected) {
+			t.Errorf("failover cause is %v, want %v", failover.Cause, coordinator.ErrDisconnected)
+		}
+	})
+
+	t.Run("stops while waiting", func(t *testing.T) {
+		clk := clock.NewFake(time.Now())
+		coord := inproc.New("node")
+		if _, err := coord.Peer("other").TryAcquire(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		wait := statestest.Start(ctx, attempter.New(slog.Default(), clk, coord, every(timeout), 0, statestest.Factory{}))
+		clk.BlockUntil(1)
+		cancel()
+		next, err := wait()
+		stopping := statestest.AssertNext(t, next, err, "Stopping")
+		if stopping.Lease != nil {
+			t.Error("attempter passed a lease to Stopping")
+		}
+	})
+	t.Run("takes over once the leader releases", func(t *testing.T) {
+		clk := clock.NewFake(time.Now())
+		coord := inproc.New("node")
+		other, err := coord.Peer("other").TryAcquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		wait := statestest.Start(context.Background(), attempter.New(slog.Default(), clk, coord, every(timeout), 0, statestest.Factory{}))
+		clk.BlockUntil(1)
+		if err := other.Release(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		// no time passes: the vacancy wakes the attempter before its timer
+		next, err := wait()
+		statestest.AssertNext(t, next, err, "Leader")
+	})
+
+	t.Run("sits out the cooldown", func(t *testing.T) {
+		clk := clock.NewFake(time.Now())
+		coord := inproc.New("node")
+		wait := statestest.Start(context.Background(), attempter.New(slog.Default(), clk, coord, every(timeout), time.Minute, statestest.Factory{}))
+		clk.BlockUntil(1)
+		clk.Advance(time.Minute - time.Second)
+		if coord.Held() {
+			t.Fatal("attempter ran for leadership during the cooldown")
+		}
+		clk.Advance(time.Second)
+		next, err := wait()
+		statestest.AssertNext(t, next, err, "Leader")
+	})
+	t.Run("stops during the cooldown", func(t *testing.T) {
+		clk := clock.NewFake(time.Now())
+		coord := inproc.New("node")
+		ctx, cancel := context.WithCancel(context.Background())
+		wait := statestest.Start(ctx, attempter.New(slog.Default(), clk, coord, every(timeout), time.Minute, statestest.Factory{}))
+		clk.BlockUntil(1)
+		cancel()
+		next, err := wait()
+		statestest.AssertNext(t, next, err, "Stopping")
+		if coord.Held() {
+			t.Error("attempter took the leadership on its way out")
+		}
+	})
+}
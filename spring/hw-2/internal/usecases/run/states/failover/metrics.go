@@ -0,0 +1,52 @@
+package failover
+
+import (
+	"errors"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	outcomeRecovered = "recovered"
+	outcomeStopped   = "stopped"
+	outcomeGaveUp    = "gave_up"
+)
+
+// Metrics reports how failovers go; every Failover state of a node shares one.
+type Metrics struct {
+	durations *prometheus.HistogramVec
+	degraded  prometheus.Gauge
+}
+
+func NewMetrics(registerer prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "election_failover_duration_seconds",
+			Help:    "Time from a failure to the end of the failover by cause and outcome.",
+			Buckets: prometheus.ExponentialBuckets(0.1, 2, 12),
+		}, []string{"cause", "outcome"}),
+		degraded: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "election_failover_degraded",
+			Help: "1 while the node keeps retrying after the failover ran out of retries.",
+		}),
+	}
+	registerer.MustRegister(m.durations, m.degraded)
+	return m
+}
+
+func (m *Metrics) observe(cause error, outcome string, d time.Duration) {
+	m.durations.WithLabelValues(causeLabel(cause), outcome).Observe(d.Seconds())
+}
+
+func causeLabel(cause error) string {
+	switch {
+	case errors.Is(cause, coordinator.ErrSessionExpired):
+		return "session_expired"
+	case errors.Is(cause, coordinator.ErrDisconnected):
+		return "disconnected"
+	default:
+		return "other"
+	}
+}
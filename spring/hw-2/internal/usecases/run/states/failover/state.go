@@ -0,0 +1,153 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/backoff"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/clock"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states"
+)
+
+// ErrGaveUp is returned in ModeExit once the backoff policy runs out of retries.
+var ErrGaveUp = errors.New("coordinator didn't come back")
+
+// Mode decides what the state does once the backoff policy runs out of retries.
+type Mode string
+
+const (
+	// ModeExit fails the state machine so the process exits non-zero.
+	ModeExit Mode = "exit"
+	// ModeDegraded keeps retrying at the maximum delay, reporting the node as degraded.
+	ModeDegraded Mode = "degraded"
+)
+
+// Config sets how the state retries the coordination backend.
+type Config struct {
+	// Timeout bounds every check of the backend.
+	Timeout time.Duration
+	Backoff backoff.Policy
+	Mode    Mode
+	// Rand draws the backoff jitter.
+	Rand func() float64
+}
+
+func New(
+	logger *slog.Logger,
+	clk clock.Clock,
+	coord coordinator.Coordinator,
+	cause error,
+	cfg Config,
+	metrics *Metrics,
+	next states.Factory,
+) *State {
+	logger = logger.With("subsystem", "FailoverState")
+	return &State{
+		logger:  logger,
+		clock:   clk,
+		coord:   coord,
+		cause:   cause,
+		cfg:     cfg,
+		metrics: metrics,
+		next:    next,
+	}
+}
+
+// State waits for the coordination backend to come back. After a disconnect the session
+// may have survived, so the node rejoins the election right away; after anything else,
+// a session expiry included, it starts over from Init.
+type State struct {
+	logger  *slog.Logger
+	clock   clock.Clock
+	coord   coordinator.Coordinator
+	cause   error
+	cfg     Config
+	metrics *Metrics
+	next    states.Factory
+}
+
+func (s *State) String() string {
+	return states.FailoverName
+}
+
+func (s *State) Run(ctx context.Context) (states.AutomataState, error) {
+	s.logger.LogAttrs(ctx, slog.LevelWarn, "recovering from failure", slog.String("cause", s.cause.Error()))
+	watchCtx, stopWatch := context.WithCancel(ctx)
+	defer stopWatch()
+	events := s.coord.Watch(watchCtx)
+	retries := s.cfg.Backoff.Start(s.clock.Now(), s.cfg.Rand)
+	degraded := false
+	defer func() {
+		if degraded {
+			s.metrics.degraded.Set(0)
+		}
+	}()
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, s.cfg.Timeout)
+		err := s.coord.Check(checkCtx)
+		cancel()
+		if ctx.Err() != nil {
+			s.metrics.observe(s.cause, outcomeStopped, retries.Elapsed(s.clock.Now()))
+			return s.next.Stopping(nil), nil
+		}
+		if err == nil {
+			s.metrics.observe(s.cause, outcomeRecovered, retries.Elapsed(s.clock.Now()))
+			if s.sessionSurvived() {
+				s.logger.LogAttrs(ctx, slog.LevelInfo, "reconnected within the session")
+				return s.next.Attempter(0), nil
+			}
+			s.logger.LogAttrs(ctx, slog.LevelInfo, "coordinator is available again")
+			return s.next.Init(), nil
+		}
+		delay, ok := retries.Next(s.clock.Now())
+		if !ok && !degraded {
+			if s.cfg.Mode != ModeDegraded {
+				s.metrics.observe(s.cause, outcomeGaveUp, retries.Elapsed(s.clock.Now()))
+				return nil, fmt.Errorf("%w after %d attempts in %s: %w",
+					ErrGaveUp, retries.Attempts(), retries.Elapsed(s.clock.Now()), err)
+			}
+			s.logger.LogAttrs(ctx, slog.LevelError, "out of retries, running degraded",
+				slog.Int("attempts", retries.Attempts()))
+			s.metrics.degraded.Set(1)
+			degraded = true
+		}
+		s.logger.LogAttrs(ctx, slog.LevelWarn, "coordinator is still unavailable",
+			slog.String("error", err.Error()),
+			slog.Int("attempt", retries.Attempts()),
+			slog.Duration("retry_in", delay),
+		)
+		if !s.wait(ctx, events, delay) {
+			s.metrics.observe(s.cause, outcomeStopped, retries.Elapsed(s.clock.Now()))
+			return s.next.Stopping(nil), nil
+		}
+	}
+}
+
+// sessionSurvived reports whether the failure was a disconnect the session outlived.
+func (s *State) sessionSurvived() bool {
+	return errors.Is(s.cause, coordinator.ErrDisconnected) && !errors.Is(s.cause, coordinator.ErrSessionExpired)
+}
+
+// wait sleeps until the next attempt, returning early on a session event. It reports
+// false on shutdown.
+func (s *State) wait(ctx context.Context, events <-chan coordinator.SessionEvent, delay time.Duration) bool {
+	timer := s.clock.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case event := <-events:
+		s.logger.LogAttrs(ctx, slog.LevelInfo, "session event", slog.String("event", event.String()))
+		if event == coordinator.SessionExpired && !errors.Is(s.cause, coordinator.ErrSessionExpired) {
+			// nothing survived the session, the node has to start over
+			s.cause = fmt.Errorf("%w while recovering from: %w", coordinator.ErrSessionExpired, s.cause)
+		}
+		return true
+	case <-timer.C():
+		return true
+	}
+}
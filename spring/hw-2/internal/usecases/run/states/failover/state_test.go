@@ -0,0 +1,216 @@
+package failover_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/backoff"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/clock"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator/inproc"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states/failover"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states/statestest"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var errConnection = errors.New("connection lost")
+
+func config(mode failover.Mode, maxAttempts int) failover.Config {
+	return failover.Config{
+		Timeout: time.Second,
+		Backoff: backoff.Policy{
+			Initial:     time.Second,
+			Max:         4 * time.Second,
+			Multiplier:  2,
+			Jitter:      0.5,
+			MaxAttempts: maxAttempts,
+		},
+		Mode: mode,
+		// no jitter: the delays are exactly Initial, 2*Initial and so on
+		Rand: func() float64 { return 0.5 },
+	}
+}
+
+// checks records when the state checks the backend.
+type checks struct {
+	*inproc.Coordinator
+	clock clock.Clock
+	at    chan time.Time
+}
+
+func (c *checks) Check(ctx context.Context) error {
+	c.at <- c.clock.Now()
+	return c.Coordinator.Check(ctx)
+}
+
+type fixture struct {
+	clock    *clock.Fake
+	coord    *inproc.Coordinator
+	registry *prometheus.Registry
+	state    *failover.State
+}
+
+func newFixture(cause error, cfg failover.Config) *fixture {
+	clk := clock.NewFake(time.Now())
+	coord := inproc.New("node")
+	coord.SetUnavailable(errConnection)
+	registry := prometheus.NewRegistry()
+	state := failover.New(slog.Default(), clk, coord, cause, cfg, failover.NewMetrics(registry), statestest.Factory{})
+	return &fixture{clock: clk, coord: coord, registry: registry, state: state}
+}
+
+func TestFailover(t *testing.T) {
+	t.Run("starts over after expiry", func(t *testing.T) {
+		f := newFixture(coordinator.ErrSessionExpired, config(failover.ModeExit, 0))
+		wait := statestest.Start(context.Background(), f.state)
+		f.clock.BlockUntil(1)
+		f.coord.SetUnavailable(nil)
+		f.clock.Advance(time.Second)
+		next, err := wait()
+		statestest.AssertNext(t, next, err, "Init")
+		assertObserved(t, f.registry, "session_expired", "recovered", 1)
+	})
+
+	t.Run("rejoins after a disconnect", func(t *testing.T) {
+		f := newFixture(fmt.Errorf("wait: %w", coordinator.ErrDisconnected), config(failover.ModeExit, 0))
+		wait := statestest.Start(context.Background(), f.state)
+		f.clock.BlockUntil(1)
+		// the reconnect wakes the state before its timer
+		f.coord.SetUnavailable(nil)
+		next, err := wait()
+		statestest.AssertNext(t, next, err, "Attempter")
+		assertObserved(t, f.registry, "disconnected", "recovered", 1)
+	})
+
+	t.Run("session expires while disconnected", func(t *testing.T) {
+		f := newFixture(coordinator.ErrDisconnected, config(failover.ModeExit, 0))
+		wait := statestest.Start(context.Background(), f.state)
+		f.clock.BlockUntil(1)
+		f.coord.Expire()
+		f.clock.BlockUntil(1)
+		f.coord.SetUnavailable(nil)
+		next, err := wait()
+		statestest.AssertNext(t, next, err, "Init")
+		assertObserved(t, f.registry, "session_expired", "recovered", 1)
+	})
+
+	t.Run("backs off exponentially", func(t *testing.T) {
+		clk := clock.NewFake(time.Now())
+		coord := &checks{Coordinator: inproc.New("node"), clock: clk, at: make(chan time.Time, 10)}
+		coord.SetUnavailable(errConnection)
+		state := failover.New(slog.Default(), clk, coord, errConnection, config(failover.ModeExit, 0),
+			failover.NewMetrics(prometheus.NewRegistry()), statestest.Factory{})
+		wait := statestest.Start(context.Background(), state)
+		start := <-coord.at
+		for _, delay := range []time.Duration{1, 2, 4, 4} {
+			clk.BlockUntil(1)
+			clk.Advance(delay*time.Second - time.Millisecond)
+			select {
+			case at := <-coord.at:
+				t.Fatalf("retried after %s, want %s", at.Sub(start), delay*time.Second)
+			default:
+			}
+			clk.Advance(time.Millisecond)
+			at := <-coord.at
+			if at.Sub(start) != delay*time.Second {
+				t.Errorf("retried after %s, want %s", at.Sub(start), delay*time.Second)
+			}
+			start = at
+		}
+		clk.BlockUntil(1)
+		coord.SetUnavailable(nil)
+		next, err := wait()
+		statestest.AssertNext(t, next, err, "Init")
+	})
+
+	t.Run("gives up in exit mode", func(t *testing.T) {
+		f := newFixture(errConnection, config(failover.ModeExit, 3))
+		wait := statestest.Start(context.Background(), f.state)
+		f.clock.BlockUntil(1)
+		f.clock.Advance(time.Second)
+		f.clock.BlockUntil(1)
+		f.clock.Advance(2 * time.Second)
+		next, err := wait()
+		if !errors.Is(err, failover.ErrGaveUp) || next != nil {
+			t.Fatalf("got %v, %v, want %v", next, err, failover.ErrGaveUp)
+		}
+		assertObserved(t, f.registry, "other", "gave_up", 1)
+	})
+
+	t.Run("runs degraded", func(t *testing.T) {
+		f := newFixture(errConnection, config(failover.ModeDegraded, 1))
+		wait := statestest.Start(context.Background(), f.state)
+		f.clock.BlockUntil(1)
+		if v := gauge(t, f.registry, "election_failover_degraded"); v != 1 {
+			t.Errorf("degraded gauge is %v, want 1", v)
+		}
+		for range 3 {
+			f.clock.Advance(4 * time.Second)
+			f.clock.BlockUntil(1)
+		}
+		f.coord.SetUnavailable(nil)
+		f.clock.Advance(4 * time.Second)
+		next, err := wait()
+		statestest.AssertNext(t, next, err, "Init")
+		if v := gauge(t, f.registry, "election_failover_degraded"); v != 0 {
+			t.Errorf("degraded gauge is %v after recovery, want 0", v)
+		}
+		assertObserved(t, f.registry, "other", "recovered", 1)
+	})
+
+	t.Run("stops while broken", func(t *testing.T) {
+		f := newFixture(errConnection, config(failover.ModeExit, 0))
+		ctx, cancel := context.WithCancel(context.Background())
+		wait := statestest.Start(ctx, f.state)
+		f.clock.BlockUntil(1)
+		cancel()
+		next, err := wait()
+		statestest.AssertNext(t, next, err, "Stopping")
+		assertObserved(t, f.registry, "other", "stopped", 1)
+	})
+}
+
+func assertObserved(t *testing.T, registry *prometheus.Registry, cause, outcome string, want uint64) {
+	t.Helper()
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != "election_failover_duration_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["cause"] == cause && labels["outcome"] == outcome {
+				if got := metric.GetHistogram().GetSampleCount(); got != want {
+					t.Errorf("%s/%s failovers observed %d times, want %d", cause, outcome, got, want)
+				}
+				return
+			}
+		}
+	}
+	t.Errorf("no %s/%s failover observed", cause, outcome)
+}
+
+func gauge(t *testing.T, registry *prometheus.Registry, name string) float64 {
+	t.Helper()
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() == name {
+			return family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	t.Fatalf("no metric %s", name)
+	return 0
+}
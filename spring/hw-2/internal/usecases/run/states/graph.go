@@ -0,0 +1,106 @@
+package states
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Transition is an edge of the state graph. An empty From is the start of the machine,
+// an empty To is its end.
+type Transition struct {
+	From   string
+	To     string
+	Reason string
+}
+
+// Graph lists the transitions a state machine is allowed to make.
+type Graph []Transition
+
+// Election is the graph of the election states, in the order it's drawn in the README.
+var Election = Graph{
+	{To: InitName},
+	{From: InitName, To: AttempterName, Reason: "Инициализация успешна, начинаем"},
+	{From: InitName, To: ShardsName, Reason: "Инициализация успешна, заданы шарды"},
+	{From: InitName, To: FailoverName, Reason: "Произошел сбой, стал недоступен зукипер"},
+	{From: AttempterName, To: FailoverName, Reason: "Произошел сбой, стал недоступен зукипер"},
+	{From: LeaderName, To: FailoverName, Reason: "Произошел сбой, стал недоступен зукипер"},
+	{From: ShardsName, To: FailoverName, Reason: "Произошел сбой, стал недоступен зукипер"},
+	{From: AttempterName, To: LeaderName, Reason: "Смогли создать эфемерную ноду в зукипере"},
+	{From: LeaderName, To: AttempterName, Reason: "Уступили лидерство по `SIGUSR1`"},
+	{From: FailoverName, To: InitName, Reason: "Зукипер снова доступен, начинаем заново"},
+	{From: FailoverName, To: AttempterName, Reason: "Переподключились, сессия жива"},
+	{From: FailoverName, To: ShardsName, Reason: "Переподключились, сессия жива"},
+	{From: InitName, To: StoppingName, Reason: "Получили `SIGTERM`"},
+	{From: AttempterName, To: StoppingName, Reason: "Получили `SIGTERM`"},
+	{From: LeaderName, To: StoppingName, Reason: "Получили `SIGTERM`"},
+	{From: ShardsName, To: StoppingName, Reason: "Получили `SIGTERM`"},
+	{From: FailoverName, To: StoppingName, Reason: "Получили `SIGTERM`"},
+	{From: StoppingName, Reason: "Ресурсы освобождены"},
+}
+
+// Shard is the graph of the machine Shards runs for every shard assigned to the node.
+var Shard = Graph{
+	{To: AttempterName},
+	{From: AttempterName, To: LeaderName, Reason: "Захватили лидерство шарда"},
+	{From: AttempterName, To: FailoverName, Reason: "Произошел сбой, стал недоступен зукипер"},
+	{From: LeaderName, To: FailoverName, Reason: "Потеряли лидерство шарда"},
+	{From: AttempterName, To: StoppingName, Reason: "Шард перешел к другой ноде или получили `SIGTERM`"},
+	{From: LeaderName, To: StoppingName, Reason: "Шард перешел к другой ноде или получили `SIGTERM`"},
+	{From: FailoverName, Reason: "Сбой передан в `Shards`"},
+	{From: StoppingName, Reason: "Лидерство шарда освобождено"},
+}
+
+// Allows reports whether the graph has an edge from one state to the other.
+func (g Graph) Allows(from, to string) bool {
+	for _, t := range g {
+		if t.From == from && t.To == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Mermaid renders the graph as a mermaid state diagram.
+func (g Graph) Mermaid() string {
+	var b strings.Builder
+	b.WriteString("stateDiagram-v2\n\n")
+	for _, t := range g {
+		fmt.Fprintf(&b, "%s --> %s", mermaidNode(t.From), mermaidNode(t.To))
+		if t.Reason != "" {
+			fmt.Fprintf(&b, " : %s", t.Reason)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// DOT renders the graph in the graphviz DOT language.
+func (g Graph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph election {\n")
+	b.WriteString("\tstart [shape=point];\n")
+	b.WriteString("\tend [shape=doublecircle, label=\"\", width=0.2];\n")
+	for _, t := range g {
+		from, to := t.From, t.To
+		if from == "" {
+			from = "start"
+		}
+		if to == "" {
+			to = "end"
+		}
+		fmt.Fprintf(&b, "\t%q -> %q", from, to)
+		if t.Reason != "" {
+			fmt.Fprintf(&b, " [label=%q]", t.Reason)
+		}
+		b.WriteString(";\n")
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func mermaidNode(name string) string {
+	if name == "" {
+		return "[*]"
+	}
+	return name
+}
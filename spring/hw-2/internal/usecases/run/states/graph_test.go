@@ -0,0 +1,77 @@
+package states_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states"
+)
+
+func TestElectionMatchesReadme(t *testing.T) {
+	readme, err := os.ReadFile("../../../../README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := strings.Split(string(readme), "```mermaid\n")[1:]
+	graphs := []struct {
+		graph   states.Graph
+		command string
+	}{
+		{states.Election, "election graph"},
+		{states.Shard, "election graph --shard"},
+	}
+	if len(blocks) < len(graphs) {
+		t.Fatalf("README has %d mermaid diagrams, want %d", len(blocks), len(graphs))
+	}
+	for i, g := range graphs {
+		diagram, _, _ := strings.Cut(blocks[i], "```")
+		if got := g.graph.Mermaid(); got != diagram {
+			t.Errorf("README diagram %d is out of date, regenerate it with `%s`:\n%s", i+1, g.command, got)
+		}
+	}
+}
+
+func TestElectionAllows(t *testing.T) {
+	cases := []struct {
+		from, to string
+		allowed  bool
+	}{
+		{"", states.InitName, true},
+		{"", states.LeaderName, false},
+		{states.AttempterName, states.LeaderName, true},
+		{states.FailoverName, states.LeaderName, false},
+		{states.LeaderName, states.AttempterName, true},
+		{states.FailoverName, states.AttempterName, true},
+		{states.FailoverName, states.ShardsName, true},
+		{states.ShardsName, states.LeaderName, false},
+		{states.StoppingName, "", true},
+		{states.LeaderName, "", false},
+	}
+	for _, c := range cases {
+		if got := states.Election.Allows(c.from, c.to); got != c.allowed {
+			t.Errorf("Allows(%q, %q) = %v, want %v", c.from, c.to, got, c.allowed)
+		}
+	}
+}
+
+func TestShardAllows(t *testing.T) {
+	cases := []struct {
+		from, to string
+		allowed  bool
+	}{
+		{"", states.AttempterName, true},
+		{"", states.InitName, false},
+		{states.AttempterName, states.LeaderName, true},
+		{states.LeaderName, states.AttempterName, false},
+		{states.LeaderName, states.StoppingName, true},
+		{states.FailoverName, states.AttempterName, false},
+		{states.FailoverName, "", true},
+		{states.StoppingName, "", true},
+	}
+	for _, c := range cases {
+		if got := states.Shard.Allows(c.from, c.to); got != c.allowed {
+			t.Errorf("Allows(%q, %q) = %v, want %v", c.from, c.to, got, c.allowed)
+		}
+	}
+}
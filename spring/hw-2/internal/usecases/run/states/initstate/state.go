@@ -0,0 +1,59 @@
+package initstate
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/filestore"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states"
+)
+
+func New(
+	logger *slog.Logger,
+	coord coordinator.Coordinator,
+	files *filestore.Store,
+	timeout time.Duration,
+	next states.Factory,
+) *State {
+	logger = logger.With("subsystem", "InitState")
+	return &State{
+		logger:  logger,
+		coord:   coord,
+		files:   files,
+		timeout: timeout,
+		next:    next,
+	}
+}
+
+// State checks that the coordination backend and the file directory are usable.
+type State struct {
+	logger  *slog.Logger
+	coord   coordinator.Coordinator
+	files   *filestore.Store
+	timeout time.Duration
+	next    states.Factory
+}
+
+func (s *State) String() string {
+	return states.InitName
+}
+
+func (s *State) Run(ctx context.Context) (states.AutomataState, error) {
+	if err := s.files.Check(); err != nil {
+		return s.next.Failover(fmt.Errorf("check file dir: %w", err)), nil
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	err := s.coord.Check(checkCtx)
+	if ctx.Err() != nil {
+		return s.next.Stopping(nil), nil
+	}
+	if err != nil {
+		return s.next.Failover(fmt.Errorf("check coordinator: %w", err)), nil
+	}
+	s.logger.LogAttrs(ctx, slog.LevelInfo, "resources are available")
+	return s.next.Attempter(0), nil
+}
@@ -0,0 +1,58 @@
+package initstate_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/clock"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator/inproc"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/filestore"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states/initstate"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states/statestest"
+)
+
+func TestInit(t *testing.T) {
+	files := filestore.New(filepath.Join(t.TempDir(), "files"), 1, clock.New())
+
+	t.Run("available", func(t *testing.T) {
+		state := initstate.New(slog.Default(), inproc.New("node"), files, time.Second, statestest.Factory{})
+		next, err := state.Run(context.Background())
+		statestest.AssertNext(t, next, err, "Attempter")
+	})
+
+	t.Run("coordinator unavailable", func(t *testing.T) {
+		coord := inproc.New("node")
+		coord.SetUnavailable(errors.New("no quorum"))
+		state := initstate.New(slog.Default(), coord, files, time.Second, statestest.Factory{})
+		next, err := state.Run(context.Background())
+		failover := statestest.AssertNext(t, next, err, "Failover")
+		if failover.Cause == nil {
+			t.Error("failover has no cause")
+		}
+	})
+
+	t.Run("bad file dir", func(t *testing.T) {
+		// a regular file where the directory should be
+		blocker := filepath.Join(t.TempDir(), "blocker")
+		if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		bad := filestore.New(filepath.Join(blocker, "files"), 1, clock.New())
+		state := initstate.New(slog.Default(), inproc.New("node"), bad, time.Second, statestest.Factory{})
+		next, err := state.Run(context.Background())
+		statestest.AssertNext(t, next, err, "Failover")
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		state := initstate.New(slog.Default(), inproc.New("node"), files, time.Second, statestest.Factory{})
+		next, err := state.Run(ctx)
+		statestest.AssertNext(t, next, err, "Stopping")
+	})
+}
@@ -0,0 +1,83 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/stepdown"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/workload"
+)
+
+var ErrLeadershipLost = errors.New("leadership lost")
+
+func New(
+	logger *slog.Logger,
+	lease coordinator.Lease,
+	workloads *workload.Group,
+	stepDown *stepdown.Requests,
+	cooldown time.Duration,
+	next states.Factory,
+) *State {
+	logger = logger.With("subsystem", "LeaderState")
+	return &State{
+		logger:    logger,
+		lease:     lease,
+		workloads: workloads,
+		stepDown:  stepDown,
+		cooldown:  cooldown,
+		next:      next,
+	}
+}
+
+// State runs the leader-only workloads for as long as the lease is held.
+// On a step-down request it finishes them, releases the lease and sits out for cooldown.
+type State struct {
+	logger    *slog.Logger
+	lease     coordinator.Lease
+	workloads *workload.Group
+	stepDown  *stepdown.Requests
+	cooldown  time.Duration
+	next      states.Factory
+}
+
+func (s *State) String() string {
+	return states.LeaderName
+}
+
+func (s *State) Run(ctx context.Context) (states.AutomataState, error) {
+	if err := s.workloads.Start(workload.WithTerm(ctx, s.lease)); err != nil {
+		err = fmt.Errorf("start workloads: %w", err)
+		if releaseErr := s.lease.Release(ctx); releaseErr != nil {
+			err = errors.Join(err, releaseErr)
+		}
+		return s.next.Failover(err), nil
+	}
+	s.logger.LogAttrs(ctx, slog.LevelInfo, "leading", slog.Uint64("token", s.lease.Token()))
+	select {
+	case <-ctx.Done():
+		// Stopping releases the lease once the current runs are over
+		s.stop(ctx, s.workloads.Stop)
+		return s.next.Stopping(s.lease), nil
+	case <-s.lease.Lost():
+		s.stop(ctx, s.workloads.Abort)
+		return s.next.Failover(ErrLeadershipLost), nil
+	case <-s.stepDown.C():
+		s.logger.LogAttrs(ctx, slog.LevelInfo, "stepping down", slog.Duration("cooldown", s.cooldown))
+		s.stop(ctx, s.workloads.Stop)
+		if err := s.lease.Release(ctx); err != nil {
+			return s.next.Failover(fmt.Errorf("release leadership: %w", err)), nil
+		}
+		return s.next.Attempter(s.cooldown), nil
+	}
+}
+
+func (s *State) stop(ctx context.Context, stop func() error) {
+	if err := stop(); err != nil {
+		s.logger.LogAttrs(ctx, slog.LevelWarn, "workloads stopped with error", slog.String("error", err.Error()))
+	}
+}
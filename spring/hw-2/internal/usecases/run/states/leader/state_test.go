@@ -0,0 +1,145 @@
+package leader_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/clock"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator/inproc"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/stepdown"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states/leader"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states/statestest"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/workload"
+)
+
+const (
+	grace    = 5 * time.Second
+	cooldown = time.Minute
+)
+
+// job records how the leader drives it and runs until its context is done.
+type job struct {
+	startErr error
+	started  chan uint64
+	ctx      context.Context
+	stopped  bool
+}
+
+func newJob() *job {
+	return &job{started: make(chan uint64, 1)}
+}
+
+func (j *job) String() string {
+	return "job"
+}
+
+func (j *job) Start(ctx context.Context) error {
+	if j.startErr != nil {
+		return j.startErr
+	}
+	j.ctx = ctx
+	term, _ := workload.TermFrom(ctx)
+	j.started <- term.Token()
+	return nil
+}
+
+func (j *job) Stop() error {
+	j.stopped = true
+	return nil
+}
+
+func TestLeader(t *testing.T) {
+	t.Run("runs workloads until shutdown", func(t *testing.T) {
+		coord := inproc.New("node")
+		lease, err := coord.TryAcquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		j := newJob()
+		group := workload.NewGroup(slog.Default(), clock.New(), grace, []workload.Workload{j})
+		ctx, cancel := context.WithCancel(context.Background())
+		wait := statestest.Start(ctx, leader.New(slog.Default(), lease, group, stepdown.New(), cooldown, statestest.Factory{}))
+		if token := <-j.started; token != lease.Token() {
+			t.Errorf("workload got token %d, want %d", token, lease.Token())
+		}
+		cancel()
+		next, err := wait()
+		stopping := statestest.AssertNext(t, next, err, "Stopping")
+		if stopping.Lease != lease {
+			t.Error("leader didn't hand its lease to Stopping")
+		}
+		if !j.stopped || j.ctx.Err() == nil {
+			t.Error("workload wasn't stopped")
+		}
+	})
+
+	t.Run("lease lost", func(t *testing.T) {
+		coord := inproc.New("node")
+		lease, err := coord.TryAcquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		j := newJob()
+		group := workload.NewGroup(slog.Default(), clock.New(), grace, []workload.Workload{j})
+		wait := statestest.Start(context.Background(), leader.New(slog.Default(), lease, group, stepdown.New(), cooldown, statestest.Factory{}))
+		<-j.started
+		coord.Expire()
+		next, err := wait()
+		failover := statestest.AssertNext(t, next, err, "Failover")
+		if !errors.Is(failover.Cause, leader.ErrLeadershipLost) {
+			t.Errorf("failover cause is %v, want %v", failover.Cause, leader.ErrLeadershipLost)
+		}
+		if !j.stopped || j.ctx.Err() == nil {
+			t.Error("workload wasn't stopped")
+		}
+	})
+
+	t.Run("workload fails to start", func(t *testing.T) {
+		coord := inproc.New("node")
+		lease, err := coord.TryAcquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		j := newJob()
+		j.startErr = errors.New("no such binary")
+		group := workload.NewGroup(slog.Default(), clock.New(), grace, []workload.Workload{j})
+		next, err := leader.New(slog.Default(), lease, group, stepdown.New(), cooldown, statestest.Factory{}).Run(context.Background())
+		failover := statestest.AssertNext(t, next, err, "Failover")
+		if !errors.Is(failover.Cause, j.startErr) {
+			t.Errorf("failover cause is %v, want %v", failover.Cause, j.startErr)
+		}
+		if coord.Held() {
+			t.Error("leader kept the lease")
+		}
+	})
+	t.Run("steps down on request", func(t *testing.T) {
+		coord := inproc.New("node")
+		lease, err := coord.TryAcquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		j := newJob()
+		group := workload.NewGroup(slog.Default(), clock.New(), grace, []workload.Workload{j})
+		requests := stepdown.New()
+		if requests.Request() {
+			t.Error("request accepted before the node leads")
+		}
+		wait := statestest.Start(context.Background(), leader.New(slog.Default(), lease, group, requests, cooldown, statestest.Factory{}))
+		<-j.started
+		for !requests.Request() {
+			// the state may not be waiting for requests yet
+			time.Sleep(time.Millisecond)
+		}
+		next, err := wait()
+		attempter := statestest.AssertNext(t, next, err, "Attempter")
+		if attempter.Cooldown != cooldown {
+			t.Errorf("cooldown is %s, want %s", attempter.Cooldown, cooldown)
+		}
+		if !j.stopped || coord.Held() {
+			t.Error("leader didn't stop its workloads and release the lease")
+		}
+	})
+}
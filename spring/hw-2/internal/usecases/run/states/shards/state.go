@@ -0,0 +1,206 @@
+package shards
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/rendezvous"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/workload"
+)
+
+// Machine returns the first state of the machine of a shard.
+type Machine func(shard string) (states.AutomataState, error)
+
+func New(
+	logger *slog.Logger,
+	coord coordinator.Sharded,
+	nodeID string,
+	shards []string,
+	runners func(shard string) run.Runner,
+	machine Machine,
+	table *Table,
+	next states.Factory,
+) *State {
+	logger = logger.With("subsystem", "ShardsState")
+	return &State{
+		logger:  logger,
+		coord:   coord,
+		nodeID:  nodeID,
+		shards:  shards,
+		runners: runners,
+		machine: machine,
+		table:   table,
+		next:    next,
+	}
+}
+
+// State runs a machine for every shard assigned to the node by rendezvous hashing over the
+// members of the cluster and reassigns the shards whenever the members change. The machine
+// of a shard that moves to another node is stopped, so the lease is released for the new owner.
+// A failed machine or session moves the node to Failover once all machines have stopped.
+type State struct {
+	logger  *slog.Logger
+	coord   coordinator.Sharded
+	nodeID  string
+	shards  []string
+	runners func(shard string) run.Runner
+	machine Machine
+	table   *Table
+	next    states.Factory
+}
+
+func (s *State) String() string {
+	return states.ShardsName
+}
+
+func (s *State) Run(ctx context.Context) (states.AutomataState, error) {
+	watchCtx, stopWatch := context.WithCancel(ctx)
+	defer stopWatch()
+	events := s.coord.Watch(watchCtx)
+	machines := &machines{
+		logger:  s.logger,
+		runners: s.runners,
+		table:   s.table,
+		running: make(map[string]*machine),
+		failed:  make(chan error, 1),
+	}
+	// the next state runs once the shards are released
+	defer func() {
+		machines.stop(machines.names())
+	}()
+	for {
+		err := s.assign(ctx, machines, events)
+		if ctx.Err() != nil {
+			return s.next.Stopping(nil), nil
+		}
+		if err != nil {
+			return s.next.Failover(err), nil
+		}
+	}
+}
+
+// assign starts and stops machines to match the members and waits for them to change.
+func (s *State) assign(ctx context.Context, machines *machines, events <-chan coordinator.SessionEvent) error {
+	membersCtx, stopMembers := context.WithCancel(ctx)
+	defer stopMembers()
+	members, changed, err := s.coord.Members(membersCtx)
+	if err != nil {
+		return fmt.Errorf("list members: %w", err)
+	}
+	assigned := rendezvous.Owned(s.shards, members, s.nodeID)
+	var released []string
+	for _, shard := range machines.names() {
+		if !slices.Contains(assigned, shard) {
+			released = append(released, shard)
+		}
+	}
+	machines.stop(released)
+	for _, shard := range assigned {
+		if err := machines.start(ctx, shard, s.machine); err != nil {
+			return err
+		}
+	}
+	s.logger.LogAttrs(ctx, slog.LevelInfo, "shards assigned",
+		slog.String("shards", strings.Join(assigned, ",")),
+		slog.String("released", strings.Join(released, ",")),
+		slog.Int("members", len(members)))
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-changed:
+		return nil
+	case event := <-events:
+		s.logger.LogAttrs(ctx, slog.LevelInfo, "session event", slog.String("event", event.String()))
+		return event.Err()
+	case err := <-machines.failed:
+		return err
+	}
+}
+
+type machines struct {
+	logger  *slog.Logger
+	runners func(shard string) run.Runner
+	table   *Table
+	running map[string]*machine
+	// failed gets the error of the first machine that fails on its own
+	failed chan error
+}
+
+type machine struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (m *machines) names() []string {
+	names := make([]string, 0, len(m.running))
+	for shard := range m.running {
+		names = append(names, shard)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// start runs the machine of a shard unless it's running already.
+func (m *machines) start(ctx context.Context, shard string, first Machine) error {
+	if _, ok := m.running[shard]; ok {
+		return nil
+	}
+	state, err := first(shard)
+	if err != nil {
+		return fmt.Errorf("start shard %s: %w", shard, err)
+	}
+	ctx, cancel := context.WithCancel(workload.WithShard(ctx, shard))
+	running := &machine{cancel: cancel, done: make(chan struct{})}
+	m.running[shard] = running
+	go func() {
+		defer close(running.done)
+		defer m.table.remove(shard)
+		err := m.runners(shard).Run(ctx, m.table.track(shard, state))
+		switch {
+		case err == nil:
+		case ctx.Err() != nil:
+			m.logger.LogAttrs(ctx, slog.LevelWarn, "shard stopped with error",
+				slog.String("shard", shard), slog.String("error", err.Error()))
+		default:
+			select {
+			case m.failed <- fmt.Errorf("shard %s: %w", shard, err):
+			default:
+			}
+		}
+	}()
+	return nil
+}
+
+// stop cancels the machines of the shards and waits for all of them to finish.
+func (m *machines) stop(shards []string) {
+	for _, shard := range shards {
+		m.running[shard].cancel()
+	}
+	for _, shard := range shards {
+		<-m.running[shard].done
+		delete(m.running, shard)
+	}
+}
+
+// Failed ends the machine of a shard with the cause; Shards moves the node to Failover.
+func Failed(cause error) states.AutomataState {
+	return &failed{cause: cause}
+}
+
+type failed struct {
+	cause error
+}
+
+func (s *failed) String() string {
+	return states.FailoverName
+}
+
+func (s *failed) Run(context.Context) (states.AutomataState, error) {
+	return nil, s.cause
+}
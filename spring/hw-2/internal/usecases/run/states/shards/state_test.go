@@ -0,0 +1,199 @@
+package shards_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/clock"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator/inproc"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/rendezvous"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/stepdown"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states/attempter"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states/leader"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states/shards"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states/statestest"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states/stopping"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/workload"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const settleTimeout = 5 * time.Second
+
+var names = []string{"shard-0", "shard-1", "shard-2", "shard-3", "shard-4", "shard-5", "shard-6", "shard-7"}
+
+// shardFactory builds the real shard states; elections are driven by Vacant, not the timeout.
+type shardFactory struct {
+	coord coordinator.Coordinator
+}
+
+func (f *shardFactory) Init() states.AutomataState {
+	return f.Attempter(0)
+}
+
+func (f *shardFactory) Attempter(cooldown time.Duration) states.AutomataState {
+	return attempter.New(slog.Default(), clock.New(), f.coord, func() time.Duration { return time.Minute }, cooldown, f)
+}
+
+func (f *shardFactory) Leader(lease coordinator.Lease) states.AutomataState {
+	workloads := workload.NewGroup(slog.Default(), clock.New(), time.Second, nil)
+	return leader.New(slog.Default(), lease, workloads, stepdown.New(), 0, f)
+}
+
+func (f *shardFactory) Failover(cause error) states.AutomataState {
+	return shards.Failed(cause)
+}
+
+func (f *shardFactory) Stopping(lease coordinator.Lease) states.AutomataState {
+	return stopping.New(slog.Default(), f.coord, lease, time.Second)
+}
+
+type node struct {
+	id    string
+	coord *inproc.Coordinator
+	table *shards.Table
+	stop  context.CancelFunc
+	wait  func() (states.AutomataState, error)
+}
+
+// loopRunner runs the machine of a shard without observing it.
+func loopRunner(string) run.Runner {
+	return run.NewLoopRunner(slog.Default(), states.Shard)
+}
+
+func startNode(id string, coord *inproc.Coordinator) *node {
+	table := shards.NewTable(prometheus.NewRegistry())
+	state := shards.New(slog.Default(), coord, id, names, loopRunner,
+		func(shard string) (states.AutomataState, error) {
+			return (&shardFactory{coord: coord.Shard(shard)}).Attempter(0), nil
+		}, table, statestest.Factory{})
+	ctx, cancel := context.WithCancel(context.Background())
+	return &node{id: id, coord: coord, table: table, stop: cancel, wait: statestest.Start(ctx, state)}
+}
+
+// eventuallyOwns waits until every node leads the shards rendezvous hashing assigns it.
+func eventuallyOwns(t *testing.T, nodes ...*node) {
+	t.Helper()
+	var members []string
+	for _, n := range nodes {
+		members = append(members, n.id)
+	}
+	deadline := time.Now().Add(settleTimeout)
+	for {
+		settled := true
+		for _, n := range nodes {
+			if !slices.Equal(n.table.Owned(), rendezvous.Owned(names, members, n.id)) {
+				settled = false
+			}
+		}
+		if settled {
+			return
+		}
+		if time.Now().After(deadline) {
+			for _, n := range nodes {
+				t.Errorf("%s owns %v, want %v", n.id, n.table.Owned(), rendezvous.Owned(names, members, n.id))
+			}
+			t.FailNow()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestShards(t *testing.T) {
+	t.Run("rebalances when nodes join and leave", func(t *testing.T) {
+		a := startNode("node-a", inproc.New("node-a"))
+		defer a.stop()
+		eventuallyOwns(t, a)
+		if len(a.table.Owned()) != len(names) {
+			t.Fatalf("single node owns %v, want every shard", a.table.Owned())
+		}
+
+		b := startNode("node-b", a.coord.Peer("node-b"))
+		eventuallyOwns(t, a, b)
+		if len(a.table.Owned()) == 0 || len(b.table.Owned()) == 0 {
+			t.Fatalf("shards aren't spread: %v and %v", a.table.Owned(), b.table.Owned())
+		}
+
+		b.stop()
+		next, err := b.wait()
+		statestest.AssertNext(t, next, err, states.StoppingName)
+		if owned := b.table.Owned(); len(owned) != 0 {
+			t.Errorf("stopped node still owns %v", owned)
+		}
+		// the Stopping state closes the coordinator, which leaves the cluster
+		if err := b.coord.Close(); err != nil {
+			t.Fatal(err)
+		}
+		eventuallyOwns(t, a)
+	})
+
+	t.Run("session loss releases the shards", func(t *testing.T) {
+		a := startNode("node-a", inproc.New("node-a"))
+		defer a.stop()
+		eventuallyOwns(t, a)
+		errConnection := errors.New("connection lost")
+		a.coord.SetUnavailable(errConnection)
+		next, err := a.wait()
+		failover := statestest.AssertNext(t, next, err, states.FailoverName)
+		if !errors.Is(failover.Cause, coordinator.ErrDisconnected) {
+			t.Errorf("cause %v, want %v", failover.Cause, coordinator.ErrDisconnected)
+		}
+		if owned := a.table.Owned(); len(owned) != 0 {
+			t.Errorf("node still owns %v after failing over", owned)
+		}
+	})
+
+	t.Run("shutdown releases the shards", func(t *testing.T) {
+		a := startNode("node-a", inproc.New("node-a"))
+		eventuallyOwns(t, a)
+		a.stop()
+		next, err := a.wait()
+		statestest.AssertNext(t, next, err, states.StoppingName)
+		for _, shard := range names {
+			if a.coord.Shard(shard).(*inproc.Coordinator).Held() {
+				t.Errorf("%s is still held", shard)
+			}
+		}
+	})
+
+	t.Run("a failed machine fails over", func(t *testing.T) {
+		coord := inproc.New("node-a")
+		errBroken := errors.New("broken")
+		state := shards.New(slog.Default(), coord, "node-a", names, loopRunner,
+			func(shard string) (states.AutomataState, error) {
+				if shard == names[3] {
+					return &brokenAttempter{cause: errBroken}, nil
+				}
+				return (&shardFactory{coord: coord.Shard(shard)}).Attempter(0), nil
+			}, shards.NewTable(prometheus.NewRegistry()), statestest.Factory{})
+		next, err := state.Run(context.Background())
+		failover := statestest.AssertNext(t, next, err, states.FailoverName)
+		if !errors.Is(failover.Cause, errBroken) {
+			t.Errorf("cause %v, want %v", failover.Cause, errBroken)
+		}
+		if want := fmt.Sprintf("shard %s", names[3]); !strings.Contains(failover.Cause.Error(), want) {
+			t.Errorf("cause %q doesn't name the shard", failover.Cause)
+		}
+	})
+}
+
+// brokenAttempter fails the way a real Attempter of a shard does.
+type brokenAttempter struct {
+	cause error
+}
+
+func (s *brokenAttempter) String() string {
+	return states.AttempterName
+}
+
+func (s *brokenAttempter) Run(context.Context) (states.AutomataState, error) {
+	return shards.Failed(s.cause), nil
+}
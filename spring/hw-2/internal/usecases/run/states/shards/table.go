@@ -0,0 +1,74 @@
+package shards
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Table tracks the state of every shard machine of the node; every Shards state of a
+// node shares one.
+type Table struct {
+	mu     sync.Mutex
+	states map[string]string
+}
+
+func NewTable(registerer prometheus.Registerer) *Table {
+	t := &Table{states: make(map[string]string)}
+	registerer.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "election_shards_owned",
+		Help: "Number of shards the node leads.",
+	}, func() float64 {
+		return float64(len(t.Owned()))
+	}))
+	return t
+}
+
+// Owned returns the sorted names of the shards the node leads.
+func (t *Table) Owned() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var owned []string
+	for shard, state := range t.states {
+		if state == states.LeaderName {
+			owned = append(owned, shard)
+		}
+	}
+	slices.Sort(owned)
+	return owned
+}
+
+func (t *Table) enter(shard, state string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.states[shard] = state
+}
+
+func (t *Table) remove(shard string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.states, shard)
+}
+
+// tracked records entering the wrapped state of a shard and wraps the state it returns.
+type tracked struct {
+	states.AutomataState
+	shard string
+	table *Table
+}
+
+func (t *Table) track(shard string, state states.AutomataState) states.AutomataState {
+	if state == nil {
+		return nil
+	}
+	return &tracked{AutomataState: state, shard: shard, table: t}
+}
+
+func (s *tracked) Run(ctx context.Context) (states.AutomataState, error) {
+	s.table.enter(s.shard, s.AutomataState.String())
+	next, err := s.AutomataState.Run(ctx)
+	return s.table.track(s.shard, next), err
+}
@@ -1,8 +1,35 @@
 package states
 
-import "context"
+import (
+	"context"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator"
+)
+
+// Names returned by String of the election states.
+const (
+	InitName      = "Init"
+	AttempterName = "Attempter"
+	LeaderName    = "Leader"
+	FailoverName  = "Failover"
+	StoppingName  = "Stopping"
+	ShardsName    = "Shards"
+)
 
 type AutomataState interface {
 	Run(ctx context.Context) (AutomataState, error)
 	String() string
 }
+
+// Factory builds the states a state can move to, so state packages don't import each other.
+type Factory interface {
+	Init() AutomataState
+	// Attempter sits out of elections for cooldown before its first attempt. With shards
+	// configured, the node elects a leader per shard in the Shards state instead.
+	Attempter(cooldown time.Duration) AutomataState
+	Leader(lease coordinator.Lease) AutomataState
+	Failover(cause error) AutomataState
+	// Stopping releases lease if it isn't nil.
+	Stopping(lease coordinator.Lease) AutomataState
+}
@@ -0,0 +1,42 @@
+package statestest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states"
+)
+
+// AssertNext fails the test unless state is the Next marker with the given name.
+func AssertNext(t *testing.T, state states.AutomataState, err error, name string) *Next {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	next, ok := state.(*Next)
+	if !ok {
+		t.Fatalf("next state is %T, want *statestest.Next", state)
+	}
+	if next.Name != name {
+		t.Fatalf("next state is %s, want %s", next.Name, name)
+	}
+	return next
+}
+
+type result struct {
+	state states.AutomataState
+	err   error
+}
+
+// Start runs state in the background; the returned func waits for its result.
+func Start(ctx context.Context, state states.AutomataState) func() (states.AutomataState, error) {
+	done := make(chan result, 1)
+	go func() {
+		next, err := state.Run(ctx)
+		done <- result{state: next, err: err}
+	}()
+	return func() (states.AutomataState, error) {
+		r := <-done
+		return r.state, r.err
+	}
+}
@@ -0,0 +1,50 @@
+package statestest
+
+import (
+	"context"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states"
+)
+
+var _ states.Factory = Factory{}
+
+// Next stands in for the state a state under test moved to.
+type Next struct {
+	Name     string
+	Lease    coordinator.Lease
+	Cause    error
+	Cooldown time.Duration
+}
+
+func (n *Next) Run(context.Context) (states.AutomataState, error) {
+	return nil, nil
+}
+
+func (n *Next) String() string {
+	return n.Name
+}
+
+// Factory returns Next markers instead of real states.
+type Factory struct{}
+
+func (Factory) Init() states.AutomataState {
+	return &Next{Name: states.InitName}
+}
+
+func (Factory) Attempter(cooldown time.Duration) states.AutomataState {
+	return &Next{Name: states.AttempterName, Cooldown: cooldown}
+}
+
+func (Factory) Leader(lease coordinator.Lease) states.AutomataState {
+	return &Next{Name: states.LeaderName, Lease: lease}
+}
+
+func (Factory) Failover(cause error) states.AutomataState {
+	return &Next{Name: states.FailoverName, Cause: cause}
+}
+
+func (Factory) Stopping(lease coordinator.Lease) states.AutomataState {
+	return &Next{Name: states.StoppingName, Lease: lease}
+}
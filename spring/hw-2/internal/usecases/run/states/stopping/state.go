@@ -0,0 +1,52 @@
+package stopping
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states"
+)
+
+func New(logger *slog.Logger, coord coordinator.Coordinator, lease coordinator.Lease, timeout time.Duration) *State {
+	logger = logger.With("subsystem", "StoppingState")
+	return &State{
+		logger:  logger,
+		coord:   coord,
+		lease:   lease,
+		timeout: timeout,
+	}
+}
+
+// State releases the leadership and the coordinator connection; it is the last state.
+type State struct {
+	logger  *slog.Logger
+	coord   coordinator.Coordinator
+	lease   coordinator.Lease
+	timeout time.Duration
+}
+
+func (s *State) String() string {
+	return states.StoppingName
+}
+
+func (s *State) Run(ctx context.Context) (states.AutomataState, error) {
+	// the run context is usually cancelled by now, cleanup still needs its own deadline
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.timeout)
+	defer cancel()
+	var errs []error
+	if s.lease != nil {
+		if err := s.lease.Release(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("release leadership: %w", err))
+		} else {
+			s.logger.LogAttrs(ctx, slog.LevelInfo, "leadership released")
+		}
+	}
+	if err := s.coord.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("close coordinator: %w", err))
+	}
+	return nil, errors.Join(errs...)
+}
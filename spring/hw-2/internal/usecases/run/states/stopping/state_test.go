@@ -0,0 +1,31 @@
+package stopping_test
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator/inproc"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/usecases/run/states/stopping"
+)
+
+func TestStoppingReleasesLeadership(t *testing.T) {
+	coord := inproc.New("node")
+	lease, err := coord.TryAcquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	next, err := stopping.New(slog.Default(), coord, lease, time.Second).Run(ctx)
+	if err != nil || next != nil {
+		t.Fatalf("got %v, %v; want the machine to finish", next, err)
+	}
+	if coord.Held() {
+		t.Error("leadership is still held")
+	}
+	if !coord.Closed() {
+		t.Error("coordinator is not closed")
+	}
+}
@@ -0,0 +1,123 @@
+package workload
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/clock"
+)
+
+const (
+	// CronName is the registry name of the scheduled shell command.
+	CronName = "cron"
+	// TokenEnv passes the fencing token of the term to the command.
+	TokenEnv = "ELECTION_FENCING_TOKEN"
+	// ShardEnv passes the shard the command runs for, if the node leads shards.
+	ShardEnv = "ELECTION_SHARD"
+	// maxOutputBytes limits the command output kept for the log.
+	maxOutputBytes = 4 << 10
+)
+
+var _ Workload = &Command{}
+
+func NewCommand(logger *slog.Logger, clk clock.Clock, schedule Schedule, command string, killDelay time.Duration) *Command {
+	logger = logger.With("subsystem", "CronCommand")
+	return &Command{
+		logger:    logger,
+		clock:     clk,
+		schedule:  schedule,
+		command:   command,
+		killDelay: killDelay,
+	}
+}
+
+// Command runs a shell command on a schedule. A run that outlasts the next scheduled time
+// delays it instead of overlapping. A stop lets the running command finish; once its
+// iteration context ends the command gets SIGTERM and, after killDelay, SIGKILL.
+type Command struct {
+	loop
+	logger    *slog.Logger
+	clock     clock.Clock
+	schedule  Schedule
+	command   string
+	killDelay time.Duration
+}
+
+func (c *Command) String() string {
+	return CronName
+}
+
+func (c *Command) Start(ctx context.Context) error {
+	c.start(ctx, c.run)
+	return nil
+}
+
+func (c *Command) run(ctx context.Context) error {
+	for {
+		now := c.clock.Now()
+		next := c.schedule.Next(now)
+		if next.IsZero() {
+			c.logger.LogAttrs(ctx, slog.LevelWarn, "schedule has no more runs")
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		timer := c.clock.NewTimer(next.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C():
+		}
+		c.exec(ctx)
+	}
+}
+
+func (c *Command) exec(ctx context.Context) {
+	cmd := exec.CommandContext(Iteration(ctx), "/bin/sh", "-c", c.command)
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = c.killDelay
+	cmd.Env = os.Environ()
+	if term, ok := TermFrom(ctx); ok {
+		cmd.Env = append(cmd.Env, TokenEnv+"="+strconv.FormatUint(term.Token(), 10))
+	}
+	if shard, ok := ShardFrom(ctx); ok {
+		cmd.Env = append(cmd.Env, ShardEnv+"="+shard)
+	}
+	var output bytes.Buffer
+	cmd.Stdout = &limitedWriter{buf: &output, limit: maxOutputBytes}
+	cmd.Stderr = cmd.Stdout
+	started := c.clock.Now()
+	err := cmd.Run()
+	attrs := []slog.Attr{
+		slog.String("command", c.command),
+		slog.Duration("duration", c.clock.Now().Sub(started)),
+		slog.String("output", output.String()),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+		c.logger.LogAttrs(ctx, slog.LevelError, "command failed", attrs...)
+		return
+	}
+	c.logger.LogAttrs(ctx, slog.LevelInfo, "command finished", attrs...)
+}
+
+// limitedWriter keeps the first limit bytes and drops the rest without failing the command.
+type limitedWriter struct {
+	buf   *bytes.Buffer
+	limit int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if room := w.limit - w.buf.Len(); room > 0 {
+		w.buf.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
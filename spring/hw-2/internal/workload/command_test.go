@@ -0,0 +1,147 @@
+package workload_test
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/clock"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator/inproc"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/workload"
+)
+
+func TestCommand(t *testing.T) {
+	t.Run("runs on schedule with the token", func(t *testing.T) {
+		clk := clock.NewFake(time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC))
+		lease, err := inproc.New("node").TryAcquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		schedule, err := workload.ParseSchedule("@every 1m")
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := filepath.Join(t.TempDir(), "out")
+		command := workload.NewCommand(slog.Default(), clk, schedule, "echo $"+workload.TokenEnv+" >> "+out, time.Second)
+		if err := command.Start(workload.WithTerm(context.Background(), lease)); err != nil {
+			t.Fatalf("start: %v", err)
+		}
+		for range 2 {
+			clk.BlockUntil(1)
+			clk.Advance(time.Minute)
+		}
+		// the third timer is set once the second run is over
+		clk.BlockUntil(1)
+		if err := command.Stop(); err != nil {
+			t.Errorf("stop: %v", err)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Fields(string(data)); len(got) != 2 || got[0] != "1" || got[1] != "1" {
+			t.Errorf("command output %q, want the token 1 twice", data)
+		}
+	})
+
+	t.Run("passes the shard", func(t *testing.T) {
+		clk := clock.NewFake(time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC))
+		schedule, err := workload.ParseSchedule("@every 1m")
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := filepath.Join(t.TempDir(), "out")
+		command := workload.NewCommand(slog.Default(), clk, schedule, "echo $"+workload.ShardEnv+" >> "+out, time.Second)
+		if err := command.Start(workload.WithShard(context.Background(), "shard-0")); err != nil {
+			t.Fatalf("start: %v", err)
+		}
+		clk.BlockUntil(1)
+		clk.Advance(time.Minute)
+		clk.BlockUntil(1)
+		if err := command.Stop(); err != nil {
+			t.Errorf("stop: %v", err)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimSpace(string(data)); got != "shard-0" {
+			t.Errorf("command output %q, want the shard", data)
+		}
+	})
+
+	t.Run("stop interrupts a running command", func(t *testing.T) {
+		clk := clock.NewFake(time.Now())
+		schedule, err := workload.ParseSchedule("@every 1s")
+		if err != nil {
+			t.Fatal(err)
+		}
+		command := workload.NewCommand(slog.Default(), clk, schedule, "sleep 30", 100*time.Millisecond)
+		if err := command.Start(context.Background()); err != nil {
+			t.Fatalf("start: %v", err)
+		}
+		clk.BlockUntil(1)
+		clk.Advance(time.Second)
+		started := time.Now()
+		if err := command.Stop(); err != nil {
+			t.Errorf("stop: %v", err)
+		}
+		if elapsed := time.Since(started); elapsed > 5*time.Second {
+			t.Errorf("stop took %s", elapsed)
+		}
+	})
+}
+
+func TestCommandInGroup(t *testing.T) {
+	// start runs the command once and returns while it is running
+	start := func(t *testing.T, command string) *workload.Group {
+		t.Helper()
+		running := filepath.Join(t.TempDir(), "running")
+		command = "touch " + running + "; " + command
+		clk := clock.NewFake(time.Now())
+		schedule, err := workload.ParseSchedule("@every 1s")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the grace period runs on the real clock, the schedule on the fake one
+		cmd := workload.NewCommand(slog.Default(), clk, schedule, command, 100*time.Millisecond)
+		group := workload.NewGroup(slog.Default(), clock.New(), grace, []workload.Workload{cmd})
+		if err := group.Start(context.Background()); err != nil {
+			t.Fatalf("start: %v", err)
+		}
+		clk.BlockUntil(1)
+		clk.Advance(time.Second)
+		for {
+			if _, err := os.Stat(running); err == nil {
+				return group
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	t.Run("stop lets the run finish", func(t *testing.T) {
+		out := filepath.Join(t.TempDir(), "out")
+		group := start(t, "sleep 0.3; echo done > "+out)
+		if err := group.Stop(); err != nil {
+			t.Errorf("stop: %v", err)
+		}
+		if _, err := os.Stat(out); err != nil {
+			t.Errorf("run didn't finish: %v", err)
+		}
+	})
+
+	t.Run("abort interrupts the run", func(t *testing.T) {
+		group := start(t, "sleep 30")
+		started := time.Now()
+		if err := group.Abort(); err != nil {
+			t.Errorf("abort: %v", err)
+		}
+		if elapsed := time.Since(started); elapsed > grace {
+			t.Errorf("abort took %s", elapsed)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package workload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/clock"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/filestore"
+)
+
+// FilesName is the registry name of the file writer.
+const FilesName = "files"
+
+var _ Workload = &FileWriter{}
+
+func NewFileWriter(logger *slog.Logger, clk clock.Clock, files *filestore.Store, nodeID string, interval time.Duration) *FileWriter {
+	logger = logger.With("subsystem", "FileWriter")
+	w := &FileWriter{
+		logger: logger,
+		clock:  clk,
+		files:  files,
+		nodeID: nodeID,
+	}
+	w.SetInterval(interval)
+	return w
+}
+
+// FileWriter writes a file every interval, keeping the store's capacity.
+// Failed writes are retried on the next tick, writes fenced off by a later term end the workload.
+type FileWriter struct {
+	loop
+	logger   *slog.Logger
+	clock    clock.Clock
+	files    *filestore.Store
+	nodeID   string
+	interval atomic.Int64
+}
+
+func (w *FileWriter) String() string {
+	return FilesName
+}
+
+// SetInterval changes the time between writes, starting after the next write.
+func (w *FileWriter) SetInterval(interval time.Duration) {
+	w.interval.Store(int64(interval))
+}
+
+func (w *FileWriter) Start(ctx context.Context) error {
+	term, ok := TermFrom(ctx)
+	if !ok {
+		return errors.New("no leadership term in context")
+	}
+	w.start(ctx, func(ctx context.Context) error {
+		return w.run(ctx, term)
+	})
+	return nil
+}
+
+func (w *FileWriter) run(ctx context.Context, term filestore.Term) error {
+	for {
+		err := w.write(ctx, term)
+		if errors.Is(err, filestore.ErrTermLost) || errors.Is(err, filestore.ErrStaleTerm) {
+			return err
+		}
+		if err != nil {
+			w.logger.LogAttrs(ctx, slog.LevelError, "write failed", slog.String("error", err.Error()))
+		}
+		timer := w.clock.NewTimer(time.Duration(w.interval.Load()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C():
+		}
+	}
+}
+
+func (w *FileWriter) write(ctx context.Context, term filestore.Term) error {
+	data := fmt.Sprintf("written by %s at %s\n", w.nodeID, w.clock.Now().Format(time.RFC3339Nano))
+	name, err := w.files.Write(term, []byte(data))
+	if err != nil {
+		return fmt.Errorf("write file: %w", err)
+	}
+	w.logger.LogAttrs(ctx, slog.LevelInfo, "file written", slog.String("file", name), slog.Uint64("token", term.Token()))
+	return nil
+}
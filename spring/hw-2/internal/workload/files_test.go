@@ -0,0 +1,103 @@
+package workload_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/clock"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/coordinator/inproc"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/filestore"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/workload"
+)
+
+const interval = 10 * time.Second
+
+func TestFileWriter(t *testing.T) {
+	t.Run("writes every interval", func(t *testing.T) {
+		clk := clock.NewFake(time.Now())
+		lease, err := inproc.New("node").TryAcquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		files := filestore.New(t.TempDir(), 2, clk)
+		writer := workload.NewFileWriter(slog.Default(), clk, files, "node", interval)
+		if err := writer.Start(workload.WithTerm(context.Background(), lease)); err != nil {
+			t.Fatalf("start: %v", err)
+		}
+		for i := 1; i <= 3; i++ {
+			clk.BlockUntil(1)
+			names, err := files.Files()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := min(i, 2); len(names) != want {
+				t.Fatalf("after %d writes got %d files, want %d", i, len(names), want)
+			}
+			clk.Advance(interval)
+		}
+		clk.BlockUntil(1)
+		if err := writer.Stop(); err != nil {
+			t.Errorf("stop: %v", err)
+		}
+	})
+
+	t.Run("picks up a new interval", func(t *testing.T) {
+		clk := clock.NewFake(time.Now())
+		lease, err := inproc.New("node").TryAcquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		files := filestore.New(t.TempDir(), 10, clk)
+		writer := workload.NewFileWriter(slog.Default(), clk, files, "node", interval)
+		if err := writer.Start(workload.WithTerm(context.Background(), lease)); err != nil {
+			t.Fatalf("start: %v", err)
+		}
+		clk.BlockUntil(1)
+		writer.SetInterval(interval / 2)
+		// the pending wait keeps the old interval
+		clk.Advance(interval)
+		clk.BlockUntil(1)
+		clk.Advance(interval / 2)
+		clk.BlockUntil(1)
+		if names, err := files.Files(); err != nil || len(names) != 3 {
+			t.Errorf("got files %v (%v), want 3", names, err)
+		}
+		if err := writer.Stop(); err != nil {
+			t.Errorf("stop: %v", err)
+		}
+	})
+
+	t.Run("stops writing once the term is lost", func(t *testing.T) {
+		clk := clock.NewFake(time.Now())
+		coord := inproc.New("node")
+		lease, err := coord.TryAcquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		files := filestore.New(t.TempDir(), 10, clk)
+		writer := workload.NewFileWriter(slog.Default(), clk, files, "node", interval)
+		if err := writer.Start(workload.WithTerm(context.Background(), lease)); err != nil {
+			t.Fatalf("start: %v", err)
+		}
+		clk.BlockUntil(1)
+		coord.Expire()
+		clk.Advance(interval)
+		if err := writer.Stop(); !errors.Is(err, filestore.ErrTermLost) {
+			t.Errorf("stop: %v, want %v", err, filestore.ErrTermLost)
+		}
+		if names, err := files.Files(); err != nil || len(names) != 1 {
+			t.Errorf("got files %v (%v), want one written before the loss", names, err)
+		}
+	})
+
+	t.Run("needs a term", func(t *testing.T) {
+		clk := clock.NewFake(time.Now())
+		writer := workload.NewFileWriter(slog.Default(), clk, filestore.New(t.TempDir(), 1, clk), "node", interval)
+		if err := writer.Start(context.Background()); err == nil {
+			t.Error("start without a term: want error")
+		}
+	})
+}
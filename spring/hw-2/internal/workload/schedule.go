@@ -0,0 +1,158 @@
+package workload
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule tells when a scheduled workload runs next.
+type Schedule interface {
+	// Next returns the first run time after t, or the zero time if there is none.
+	Next(t time.Time) time.Time
+}
+
+// ParseSchedule reads "@every <duration>", one of @yearly, @monthly, @weekly, @daily and @hourly,
+// or five cron fields: minute, hour, day of month, month and day of week. Fields take
+// numbers, "*", ranges "a-b", steps "*/n" or "a-b/n" and comma-separated lists of them.
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if every, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(every))
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q: %w", spec, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("schedule %q: interval must be positive", spec)
+		}
+		return everySchedule(d), nil
+	}
+	switch spec {
+	case "@yearly", "@annually":
+		spec = "0 0 1 1 *"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@daily", "@midnight":
+		spec = "0 0 * * *"
+	case "@hourly":
+		spec = "0 * * * *"
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule %q: want 5 fields, got %d", spec, len(fields))
+	}
+	var (
+		s   cronSchedule
+		err error
+	)
+	if s.minute, _, err = parseField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("schedule %q minute: %w", spec, err)
+	}
+	if s.hour, _, err = parseField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("schedule %q hour: %w", spec, err)
+	}
+	if s.dom, s.domAny, err = parseField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("schedule %q day of month: %w", spec, err)
+	}
+	if s.month, _, err = parseField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("schedule %q month: %w", spec, err)
+	}
+	if s.dow, s.dowAny, err = parseField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("schedule %q day of week: %w", spec, err)
+	}
+	// both 0 and 7 are Sunday
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+type everySchedule time.Duration
+
+func (s everySchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+// cronSchedule keeps the allowed values of every field as bits.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+// maxScheduleYears bounds the search for specs that never match, such as February 30.
+const maxScheduleYears = 5
+
+func (s cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Year() + maxScheduleYears
+	for t.Year() <= limit {
+		year, month, day := t.Date()
+		switch {
+		case !has(s.month, int(month)):
+			t = time.Date(year, month+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(year, month, day+1, 0, 0, 0, 0, t.Location())
+		case !has(s.hour, t.Hour()):
+			t = time.Date(year, month, day, t.Hour()+1, 0, 0, 0, t.Location())
+		case !has(s.minute, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches follows cron: when both day fields are restricted either of them may match.
+func (s cronSchedule) dayMatches(t time.Time) bool {
+	dom, dow := has(s.dom, t.Day()), has(s.dow, int(t.Weekday()))
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func has(set uint64, value int) bool {
+	return set&(1<<value) != 0
+}
+
+// parseField returns the values a field allows and whether it starts with "*".
+func parseField(field string, lo, hi int) (uint64, bool, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		expr, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step < 1 {
+				return 0, false, fmt.Errorf("bad step %q", stepText)
+			}
+		}
+		from, to := lo, hi
+		if expr != "*" {
+			first, last, isRange := strings.Cut(expr, "-")
+			var err error
+			if from, err = strconv.Atoi(first); err != nil {
+				return 0, false, fmt.Errorf("bad value %q", first)
+			}
+			to = from
+			if isRange {
+				if to, err = strconv.Atoi(last); err != nil {
+					return 0, false, fmt.Errorf("bad value %q", last)
+				}
+			} else if hasStep {
+				to = hi
+			}
+		}
+		if from < lo || to > hi || from > to {
+			return 0, false, fmt.Errorf("%q is out of range %d-%d", part, lo, hi)
+		}
+		for v := from; v <= to; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, strings.HasPrefix(field, "*"), nil
+}
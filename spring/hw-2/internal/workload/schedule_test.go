@@ -0,0 +1,46 @@
+package workload_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/workload"
+)
+
+func TestParseSchedule(t *testing.T) {
+	// Monday
+	from := time.Date(2024, 4, 1, 12, 30, 15, 0, time.UTC)
+	cases := []struct {
+		spec string
+		want time.Time
+	}{
+		{"@every 90s", from.Add(90 * time.Second)},
+		{"* * * * *", time.Date(2024, 4, 1, 12, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 4, 1, 12, 45, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2024, 4, 1, 13, 0, 0, 0, time.UTC)},
+		{"5,10 0 * * *", time.Date(2024, 4, 2, 0, 5, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 4, 2, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 4, 7, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+		// either day field matches when both are set: the 15th or the next Friday
+		{"0 0 15 * 5", time.Date(2024, 4, 5, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, c := range cases {
+		schedule, err := workload.ParseSchedule(c.spec)
+		if err != nil {
+			t.Errorf("parse %q: %v", c.spec, err)
+			continue
+		}
+		if got := schedule.Next(from); !got.Equal(c.want) {
+			t.Errorf("%q: next is %s, want %s", c.spec, got, c.want)
+		}
+	}
+
+	for _, spec := range []string{"", "@every -1s", "@every soon", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *"} {
+		if _, err := workload.ParseSchedule(spec); err == nil {
+			t.Errorf("parse %q: want error", spec)
+		}
+	}
+}
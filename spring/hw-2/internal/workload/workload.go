@@ -0,0 +1,248 @@
+package workload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/clock"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/filestore"
+)
+
+// ErrGraceExceeded is returned by Group.Stop when workloads outlive the grace period.
+var ErrGraceExceeded = errors.New("workloads didn't stop within the grace period")
+
+// Workload is a job that only the leader runs.
+type Workload interface {
+	String() string
+	// Start launches the workload in the background and returns once it is running.
+	// The workload runs until ctx is done or Stop is called.
+	Start(ctx context.Context) error
+	// Stop ends the workload, waits for it to return and reports the error it failed with.
+	Stop() error
+}
+
+type (
+	termKey      struct{}
+	shardKey     struct{}
+	iterationKey struct{}
+)
+
+// WithTerm attaches the leadership term the workloads run in to ctx.
+func WithTerm(ctx context.Context, term filestore.Term) context.Context {
+	return context.WithValue(ctx, termKey{}, term)
+}
+
+// TermFrom returns the leadership term attached with WithTerm.
+func TermFrom(ctx context.Context) (filestore.Term, bool) {
+	term, ok := ctx.Value(termKey{}).(filestore.Term)
+	return term, ok
+}
+
+// WithShard attaches the shard the workloads run for to ctx.
+func WithShard(ctx context.Context, shard string) context.Context {
+	return context.WithValue(ctx, shardKey{}, shard)
+}
+
+// ShardFrom returns the shard attached with WithShard.
+func ShardFrom(ctx context.Context) (string, bool) {
+	shard, ok := ctx.Value(shardKey{}).(string)
+	return shard, ok
+}
+
+// Iteration returns the context for a single run of a workload started with ctx. It outlives ctx,
+// so a graceful stop lets the current run finish, and ends when the group aborts the workloads
+// or the grace period runs out.
+func Iteration(ctx context.Context) context.Context {
+	if iteration, ok := ctx.Value(iterationKey{}).(context.Context); ok {
+		return iteration
+	}
+	return ctx
+}
+
+// Factory builds a configured workload.
+type Factory func() (Workload, error)
+
+// Registry knows how to build workloads by name.
+type Registry struct {
+	factories map[string]Factory
+}
+
+func NewRegistry() *Registry {
+	return &Registry{factories: make(map[string]Factory)}
+}
+
+func (r *Registry) Register(name string, factory Factory) {
+	r.factories[name] = factory
+}
+
+// Names lists the registered workloads in alphabetical order.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Build creates the named workloads in the given order.
+func (r *Registry) Build(names []string) ([]Workload, error) {
+	workloads := make([]Workload, 0, len(names))
+	for _, name := range names {
+		factory, ok := r.factories[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown workload %q, known are %s", name, strings.Join(r.Names(), ", "))
+		}
+		w, err := factory()
+		if err != nil {
+			return nil, fmt.Errorf("build workload %s: %w", name, err)
+		}
+		workloads = append(workloads, w)
+	}
+	return workloads, nil
+}
+
+func NewGroup(logger *slog.Logger, clk clock.Clock, grace time.Duration, workloads []Workload) *Group {
+	logger = logger.With("subsystem", "Workloads")
+	return &Group{
+		logger:    logger,
+		clock:     clk,
+		grace:     grace,
+		workloads: workloads,
+	}
+}
+
+// Group starts the leader's workloads together and stops them within a grace period.
+// It is started once per leadership term and isn't safe for concurrent use.
+type Group struct {
+	logger    *slog.Logger
+	clock     clock.Clock
+	grace     time.Duration
+	workloads []Workload
+
+	cancel      context.CancelFunc
+	cancelIters context.CancelFunc
+	started     []Workload
+}
+
+// Start launches every workload. If one of them fails to start the others are stopped.
+// Cancelling ctx stops the workloads like Stop does, letting their current runs finish.
+func (g *Group) Start(ctx context.Context) error {
+	iterations, cancelIters := context.WithCancel(context.WithoutCancel(ctx))
+	ctx, g.cancel = context.WithCancel(context.WithValue(ctx, iterationKey{}, iterations))
+	g.cancelIters = cancelIters
+	g.started = g.started[:0]
+	for _, w := range g.workloads {
+		if err := w.Start(ctx); err != nil {
+			return errors.Join(fmt.Errorf("start %s: %w", w, err), g.Stop())
+		}
+		g.started = append(g.started, w)
+		g.logger.LogAttrs(ctx, slog.LevelInfo, "workload started", slog.String("workload", w.String()))
+	}
+	return nil
+}
+
+// Stop cancels the workloads and waits at most the grace period for their current runs to finish.
+// Runs still going after it are cancelled, left behind and reported with ErrGraceExceeded.
+func (g *Group) Stop() error {
+	return g.stop(false)
+}
+
+// Abort is Stop that cancels the current runs right away, for when the leadership is already lost.
+func (g *Group) Abort() error {
+	return g.stop(true)
+}
+
+func (g *Group) stop(abort bool) error {
+	if g.cancel == nil {
+		return nil
+	}
+	cancelIters := g.cancelIters
+	defer cancelIters()
+	if abort {
+		cancelIters()
+	}
+	g.cancel()
+	g.cancel, g.cancelIters = nil, nil
+
+	var (
+		mu      sync.Mutex
+		errs    []error
+		running = make(map[string]bool, len(g.started))
+		done    = make(chan struct{})
+		wg      sync.WaitGroup
+	)
+	for _, w := range g.started {
+		running[w.String()] = true
+	}
+	for _, w := range g.started {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := w.Stop()
+			mu.Lock()
+			defer mu.Unlock()
+			delete(running, w.String())
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", w, err))
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	timer := g.clock.NewTimer(g.grace)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C():
+		mu.Lock()
+		defer mu.Unlock()
+		names := make([]string, 0, len(running))
+		for name := range running {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return errors.Join(append(errs, fmt.Errorf("%w: %s", ErrGraceExceeded, strings.Join(names, ", ")))...)
+	}
+	g.logger.LogAttrs(context.Background(), slog.LevelInfo, "workloads stopped")
+	return errors.Join(errs...)
+}
+
+// loop runs a function in the background until its context is cancelled;
+// the built-in workloads embed it for Start and Stop.
+type loop struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+func (l *loop) start(ctx context.Context, run func(ctx context.Context) error) {
+	ctx, l.cancel = context.WithCancel(ctx)
+	l.done = make(chan struct{})
+	l.err = nil
+	go func() {
+		defer close(l.done)
+		err := run(ctx)
+		if !errors.Is(err, context.Canceled) {
+			l.err = err
+		}
+	}()
+}
+
+func (l *loop) Stop() error {
+	if l.cancel == nil {
+		return nil
+	}
+	l.cancel()
+	<-l.done
+	return l.err
+}
@@ -0,0 +1,123 @@
+package workload_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/clock"
+	"github.com/central-university-dev/2024-spring-go-course-lesson8-leader-election/internal/workload"
+)
+
+const grace = 5 * time.Second
+
+// job is a workload whose Stop returns once release is closed.
+type job struct {
+	name     string
+	startErr error
+	stopErr  error
+	release  chan struct{}
+	ctx      context.Context
+	stopped  bool
+}
+
+func newJob(name string) *job {
+	release := make(chan struct{})
+	close(release)
+	return &job{name: name, release: release}
+}
+
+func (j *job) String() string {
+	return j.name
+}
+
+func (j *job) Start(ctx context.Context) error {
+	j.ctx = ctx
+	return j.startErr
+}
+
+func (j *job) Stop() error {
+	<-j.release
+	j.stopped = true
+	return j.stopErr
+}
+
+func TestGroup(t *testing.T) {
+	t.Run("stop cancels and waits", func(t *testing.T) {
+		a, b := newJob("a"), newJob("b")
+		b.stopErr = errors.New("disk full")
+		group := workload.NewGroup(slog.Default(), clock.New(), grace, []workload.Workload{a, b})
+		if err := group.Start(context.Background()); err != nil {
+			t.Fatalf("start: %v", err)
+		}
+		if err := group.Stop(); !errors.Is(err, b.stopErr) {
+			t.Errorf("stop: %v, want %v", err, b.stopErr)
+		}
+		if !a.stopped || !b.stopped || a.ctx.Err() == nil || b.ctx.Err() == nil {
+			t.Error("workloads weren't cancelled and stopped")
+		}
+		if err := group.Stop(); err != nil {
+			t.Errorf("second stop: %v", err)
+		}
+	})
+
+	t.Run("failed start stops the started ones", func(t *testing.T) {
+		a, b, c := newJob("a"), newJob("b"), newJob("c")
+		b.startErr = errors.New("no such binary")
+		group := workload.NewGroup(slog.Default(), clock.New(), grace, []workload.Workload{a, b, c})
+		if err := group.Start(context.Background()); !errors.Is(err, b.startErr) {
+			t.Fatalf("start: %v, want %v", err, b.startErr)
+		}
+		if !a.stopped || b.stopped || c.ctx != nil {
+			t.Errorf("stopped a=%v b=%v, started c=%v", a.stopped, b.stopped, c.ctx != nil)
+		}
+	})
+
+	t.Run("grace period", func(t *testing.T) {
+		clk := clock.NewFake(time.Now())
+		stuck := newJob("stuck")
+		stuck.release = make(chan struct{})
+		defer close(stuck.release)
+		group := workload.NewGroup(slog.Default(), clk, grace, []workload.Workload{newJob("quick"), stuck})
+		if err := group.Start(context.Background()); err != nil {
+			t.Fatalf("start: %v", err)
+		}
+		stopped := make(chan error)
+		go func() {
+			stopped <- group.Stop()
+		}()
+		clk.BlockUntil(1)
+		clk.Advance(grace)
+		err := <-stopped
+		if !errors.Is(err, workload.ErrGraceExceeded) {
+			t.Fatalf("stop: %v, want %v", err, workload.ErrGraceExceeded)
+		}
+		// quick may or may not have returned by the time the timer fires
+		if !strings.HasSuffix(err.Error(), "stuck") {
+			t.Errorf("stop: %q doesn't name the stuck workload", err)
+		}
+	})
+}
+
+func TestRegistry(t *testing.T) {
+	registry := workload.NewRegistry()
+	registry.Register("b", func() (workload.Workload, error) {
+		return newJob("b"), nil
+	})
+	registry.Register("a", func() (workload.Workload, error) {
+		return nil, errors.New("bad config")
+	})
+	workloads, err := registry.Build([]string{"b"})
+	if err != nil || len(workloads) != 1 || workloads[0].String() != "b" {
+		t.Errorf("build b: %v, %v", workloads, err)
+	}
+	if _, err := registry.Build([]string{"b", "a"}); err == nil {
+		t.Error("build a: want the factory error")
+	}
+	if _, err := registry.Build([]string{"c"}); err == nil || err.Error() != `unknown workload "c", known are a, b` {
+		t.Errorf("build c: %v", err)
+	}
+}